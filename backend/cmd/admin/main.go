@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"tmember/internal/database"
+	"tmember/internal/handlers"
+	"tmember/internal/utils"
+)
+
+const usage = `Usage: admin <command> [flags]
+
+Commands:
+  unlock -email <email>
+      Clear failed sign-in attempts and any lockout of an account
+  build-blocklist -in <hashes> -out <filter> [-fp 0.001] [-min-count 1]
+      Build a breached password bloom filter from a Pwned Passwords SHA-1 file
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "unlock":
+		unlock(os.Args[2:])
+	case "build-blocklist":
+		buildBlocklist(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// unlock clears the sign-in lockout of the account with the given email
+func unlock(args []string) {
+	flags := flag.NewFlagSet("unlock", flag.ExitOnError)
+	email := flags.String("email", "", "email address of the account to unlock")
+	flags.Parse(args)
+
+	if *email == "" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := database.Initialize(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer database.Close()
+
+	unlocked, err := handlers.UnlockAccount(database.GetDB(), *email)
+	if err != nil {
+		log.Fatalf("Failed to unlock account: %v", err)
+	}
+
+	if unlocked {
+		fmt.Printf("Cleared failed sign-in attempts for %s\n", *email)
+	} else {
+		fmt.Printf("No failed sign-in attempts recorded for %s\n", *email)
+	}
+}
+
+// buildBlocklist builds a password blocklist bloom filter from a file of SHA-1 password hashes
+func buildBlocklist(args []string) {
+	flags := flag.NewFlagSet("build-blocklist", flag.ExitOnError)
+	in := flags.String("in", "", "Pwned Passwords SHA-1 file with HASH or HASH:COUNT lines")
+	out := flags.String("out", "", "bloom filter file to write")
+	falsePositiveRate := flags.Float64("fp", 0.001, "share of unlisted passwords that may be rejected")
+	minCount := flags.Int("min-count", 1, "only include passwords seen in at least this many breaches")
+	flags.Parse(args)
+
+	if *in == "" || *out == "" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// The first pass sizes the filter, the second fills it
+	var expected uint64
+	if err := scanPasswordHashes(*in, *minCount, func([20]byte) { expected++ }); err != nil {
+		log.Fatalf("Failed to read password hashes: %v", err)
+	}
+	if expected == 0 {
+		log.Fatalf("No password hashes found in %s", *in)
+	}
+
+	filter, err := utils.NewBloomFilter(expected, *falsePositiveRate)
+	if err != nil {
+		log.Fatalf("Failed to create bloom filter: %v", err)
+	}
+	if err := scanPasswordHashes(*in, *minCount, filter.AddHash); err != nil {
+		log.Fatalf("Failed to read password hashes: %v", err)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Failed to create bloom filter file: %v", err)
+	}
+	if _, err := filter.WriteTo(file); err != nil {
+		file.Close()
+		log.Fatalf("Failed to write bloom filter: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("Failed to write bloom filter: %v", err)
+	}
+
+	fmt.Printf("Wrote %d password hashes to %s\n", expected, *out)
+}
+
+// scanPasswordHashes calls add for every hash in the file seen in at least minCount breaches
+func scanPasswordHashes(path string, minCount int, add func([20]byte)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		digest, ok := utils.ParsePasswordHashLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if _, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":"); found {
+			if n, err := strconv.Atoi(count); err == nil && n < minCount {
+				continue
+			}
+		}
+		add(digest)
+	}
+	return scanner.Err()
+}
@@ -5,11 +5,23 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"tmember/internal/config"
 	"tmember/internal/database"
+	"tmember/internal/handlers"
+	"tmember/internal/ldap"
+	"tmember/internal/mailer"
+	"tmember/internal/oidc"
+	"tmember/internal/utils"
 	"tmember/pkg/api"
+
+	"gorm.io/gorm"
 )
 
+// accountPurgeInterval is how often accounts past their deletion grace period are looked for
+const accountPurgeInterval = time.Hour
+
 func main() {
 	// Initialize database connection
 	log.Println("Initializing database connection...")
@@ -17,6 +29,11 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// Select how email addresses are told apart; migrations store the normalized emails
+	if err := utils.InitializeEmailNormalization(); err != nil {
+		log.Fatalf("Failed to initialize email normalization: %v", err)
+	}
+
 	// Run database migrations
 	log.Println("Running database migrations...")
 	if err := database.Migrate(); err != nil {
@@ -28,9 +45,42 @@ func main() {
 		log.Fatalf("Database connection test failed: %v", err)
 	}
 
+	// Load the access token signing keys
+	if err := utils.InitializeJWTKeys(config.IsProduction()); err != nil {
+		log.Fatalf("Failed to initialize JWT keys: %v", err)
+	}
+
+	// Select the password hashing algorithm
+	if err := utils.InitializePasswordHasher(); err != nil {
+		log.Fatalf("Failed to initialize password hasher: %v", err)
+	}
+
+	// Load the breached password blocklist
+	if err := utils.InitializePasswordBlocklist(); err != nil {
+		log.Fatalf("Failed to load password blocklist: %v", err)
+	}
+
+	// Initialize the mailer
+	if err := mailer.Initialize(); err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+
+	// Configure the external identity providers
+	if err := oidc.Initialize(config.OIDCRedirectURL()); err != nil {
+		log.Fatalf("Failed to initialize OIDC providers: %v", err)
+	}
+
+	// Configure the LDAP directory, if passwords are checked against one
+	if err := ldap.Initialize(); err != nil {
+		log.Fatalf("Failed to initialize LDAP directory: %v", err)
+	}
+
 	// Create a new server
 	server := api.NewServer()
 
+	// Anonymize deleted accounts once their grace period ends
+	go purgeDeletedAccounts(database.GetDB())
+
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -41,11 +91,31 @@ func main() {
 	addr := fmt.Sprintf(":%s", port)
 	log.Printf("Server starting on port %s", port)
 	log.Printf("Health check available at: http://localhost:%s/api/health", port)
+	log.Printf("JWKS available at: http://localhost:%s/.well-known/jwks.json", port)
 	log.Printf("Authentication endpoints:")
 	log.Printf("  Register: http://localhost:%s/api/auth/register", port)
 	log.Printf("  Login: http://localhost:%s/api/auth/login", port)
+	log.Printf("  Refresh: http://localhost:%s/api/auth/refresh", port)
+	log.Printf("  Logout: http://localhost:%s/api/auth/logout", port)
+	log.Printf("  MFA verify: http://localhost:%s/api/auth/mfa/verify", port)
+	log.Printf("  Magic link: http://localhost:%s/api/auth/magic-link", port)
+	log.Printf("  Passkey login: http://localhost:%s/api/auth/webauthn/login", port)
+	log.Printf("  OIDC providers: http://localhost:%s/api/auth/oidc/providers", port)
+	log.Printf("  Account export: http://localhost:%s/api/users/me/export", port)
 
 	if err := http.ListenAndServe(addr, server.Handler()); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
+
+// purgeDeletedAccounts periodically anonymizes accounts whose deletion grace period has ended
+func purgeDeletedAccounts(db *gorm.DB) {
+	for {
+		if purged, err := handlers.PurgeDeletedAccounts(db, time.Now()); err != nil {
+			log.Printf("Failed to purge deleted accounts: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d deleted accounts", purged)
+		}
+		time.Sleep(accountPurgeInterval)
+	}
+}
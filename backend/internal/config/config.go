@@ -0,0 +1,214 @@
+package config
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoginThrottleConfig holds the thresholds used to slow down and lock out password guessing
+type LoginThrottleConfig struct {
+	DelayAfterFailures int           // Failures per account before each further attempt is delayed
+	MaxAccountFailures int           // Failures per account before it is locked out
+	MaxIPFailures      int           // Failures per client IP address before it is locked out
+	FailureWindow      time.Duration // Failures older than this are forgotten
+	LockoutDuration    time.Duration // How long a lockout lasts
+}
+
+// WebAuthnConfig holds the relying party settings passkeys are registered with
+type WebAuthnConfig struct {
+	RPID    string   // Domain passkeys are scoped to
+	RPName  string   // Name shown by authenticators
+	Origins []string // Origins of the web application allowed to use passkeys
+}
+
+// OIDCProviderConfig holds the settings of an external OpenID Connect identity provider
+type OIDCProviderConfig struct {
+	Name          string   // Lowercased name as listed in OIDC_PROVIDERS
+	EnvPrefix     string   // Prefix of the provider's variables, e.g. "OIDC_OKTA_PROD_"
+	DisplayName   string   // Name shown on the sign-in button
+	Issuer        string   // Issuer URL the discovery document is fetched from
+	ClientID      string   // Client registered with the provider
+	ClientSecret  string   // Secret of the client, empty for public clients
+	Scopes        []string // Scopes to request, empty for the defaults
+	AutoProvision bool     // Whether unknown users get an account on their first sign-in
+}
+
+// MailerConfig holds the settings of the mailer outgoing email is sent with
+type MailerConfig struct {
+	Driver       string // "smtp", "file" or "memory"
+	From         string // Sender address of every message
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string // Empty to send without authenticating
+	SMTPPassword string
+	FileDir      string // Directory the file driver writes messages to
+}
+
+// LDAPConfig holds the settings of the LDAP or Active Directory server users may sign in with. Empty
+// values leave the directory's defaults in place; the ldap package validates and parses the rest.
+type LDAPConfig struct {
+	URL                string // ldap://host:389 or ldaps://host:636; LDAP is disabled when empty
+	StartTLS           bool   // Whether to upgrade ldap:// connections with StartTLS
+	InsecureSkipVerify bool   // Whether to accept any server certificate, for testing only
+	BindDN             string // Account users are searched for as, empty for an anonymous search
+	BindPassword       string // Password of the bind account
+	BaseDN             string // Subtree users are searched in
+	UserFilter         string // Search filter in which {email} stands for the sign-in email
+	EmailAttribute     string // Attribute holding a user's email
+	GroupAttribute     string // Attribute listing a user's groups
+	LocalFallback      bool   // Whether users the directory does not know may sign in with a local password
+	TimeoutSeconds     string // Bound on connecting and each request
+	GroupRoles         string // "group DN=organization ID:role" entries separated by semicolons
+}
+
+// IsProduction reports whether the server runs in production mode
+func IsProduction() bool {
+	return getEnv("GO_ENV", "development") == "production"
+}
+
+// AppBaseURL returns the public base URL of the web application, used to build links in emails
+func AppBaseURL() string {
+	return strings.TrimRight(getEnv("APP_BASE_URL", "http://localhost:5173"), "/")
+}
+
+// APIBaseURL returns the public base URL of this API, used in URLs registered with external identity providers
+func APIBaseURL() string {
+	return strings.TrimRight(getEnv("API_BASE_URL", "http://localhost:8080"), "/")
+}
+
+// OIDCRedirectURL returns the web application page external identity providers redirect back to after sign-in
+func OIDCRedirectURL() string {
+	return getEnv("OIDC_REDIRECT_URL", AppBaseURL()+"/auth/oidc/callback")
+}
+
+// OIDCProviders returns the identity providers listed in OIDC_PROVIDERS (e.g. "google,okta"). Each provider
+// NAME is configured with OIDC_NAME_ISSUER, OIDC_NAME_CLIENT_ID, OIDC_NAME_CLIENT_SECRET and optionally
+// OIDC_NAME_DISPLAY_NAME, OIDC_NAME_SCOPES and OIDC_NAME_AUTO_PROVISION.
+func OIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:          name,
+			EnvPrefix:     prefix,
+			DisplayName:   getEnv(prefix+"DISPLAY_NAME", name),
+			Issuer:        os.Getenv(prefix + "ISSUER"),
+			ClientID:      os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret:  os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:        strings.Fields(strings.ReplaceAll(os.Getenv(prefix+"SCOPES"), ",", " ")),
+			AutoProvision: os.Getenv(prefix+"AUTO_PROVISION") == "true",
+		})
+	}
+	return providers
+}
+
+// Mailer returns the mailer settings. MAILER_DRIVER defaults to "file", which writes messages to MAILER_FILE_DIR.
+func Mailer() MailerConfig {
+	return MailerConfig{
+		Driver:       getEnv("MAILER_DRIVER", "file"),
+		From:         getEnv("MAIL_FROM", "no-reply@tmember.local"),
+		SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:     getEnv("SMTP_PORT", "25"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		FileDir:      getEnv("MAILER_FILE_DIR", "tmp/mail"),
+	}
+}
+
+// LDAP returns the directory settings from the LDAP_ environment variables
+func LDAP() LDAPConfig {
+	return LDAPConfig{
+		URL:                os.Getenv("LDAP_URL"),
+		StartTLS:           os.Getenv("LDAP_START_TLS") == "true",
+		InsecureSkipVerify: os.Getenv("LDAP_INSECURE_SKIP_VERIFY") == "true",
+		BindDN:             os.Getenv("LDAP_BIND_DN"),
+		BindPassword:       os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:             os.Getenv("LDAP_BASE_DN"),
+		UserFilter:         os.Getenv("LDAP_USER_FILTER"),
+		EmailAttribute:     os.Getenv("LDAP_EMAIL_ATTRIBUTE"),
+		GroupAttribute:     os.Getenv("LDAP_GROUP_ATTRIBUTE"),
+		LocalFallback:      os.Getenv("LDAP_LOCAL_FALLBACK") == "true",
+		TimeoutSeconds:     os.Getenv("LDAP_TIMEOUT_SECONDS"),
+		GroupRoles:         os.Getenv("LDAP_GROUP_ROLES"),
+	}
+}
+
+// RequireEmailVerification reports whether users must verify their email before creating or joining organizations
+func RequireEmailVerification() bool {
+	return getEnv("REQUIRE_EMAIL_VERIFICATION", "false") == "true"
+}
+
+// MFAIssuer returns the issuer name shown in authenticator apps
+func MFAIssuer() string {
+	return getEnv("MFA_ISSUER", "TMember")
+}
+
+// LoginThrottle returns the sign-in throttling thresholds
+func LoginThrottle() LoginThrottleConfig {
+	return LoginThrottleConfig{
+		DelayAfterFailures: getEnvInt("LOGIN_DELAY_AFTER_FAILURES", 3),
+		MaxAccountFailures: getEnvInt("LOGIN_MAX_FAILURES", 10),
+		MaxIPFailures:      getEnvInt("LOGIN_MAX_FAILURES_PER_IP", 100),
+		FailureWindow:      getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LockoutDuration:    getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+	}
+}
+
+// WebAuthn returns the passkey relying party settings. They default to the host and origin of the web application.
+func WebAuthn() WebAuthnConfig {
+	appURL := AppBaseURL()
+	defaultRPID := "localhost"
+	if parsed, err := url.Parse(appURL); err == nil && parsed.Hostname() != "" {
+		defaultRPID = parsed.Hostname()
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(getEnv("WEBAUTHN_ORIGINS", appURL), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	return WebAuthnConfig{
+		RPID:    getEnv("WEBAUTHN_RP_ID", defaultRPID),
+		RPName:  getEnv("WEBAUTHN_RP_NAME", MFAIssuer()),
+		Origins: origins,
+	}
+}
+
+// AccountDeletionGracePeriod returns how long a deleted account can still be restored by signing in
+func AccountDeletionGracePeriod() time.Duration {
+	return getEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour)
+}
+
+// getEnv gets an environment variable with a fallback default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvInt gets a positive integer environment variable with a fallback default value
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvDuration gets a positive duration environment variable such as "15m" with a fallback default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
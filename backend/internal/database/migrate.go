@@ -5,6 +5,9 @@ import (
 	"log"
 
 	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
 )
 
 // Migrate runs database migrations for all models
@@ -26,6 +29,16 @@ func Migrate() error {
 		return fmt.Errorf("failed to add database constraints: %w", err)
 	}
 
+	// Fill in normalized emails, which accounts created before they existed lack
+	duplicates, err := normalizeUserEmails(DB)
+	if err != nil {
+		return fmt.Errorf("failed to normalize user emails: %w", err)
+	}
+	for _, duplicate := range duplicates {
+		log.Printf("Warning: users %v share the email %s; only user %d can sign in with it until the others change their email",
+			duplicate.UserIDs, duplicate.NormalizedEmail, duplicate.UserIDs[0])
+	}
+
 	log.Println("Database migration completed successfully")
 	return nil
 }
@@ -62,6 +75,76 @@ func addConstraints() error {
 	return nil
 }
 
+// DuplicateEmail lists accounts whose email addresses normalize to the same key, such as Alice@example.com
+// and alice@example.com
+type DuplicateEmail struct {
+	NormalizedEmail string
+	UserIDs         []uint // Oldest first; only the oldest account keeps the normalized email
+}
+
+// normalizeUserEmails stores the normalized email of every user, including deleted ones, whose stored value is
+// missing or was computed under a different local-part policy. When several accounts share a normalized email,
+// the oldest keeps it and the others are left without one, so the unique index holds; they are returned so
+// they can be reported.
+func normalizeUserEmails(db *gorm.DB) ([]DuplicateEmail, error) {
+	var users []models.User
+	if err := db.Unscoped().Select("id", "email", "normalized_email").Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	owners := map[string]int{}
+	var duplicates []DuplicateEmail
+	wanted := make([]*string, len(users))
+	for i, user := range users {
+		key := utils.EmailKey(user.Email)
+		owner, taken := owners[key]
+		if !taken {
+			owners[key] = len(duplicates)
+			duplicates = append(duplicates, DuplicateEmail{NormalizedEmail: key, UserIDs: []uint{user.ID}})
+			wanted[i] = &key
+			continue
+		}
+		duplicates[owner].UserIDs = append(duplicates[owner].UserIDs, user.ID)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Clear changing values first, so moving a key from one account to another never trips the unique index
+		for i, user := range users {
+			if user.NormalizedEmail != nil && !sameString(user.NormalizedEmail, wanted[i]) {
+				if err := tx.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).UpdateColumn("normalized_email", nil).Error; err != nil {
+					return err
+				}
+			}
+		}
+		for i, user := range users {
+			if wanted[i] != nil && !sameString(user.NormalizedEmail, wanted[i]) {
+				if err := tx.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).UpdateColumn("normalized_email", *wanted[i]).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	shared := duplicates[:0]
+	for _, duplicate := range duplicates {
+		if len(duplicate.UserIDs) > 1 {
+			shared = append(shared, duplicate)
+		}
+	}
+	return shared, nil
+}
+
+func sameString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 // TestConnection tests the database connection and basic operations
 func TestConnection() error {
 	if DB == nil {
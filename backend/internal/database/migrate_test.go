@@ -0,0 +1,60 @@
+package database
+
+import (
+	"testing"
+
+	"tmember/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// TestNormalizeUserEmails tests backfilling normalized emails of accounts created before they were stored
+func TestNormalizeUserEmails(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	// Legacy rows, written without the hook that fills in normalized emails
+	legacy := []models.User{
+		{Email: "Alice@Example.com", PasswordHash: "hash"},
+		{Email: "bob@example.com", PasswordHash: "hash"},
+		{Email: "alice@example.com", PasswordHash: "hash"},
+	}
+	if err := db.Session(&gorm.Session{SkipHooks: true}).Create(&legacy).Error; err != nil {
+		t.Fatalf("Failed to create legacy users: %v", err)
+	}
+	if err := db.Delete(&legacy[1]).Error; err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	duplicates, err := normalizeUserEmails(db)
+	if err != nil {
+		t.Fatalf("Failed to normalize emails: %v", err)
+	}
+	if len(duplicates) != 1 || duplicates[0].NormalizedEmail != "alice@example.com" ||
+		len(duplicates[0].UserIDs) != 2 || duplicates[0].UserIDs[0] != legacy[0].ID || duplicates[0].UserIDs[1] != legacy[2].ID {
+		t.Fatalf("Expected the two alice accounts to be reported, got %+v", duplicates)
+	}
+
+	var users []models.User
+	db.Unscoped().Order("id").Find(&users)
+	if users[0].NormalizedEmail == nil || *users[0].NormalizedEmail != "alice@example.com" {
+		t.Errorf("Expected the oldest account to keep the normalized email, got %v", users[0].NormalizedEmail)
+	}
+	if users[1].NormalizedEmail == nil || *users[1].NormalizedEmail != "bob@example.com" {
+		t.Errorf("Expected deleted accounts to be normalized too, got %v", users[1].NormalizedEmail)
+	}
+	if users[2].NormalizedEmail != nil {
+		t.Errorf("Expected the newer duplicate to be left without a normalized email, got %v", *users[2].NormalizedEmail)
+	}
+
+	// Running again changes nothing and reports the same duplicate
+	if duplicates, err := normalizeUserEmails(db); err != nil || len(duplicates) != 1 {
+		t.Errorf("Expected a second run to report the duplicate again, got %+v, %v", duplicates, err)
+	}
+}
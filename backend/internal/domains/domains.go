@@ -0,0 +1,129 @@
+// Package domains verifies that an organization controls an email domain through a DNS TXT record
+package domains
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+const (
+	// recordPrefix is the label under which the verification TXT record is published
+	recordPrefix = "_tmember-verification."
+	// valuePrefix prefixes the verification token in the TXT record
+	valuePrefix = "tmember-verification="
+)
+
+// ErrInvalidDomain is returned for values that are not a fully qualified domain name
+var ErrInvalidDomain = errors.New("invalid domain name")
+
+// Resolver looks up DNS TXT records. *net.Resolver satisfies it.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DefaultResolver returns the system DNS resolver
+func DefaultResolver() Resolver {
+	return net.DefaultResolver
+}
+
+// Normalize lowercases a domain name, strips a trailing dot and checks that it is a valid hostname with at least two labels
+func Normalize(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if len(domain) == 0 || len(domain) > 253 {
+		return "", ErrInvalidDomain
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", ErrInvalidDomain
+	}
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", ErrInvalidDomain
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return "", ErrInvalidDomain
+			}
+		}
+	}
+
+	return domain, nil
+}
+
+// FromEmail returns the normalized domain of an email address, or "" if it has none
+func FromEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	domain, err := Normalize(email[at+1:])
+	if err != nil {
+		return ""
+	}
+	return domain
+}
+
+// RecordName returns the name of the TXT record that proves control of the domain
+func RecordName(domain string) string {
+	return recordPrefix + domain
+}
+
+// RecordValue returns the TXT record value for a verification token
+func RecordValue(token string) string {
+	return valuePrefix + token
+}
+
+// Verify reports whether the domain publishes the TXT record for the verification token.
+// A missing record is not an error.
+func Verify(ctx context.Context, resolver Resolver, domain, token string) (bool, error) {
+	records, err := resolver.LookupTXT(ctx, RecordName(domain))
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	expected := RecordValue(token)
+	for _, record := range records {
+		if strings.TrimSpace(record) == expected {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// StaticResolver serves TXT records from memory, for tests and local development
+type StaticResolver struct {
+	mu      sync.Mutex
+	records map[string][]string
+}
+
+// NewStaticResolver creates an empty static resolver
+func NewStaticResolver() *StaticResolver {
+	return &StaticResolver{records: map[string][]string{}}
+}
+
+// SetTXT replaces the TXT records published under a name
+func (s *StaticResolver) SetTXT(name string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[strings.TrimSuffix(strings.ToLower(name), ".")] = values
+}
+
+// LookupTXT returns the records published under a name, or a not-found DNS error
+func (s *StaticResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values, ok := s.records[strings.TrimSuffix(strings.ToLower(name), ".")]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return append([]string(nil), values...), nil
+}
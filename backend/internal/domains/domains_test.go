@@ -0,0 +1,60 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestNormalize tests domain name normalization and validation
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		valid    bool
+	}{
+		{"Example.COM", "example.com", true},
+		{" sub.example.co.uk. ", "sub.example.co.uk", true},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example", true},
+		{"localhost", "", false},
+		{"-bad.example.com", "", false},
+		{"bad..example.com", "", false},
+		{"under_score.example.com", "", false},
+		{"user@example.com", "", false},
+	}
+
+	for _, tt := range tests {
+		domain, err := Normalize(tt.input)
+		if tt.valid && (err != nil || domain != tt.expected) {
+			t.Errorf("Normalize(%q) = %q, %v; expected %q", tt.input, domain, err, tt.expected)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidDomain) {
+			t.Errorf("Normalize(%q) = %q; expected ErrInvalidDomain", tt.input, domain)
+		}
+	}
+
+	if domain := FromEmail("Jane@Example.com"); domain != "example.com" {
+		t.Errorf("Expected example.com, got %q", domain)
+	}
+}
+
+// TestVerify tests TXT record verification against a static resolver
+func TestVerify(t *testing.T) {
+	resolver := NewStaticResolver()
+	ctx := context.Background()
+
+	// A missing record is not an error
+	if ok, err := Verify(ctx, resolver, "example.com", "token-1"); ok || err != nil {
+		t.Errorf("Expected no verification without a record, got %v, %v", ok, err)
+	}
+
+	resolver.SetTXT(RecordName("example.com"), "v=spf1 -all", RecordValue("token-2"))
+	if ok, _ := Verify(ctx, resolver, "example.com", "token-1"); ok {
+		t.Error("Expected another token's record not to verify")
+	}
+
+	resolver.SetTXT(RecordName("example.com"), "v=spf1 -all", RecordValue("token-1"))
+	if ok, err := Verify(ctx, resolver, "example.com", "token-1"); !ok || err != nil {
+		t.Errorf("Expected the domain to verify, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"tmember/internal/config"
+	"tmember/internal/mailer"
+	"tmember/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// DeleteAccountHandler schedules the current user's account for deletion and signs it out everywhere. The
+// account is anonymized when the grace period ends, unless the user signs in again before then. Users who are
+// the only admin of an organization must hand it over first.
+func (ah *AuthHandlers) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r, ah.DB)
+	if !ok {
+		return
+	}
+
+	// The body may be empty for accounts without a password
+	var req models.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	if user.PasswordHash != "" && !checkCurrentPassword(w, r, ah.DB, *user, req.Password) {
+		return
+	}
+
+	if _, ok := requireSecondFactorStepUp(w, r, ah.DB, *user, "delete your account"); !ok {
+		return
+	}
+
+	orgs, err := soleAdminOrganizations(ah.DB, user.ID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to check admin count", "ADMIN_COUNT_ERROR")
+		return
+	}
+	if len(orgs) > 0 {
+		names := make([]string, len(orgs))
+		for i, org := range orgs {
+			names[i] = org.Name
+		}
+		writeErrorResponse(w, http.StatusBadRequest,
+			fmt.Sprintf("You are the last admin of %s; make another member an admin before deleting your account", strings.Join(names, ", ")),
+			"LAST_ADMIN_ERROR")
+		return
+	}
+
+	scheduledAt := time.Now().Add(config.AccountDeletionGracePeriod())
+	err = ah.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("deletion_scheduled_at", scheduledAt).Error; err != nil {
+			return err
+		}
+
+		// Sign out everywhere, including this session, and retire every credential issued to the account
+		if _, err := revokeUserSessions(tx, user.ID, 0); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PersonalAccessToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error
+	})
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to delete account", "DELETE_ERROR")
+		return
+	}
+	recordAuditEvent(ah.DB, r, user.ID, models.AuditActionDeletionRequested)
+
+	if err := ah.sendAccountDeletionEmail(*user, scheduledAt); err != nil {
+		log.Printf("Failed to send account deletion email to user %d: %v", user.ID, err)
+	}
+
+	response := map[string]interface{}{
+		"message":               "Your account is scheduled for deletion; sign in before then to keep it",
+		"deletion_scheduled_at": scheduledAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ExportAccountHandler returns an archive of the current user's personal data as a JSON download
+func (ah *AuthHandlers) ExportAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r, ah.DB)
+	if !ok {
+		return
+	}
+
+	export, err := exportAccount(ah.DB, *user)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to export account", "EXPORT_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tmember-account-%d.json"`, user.ID))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(export)
+}
+
+// exportAccount collects the personal data stored about a user
+func exportAccount(db *gorm.DB, user models.User) (*models.AccountExport, error) {
+	export := &models.AccountExport{
+		ExportedAt:           time.Now(),
+		User:                 user,
+		Memberships:          []models.AccountExportMembership{},
+		PasskeyCredentials:   []models.WebAuthnCredentialResponse{},
+		PersonalAccessTokens: []models.PersonalAccessTokenResponse{},
+	}
+
+	var memberships []models.OrganizationMembership
+	if err := db.Preload("Organization").Where("user_id = ?", user.ID).Order("id").Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	for _, membership := range memberships {
+		export.Memberships = append(export.Memberships, models.AccountExportMembership{
+			OrganizationID:   membership.OrganizationID,
+			OrganizationName: membership.Organization.Name,
+			Role:             membership.Role,
+			JoinedAt:         membership.CreatedAt,
+		})
+	}
+
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&export.Sessions).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&export.Identities).Error; err != nil {
+		return nil, err
+	}
+
+	var credentials []models.WebAuthnCredential
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+	for _, credential := range credentials {
+		export.PasskeyCredentials = append(export.PasskeyCredentials, toWebAuthnCredentialResponse(credential))
+	}
+
+	var tokens []models.PersonalAccessToken
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		export.PersonalAccessTokens = append(export.PersonalAccessTokens, toPersonalAccessTokenResponse(token))
+	}
+
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&export.AuditEvents).Error; err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// soleAdminOrganizations returns the organizations in which the user is the only admin
+func soleAdminOrganizations(db *gorm.DB, userID uint) ([]models.Organization, error) {
+	var memberships []models.OrganizationMembership
+	if err := db.Preload("Organization").Where("user_id = ? AND role = ?", userID, models.RoleAdmin).Order("id").Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+
+	var orgs []models.Organization
+	for _, membership := range memberships {
+		lastAdmin, err := isLastAdmin(db, membership.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+		if lastAdmin {
+			orgs = append(orgs, membership.Organization)
+		}
+	}
+	return orgs, nil
+}
+
+// PurgeDeletedAccounts anonymizes the accounts whose deletion grace period ended before now, returning how many
+// were purged. Accounts that have since become the only admin of an organization are kept until they are not.
+func PurgeDeletedAccounts(db *gorm.DB, now time.Time) (int, error) {
+	var users []models.User
+	if err := db.Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", now).Find(&users).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		orgs, err := soleAdminOrganizations(db, user.ID)
+		if err != nil {
+			return purged, err
+		}
+		if len(orgs) > 0 {
+			log.Printf("Not purging user %d, the last admin of organization %d", user.ID, orgs[0].ID)
+			continue
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return anonymizeAccount(tx, user)
+		}); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// anonymizeAccount removes a user's personal data and credentials. The user row itself is kept, without its
+// email address, so records referring to it stay consistent.
+func anonymizeAccount(tx *gorm.DB, user models.User) error {
+	sessions := tx.Model(&models.Session{}).Select("id").Where("user_id = ?", user.ID)
+	if err := tx.Where("session_id IN (?)", sessions).Delete(&models.RefreshToken{}).Error; err != nil {
+		return err
+	}
+
+	for _, record := range []interface{}{
+		&models.Session{},
+		&models.UserToken{},
+		&models.MFARecoveryCode{},
+		&models.MFAChallenge{},
+		&models.PersonalAccessToken{},
+		&models.UserIdentity{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnChallenge{},
+		&models.OrganizationJoinRequest{},
+		&models.SCIMUser{},
+		&models.SCIMGroupMember{},
+		&models.SAMLProvisionedUser{},
+		&models.AuditEvent{},
+	} {
+		if err := tx.Where("user_id = ?", user.ID).Delete(record).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.OrganizationMembership{}).Error; err != nil {
+		return err
+	}
+	if _, err := UnlockAccount(tx, user.Email); err != nil {
+		return err
+	}
+
+	if err := tx.Model(&user).Updates(map[string]interface{}{
+		"email":                 fmt.Sprintf("deleted-%d@deleted.invalid", user.ID),
+		"password_hash":         "",
+		"email_verified_at":     nil,
+		"totp_secret":           "",
+		"totp_last_step":        0,
+		"mfa_enabled_at":        nil,
+		"deletion_scheduled_at": nil,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&user).Error
+}
+
+// sendAccountDeletionEmail tells the user when their account will be deleted and how to keep it
+func (ah *AuthHandlers) sendAccountDeletionEmail(user models.User, scheduledAt time.Time) error {
+	return ah.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your TMember account will be deleted",
+		Body: fmt.Sprintf("Your TMember account is scheduled for deletion on %s.\n\n"+
+			"You have been signed out everywhere. If you change your mind, sign in at %s before then to keep your account.\n",
+			scheduledAt.UTC().Format("January 2, 2006"), config.AppBaseURL()),
+	})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"tmember/internal/config"
+	"tmember/internal/mailer"
+	"tmember/internal/models"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	org, admin := createTestOrgWithAdmin(db, "Example", "admin@example.com")
+	auth := loginForTest(t, authHandlers, admin.Email, "TestPassword123")
+
+	if w := serveSessionRequest(t, authHandlers.DeleteAccountHandler, auth.Token, http.MethodDelete, "/api/users/me", models.DeleteAccountRequest{Password: "wrong"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a wrong password, got %d", http.StatusUnauthorized, w.Code)
+	}
+	var throttle models.LoginThrottle
+	db.Where("key_hash = ?", loginThrottleAccountKey(admin.Email)).Limit(1).Find(&throttle)
+	if throttle.Failures != 1 {
+		t.Errorf("Expected the wrong password to count against the account, got %d failures", throttle.Failures)
+	}
+
+	// The only admin of an organization cannot leave it without an admin
+	w := serveSessionRequest(t, authHandlers.DeleteAccountHandler, auth.Token, http.MethodDelete, "/api/users/me", models.DeleteAccountRequest{Password: "TestPassword123"})
+	if w.Code != http.StatusBadRequest || decodeErrorCode(w) != "LAST_ADMIN_ERROR" {
+		t.Fatalf("Expected 400 LAST_ADMIN_ERROR, got %d: %s", w.Code, w.Body.String())
+	}
+
+	other := createUnitTestUser(db, "other@example.com")
+	db.Create(&models.OrganizationMembership{UserID: other.ID, OrganizationID: org.ID, Role: models.RoleAdmin})
+	w = serveSessionRequest(t, authHandlers.DeleteAccountHandler, auth.Token, http.MethodDelete, "/api/users/me", models.DeleteAccountRequest{Password: "TestPassword123"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var user models.User
+	db.First(&user, admin.ID)
+	if !user.IsDeletionScheduled() || user.DeletionScheduledAt.Before(time.Now().Add(config.AccountDeletionGracePeriod()-time.Minute)) {
+		t.Errorf("Expected deletion to be scheduled after the grace period, got %v", user.DeletionScheduledAt)
+	}
+	var activeSessions int64
+	db.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", admin.ID).Count(&activeSessions)
+	if activeSessions != 0 {
+		t.Errorf("Expected every session to be revoked, got %d active", activeSessions)
+	}
+	if msg, ok := authHandlers.Mailer.(*mailer.MemoryMailer).Last(); !ok || msg.To != admin.Email {
+		t.Error("Expected a deletion notice to be emailed")
+	}
+
+	// Signing in during the grace period keeps the account
+	loginForTest(t, authHandlers, admin.Email, "TestPassword123")
+	user = models.User{}
+	db.First(&user, admin.ID)
+	if user.IsDeletionScheduled() {
+		t.Error("Expected signing in to cancel the deletion")
+	}
+	var cancelled int64
+	db.Model(&models.AuditEvent{}).Where("user_id = ? AND action = ?", admin.ID, models.AuditActionDeletionCancelled).Count(&cancelled)
+	if cancelled != 1 {
+		t.Errorf("Expected the cancellation to be audited, got %d events", cancelled)
+	}
+}
+
+func TestPurgeDeletedAccounts(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	org, _ := createTestOrgWithAdmin(db, "Example", "admin@example.com")
+	auth := registerForTest(t, authHandlers, "leaving@example.com", "ValidPass123")
+	db.Create(&models.OrganizationMembership{UserID: auth.User.ID, OrganizationID: org.ID, Role: models.RoleMember})
+
+	w := serveSessionRequest(t, authHandlers.DeleteAccountHandler, auth.Token, http.MethodDelete, "/api/users/me", models.DeleteAccountRequest{Password: "ValidPass123"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if purged, err := PurgeDeletedAccounts(db, time.Now()); err != nil || purged != 0 {
+		t.Fatalf("Expected nothing to be purged during the grace period, got %d, %v", purged, err)
+	}
+	purged, err := PurgeDeletedAccounts(db, time.Now().Add(config.AccountDeletionGracePeriod()+time.Hour))
+	if err != nil || purged != 1 {
+		t.Fatalf("Expected one account to be purged, got %d, %v", purged, err)
+	}
+
+	var user models.User
+	db.Unscoped().First(&user, auth.User.ID)
+	if !user.DeletedAt.Valid || strings.Contains(user.Email, "leaving") || user.PasswordHash != "" {
+		t.Errorf("Expected an anonymized, deleted user, got %+v", user)
+	}
+	for _, record := range []interface{}{&models.OrganizationMembership{}, &models.Session{}, &models.AuditEvent{}} {
+		var count int64
+		db.Unscoped().Model(record).Where("user_id = ?", auth.User.ID).Count(&count)
+		if count != 0 {
+			t.Errorf("Expected %T records to be removed, got %d", record, count)
+		}
+	}
+
+	// The address is free to register again
+	registerForTest(t, authHandlers, "leaving@example.com", "ValidPass123")
+}
+
+func TestExportAccount(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	org, admin := createTestOrgWithAdmin(db, "Example", "admin@example.com")
+	auth := loginForTest(t, authHandlers, admin.Email, "TestPassword123")
+
+	w := serveSessionRequest(t, authHandlers.ExportAccountHandler, auth.Token, http.MethodGet, "/api/users/me/export", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment;") {
+		t.Errorf("Expected the export to be a download, got %q", w.Header().Get("Content-Disposition"))
+	}
+	if strings.Contains(w.Body.String(), admin.PasswordHash) {
+		t.Error("Expected the export not to contain the password hash")
+	}
+
+	var export models.AccountExport
+	json.NewDecoder(w.Body).Decode(&export)
+	if export.User.Email != admin.Email {
+		t.Errorf("Expected the user's profile, got %q", export.User.Email)
+	}
+	if len(export.Memberships) != 1 || export.Memberships[0].OrganizationName != org.Name || export.Memberships[0].Role != models.RoleAdmin {
+		t.Errorf("Expected the admin membership, got %+v", export.Memberships)
+	}
+	if len(export.Sessions) != 1 || len(export.AuditEvents) != 1 || export.AuditEvents[0].Action != models.AuditActionLogin {
+		t.Errorf("Expected the session and its login event, got %d sessions and %+v", len(export.Sessions), export.AuditEvents)
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// recordAuditEvent adds an action to the user's audit log. The action has already taken effect, so a failure is
+// logged rather than failing the request.
+func recordAuditEvent(db *gorm.DB, r *http.Request, userID uint, action models.AuditAction) {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	event := models.AuditEvent{
+		UserID:    userID,
+		Action:    action,
+		IPAddress: utils.ClientIP(r),
+		UserAgent: userAgent,
+	}
+	if err := db.Create(&event).Error; err != nil {
+		log.Printf("Failed to record %s audit event for user %d: %v", action, userID, err)
+	}
+}
@@ -2,22 +2,38 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"time"
 
+	"tmember/internal/mailer"
 	"tmember/internal/models"
+	"tmember/internal/oidc"
 	"tmember/internal/utils"
+	"tmember/internal/webauthn"
 
 	"gorm.io/gorm"
 )
 
-// AuthHandlers contains the database connection for authentication handlers
+// AuthHandlers contains the database connection, mailer, password authenticator, external identity providers
+// and WebAuthn relying party for authentication handlers
 type AuthHandlers struct {
-	DB *gorm.DB
+	DB            *gorm.DB
+	Mailer        mailer.Mailer
+	OIDCProviders map[string]*oidc.Provider
+	Authenticator Authenticator
+	WebAuthn      *webauthn.RelyingParty
 }
 
-// NewAuthHandlers creates a new AuthHandlers instance
+// NewAuthHandlers creates a new AuthHandlers instance that checks passwords against the database
 func NewAuthHandlers(db *gorm.DB) *AuthHandlers {
-	return &AuthHandlers{DB: db}
+	return &AuthHandlers{
+		DB:            db,
+		Mailer:        mailer.NewMemoryMailer(),
+		Authenticator: &DatabaseAuthenticator{DB: db},
+		WebAuthn:      newWebAuthnRelyingParty(),
+	}
 }
 
 // RegisterHandler handles user registration
@@ -40,14 +56,14 @@ func (ah *AuthHandlers) RegisterHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Validate password security criteria
-	if err := utils.ValidatePassword(req.Password); err != nil {
+	if err := utils.ValidatePassword(req.Password, utils.DefaultPasswordPolicy); err != nil {
 		writeErrorResponse(w, http.StatusBadRequest, err.Error(), "WEAK_PASSWORD")
 		return
 	}
 
 	// Check if user already exists
 	var existingUser models.User
-	if err := ah.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
+	if err := ah.DB.Where("normalized_email = ?", utils.EmailKey(req.Email)).First(&existingUser).Error; err == nil {
 		writeErrorResponse(w, http.StatusConflict, "User with this email already exists", "EMAIL_EXISTS")
 		return
 	}
@@ -70,19 +86,18 @@ func (ah *AuthHandlers) RegisterHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(user.ID, user.Email)
+	// Send the email verification link; registration succeeds even if delivery fails
+	if err := ah.sendVerificationEmail(user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
+	// Start a session and issue tokens
+	response, err := startSession(ah.DB, user, r, false)
 	if err != nil {
 		writeErrorResponse(w, http.StatusInternalServerError, "Failed to generate token", "TOKEN_GENERATION_ERROR")
 		return
 	}
 
-	// Return success response
-	response := models.AuthResponse{
-		User:  user,
-		Token: token,
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
@@ -101,30 +116,91 @@ func (ah *AuthHandlers) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Find user by email
-	var user models.User
-	if err := ah.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		writeErrorResponse(w, http.StatusUnauthorized, "Invalid email or password", "INVALID_CREDENTIALS")
+	// Refuse attempts while the account or client is throttled, before looking at the password
+	now := time.Now()
+	clientIP := utils.ClientIP(r)
+	retryAfter, code, err := checkLoginThrottle(ah.DB, req.Email, clientIP, now)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to check sign-in attempts", "THROTTLE_CHECK_ERROR")
+		return
+	}
+	if retryAfter > 0 {
+		writeLoginThrottledResponse(w, retryAfter, code)
 		return
 	}
 
-	// Check password
-	if !utils.CheckPasswordHash(req.Password, user.PasswordHash) {
+	// Check the credentials; unknown emails are handled exactly like wrong passwords
+	authenticator := ah.Authenticator
+	if authenticator == nil {
+		authenticator = &DatabaseAuthenticator{DB: ah.DB}
+	}
+	user, err := authenticator.Authenticate(req.Email, req.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		if err := recordLoginFailure(ah.DB, req.Email, clientIP, now); err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to record sign-in attempt", "THROTTLE_RECORD_ERROR")
+			return
+		}
 		writeErrorResponse(w, http.StatusUnauthorized, "Invalid email or password", "INVALID_CREDENTIALS")
 		return
 	}
+	if err != nil {
+		log.Printf("Failed to authenticate %s: %v", req.Email, err)
+		writeErrorResponse(w, http.StatusBadGateway, "Failed to check credentials", "AUTHENTICATION_BACKEND_ERROR")
+		return
+	}
+
+	ah.completeLogin(w, r, *user)
+}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(user.ID, user.Email)
+// completeLogin finishes a login whose first factor was verified: users with a second factor get a
+// short-lived challenge instead of tokens, everyone else gets a new session
+func (ah *AuthHandlers) completeLogin(w http.ResponseWriter, r *http.Request, user models.User) {
+	methods, err := secondFactorMethods(ah.DB, user)
 	if err != nil {
-		writeErrorResponse(w, http.StatusInternalServerError, "Failed to generate token", "TOKEN_GENERATION_ERROR")
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to start MFA challenge", "MFA_CHALLENGE_ERROR")
+		return
+	}
+
+	if len(methods) > 0 {
+		// Wrong codes count against the account, so an account locked out by them gets no new challenges
+		retryAfter, code, err := checkLoginThrottle(ah.DB, user.Email, utils.ClientIP(r), time.Now())
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to check sign-in attempts", "THROTTLE_CHECK_ERROR")
+			return
+		}
+		if retryAfter > 0 {
+			writeLoginThrottledResponse(w, retryAfter, code)
+			return
+		}
+
+		challenge, err := createMFAChallenge(ah.DB, user.ID)
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to start MFA challenge", "MFA_CHALLENGE_ERROR")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(models.MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    challenge,
+			Methods:     methods,
+			ExpiresIn:   int(mfaChallengeTTL.Seconds()),
+		})
 		return
 	}
 
-	// Return success response
-	response := models.AuthResponse{
-		User:  user,
-		Token: token,
+	// A completed sign-in clears the account's failed attempts
+	if _, err := UnlockAccount(ah.DB, user.Email); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to reset sign-in attempts", "THROTTLE_RECORD_ERROR")
+		return
+	}
+
+	// Start a session and issue tokens
+	response, err := startSession(ah.DB, user, r, false)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to generate token", "TOKEN_GENERATION_ERROR")
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -28,6 +28,7 @@ func setupTestDB() *gorm.DB {
 
 	// Auto-migrate the schema
 	db.AutoMigrate(&models.User{}, &models.Organization{}, &models.OrganizationMembership{})
+	db.AutoMigrate(&models.Session{}, &models.RefreshToken{}, &models.UserToken{}, &models.MFARecoveryCode{}, &models.MFAChallenge{}, &models.OrganizationSecurityPolicy{}, &models.PersonalAccessToken{}, &models.LoginThrottle{}, &models.WebAuthnCredential{}, &models.WebAuthnChallenge{}, &models.AuditEvent{})
 
 	return db
 }
@@ -196,10 +197,8 @@ func TestPasswordSecurityAndHashing(t *testing.T) {
 			return false
 		}
 
-		// Password hash should be bcrypt format (starts with $2a$, $2b$, or $2y$)
-		if !strings.HasPrefix(user.PasswordHash, "$2a$") &&
-			!strings.HasPrefix(user.PasswordHash, "$2b$") &&
-			!strings.HasPrefix(user.PasswordHash, "$2y$") {
+		// Password hash should be argon2id format
+		if !strings.HasPrefix(user.PasswordHash, "$argon2id$") {
 			return false
 		}
 
@@ -10,6 +10,7 @@ import (
 	"tmember/internal/models"
 	"tmember/internal/utils"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -22,7 +23,25 @@ func setupTestDBForUnit() *gorm.DB {
 	}
 
 	// Auto-migrate the schema
-	db.AutoMigrate(&models.User{}, &models.Organization{}, &models.OrganizationMembership{})
+	db.AutoMigrate(&models.User{}, &models.Organization{})
+	db.AutoMigrate(&models.Session{}, &models.RefreshToken{}, &models.UserToken{}, &models.MFARecoveryCode{}, &models.MFAChallenge{}, &models.OrganizationSecurityPolicy{}, &models.PersonalAccessToken{}, &models.LoginThrottle{})
+	db.AutoMigrate(&models.OrganizationDomain{}, &models.OrganizationJoinRequest{})
+	db.AutoMigrate(&models.SCIMToken{}, &models.SCIMUser{}, &models.SCIMGroup{}, &models.SCIMGroupMember{})
+	db.AutoMigrate(&models.WebAuthnCredential{}, &models.WebAuthnChallenge{})
+	db.AutoMigrate(&models.UserIdentity{}, &models.AuditEvent{}, &models.SAMLProvisionedUser{})
+
+	// Create organization_memberships table manually for SQLite compatibility
+	db.Exec(`CREATE TABLE organization_memberships (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		organization_id INTEGER NOT NULL,
+		role TEXT NOT NULL,
+		created_at DATETIME,
+		updated_at DATETIME,
+		deleted_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id),
+		FOREIGN KEY (organization_id) REFERENCES organizations(id)
+	)`)
 
 	return db
 }
@@ -131,6 +150,32 @@ func TestRegisterHandler_DuplicateEmail(t *testing.T) {
 	}
 }
 
+func TestRegisterHandler_DuplicateEmailDifferentCase(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	first := postJSON(authHandlers.RegisterHandler, "/api/auth/register", models.RegisterRequest{Email: " Alice@Example.COM ", Password: "ValidPass123"})
+	if first.Code != http.StatusCreated {
+		t.Fatalf("First registration failed with status %d", first.Code)
+	}
+
+	// The address is stored as entered, apart from the domain
+	var user models.User
+	db.First(&user)
+	if user.Email != "Alice@example.com" || user.NormalizedEmail == nil || *user.NormalizedEmail != "alice@example.com" {
+		t.Errorf("Unexpected stored email %q, normalized %v", user.Email, user.NormalizedEmail)
+	}
+
+	second := postJSON(authHandlers.RegisterHandler, "/api/auth/register", models.RegisterRequest{Email: "alice@example.com", Password: "ValidPass123"})
+	if second.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for a differently cased duplicate, got %d", http.StatusConflict, second.Code)
+	}
+
+	if w := attemptLogin(authHandlers, "ALICE@example.com", "ValidPass123"); w.Code != http.StatusOK {
+		t.Errorf("Expected sign-in with a differently cased email to succeed, got %d", w.Code)
+	}
+}
+
 func TestRegisterHandler_InvalidJSON(t *testing.T) {
 	db := setupTestDBForUnit()
 	authHandlers := NewAuthHandlers(db)
@@ -204,6 +249,38 @@ func TestLoginHandler_ValidCredentials(t *testing.T) {
 	}
 }
 
+func TestLoginHandler_RehashesLegacyPassword(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	// A user whose password was hashed with bcrypt before argon2id was introduced
+	email := "legacy@example.com"
+	password := "ValidPass123"
+	legacyHash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+
+	user := models.User{
+		Email:        email,
+		PasswordHash: string(legacyHash),
+	}
+	db.Create(&user)
+
+	reqBody, _ := json.Marshal(models.LoginRequest{Email: email, Password: password})
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(reqBody))
+	w := httptest.NewRecorder()
+
+	authHandlers.LoginHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// The stored hash is upgraded and still verifies the password
+	db.First(&user, user.ID)
+	if utils.PasswordNeedsRehash(user.PasswordHash) || !utils.CheckPasswordHash(password, user.PasswordHash) {
+		t.Errorf("Expected password to be rehashed, got %s", user.PasswordHash)
+	}
+}
+
 func TestLoginHandler_InvalidCredentials(t *testing.T) {
 	db := setupTestDBForUnit()
 	authHandlers := NewAuthHandlers(db)
@@ -288,7 +365,7 @@ func TestJWTTokenGeneration(t *testing.T) {
 	userID := uint(123)
 	email := "test@example.com"
 
-	token, err := utils.GenerateJWT(userID, email)
+	token, err := utils.GenerateJWT(userID, email, 0)
 	if err != nil {
 		t.Fatalf("Failed to generate JWT: %v", err)
 	}
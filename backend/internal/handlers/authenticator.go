@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"tmember/internal/ldap"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCredentials is returned by authenticators when the email or password is wrong. Unknown
+// emails return it too, so sign-in responses do not reveal which accounts exist.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// Authenticator verifies the email and password of a sign-in and returns the user signing in
+type Authenticator interface {
+	Authenticate(email, password string) (*models.User, error)
+}
+
+// DatabaseAuthenticator checks passwords against the hashes stored with users
+type DatabaseAuthenticator struct {
+	DB *gorm.DB
+}
+
+// Authenticate implements Authenticator
+func (a *DatabaseAuthenticator) Authenticate(email, password string) (*models.User, error) {
+	var user models.User
+	found := a.DB.Where("normalized_email = ?", utils.EmailKey(email)).First(&user).Error == nil
+	if !found {
+		checkPasswordOfUnknownUser(password)
+	}
+	if !found || !utils.CheckPasswordHash(password, user.PasswordHash) {
+		return nil, ErrInvalidCredentials
+	}
+
+	// Upgrade hashes made with an outdated algorithm or cost while the password is at hand
+	if utils.PasswordNeedsRehash(user.PasswordHash) {
+		if hashedPassword, err := utils.HashPassword(password); err != nil {
+			log.Printf("Failed to rehash password of user %d: %v", user.ID, err)
+		} else if err := a.DB.Model(&user).Update("password_hash", hashedPassword).Error; err != nil {
+			log.Printf("Failed to store rehashed password of user %d: %v", user.ID, err)
+		}
+	}
+
+	return &user, nil
+}
+
+// LDAPAuthenticator checks passwords against an LDAP directory. Directory users signing in for the first
+// time get an account without a local password. If the directory maps groups to organization roles,
+// memberships of the mapped organizations follow the user's groups on every sign-in.
+type LDAPAuthenticator struct {
+	DB        *gorm.DB
+	Directory *ldap.Directory
+}
+
+// Authenticate implements Authenticator
+func (a *LDAPAuthenticator) Authenticate(email, password string) (*models.User, error) {
+	entry, err := a.Directory.Authenticate(email, password)
+	if errors.Is(err, ldap.ErrUserNotFound) && a.Directory.LocalFallback {
+		return (&DatabaseAuthenticator{DB: a.DB}).Authenticate(email, password)
+	}
+	if errors.Is(err, ldap.ErrUserNotFound) || errors.Is(err, ldap.ErrInvalidCredentials) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the spelling the user signed in with when the directory only differs in case
+	if strings.EqualFold(entry.Email, email) {
+		entry.Email = email
+	}
+	if !utils.ValidateEmail(entry.Email) {
+		return nil, errors.New("ldap: directory entry has no valid email address")
+	}
+
+	now := time.Now()
+	var user models.User
+	newlyVerified := false
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("normalized_email = ?", utils.EmailKey(entry.Email)).Limit(1).Find(&user).Error; err != nil {
+			return err
+		}
+
+		switch {
+		case user.ID == 0:
+			// Directory users have no local password; the directory vouches for their email
+			user = models.User{Email: entry.Email, EmailVerifiedAt: &now}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			newlyVerified = true
+		case !user.IsEmailVerified():
+			if err := claimUnverifiedAccount(tx, &user, now); err != nil {
+				return err
+			}
+			newlyVerified = true
+		}
+
+		return syncLDAPMemberships(tx, a.Directory, entry, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if newlyVerified {
+		if err := joinVerifiedDomainOrganizations(a.DB, user); err != nil {
+			log.Printf("Failed to join verified domain organizations for user %d: %v", user.ID, err)
+		}
+	}
+
+	return &user, nil
+}
+
+// syncLDAPMemberships makes the user's memberships of the organizations named by the directory's group
+// role mappings match their groups: members of a mapped group get its role, everyone else is removed.
+// Organizations are never left without an admin.
+func syncLDAPMemberships(tx *gorm.DB, directory *ldap.Directory, entry *ldap.Entry, userID uint) error {
+	roles := directory.Roles(entry)
+
+	for _, orgID := range directory.ManagedOrganizations() {
+		var membership models.OrganizationMembership
+		if err := tx.Where("organization_id = ? AND user_id = ?", orgID, userID).Limit(1).Find(&membership).Error; err != nil {
+			return err
+		}
+
+		role, granted := roles[orgID]
+		switch {
+		case granted && membership.ID == 0:
+			var org models.Organization
+			if err := tx.Limit(1).Find(&org, orgID).Error; err != nil {
+				return err
+			}
+			if org.ID == 0 {
+				log.Printf("LDAP group role mapping names unknown organization %d", orgID)
+				continue
+			}
+			if err := tx.Create(&models.OrganizationMembership{
+				UserID:         userID,
+				OrganizationID: orgID,
+				Role:           models.Role(role),
+			}).Error; err != nil {
+				return err
+			}
+		case granted && membership.Role != models.Role(role):
+			if membership.Role == models.RoleAdmin {
+				if last, err := isLastAdmin(tx, orgID); err != nil {
+					return err
+				} else if last {
+					log.Printf("Not demoting user %d, the last admin of organization %d", userID, orgID)
+					continue
+				}
+			}
+			if err := tx.Model(&membership).Update("role", role).Error; err != nil {
+				return err
+			}
+		case !granted && membership.ID != 0:
+			if membership.Role == models.RoleAdmin {
+				if last, err := isLastAdmin(tx, orgID); err != nil {
+					return err
+				} else if last {
+					log.Printf("Not removing user %d, the last admin of organization %d", userID, orgID)
+					continue
+				}
+			}
+			if err := tx.Delete(&membership).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,568 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tmember/internal/domains"
+	"tmember/internal/middleware"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// domainVerificationTimeout bounds the DNS lookup made when verifying a domain
+const domainVerificationTimeout = 10 * time.Second
+
+// errJoinRequestDecided is returned when a join request was approved or rejected already
+var errJoinRequestDecided = errors.New("join request has already been decided")
+
+// requireOrgAdmin checks that the caller is an admin of the organization in the request context
+func requireOrgAdmin(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	orgID, ok := middleware.GetOrganizationIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusBadRequest, "Organization ID not found", "MISSING_ORG_ID")
+		return 0, false
+	}
+
+	role, ok := middleware.GetOrganizationRoleFromContext(r.Context())
+	if !ok || role != string(models.RoleAdmin) {
+		writeErrorResponse(w, http.StatusForbidden, "Admin access required", "ADMIN_REQUIRED")
+		return 0, false
+	}
+
+	return orgID, true
+}
+
+// parseDomainJoinMode validates a join mode, defaulting to join requests
+func parseDomainJoinMode(value string) (models.DomainJoinMode, bool) {
+	switch mode := models.DomainJoinMode(value); mode {
+	case "":
+		return models.DomainJoinRequest, true
+	case models.DomainJoinAutomatic, models.DomainJoinRequest, models.DomainJoinDisabled:
+		return mode, true
+	default:
+		return "", false
+	}
+}
+
+// ListDomainsHandler lists the organization's claimed domains (admin only)
+func (oh *OrganizationHandlers) ListDomainsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, ok := requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var orgDomains []models.OrganizationDomain
+	if err := oh.DB.Where("organization_id = ?", orgID).Order("domain").Find(&orgDomains).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch domains", "FETCH_ERROR")
+		return
+	}
+
+	response := models.ListDomainsResponse{Domains: []models.DomainResponse{}}
+	for _, domain := range orgDomains {
+		response.Domains = append(response.Domains, toDomainResponse(domain))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// CreateDomainHandler claims a domain for the organization and returns the TXT record that proves control of it (admin only)
+func (oh *OrganizationHandlers) CreateDomainHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, ok := requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	name, err := domains.Normalize(req.Domain)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid domain name", "INVALID_DOMAIN")
+		return
+	}
+
+	joinMode, ok := parseDomainJoinMode(req.JoinMode)
+	if !ok {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid join mode. Must be 'automatic', 'request' or 'disabled'", "INVALID_JOIN_MODE")
+		return
+	}
+
+	var existing int64
+	if err := oh.DB.Model(&models.OrganizationDomain{}).Where("organization_id = ? AND domain = ?", orgID, name).Count(&existing).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to check existing domains", "DOMAIN_CHECK_ERROR")
+		return
+	}
+	if existing > 0 {
+		writeErrorResponse(w, http.StatusConflict, "The organization has already added this domain", "DOMAIN_EXISTS")
+		return
+	}
+
+	token, err := utils.GenerateSecureToken(24)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to generate verification token", "TOKEN_GENERATION_ERROR")
+		return
+	}
+
+	domain := models.OrganizationDomain{
+		OrganizationID:    orgID,
+		Domain:            name,
+		VerificationToken: token,
+		JoinMode:          joinMode,
+	}
+	if err := oh.DB.Create(&domain).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to add domain", "DOMAIN_CREATION_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toDomainResponse(domain))
+}
+
+// UpdateDomainHandler changes what happens when users verify an email on the domain (admin only)
+func (oh *OrganizationHandlers) UpdateDomainHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, ok := requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	domain, ok := oh.findDomain(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	joinMode, ok := parseDomainJoinMode(req.JoinMode)
+	if !ok || req.JoinMode == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid join mode. Must be 'automatic', 'request' or 'disabled'", "INVALID_JOIN_MODE")
+		return
+	}
+
+	if err := oh.DB.Model(domain).Update("join_mode", joinMode).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to update domain", "UPDATE_ERROR")
+		return
+	}
+	domain.JoinMode = joinMode
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toDomainResponse(*domain))
+}
+
+// VerifyDomainHandler checks the domain's DNS TXT record and marks the domain as verified (admin only)
+func (oh *OrganizationHandlers) VerifyDomainHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, ok := requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	domain, ok := oh.findDomain(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	if !domain.IsVerified() {
+		// A domain can belong to only one organization
+		var claimed int64
+		if err := oh.DB.Model(&models.OrganizationDomain{}).
+			Where("domain = ? AND organization_id <> ? AND verified_at IS NOT NULL", domain.Domain, orgID).
+			Count(&claimed).Error; err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to check existing domains", "DOMAIN_CHECK_ERROR")
+			return
+		}
+		if claimed > 0 {
+			writeErrorResponse(w, http.StatusConflict, "Another organization has already verified this domain", "DOMAIN_ALREADY_CLAIMED")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), domainVerificationTimeout)
+		defer cancel()
+
+		verified, err := domains.Verify(ctx, oh.Resolver, domain.Domain, domain.VerificationToken)
+		if err != nil {
+			log.Printf("Failed to look up verification record for %s: %v", domain.Domain, err)
+			writeErrorResponse(w, http.StatusBadGateway, "Failed to look up the verification record; please try again later", "DNS_LOOKUP_ERROR")
+			return
+		}
+		if !verified {
+			writeErrorResponse(w, http.StatusUnprocessableEntity, "The verification TXT record was not found", "DOMAIN_VERIFICATION_FAILED")
+			return
+		}
+
+		now := time.Now()
+		if err := oh.DB.Model(domain).Update("verified_at", now).Error; err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify domain", "UPDATE_ERROR")
+			return
+		}
+		domain.VerifiedAt = &now
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toDomainResponse(*domain))
+}
+
+// DeleteDomainHandler removes a domain from the organization (admin only)
+func (oh *OrganizationHandlers) DeleteDomainHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, ok := requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	domain, ok := oh.findDomain(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	if err := oh.DB.Delete(domain).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to delete domain", "DELETE_ERROR")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":   "Domain removed successfully",
+		"domain_id": domain.ID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// findDomain loads the domain addressed by the URL path within the organization
+func (oh *OrganizationHandlers) findDomain(w http.ResponseWriter, r *http.Request, orgID uint) (*models.OrganizationDomain, bool) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 6 {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid domain ID", "INVALID_DOMAIN_ID")
+		return nil, false
+	}
+
+	domainID, err := strconv.ParseUint(parts[5], 10, 32) // /api/organizations/{id}/domains/{domain_id}
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid domain ID format", "INVALID_DOMAIN_ID_FORMAT")
+		return nil, false
+	}
+
+	var domain models.OrganizationDomain
+	if err := oh.DB.Where("id = ? AND organization_id = ?", uint(domainID), orgID).First(&domain).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeErrorResponse(w, http.StatusNotFound, "Domain not found", "DOMAIN_NOT_FOUND")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to find domain", "DOMAIN_FETCH_ERROR")
+		}
+		return nil, false
+	}
+
+	return &domain, true
+}
+
+// ListJoinRequestsHandler lists the pending requests to join the organization (admin only)
+func (oh *OrganizationHandlers) ListJoinRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, ok := requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var joinRequests []models.OrganizationJoinRequest
+	if err := oh.DB.Preload("User").Preload("Organization").
+		Where("organization_id = ? AND status = ?", orgID, models.JoinRequestPending).
+		Order("created_at").Find(&joinRequests).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch join requests", "FETCH_ERROR")
+		return
+	}
+
+	writeJoinRequests(w, joinRequests)
+}
+
+// DecideJoinRequestHandler approves or rejects a pending join request (admin only). Approval makes the user a member.
+func (oh *OrganizationHandlers) DecideJoinRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, ok := requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	// Extract the request ID and decision from the URL path: /api/organizations/{id}/join-requests/{request_id}/{approve|reject}
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) != 7 || (parts[6] != "approve" && parts[6] != "reject") {
+		writeErrorResponse(w, http.StatusNotFound, "Not found", "NOT_FOUND")
+		return
+	}
+
+	requestID, err := strconv.ParseUint(parts[5], 10, 32)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid join request ID format", "INVALID_JOIN_REQUEST_ID_FORMAT")
+		return
+	}
+
+	var joinRequest models.OrganizationJoinRequest
+	if err := oh.DB.Preload("User").Preload("Organization").
+		Where("id = ? AND organization_id = ?", uint(requestID), orgID).First(&joinRequest).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeErrorResponse(w, http.StatusNotFound, "Join request not found", "JOIN_REQUEST_NOT_FOUND")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to find join request", "JOIN_REQUEST_FETCH_ERROR")
+		}
+		return
+	}
+
+	status := models.JoinRequestRejected
+	if parts[6] == "approve" {
+		status = models.JoinRequestApproved
+	}
+
+	updates := map[string]interface{}{"status": status, "decided_at": time.Now()}
+	if userID, isUser := middleware.GetUserIDFromContext(r.Context()); isUser {
+		updates["decided_by_id"] = userID
+	}
+
+	err = oh.DB.Transaction(func(tx *gorm.DB) error {
+		// Mark the request as decided, guarding against concurrent decisions
+		result := tx.Model(&models.OrganizationJoinRequest{}).
+			Where("id = ? AND status = ?", joinRequest.ID, models.JoinRequestPending).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errJoinRequestDecided
+		}
+
+		if status != models.JoinRequestApproved {
+			return nil
+		}
+		return addDomainMember(tx, orgID, joinRequest.UserID)
+	})
+	if err != nil {
+		if err == errJoinRequestDecided {
+			writeErrorResponse(w, http.StatusConflict, "Join request has already been decided", "JOIN_REQUEST_NOT_PENDING")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to decide join request", "JOIN_REQUEST_ERROR")
+		}
+		return
+	}
+	joinRequest.Status = status
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toJoinRequestResponse(joinRequest))
+}
+
+// ListMyJoinRequestsHandler lists the current user's pending requests to join organizations
+func (oh *OrganizationHandlers) ListMyJoinRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
+		return
+	}
+
+	var joinRequests []models.OrganizationJoinRequest
+	if err := oh.DB.Preload("User").Preload("Organization").
+		Where("user_id = ? AND status = ?", userID, models.JoinRequestPending).
+		Order("created_at").Find(&joinRequests).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch join requests", "FETCH_ERROR")
+		return
+	}
+
+	writeJoinRequests(w, joinRequests)
+}
+
+// writeJoinRequests writes a list of join requests
+func writeJoinRequests(w http.ResponseWriter, joinRequests []models.OrganizationJoinRequest) {
+	response := models.ListJoinRequestsResponse{JoinRequests: []models.JoinRequestResponse{}}
+	for _, joinRequest := range joinRequests {
+		response.JoinRequests = append(response.JoinRequests, toJoinRequestResponse(joinRequest))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// joinVerifiedDomainOrganizations acts on the organizations that verified the domain of a user's newly
+// verified email: the user becomes a member, or files a join request, according to each domain's join mode
+func joinVerifiedDomainOrganizations(db *gorm.DB, user models.User) error {
+	domain := domains.FromEmail(user.Email)
+	if domain == "" {
+		return nil
+	}
+
+	var orgDomains []models.OrganizationDomain
+	if err := db.Where("domain = ? AND verified_at IS NOT NULL AND join_mode <> ?", domain, models.DomainJoinDisabled).
+		Find(&orgDomains).Error; err != nil {
+		return err
+	}
+
+	for _, orgDomain := range orgDomains {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if orgDomain.JoinMode == models.DomainJoinAutomatic {
+				return addDomainMember(tx, orgDomain.OrganizationID, user.ID)
+			}
+
+			// Members and users with a pending request need no new request
+			var members, pending int64
+			if err := tx.Model(&models.OrganizationMembership{}).
+				Where("organization_id = ? AND user_id = ?", orgDomain.OrganizationID, user.ID).
+				Count(&members).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.OrganizationJoinRequest{}).
+				Where("organization_id = ? AND user_id = ? AND status = ?", orgDomain.OrganizationID, user.ID, models.JoinRequestPending).
+				Count(&pending).Error; err != nil {
+				return err
+			}
+			if members > 0 || pending > 0 {
+				return nil
+			}
+
+			return tx.Create(&models.OrganizationJoinRequest{
+				OrganizationID: orgDomain.OrganizationID,
+				UserID:         user.ID,
+				Status:         models.JoinRequestPending,
+			}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addDomainMember makes the user a member of the organization unless they already belong to it
+func addDomainMember(tx *gorm.DB, orgID, userID uint) error {
+	var existing int64
+	if err := tx.Model(&models.OrganizationMembership{}).
+		Where("organization_id = ? AND user_id = ?", orgID, userID).
+		Count(&existing).Error; err != nil || existing > 0 {
+		return err
+	}
+
+	return tx.Create(&models.OrganizationMembership{
+		UserID:         userID,
+		OrganizationID: orgID,
+		Role:           models.RoleMember,
+	}).Error
+}
+
+// inviteAllowedByDomains reports whether an email may be invited to the organization: either the
+// organization has verified no domains, or the email is on one of them
+func inviteAllowedByDomains(db *gorm.DB, orgID uint, email string) (bool, error) {
+	var verified []models.OrganizationDomain
+	if err := db.Where("organization_id = ? AND verified_at IS NOT NULL", orgID).Find(&verified).Error; err != nil {
+		return false, err
+	}
+	if len(verified) == 0 {
+		return true, nil
+	}
+
+	emailDomain := domains.FromEmail(email)
+	for _, domain := range verified {
+		if domain.Domain == emailDomain {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// emailOnVerifiedDomain reports whether an email is on a domain the organization has verified
+func emailOnVerifiedDomain(db *gorm.DB, orgID uint, email string) (bool, error) {
+	var count int64
+	if err := db.Model(&models.OrganizationDomain{}).
+		Where("organization_id = ? AND domain = ? AND verified_at IS NOT NULL", orgID, domains.FromEmail(email)).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// toDomainResponse converts an organization domain to its API representation
+func toDomainResponse(domain models.OrganizationDomain) models.DomainResponse {
+	response := models.DomainResponse{
+		ID:             domain.ID,
+		OrganizationID: domain.OrganizationID,
+		Domain:         domain.Domain,
+		JoinMode:       string(domain.JoinMode),
+		Verified:       domain.IsVerified(),
+		RecordName:     domains.RecordName(domain.Domain),
+		RecordValue:    domains.RecordValue(domain.VerificationToken),
+		CreatedAt:      domain.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if domain.VerifiedAt != nil {
+		verifiedAt := domain.VerifiedAt.Format("2006-01-02T15:04:05Z07:00")
+		response.VerifiedAt = &verifiedAt
+	}
+	return response
+}
+
+// toJoinRequestResponse converts a join request to its API representation
+func toJoinRequestResponse(joinRequest models.OrganizationJoinRequest) models.JoinRequestResponse {
+	return models.JoinRequestResponse{
+		ID:               joinRequest.ID,
+		OrganizationID:   joinRequest.OrganizationID,
+		OrganizationName: joinRequest.Organization.Name,
+		UserID:           joinRequest.UserID,
+		Email:            joinRequest.User.Email,
+		Status:           string(joinRequest.Status),
+		CreatedAt:        joinRequest.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tmember/internal/domains"
+	"tmember/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// serveOrgRequest calls an organization handler through the organization access middleware as the given user
+func serveOrgRequest(orgHandlers *OrganizationHandlers, handler http.HandlerFunc, user models.User, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reqBody bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&reqBody).Encode(body)
+	}
+	req := withUserContext(httptest.NewRequest(method, path, &reqBody), user)
+	w := httptest.NewRecorder()
+	orgHandlers.OrganizationAccessMiddleware(handler).ServeHTTP(w, req)
+	return w
+}
+
+// createTestOrgWithAdmin creates an organization administered by a new user
+func createTestOrgWithAdmin(db *gorm.DB, name, adminEmail string) (models.Organization, models.User) {
+	admin := createUnitTestUser(db, adminEmail)
+	org := models.Organization{Name: name}
+	db.Create(&org)
+	db.Create(&models.OrganizationMembership{UserID: admin.ID, OrganizationID: org.ID, Role: models.RoleAdmin})
+	return org, admin
+}
+
+// verifyTestDomain adds a domain to the organization, publishes its TXT record and verifies it
+func verifyTestDomain(t *testing.T, orgHandlers *OrganizationHandlers, resolver *domains.StaticResolver, admin models.User, orgID uint, domain, joinMode string) models.DomainResponse {
+	w := serveOrgRequest(orgHandlers, orgHandlers.CreateDomainHandler, admin, http.MethodPost,
+		fmt.Sprintf("/api/organizations/%d/domains", orgID), models.CreateDomainRequest{Domain: domain, JoinMode: joinMode})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created models.DomainResponse
+	json.NewDecoder(w.Body).Decode(&created)
+
+	resolver.SetTXT(created.RecordName, created.RecordValue)
+	w = serveOrgRequest(orgHandlers, orgHandlers.VerifyDomainHandler, admin, http.MethodPost,
+		fmt.Sprintf("/api/organizations/%d/domains/%d/verify", orgID, created.ID), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var verified models.DomainResponse
+	json.NewDecoder(w.Body).Decode(&verified)
+	return verified
+}
+
+// createVerifiedDomainForTest records a domain as verified by the organization, skipping the DNS check
+func createVerifiedDomainForTest(db *gorm.DB, orgID uint, domain string) models.OrganizationDomain {
+	now := time.Now()
+	record := models.OrganizationDomain{OrganizationID: orgID, Domain: domain, VerificationToken: "token", JoinMode: models.DomainJoinDisabled, VerifiedAt: &now}
+	db.Create(&record)
+	return record
+}
+
+// verifyEmailForTest verifies a user's email through the verification endpoint
+func verifyEmailForTest(t *testing.T, authHandlers *AuthHandlers, userID uint) {
+	token, err := createUserToken(authHandlers.DB, userID, models.TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		t.Fatalf("Failed to create verification token: %v", err)
+	}
+	if w := postJSON(authHandlers.VerifyEmailHandler, "/api/auth/verify-email", models.VerifyEmailRequest{Token: token}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+func TestDomainVerification(t *testing.T) {
+	db := setupTestDBForUnit()
+	orgHandlers := NewOrganizationHandlers(db)
+	resolver := domains.NewStaticResolver()
+	orgHandlers.Resolver = resolver
+
+	org, admin := createTestOrgWithAdmin(db, "Example", "admin@example.com")
+	domainsPath := fmt.Sprintf("/api/organizations/%d/domains", org.ID)
+
+	w := serveOrgRequest(orgHandlers, orgHandlers.CreateDomainHandler, admin, http.MethodPost, domainsPath, models.CreateDomainRequest{Domain: "Example.COM."})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created models.DomainResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Domain != "example.com" || created.Verified || created.JoinMode != "request" || created.RecordName != "_tmember-verification.example.com" {
+		t.Errorf("Unexpected domain: %+v", created)
+	}
+
+	// Verification fails until the TXT record is published
+	verifyPath := fmt.Sprintf("%s/%d/verify", domainsPath, created.ID)
+	if w := serveOrgRequest(orgHandlers, orgHandlers.VerifyDomainHandler, admin, http.MethodPost, verifyPath, nil); w.Code != http.StatusUnprocessableEntity || decodeErrorCode(w) != "DOMAIN_VERIFICATION_FAILED" {
+		t.Errorf("Expected DOMAIN_VERIFICATION_FAILED, got %d", w.Code)
+	}
+	resolver.SetTXT(created.RecordName, created.RecordValue)
+	if w := serveOrgRequest(orgHandlers, orgHandlers.VerifyDomainHandler, admin, http.MethodPost, verifyPath, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the domain to verify, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Another organization cannot verify the same domain, even with its own record published
+	other, otherAdmin := createTestOrgWithAdmin(db, "Squatter", "admin@squatter.com")
+	w = serveOrgRequest(orgHandlers, orgHandlers.CreateDomainHandler, otherAdmin, http.MethodPost,
+		fmt.Sprintf("/api/organizations/%d/domains", other.ID), models.CreateDomainRequest{Domain: "example.com"})
+	var squatted models.DomainResponse
+	json.NewDecoder(w.Body).Decode(&squatted)
+	resolver.SetTXT(squatted.RecordName, squatted.RecordValue)
+	w = serveOrgRequest(orgHandlers, orgHandlers.VerifyDomainHandler, otherAdmin, http.MethodPost,
+		fmt.Sprintf("/api/organizations/%d/domains/%d/verify", other.ID, squatted.ID), nil)
+	if w.Code != http.StatusConflict || decodeErrorCode(w) != "DOMAIN_ALREADY_CLAIMED" {
+		t.Errorf("Expected DOMAIN_ALREADY_CLAIMED, got %d", w.Code)
+	}
+
+	// Members cannot manage domains
+	member := createUnitTestUser(db, "member@example.com")
+	db.Create(&models.OrganizationMembership{UserID: member.ID, OrganizationID: org.ID, Role: models.RoleMember})
+	if w := serveOrgRequest(orgHandlers, orgHandlers.ListDomainsHandler, member, http.MethodGet, domainsPath, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected members to be refused, got %d", w.Code)
+	}
+
+	w = serveOrgRequest(orgHandlers, orgHandlers.ListDomainsHandler, admin, http.MethodGet, domainsPath, nil)
+	var list models.ListDomainsResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Domains) != 1 || !list.Domains[0].Verified || list.Domains[0].VerifiedAt == nil {
+		t.Errorf("Expected one verified domain, got %+v", list.Domains)
+	}
+}
+
+func TestDomainJoin_OnEmailVerification(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	orgHandlers := NewOrganizationHandlers(db)
+	resolver := domains.NewStaticResolver()
+	orgHandlers.Resolver = resolver
+
+	autoOrg, autoAdmin := createTestOrgWithAdmin(db, "Auto", "admin@auto.example")
+	verifyTestDomain(t, orgHandlers, resolver, autoAdmin, autoOrg.ID, "auto.example", "automatic")
+	requestOrg, requestAdmin := createTestOrgWithAdmin(db, "Request", "admin@request.example")
+	verifyTestDomain(t, orgHandlers, resolver, requestAdmin, requestOrg.ID, "request.example", "request")
+
+	// Registering is not enough; the user has to prove they own the address
+	autoUser := registerForTest(t, authHandlers, "jane@Auto.example", "ValidPass123")
+	var memberships int64
+	db.Model(&models.OrganizationMembership{}).Where("user_id = ?", autoUser.User.ID).Count(&memberships)
+	if memberships != 0 {
+		t.Errorf("Expected no membership before verification, got %d", memberships)
+	}
+
+	verifyEmailForTest(t, authHandlers, autoUser.User.ID)
+	var membership models.OrganizationMembership
+	db.Where("organization_id = ? AND user_id = ?", autoOrg.ID, autoUser.User.ID).Limit(1).Find(&membership)
+	if membership.ID == 0 || membership.Role != models.RoleMember {
+		t.Errorf("Expected an automatic member membership, got %+v", membership)
+	}
+
+	// Domains in request mode file a join request the user can see
+	requestUser := registerForTest(t, authHandlers, "joe@request.example", "ValidPass123")
+	verifyEmailForTest(t, authHandlers, requestUser.User.ID)
+
+	var user models.User
+	db.First(&user, requestUser.User.ID)
+	w := httptest.NewRecorder()
+	orgHandlers.ListMyJoinRequestsHandler(w, withUserContext(httptest.NewRequest(http.MethodGet, "/api/users/me/join-requests", nil), user))
+	var mine models.ListJoinRequestsResponse
+	json.NewDecoder(w.Body).Decode(&mine)
+	if len(mine.JoinRequests) != 1 || mine.JoinRequests[0].OrganizationName != "Request" || mine.JoinRequests[0].Status != "pending" {
+		t.Fatalf("Expected a pending join request, got %+v", mine.JoinRequests)
+	}
+
+	joinRequestsPath := fmt.Sprintf("/api/organizations/%d/join-requests", requestOrg.ID)
+	w = serveOrgRequest(orgHandlers, orgHandlers.ListJoinRequestsHandler, requestAdmin, http.MethodGet, joinRequestsPath, nil)
+	var pending models.ListJoinRequestsResponse
+	json.NewDecoder(w.Body).Decode(&pending)
+	if len(pending.JoinRequests) != 1 || pending.JoinRequests[0].Email != "joe@request.example" {
+		t.Fatalf("Expected the admin to see the join request, got %+v", pending.JoinRequests)
+	}
+
+	approvePath := fmt.Sprintf("%s/%d/approve", joinRequestsPath, pending.JoinRequests[0].ID)
+	if w := serveOrgRequest(orgHandlers, orgHandlers.DecideJoinRequestHandler, requestAdmin, http.MethodPost, approvePath, nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	db.Model(&models.OrganizationMembership{}).Where("organization_id = ? AND user_id = ?", requestOrg.ID, requestUser.User.ID).Count(&memberships)
+	if memberships != 1 {
+		t.Errorf("Expected approval to create a membership, got %d", memberships)
+	}
+
+	rejectPath := fmt.Sprintf("%s/%d/reject", joinRequestsPath, pending.JoinRequests[0].ID)
+	if w := serveOrgRequest(orgHandlers, orgHandlers.DecideJoinRequestHandler, requestAdmin, http.MethodPost, rejectPath, nil); w.Code != http.StatusConflict || decodeErrorCode(w) != "JOIN_REQUEST_NOT_PENDING" {
+		t.Errorf("Expected JOIN_REQUEST_NOT_PENDING, got %d", w.Code)
+	}
+}
+
+func TestCreateInvitation_VerifiedDomainRestriction(t *testing.T) {
+	db := setupTestDBForUnit()
+	db.AutoMigrate(&models.Invitation{})
+	orgHandlers := NewOrganizationHandlers(db)
+	resolver := domains.NewStaticResolver()
+	orgHandlers.Resolver = resolver
+
+	org, admin := createTestOrgWithAdmin(db, "Example", "admin@example.com")
+	invitationsPath := fmt.Sprintf("/api/organizations/%d/invitations", org.ID)
+	invite := func(email string, allowExternal bool) *httptest.ResponseRecorder {
+		return serveOrgRequest(orgHandlers, orgHandlers.CreateInvitationHandler, admin, http.MethodPost, invitationsPath,
+			models.CreateInvitationRequest{Email: email, AllowExternalDomain: allowExternal})
+	}
+
+	// Without verified domains anyone can be invited
+	if w := invite("first@elsewhere.com", false); w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	verifyTestDomain(t, orgHandlers, resolver, admin, org.ID, "example.com", "disabled")
+	if w := invite("colleague@example.com", false); w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	if w := invite("outsider@elsewhere.com", false); w.Code != http.StatusForbidden || decodeErrorCode(w) != "EMAIL_DOMAIN_NOT_ALLOWED" {
+		t.Errorf("Expected EMAIL_DOMAIN_NOT_ALLOWED, got %d", w.Code)
+	}
+	if w := invite("outsider@elsewhere.com", true); w.Code != http.StatusCreated {
+		t.Errorf("Expected the admin override to invite, got %d", w.Code)
+	}
+}
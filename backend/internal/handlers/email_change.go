@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"tmember/internal/config"
+	"tmember/internal/mailer"
+	"tmember/internal/middleware"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// emailChangeTTL is how long the confirmation link sent to a new email address remains valid
+	emailChangeTTL = 24 * time.Hour
+	// emailChangeRevertTTL is how long the previous address can undo an email change
+	emailChangeRevertTTL = 7 * 24 * time.Hour
+)
+
+// ChangeEmailHandler starts changing the current user's email address. The address is only swapped once the
+// link sent to the new address is followed; the previous address is told about the change and can revert it.
+func (ah *AuthHandlers) ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r, ah.DB)
+	if !ok {
+		return
+	}
+
+	var req models.ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	if user.PasswordHash == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "Set a password with a password reset before changing your email", "PASSWORD_NOT_SET")
+		return
+	}
+	if !checkCurrentPassword(w, r, ah.DB, *user, req.Password) {
+		return
+	}
+
+	if _, ok := requireSecondFactorStepUp(w, r, ah.DB, *user, "change your email"); !ok {
+		return
+	}
+
+	newEmail, err := utils.CanonicalizeEmail(req.NewEmail)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid email format", "INVALID_EMAIL")
+		return
+	}
+	if utils.EmailKey(newEmail) == utils.EmailKey(user.Email) {
+		writeErrorResponse(w, http.StatusBadRequest, "New email must be different from the current email", "EMAIL_UNCHANGED")
+		return
+	}
+
+	taken, err := emailTaken(ah.DB, newEmail, user.ID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to check email", "DATABASE_ERROR")
+		return
+	}
+	if taken {
+		writeErrorResponse(w, http.StatusConflict, "User with this email already exists", "EMAIL_EXISTS")
+		return
+	}
+
+	if err := ah.sendEmailChangeEmails(*user, newEmail); err != nil {
+		log.Printf("Failed to send email change emails for user %d: %v", user.ID, err)
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to send confirmation email", "EMAIL_SEND_ERROR")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Follow the link sent to your new email address to confirm the change",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ConfirmEmailChangeHandler swaps the current user's email address for the one confirmed by the token, and
+// signs out every other session
+func (ah *AuthHandlers) ConfirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r, ah.DB)
+	if !ok {
+		return
+	}
+
+	var req models.ConfirmEmailChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	record, err := findUserToken(ah.DB, req.Token, models.TokenPurposeEmailChange)
+	if err != nil || record.UserID != user.ID {
+		writeEmailChangeTokenError(w, err)
+		return
+	}
+
+	currentSessionID, _ := middleware.GetSessionIDFromContext(r.Context())
+
+	err = ah.DB.Transaction(func(tx *gorm.DB) error {
+		if err := useUserToken(tx, record); err != nil {
+			return err
+		}
+		if err := swapEmail(tx, user, record.Data); err != nil {
+			return err
+		}
+		_, err := revokeUserSessions(tx, user.ID, currentSessionID)
+		return err
+	})
+	if err != nil {
+		writeSwapEmailError(w, err)
+		return
+	}
+	recordAuditEvent(ah.DB, r, user.ID, models.AuditActionEmailChanged)
+
+	response := map[string]interface{}{
+		"message": "Email address changed successfully",
+		"email":   user.Email,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevertEmailChangeHandler restores the email address a revert link was sent to, cancelling any pending change.
+// Since the change may not have been made by the owner of the account, every session is signed out and the
+// second factors, which whoever made it may have enrolled, are removed.
+func (ah *AuthHandlers) RevertEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var req models.RevertEmailChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	record, err := findUserToken(ah.DB, req.Token, models.TokenPurposeEmailChangeRevert)
+	if err != nil || record.User.ID == 0 {
+		writeEmailChangeTokenError(w, err)
+		return
+	}
+	user := record.User
+
+	err = ah.DB.Transaction(func(tx *gorm.DB) error {
+		if err := useUserToken(tx, record); err != nil {
+			return err
+		}
+
+		// Changes requested after this one were made from the address being reverted, so their links go too
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND used_at IS NULL AND (purpose = ? OR (purpose = ? AND id > ?))",
+				user.ID, models.TokenPurposeEmailChange, models.TokenPurposeEmailChangeRevert, record.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if user.Email != record.Data {
+			if err := swapEmail(tx, &user, record.Data); err != nil {
+				return err
+			}
+		}
+
+		if err := removeSecondFactors(tx, &user); err != nil {
+			return err
+		}
+		if _, err := revokeUserSessions(tx, user.ID, 0); err != nil {
+			return err
+		}
+		return tx.Model(&models.PersonalAccessToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		writeSwapEmailError(w, err)
+		return
+	}
+	recordAuditEvent(ah.DB, r, user.ID, models.AuditActionEmailChangeReverted)
+
+	response := map[string]interface{}{
+		"message": "Your email address has been restored, all sessions signed out and two-factor authentication turned off. If you did not change it, reset your password.",
+		"email":   user.Email,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// errEmailTaken is returned when an email change targets an address another account holds
+var errEmailTaken = errors.New("email address is already in use")
+
+// emailTaken reports whether an account other than the given user holds the address. Deleted accounts count,
+// as they still hold their address in the unique index.
+func emailTaken(db *gorm.DB, email string, userID uint) (bool, error) {
+	var count int64
+	if err := db.Unscoped().Model(&models.User{}).Where("normalized_email = ? AND id <> ?", utils.EmailKey(email), userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// swapEmail gives the user a new, verified email address, retiring the links sent to the previous one
+func swapEmail(tx *gorm.DB, user *models.User, email string) error {
+	if taken, err := emailTaken(tx, email, user.ID); err != nil {
+		return err
+	} else if taken {
+		return errEmailTaken
+	}
+
+	if err := tx.Model(user).Updates(map[string]interface{}{"email": email, "email_verified_at": nil}).Error; err != nil {
+		// The unique index catches an address claimed since the check above
+		if taken, checkErr := emailTaken(tx, email, user.ID); checkErr == nil && taken {
+			return errEmailTaken
+		}
+		return err
+	}
+	user.Email = email
+	user.EmailVerifiedAt = nil
+
+	if err := tx.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose IN ? AND used_at IS NULL", user.ID,
+			[]models.TokenPurpose{models.TokenPurposeEmailVerification, models.TokenPurposePasswordReset, models.TokenPurposeMagicLink}).
+		Update("used_at", time.Now()).Error; err != nil {
+		return err
+	}
+
+	// Following the emailed link proves ownership of the address
+	return markEmailVerified(tx, user)
+}
+
+// writeEmailChangeTokenError writes the response for an email change token that could not be found or used
+func writeEmailChangeTokenError(w http.ResponseWriter, err error) {
+	if err != nil && err != errInvalidUserToken {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify email change link", "TOKEN_CHECK_ERROR")
+	} else {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid or expired email change link", "INVALID_EMAIL_CHANGE_TOKEN")
+	}
+}
+
+// writeSwapEmailError writes the response for an email change that could not be applied
+func writeSwapEmailError(w http.ResponseWriter, err error) {
+	switch err {
+	case errInvalidUserToken:
+		writeEmailChangeTokenError(w, err)
+	case errEmailTaken:
+		writeErrorResponse(w, http.StatusConflict, "User with this email already exists", "EMAIL_EXISTS")
+	default:
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to change email", "UPDATE_ERROR")
+	}
+}
+
+// sendEmailChangeEmails emails a confirmation link to the new address and a notice with a revert link to the
+// current one
+func (ah *AuthHandlers) sendEmailChangeEmails(user models.User, newEmail string) error {
+	token, err := createUserTokenWithData(ah.DB, user.ID, models.TokenPurposeEmailChange, emailChangeTTL, newEmail)
+	if err != nil {
+		return err
+	}
+	revertToken, err := createUserTokenWithData(ah.DB, user.ID, models.TokenPurposeEmailChangeRevert, emailChangeRevertTTL, user.Email)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/settings/email/confirm?token=%s", config.AppBaseURL(), url.QueryEscape(token))
+	if err := ah.Mailer.Send(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new TMember email address",
+		Body: fmt.Sprintf("Confirm that you want to use this address for your TMember account:\n\n"+
+			"%s\n\n"+
+			"This link expires in %d hours. If you did not request this change, you can ignore this email.\n",
+			link, int(emailChangeTTL.Hours())),
+	}); err != nil {
+		return err
+	}
+
+	revertLink := fmt.Sprintf("%s/auth/email/revert?token=%s", config.AppBaseURL(), url.QueryEscape(revertToken))
+	return ah.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your TMember email address is being changed",
+		Body: fmt.Sprintf("Someone asked to change the email address of your TMember account to %s.\n\n"+
+			"If this was not you, keep your current address and sign out everywhere: %s\n\n"+
+			"This link works for %d days, even after the change is confirmed.\n",
+			newEmail, revertLink, int(emailChangeRevertTTL.Hours()/24)),
+	})
+}
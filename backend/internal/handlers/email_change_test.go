@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"tmember/internal/mailer"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+)
+
+// requestEmailChangeForTest starts an email change and returns the confirmation and revert tokens
+func requestEmailChangeForTest(t *testing.T, authHandlers *AuthHandlers, accessToken, password, newEmail string) (string, string) {
+	t.Helper()
+	memoryMailer := authHandlers.Mailer.(*mailer.MemoryMailer)
+	sent := len(memoryMailer.Messages())
+
+	w := serveSessionRequest(t, authHandlers.ChangeEmailHandler, accessToken, http.MethodPost, "/api/users/me/email",
+		models.ChangeEmailRequest{NewEmail: newEmail, Password: password})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	messages := memoryMailer.Messages()[sent:]
+	if len(messages) != 2 || messages[0].To != newEmail {
+		t.Fatalf("Expected a confirmation to the new address and a notice to the old one, got %+v", messages)
+	}
+	return extractTokenFromMail(t, messages[0]), extractTokenFromMail(t, messages[1])
+}
+
+func TestChangeEmail(t *testing.T) {
+	authHandlers := NewAuthHandlers(setupTestDBForUnit())
+	auth := registerForTest(t, authHandlers, "old@example.com", "ValidPass123")
+	other := loginForTest(t, authHandlers, "old@example.com", "ValidPass123")
+	registerForTest(t, authHandlers, "taken@example.com", "ValidPass123")
+
+	if w := serveSessionRequest(t, authHandlers.ChangeEmailHandler, auth.Token, http.MethodPost, "/api/users/me/email",
+		models.ChangeEmailRequest{NewEmail: "new@example.com", Password: "wrong"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a wrong password, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := serveSessionRequest(t, authHandlers.ChangeEmailHandler, auth.Token, http.MethodPost, "/api/users/me/email",
+		models.ChangeEmailRequest{NewEmail: "taken@example.com", Password: "ValidPass123"}); w.Code != http.StatusConflict || decodeErrorCode(w) != "EMAIL_EXISTS" {
+		t.Errorf("Expected 409 EMAIL_EXISTS for a taken address, got %d", w.Code)
+	}
+	if w := serveSessionRequest(t, authHandlers.ChangeEmailHandler, auth.Token, http.MethodPost, "/api/users/me/email",
+		models.ChangeEmailRequest{NewEmail: "OLD@example.com", Password: "ValidPass123"}); w.Code != http.StatusBadRequest || decodeErrorCode(w) != "EMAIL_UNCHANGED" {
+		t.Errorf("Expected 400 EMAIL_UNCHANGED for the current address in another spelling, got %d", w.Code)
+	}
+
+	token, _ := requestEmailChangeForTest(t, authHandlers, auth.Token, "ValidPass123", "new@example.com")
+
+	// Nothing changes until the new address is confirmed
+	if w := attemptLogin(authHandlers, "new@example.com", "ValidPass123"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the unconfirmed address not to sign in, got %d", w.Code)
+	}
+
+	w := serveSessionRequest(t, authHandlers.ConfirmEmailChangeHandler, auth.Token, http.MethodPost, "/api/users/me/email/confirm",
+		models.ConfirmEmailChangeRequest{Token: token})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var user models.User
+	authHandlers.DB.First(&user, auth.User.ID)
+	if user.Email != "new@example.com" || !user.IsEmailVerified() {
+		t.Errorf("Expected the new address to be verified, got %q", user.Email)
+	}
+	if w := attemptLogin(authHandlers, "new@example.com", "ValidPass123"); w.Code != http.StatusOK {
+		t.Errorf("Expected the new address to sign in, got %d", w.Code)
+	}
+
+	// Other sessions are signed out, the confirming one is kept
+	otherClaims, _ := utils.ValidateJWT(other.Token)
+	claims, _ := utils.ValidateJWT(auth.Token)
+	var otherSession, session models.Session
+	authHandlers.DB.First(&otherSession, otherClaims.SessionID)
+	authHandlers.DB.First(&session, claims.SessionID)
+	if otherSession.IsActive() || !session.IsActive() {
+		t.Error("Expected other sessions to be revoked and the confirming one to stay active")
+	}
+
+	if w := serveSessionRequest(t, authHandlers.ConfirmEmailChangeHandler, auth.Token, http.MethodPost, "/api/users/me/email/confirm",
+		models.ConfirmEmailChangeRequest{Token: token}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a used link to be rejected, got %d", w.Code)
+	}
+}
+
+func TestChangeEmail_AddressTakenBeforeConfirmation(t *testing.T) {
+	authHandlers := NewAuthHandlers(setupTestDBForUnit())
+	auth := registerForTest(t, authHandlers, "old@example.com", "ValidPass123")
+	token, _ := requestEmailChangeForTest(t, authHandlers, auth.Token, "ValidPass123", "new@example.com")
+
+	registerForTest(t, authHandlers, "new@example.com", "ValidPass123")
+	w := serveSessionRequest(t, authHandlers.ConfirmEmailChangeHandler, auth.Token, http.MethodPost, "/api/users/me/email/confirm",
+		models.ConfirmEmailChangeRequest{Token: token})
+	if w.Code != http.StatusConflict || decodeErrorCode(w) != "EMAIL_EXISTS" {
+		t.Fatalf("Expected 409 EMAIL_EXISTS, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var user models.User
+	authHandlers.DB.First(&user, auth.User.ID)
+	if user.Email != "old@example.com" {
+		t.Errorf("Expected the address to stay unchanged, got %q", user.Email)
+	}
+}
+
+func TestChangeEmail_WrongPasswordsAreThrottled(t *testing.T) {
+	t.Setenv("LOGIN_DELAY_AFTER_FAILURES", "10")
+	t.Setenv("LOGIN_MAX_FAILURES", "2")
+
+	authHandlers := NewAuthHandlers(setupTestDBForUnit())
+	auth := registerForTest(t, authHandlers, "guess@example.com", "ValidPass123")
+
+	for i := 0; i < 2; i++ {
+		if w := serveSessionRequest(t, authHandlers.ChangeEmailHandler, auth.Token, http.MethodPost, "/api/users/me/email",
+			models.ChangeEmailRequest{NewEmail: "new@example.com", Password: "WrongPassword1"}); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	// Guessing through a session locks the account like failed sign-ins do
+	if w := serveSessionRequest(t, authHandlers.ChangeEmailHandler, auth.Token, http.MethodPost, "/api/users/me/email",
+		models.ChangeEmailRequest{NewEmail: "new@example.com", Password: "ValidPass123"}); w.Code != http.StatusTooManyRequests || decodeErrorCode(w) != "ACCOUNT_LOCKED" {
+		t.Errorf("Expected 429 ACCOUNT_LOCKED, got %d", w.Code)
+	}
+	if w := attemptLogin(authHandlers, "guess@example.com", "ValidPass123"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected sign-ins to be locked out too, got %d", w.Code)
+	}
+}
+
+func TestRevertEmailChange(t *testing.T) {
+	authHandlers, authenticator := newWebAuthnTestHandlers()
+	auth := registerForTest(t, authHandlers, "owner@example.com", "ValidPass123")
+
+	// Someone with the owner's password moves the account to their address, and then on to another one
+	token, ownerRevert := requestEmailChangeForTest(t, authHandlers, auth.Token, "ValidPass123", "hijacker@example.com")
+	serveSessionRequest(t, authHandlers.ConfirmEmailChangeHandler, auth.Token, http.MethodPost, "/api/users/me/email/confirm", models.ConfirmEmailChangeRequest{Token: token})
+	token, hijackerRevert := requestEmailChangeForTest(t, authHandlers, auth.Token, "ValidPass123", "hijacker2@example.com")
+	serveSessionRequest(t, authHandlers.ConfirmEmailChangeHandler, auth.Token, http.MethodPost, "/api/users/me/email/confirm", models.ConfirmEmailChangeRequest{Token: token})
+
+	// They enroll second factors of their own to keep the account
+	enrollTOTPForTest(t, authHandlers, auth.Token)
+	registerPasskeyForTest(t, authHandlers, authenticator, auth.Token, "Hijacker")
+
+	// The owner's revert link still works and signs everyone out
+	w := postJSON(authHandlers.RevertEmailChangeHandler, "/api/auth/email/revert", models.RevertEmailChangeRequest{Token: ownerRevert})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var user models.User
+	authHandlers.DB.First(&user, auth.User.ID)
+	if user.Email != "owner@example.com" {
+		t.Errorf("Expected the original address to be restored, got %q", user.Email)
+	}
+	var activeSessions int64
+	authHandlers.DB.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&activeSessions)
+	if activeSessions != 0 {
+		t.Errorf("Expected every session to be revoked, got %d active", activeSessions)
+	}
+
+	// The second factors enrolled since the change are gone
+	var recoveryCodes, credentials int64
+	authHandlers.DB.Model(&models.MFARecoveryCode{}).Where("user_id = ?", user.ID).Count(&recoveryCodes)
+	authHandlers.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&credentials)
+	if user.IsMFAEnabled() || user.TOTPSecret != "" || recoveryCodes != 0 || credentials != 0 {
+		t.Errorf("Expected second factors to be removed, got MFA %v, %d recovery codes and %d passkeys", user.IsMFAEnabled(), recoveryCodes, credentials)
+	}
+	if w := passkeyLogin(t, authHandlers, authenticator); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the hijacker's passkey to be rejected, got %d", w.Code)
+	}
+
+	// Revert links from the hijacked addresses no longer do anything
+	if w := postJSON(authHandlers.RevertEmailChangeHandler, "/api/auth/email/revert", models.RevertEmailChangeRequest{Token: hijackerRevert}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a later revert link to be rejected, got %d", w.Code)
+	}
+}
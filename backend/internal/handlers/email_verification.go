@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"tmember/internal/config"
+	"tmember/internal/mailer"
+	"tmember/internal/middleware"
+	"tmember/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// emailVerificationTTL is how long an email verification token remains valid
+const emailVerificationTTL = 48 * time.Hour
+
+// VerifyEmailHandler confirms the user's email address using a verification token
+func (ah *AuthHandlers) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var req models.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	record, err := consumeUserToken(ah.DB, req.Token, models.TokenPurposeEmailVerification)
+	if err != nil || record.User.ID == 0 {
+		if err != nil && err != errInvalidUserToken {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify token", "TOKEN_CHECK_ERROR")
+		} else {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid or expired verification token", "INVALID_VERIFICATION_TOKEN")
+		}
+		return
+	}
+
+	user := record.User
+	if err := markEmailVerified(ah.DB, &user); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify email", "UPDATE_ERROR")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Email verified successfully",
+		"user":    user,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ResendVerificationHandler sends a new verification email to the current user
+func (ah *AuthHandlers) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
+		return
+	}
+
+	var user models.User
+	if err := ah.DB.First(&user, userID).Error; err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND")
+		return
+	}
+
+	if user.IsEmailVerified() {
+		writeErrorResponse(w, http.StatusConflict, "Email is already verified", "EMAIL_ALREADY_VERIFIED")
+		return
+	}
+
+	if err := ah.sendVerificationEmail(user); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to send verification email", "MAIL_ERROR")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Verification email sent",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// sendVerificationEmail issues a verification token for the user and emails the confirmation link
+func (ah *AuthHandlers) sendVerificationEmail(user models.User) error {
+	token, err := createUserToken(ah.DB, user.ID, models.TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", config.AppBaseURL(), url.QueryEscape(token))
+	return ah.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your TMember email address",
+		Body: fmt.Sprintf("Welcome to TMember!\n\n"+
+			"Confirm your email address: %s\n\n"+
+			"This link expires in %d hours. If you did not create an account, you can ignore this email.\n",
+			link, int(emailVerificationTTL.Hours())),
+	})
+}
+
+// markEmailVerified records that the user has proven ownership of their email address
+func markEmailVerified(db *gorm.DB, user *models.User) error {
+	if err := releaseProvisionedAccount(db, user.ID); err != nil {
+		return err
+	}
+	if user.IsEmailVerified() {
+		return nil
+	}
+
+	now := time.Now()
+	if err := db.Model(user).Update("email_verified_at", now).Error; err != nil {
+		return err
+	}
+	user.EmailVerifiedAt = &now
+
+	// Joining organizations that claim the domain must not fail the verification itself
+	if err := joinVerifiedDomainOrganizations(db, *user); err != nil {
+		log.Printf("Failed to join verified domain organizations for user %d: %v", user.ID, err)
+	}
+	return nil
+}
+
+// releaseProvisionedAccount hands an account an organization provisioned to the owner of its email address,
+// who has just proved they control it. The organization's identity provider loses the right to sign the
+// account in regardless of its domain, and SCIM can no longer change its email.
+func releaseProvisionedAccount(db *gorm.DB, userID uint) error {
+	if err := db.Where("user_id = ?", userID).Delete(&models.SAMLProvisionedUser{}).Error; err != nil {
+		return err
+	}
+	return db.Model(&models.SCIMUser{}).Where("user_id = ? AND managed = ?", userID, true).Update("managed", false).Error
+}
+
+// requireVerifiedEmail writes an error and returns false when email verification is enforced and the user is unverified
+func requireVerifiedEmail(w http.ResponseWriter, user models.User) bool {
+	if config.RequireEmailVerification() && !user.IsEmailVerified() {
+		writeErrorResponse(w, http.StatusForbidden, "Please verify your email address first", "EMAIL_NOT_VERIFIED")
+		return false
+	}
+	return true
+}
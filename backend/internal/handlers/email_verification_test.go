@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tmember/internal/mailer"
+	"tmember/internal/models"
+)
+
+func TestRegisterHandler_SendsVerificationEmail(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	outbox := mailer.NewMemoryMailer()
+	authHandlers.Mailer = outbox
+
+	auth := registerForTest(t, authHandlers, "verify@example.com", "ValidPass123")
+	if auth.User.IsEmailVerified() {
+		t.Error("Expected new user to be unverified")
+	}
+
+	msg, ok := outbox.Last()
+	if !ok || msg.To != "verify@example.com" {
+		t.Fatalf("Expected verification email to verify@example.com, got %+v", msg)
+	}
+
+	w := postJSON(authHandlers.VerifyEmailHandler, "/api/auth/verify-email", models.VerifyEmailRequest{Token: extractTokenFromMail(t, msg)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var user models.User
+	db.First(&user, auth.User.ID)
+	if !user.IsEmailVerified() {
+		t.Error("Expected user to be verified after confirming")
+	}
+
+	// The token is single-use
+	if reuse := postJSON(authHandlers.VerifyEmailHandler, "/api/auth/verify-email", models.VerifyEmailRequest{Token: extractTokenFromMail(t, msg)}); reuse.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for reused token, got %d", http.StatusBadRequest, reuse.Code)
+	}
+}
+
+func TestResendVerificationHandler(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	outbox := mailer.NewMemoryMailer()
+	authHandlers.Mailer = outbox
+
+	auth := registerForTest(t, authHandlers, "resend@example.com", "ValidPass123")
+
+	req := withSessionContext(t, httptest.NewRequest(http.MethodPost, "/api/auth/verify-email/resend", nil), auth.Token)
+	w := httptest.NewRecorder()
+	authHandlers.ResendVerificationHandler(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+	if len(outbox.Messages()) != 2 {
+		t.Fatalf("Expected 2 verification emails, got %d", len(outbox.Messages()))
+	}
+
+	// Only the latest link works
+	first := extractTokenFromMail(t, outbox.Messages()[0])
+	if stale := postJSON(authHandlers.VerifyEmailHandler, "/api/auth/verify-email", models.VerifyEmailRequest{Token: first}); stale.Code != http.StatusBadRequest {
+		t.Errorf("Expected superseded token to be rejected, got %d", stale.Code)
+	}
+
+	latest, _ := outbox.Last()
+	postJSON(authHandlers.VerifyEmailHandler, "/api/auth/verify-email", models.VerifyEmailRequest{Token: extractTokenFromMail(t, latest)})
+
+	// Verified users cannot request another email
+	again := withSessionContext(t, httptest.NewRequest(http.MethodPost, "/api/auth/verify-email/resend", nil), auth.Token)
+	againW := httptest.NewRecorder()
+	authHandlers.ResendVerificationHandler(againW, again)
+
+	if againW.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, againW.Code)
+	}
+}
+
+func TestRequireEmailVerificationBlocksOrganizations(t *testing.T) {
+	t.Setenv("REQUIRE_EMAIL_VERIFICATION", "true")
+
+	db := setupInvitationTestDB()
+	orgHandlers := NewOrganizationHandlers(db)
+
+	unverified := createUnitTestUser(db, "unverified@example.com")
+
+	// Unverified users cannot create organizations
+	reqBody, _ := json.Marshal(models.CreateOrganizationRequest{Name: "Blocked Org"})
+	req := withUserContext(httptest.NewRequest(http.MethodPost, "/api/organizations", bytes.NewBuffer(reqBody)), unverified)
+	w := httptest.NewRecorder()
+	orgHandlers.CreateOrganizationHandler(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Unverified users cannot accept invitations
+	admin := createUnitTestUser(db, "admin@example.com")
+	now := time.Now()
+	db.Model(&admin).Update("email_verified_at", &now)
+	org := models.Organization{Name: "Verified Org"}
+	db.Create(&org)
+	db.Create(&models.OrganizationMembership{UserID: admin.ID, OrganizationID: org.ID, Role: models.RoleAdmin})
+
+	invitation := createInvitation(t, orgHandlers, admin, org.ID, unverified.Email)
+	acceptBody, _ := json.Marshal(models.AcceptInvitationRequest{Token: invitation.Token})
+	acceptReq := withUserContext(httptest.NewRequest(http.MethodPost, "/api/invitations/accept", bytes.NewBuffer(acceptBody)), unverified)
+	acceptW := httptest.NewRecorder()
+	orgHandlers.AcceptInvitationHandler(acceptW, acceptReq)
+
+	if acceptW.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, acceptW.Code)
+	}
+
+	// Once verified, the same invitation can be accepted
+	db.Model(&unverified).Update("email_verified_at", &now)
+	acceptReq = withUserContext(httptest.NewRequest(http.MethodPost, "/api/invitations/accept", bytes.NewBuffer(acceptBody)), unverified)
+	acceptW = httptest.NewRecorder()
+	orgHandlers.AcceptInvitationHandler(acceptW, acceptReq)
+
+	if acceptW.Code != http.StatusOK {
+		t.Errorf("Expected status %d after verification, got %d", http.StatusOK, acceptW.Code)
+	}
+}
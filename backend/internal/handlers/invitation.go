@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tmember/internal/middleware"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// invitationTTL is how long an invitation token remains valid
+const invitationTTL = 7 * 24 * time.Hour
+
+// CreateInvitationHandler handles inviting an email address to an organization (admin only)
+func (oh *OrganizationHandlers) CreateInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	// The inviter is either a user or a service account
+	userID, isUser := middleware.GetUserIDFromContext(r.Context())
+	serviceAccountID, isServiceAccount := middleware.GetServiceAccountIDFromContext(r.Context())
+	if !isUser && !isServiceAccount {
+		writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
+		return
+	}
+
+	orgID, ok := requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	// Validate email format
+	email, err := utils.CanonicalizeEmail(req.Email)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid email format", "INVALID_EMAIL")
+		return
+	}
+	req.Email = email
+
+	// Validate role, defaulting to member
+	if req.Role == "" {
+		req.Role = string(models.RoleMember)
+	}
+	if req.Role != string(models.RoleAdmin) && req.Role != string(models.RoleMember) {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid role. Must be 'admin' or 'member'", "INVALID_ROLE")
+		return
+	}
+
+	// Once the organization verifies domains, only admins overriding the check may invite outsiders
+	if !req.AllowExternalDomain {
+		allowed, err := inviteAllowedByDomains(oh.DB, orgID, req.Email)
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to check verified domains", "DOMAIN_CHECK_ERROR")
+			return
+		}
+		if !allowed {
+			writeErrorResponse(w, http.StatusForbidden, "Email is outside the organization's verified domains; set allow_external_domain to invite it anyway", "EMAIL_DOMAIN_NOT_ALLOWED")
+			return
+		}
+	}
+
+	// Check that the email does not already belong to a member
+	var memberCount int64
+	if err := oh.DB.Model(&models.OrganizationMembership{}).
+		Joins("JOIN users ON users.id = organization_memberships.user_id").
+		Where("organization_memberships.organization_id = ? AND users.normalized_email = ?", orgID, utils.EmailKey(req.Email)).
+		Count(&memberCount).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to check existing membership", "MEMBERSHIP_CHECK_ERROR")
+		return
+	}
+	if memberCount > 0 {
+		writeErrorResponse(w, http.StatusConflict, "User is already a member of this organization", "ALREADY_MEMBER")
+		return
+	}
+
+	// Check that there is no pending invitation for this email, compared the way accounts are told apart
+	var pendingEmails []string
+	if err := oh.DB.Model(&models.Invitation{}).
+		Where("organization_id = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", orgID, time.Now()).
+		Pluck("email", &pendingEmails).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to check existing invitations", "INVITATION_CHECK_ERROR")
+		return
+	}
+	for _, pending := range pendingEmails {
+		if utils.EmailKey(pending) == utils.EmailKey(req.Email) {
+			writeErrorResponse(w, http.StatusConflict, "A pending invitation already exists for this email", "INVITATION_EXISTS")
+			return
+		}
+	}
+
+	// Generate the single-use invitation token
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to generate invitation token", "TOKEN_GENERATION_ERROR")
+		return
+	}
+
+	invitation := models.Invitation{
+		OrganizationID: orgID,
+		Email:          req.Email,
+		Role:           models.Role(req.Role),
+		TokenHash:      utils.HashToken(token),
+		InvitedByID:    userID,
+		ExpiresAt:      time.Now().Add(invitationTTL),
+	}
+	if isServiceAccount {
+		invitation.InvitedByServiceAccountID = &serviceAccountID
+	}
+
+	if err := oh.DB.Create(&invitation).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to create invitation", "INVITATION_CREATION_ERROR")
+		return
+	}
+
+	// Return the invitation including the token, which is never shown again
+	response := toInvitationResponse(invitation)
+	response.Token = token
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListInvitationsHandler handles listing pending invitations of an organization (admin only)
+func (oh *OrganizationHandlers) ListInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, ok := requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var invitations []models.Invitation
+	if err := oh.DB.Where("organization_id = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", orgID, time.Now()).
+		Order("created_at DESC").
+		Find(&invitations).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch invitations", "FETCH_ERROR")
+		return
+	}
+
+	// Convert to response format
+	response := models.ListInvitationsResponse{
+		Invitations: make([]models.InvitationResponse, len(invitations)),
+	}
+	for i, invitation := range invitations {
+		response.Invitations[i] = toInvitationResponse(invitation)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeInvitationHandler handles revoking a pending invitation (admin only)
+func (oh *OrganizationHandlers) RevokeInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, ok := requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	// Extract invitation ID from URL path
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 6 {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid invitation ID", "INVALID_INVITATION_ID")
+		return
+	}
+
+	invitationID, err := strconv.ParseUint(parts[5], 10, 32) // /api/organizations/{id}/invitations/{invitation_id}
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid invitation ID format", "INVALID_INVITATION_ID_FORMAT")
+		return
+	}
+
+	// Find the invitation
+	var invitation models.Invitation
+	if err := oh.DB.Where("id = ? AND organization_id = ?", uint(invitationID), orgID).First(&invitation).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeErrorResponse(w, http.StatusNotFound, "Invitation not found", "INVITATION_NOT_FOUND")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to find invitation", "INVITATION_FETCH_ERROR")
+		}
+		return
+	}
+
+	if !invitation.IsPending(time.Now()) {
+		writeErrorResponse(w, http.StatusConflict, "Invitation is no longer pending", "INVITATION_NOT_PENDING")
+		return
+	}
+
+	// Revoke the invitation
+	now := time.Now()
+	invitation.RevokedAt = &now
+	if err := oh.DB.Save(&invitation).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to revoke invitation", "REVOKE_ERROR")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":       "Invitation revoked successfully",
+		"invitation_id": invitation.ID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AcceptInvitationHandler handles accepting an invitation by the invited user
+func (oh *OrganizationHandlers) AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
+		return
+	}
+
+	var req models.AcceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	if req.Token == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "Invitation token is required", "MISSING_TOKEN")
+		return
+	}
+
+	// Get user from database
+	var user models.User
+	if err := oh.DB.First(&user, userID).Error; err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND")
+		return
+	}
+
+	if !requireVerifiedEmail(w, user) {
+		return
+	}
+
+	// Find the invitation by its token hash
+	var invitation models.Invitation
+	if err := oh.DB.Preload("Organization").Where("token_hash = ?", utils.HashToken(req.Token)).First(&invitation).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeErrorResponse(w, http.StatusNotFound, "Invitation not found", "INVITATION_NOT_FOUND")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to find invitation", "INVITATION_FETCH_ERROR")
+		}
+		return
+	}
+
+	if !invitation.IsPending(time.Now()) {
+		writeErrorResponse(w, http.StatusGone, "Invitation has expired or is no longer valid", "INVITATION_INVALID")
+		return
+	}
+
+	// The invitation is bound to the invited email address
+	if utils.EmailKey(invitation.Email) != utils.EmailKey(user.Email) {
+		writeErrorResponse(w, http.StatusForbidden, "This invitation was sent to a different email address", "INVITATION_EMAIL_MISMATCH")
+		return
+	}
+
+	// Check that the user is not already a member
+	var existing models.OrganizationMembership
+	if err := oh.DB.Where("user_id = ? AND organization_id = ?", userID, invitation.OrganizationID).First(&existing).Error; err == nil {
+		writeErrorResponse(w, http.StatusConflict, "User is already a member of this organization", "ALREADY_MEMBER")
+		return
+	}
+
+	// Start a transaction for consuming the invitation and creating the membership
+	tx := oh.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Mark the invitation as accepted, guarding against concurrent use of the same token
+	now := time.Now()
+	result := tx.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.ID).
+		Updates(map[string]interface{}{"accepted_at": now, "accepted_by_id": userID})
+	if result.Error != nil {
+		tx.Rollback()
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to accept invitation", "ACCEPT_ERROR")
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		writeErrorResponse(w, http.StatusGone, "Invitation has expired or is no longer valid", "INVITATION_INVALID")
+		return
+	}
+
+	membership := models.OrganizationMembership{
+		UserID:         userID,
+		OrganizationID: invitation.OrganizationID,
+		Role:           invitation.Role,
+	}
+
+	if err := tx.Create(&membership).Error; err != nil {
+		tx.Rollback()
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to create organization membership", "MEMBERSHIP_ERROR")
+		return
+	}
+
+	// Commit the transaction
+	if err := tx.Commit().Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to complete invitation acceptance", "COMMIT_ERROR")
+		return
+	}
+
+	// Return the joined organization
+	response := models.OrganizationResponse{
+		ID:             invitation.Organization.ID,
+		Name:           invitation.Organization.Name,
+		BillingDetails: invitation.Organization.BillingDetails,
+		CreatedAt:      invitation.Organization.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:      invitation.Organization.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Role:           string(membership.Role),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// toInvitationResponse converts an invitation to its API representation
+func toInvitationResponse(invitation models.Invitation) models.InvitationResponse {
+	return models.InvitationResponse{
+		ID:                        invitation.ID,
+		OrganizationID:            invitation.OrganizationID,
+		Email:                     invitation.Email,
+		Role:                      string(invitation.Role),
+		InvitedByID:               invitation.InvitedByID,
+		InvitedByServiceAccountID: invitation.InvitedByServiceAccountID,
+		ExpiresAt:                 invitation.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+		CreatedAt:                 invitation.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
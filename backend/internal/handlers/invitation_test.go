@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// setupInvitationTestDB creates an in-memory SQLite database with the invitation schema
+func setupInvitationTestDB() *gorm.DB {
+	db := setupOrgUnitTestDB()
+	db.AutoMigrate(&models.Invitation{}, &models.OrganizationDomain{}, &models.OrganizationJoinRequest{})
+	return db
+}
+
+// withUserContext adds authentication context for the given user to a request
+func withUserContext(req *http.Request, user models.User) *http.Request {
+	ctx := context.WithValue(req.Context(), "user_id", user.ID)
+	ctx = context.WithValue(ctx, "user_email", user.Email)
+	return req.WithContext(ctx)
+}
+
+// createInvitation invites an email through the handler and returns the created invitation
+func createInvitation(t *testing.T, orgHandlers *OrganizationHandlers, admin models.User, orgID uint, email string) models.InvitationResponse {
+	reqBody, _ := json.Marshal(models.CreateInvitationRequest{Email: email, Role: "member"})
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/organizations/%d/invitations", orgID), bytes.NewBuffer(reqBody))
+	req = withUserContext(req, admin)
+	w := httptest.NewRecorder()
+
+	orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.CreateInvitationHandler)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response models.InvitationResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return response
+}
+
+// TestInvitationLifecycle tests creating, listing and accepting an invitation
+func TestInvitationLifecycle(t *testing.T) {
+	db := setupInvitationTestDB()
+	orgHandlers := NewOrganizationHandlers(db)
+
+	admin := createUnitTestUser(db, "admin@example.com")
+	org := models.Organization{Name: "Invite Org"}
+	db.Create(&org)
+	db.Create(&models.OrganizationMembership{UserID: admin.ID, OrganizationID: org.ID, Role: models.RoleAdmin})
+
+	// Invite an email address that has not registered yet
+	invitation := createInvitation(t, orgHandlers, admin, org.ID, "newcomer@example.com")
+	if invitation.Token == "" {
+		t.Fatal("Expected invitation token in creation response")
+	}
+
+	// Only the token hash is stored
+	var stored models.Invitation
+	db.First(&stored, invitation.ID)
+	if stored.TokenHash != utils.HashToken(invitation.Token) {
+		t.Error("Expected stored token hash to match the returned token")
+	}
+
+	// The invitation shows up in the pending list without its token
+	listReq := withUserContext(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/organizations/%d/invitations", org.ID), nil), admin)
+	listW := httptest.NewRecorder()
+	orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.ListInvitationsHandler)).ServeHTTP(listW, listReq)
+
+	var listResponse models.ListInvitationsResponse
+	json.NewDecoder(listW.Body).Decode(&listResponse)
+	if len(listResponse.Invitations) != 1 || listResponse.Invitations[0].Token != "" {
+		t.Fatalf("Expected one pending invitation without token, got %+v", listResponse.Invitations)
+	}
+
+	// The invitee registers later and accepts
+	invitee := createUnitTestUser(db, "newcomer@example.com")
+	acceptBody, _ := json.Marshal(models.AcceptInvitationRequest{Token: invitation.Token})
+	acceptReq := withUserContext(httptest.NewRequest(http.MethodPost, "/api/invitations/accept", bytes.NewBuffer(acceptBody)), invitee)
+	acceptW := httptest.NewRecorder()
+	orgHandlers.AcceptInvitationHandler(acceptW, acceptReq)
+
+	if acceptW.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, acceptW.Code, acceptW.Body.String())
+	}
+
+	var membership models.OrganizationMembership
+	if err := db.Where("user_id = ? AND organization_id = ?", invitee.ID, org.ID).First(&membership).Error; err != nil {
+		t.Fatalf("Membership not created: %v", err)
+	}
+	if membership.Role != models.RoleMember {
+		t.Errorf("Expected role member, got %s", membership.Role)
+	}
+
+	// The token is single-use
+	reuseReq := withUserContext(httptest.NewRequest(http.MethodPost, "/api/invitations/accept", bytes.NewBuffer(acceptBody)), invitee)
+	reuseW := httptest.NewRecorder()
+	orgHandlers.AcceptInvitationHandler(reuseW, reuseReq)
+
+	if reuseW.Code != http.StatusGone {
+		t.Errorf("Expected status %d for reused token, got %d", http.StatusGone, reuseW.Code)
+	}
+}
+
+// TestInvitationAccessControl tests that only admins manage invitations and only the invitee can accept
+func TestInvitationAccessControl(t *testing.T) {
+	db := setupInvitationTestDB()
+	orgHandlers := NewOrganizationHandlers(db)
+
+	admin := createUnitTestUser(db, "admin@example.com")
+	member := createUnitTestUser(db, "member@example.com")
+	other := createUnitTestUser(db, "other@example.com")
+	org := models.Organization{Name: "Guarded Org"}
+	db.Create(&org)
+	db.Create(&models.OrganizationMembership{UserID: admin.ID, OrganizationID: org.ID, Role: models.RoleAdmin})
+	db.Create(&models.OrganizationMembership{UserID: member.ID, OrganizationID: org.ID, Role: models.RoleMember})
+
+	// Members cannot invite
+	reqBody, _ := json.Marshal(models.CreateInvitationRequest{Email: "someone@example.com"})
+	req := withUserContext(httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/organizations/%d/invitations", org.ID), bytes.NewBuffer(reqBody)), member)
+	w := httptest.NewRecorder()
+	orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.CreateInvitationHandler)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Existing members cannot be invited again
+	dupBody, _ := json.Marshal(models.CreateInvitationRequest{Email: member.Email})
+	dupReq := withUserContext(httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/organizations/%d/invitations", org.ID), bytes.NewBuffer(dupBody)), admin)
+	dupW := httptest.NewRecorder()
+	orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.CreateInvitationHandler)).ServeHTTP(dupW, dupReq)
+
+	if dupW.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, dupW.Code)
+	}
+
+	// A different user cannot accept someone else's invitation
+	invitation := createInvitation(t, orgHandlers, admin, org.ID, "invitee@example.com")
+	acceptBody, _ := json.Marshal(models.AcceptInvitationRequest{Token: invitation.Token})
+	acceptReq := withUserContext(httptest.NewRequest(http.MethodPost, "/api/invitations/accept", bytes.NewBuffer(acceptBody)), other)
+	acceptW := httptest.NewRecorder()
+	orgHandlers.AcceptInvitationHandler(acceptW, acceptReq)
+
+	if acceptW.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, acceptW.Code)
+	}
+
+	// Nor can an address with a pending invitation be invited again in another spelling
+	respellBody, _ := json.Marshal(models.CreateInvitationRequest{Email: "Invitee@Example.com"})
+	respellReq := withUserContext(httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/organizations/%d/invitations", org.ID), bytes.NewBuffer(respellBody)), admin)
+	respellW := httptest.NewRecorder()
+	orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.CreateInvitationHandler)).ServeHTTP(respellW, respellReq)
+
+	if respellW.Code != http.StatusConflict || decodeErrorCode(respellW) != "INVITATION_EXISTS" {
+		t.Errorf("Expected 409 INVITATION_EXISTS, got %d", respellW.Code)
+	}
+}
+
+// TestRevokedAndExpiredInvitations tests that revoked and expired invitations cannot be accepted
+func TestRevokedAndExpiredInvitations(t *testing.T) {
+	db := setupInvitationTestDB()
+	orgHandlers := NewOrganizationHandlers(db)
+
+	admin := createUnitTestUser(db, "admin@example.com")
+	invitee := createUnitTestUser(db, "invitee@example.com")
+	org := models.Organization{Name: "Revoking Org"}
+	db.Create(&org)
+	db.Create(&models.OrganizationMembership{UserID: admin.ID, OrganizationID: org.ID, Role: models.RoleAdmin})
+
+	// Revoke a pending invitation
+	invitation := createInvitation(t, orgHandlers, admin, org.ID, invitee.Email)
+	revokeReq := withUserContext(httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/organizations/%d/invitations/%d", org.ID, invitation.ID), nil), admin)
+	revokeW := httptest.NewRecorder()
+	orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.RevokeInvitationHandler)).ServeHTTP(revokeW, revokeReq)
+
+	if revokeW.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, revokeW.Code)
+	}
+
+	acceptBody, _ := json.Marshal(models.AcceptInvitationRequest{Token: invitation.Token})
+	acceptReq := withUserContext(httptest.NewRequest(http.MethodPost, "/api/invitations/accept", bytes.NewBuffer(acceptBody)), invitee)
+	acceptW := httptest.NewRecorder()
+	orgHandlers.AcceptInvitationHandler(acceptW, acceptReq)
+
+	if acceptW.Code != http.StatusGone {
+		t.Errorf("Expected status %d for revoked invitation, got %d", http.StatusGone, acceptW.Code)
+	}
+
+	// An expired invitation cannot be accepted either
+	expired := createInvitation(t, orgHandlers, admin, org.ID, invitee.Email)
+	db.Model(&models.Invitation{}).Where("id = ?", expired.ID).Update("expires_at", time.Now().Add(-time.Hour))
+
+	expiredBody, _ := json.Marshal(models.AcceptInvitationRequest{Token: expired.Token})
+	expiredReq := withUserContext(httptest.NewRequest(http.MethodPost, "/api/invitations/accept", bytes.NewBuffer(expiredBody)), invitee)
+	expiredW := httptest.NewRecorder()
+	orgHandlers.AcceptInvitationHandler(expiredW, expiredReq)
+
+	if expiredW.Code != http.StatusGone {
+		t.Errorf("Expected status %d for expired invitation, got %d", http.StatusGone, expiredW.Code)
+	}
+}
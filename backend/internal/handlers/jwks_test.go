@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tmember/internal/utils"
+)
+
+// TestJWKSHandler tests that the JWKS endpoint publishes the public signing keys
+func TestJWKSHandler(t *testing.T) {
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	key, err := utils.NewJWTKey(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	utils.SetJWTKeySet(&utils.JWTKeySet{Signing: key, Verification: map[string]*utils.JWTKey{key.ID: key}})
+	defer utils.SetJWTKeySet(nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	JWKSHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var jwks utils.JSONWebKeySet
+	if err := json.NewDecoder(w.Body).Decode(&jwks); err != nil {
+		t.Fatalf("Failed to decode JWKS: %v", err)
+	}
+	if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != key.ID || jwks.Keys[0].Curve != "Ed25519" || jwks.Keys[0].X == "" {
+		t.Errorf("Unexpected JWKS: %+v", jwks)
+	}
+}
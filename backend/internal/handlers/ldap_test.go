@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"tmember/internal/ldap"
+	"tmember/internal/ldap/ldaptest"
+	"tmember/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ldapTestBindDN    = "cn=tmember,ou=services,dc=example,dc=com"
+	ldapTestUserDN    = "uid=jane,ou=people,dc=example,dc=com"
+	ldapTestMembersDN = "cn=members,ou=groups,dc=example,dc=com"
+	ldapTestAdminsDN  = "cn=admins,ou=groups,dc=example,dc=com"
+)
+
+// newLDAPTestHandlers starts an LDAP server with a service account and one user, and returns auth handlers
+// that check passwords against it. The directory's groups map to roles in the given organization.
+func newLDAPTestHandlers(t *testing.T, db *gorm.DB, orgID uint) (*AuthHandlers, *ldap.Directory, *ldaptest.Server) {
+	t.Helper()
+	server := ldaptest.NewServer()
+	t.Cleanup(server.Close)
+
+	server.AddEntry(ldapTestBindDN, "service-secret", map[string][]string{"objectClass": {"applicationProcess"}})
+	server.AddEntry(ldapTestUserDN, "JanePass123", map[string][]string{
+		"objectClass": {"person"},
+		"mail":        {"jane@example.com"},
+		"memberOf":    {ldapTestMembersDN},
+	})
+
+	directory := &ldap.Directory{
+		URL:          server.URL,
+		BindDN:       ldapTestBindDN,
+		BindPassword: "service-secret",
+		BaseDN:       "dc=example,dc=com",
+		GroupRoles: []ldap.GroupRole{
+			{GroupDN: ldapTestMembersDN, OrganizationID: orgID, Role: "member"},
+			{GroupDN: ldapTestAdminsDN, OrganizationID: orgID, Role: "admin"},
+		},
+	}
+
+	authHandlers := NewAuthHandlers(db)
+	authHandlers.Authenticator = &LDAPAuthenticator{DB: db, Directory: directory}
+	return authHandlers, directory, server
+}
+
+// setLDAPTestGroups replaces the groups of the directory user
+func setLDAPTestGroups(server *ldaptest.Server, groups ...string) {
+	server.AddEntry(ldapTestUserDN, "JanePass123", map[string][]string{
+		"objectClass": {"person"},
+		"mail":        {"jane@example.com"},
+		"memberOf":    groups,
+	})
+}
+
+// ldapTestRole returns the role of the user in the organization, or "" without a membership
+func ldapTestRole(db *gorm.DB, userID, orgID uint) models.Role {
+	var membership models.OrganizationMembership
+	db.Where("organization_id = ? AND user_id = ?", orgID, userID).Limit(1).Find(&membership)
+	return membership.Role
+}
+
+func TestLDAPLogin_ProvisionsUsersAndSyncsRoles(t *testing.T) {
+	db := setupTestDBForUnit()
+	org, _ := createTestOrgWithAdmin(db, "Directory Org", "owner@example.com")
+	authHandlers, _, server := newLDAPTestHandlers(t, db, org.ID)
+
+	// The first sign-in creates a verified user without a local password
+	w := attemptLogin(authHandlers, "jane@example.com", "JanePass123")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response models.AuthResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Token == "" || response.User.Email != "jane@example.com" || response.User.EmailVerifiedAt == nil {
+		t.Fatalf("Expected a verified provisioned user with tokens, got %+v", response.User)
+	}
+	var user models.User
+	db.First(&user, response.User.ID)
+	if user.PasswordHash != "" {
+		t.Errorf("Expected no local password for a directory user")
+	}
+	if role := ldapTestRole(db, user.ID, org.ID); role != models.RoleMember {
+		t.Errorf("Expected the members group to grant the member role, got %q", role)
+	}
+
+	// Wrong directory passwords count as failed sign-ins
+	if w := attemptLogin(authHandlers, "jane@example.com", "WrongPass123"); w.Code != http.StatusUnauthorized || decodeErrorCode(w) != "INVALID_CREDENTIALS" {
+		t.Errorf("Expected 401 INVALID_CREDENTIALS, got %d", w.Code)
+	}
+
+	// Group changes are applied on the next sign-in
+	setLDAPTestGroups(server, ldapTestMembersDN, ldapTestAdminsDN)
+	if w := attemptLogin(authHandlers, "jane@example.com", "JanePass123"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if role := ldapTestRole(db, user.ID, org.ID); role != models.RoleAdmin {
+		t.Errorf("Expected the admins group to grant the admin role, got %q", role)
+	}
+
+	setLDAPTestGroups(server)
+	if w := attemptLogin(authHandlers, "jane@example.com", "JanePass123"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if role := ldapTestRole(db, user.ID, org.ID); role != "" {
+		t.Errorf("Expected the membership to be removed with the groups, got %q", role)
+	}
+
+	var users int64
+	db.Model(&models.User{}).Count(&users)
+	if users != 2 {
+		t.Errorf("Expected 2 users, got %d", users)
+	}
+}
+
+func TestLDAPLogin_KeepsLastAdmin(t *testing.T) {
+	db := setupTestDBForUnit()
+	org := models.Organization{Name: "Directory Org"}
+	db.Create(&org)
+	authHandlers, _, server := newLDAPTestHandlers(t, db, org.ID)
+
+	setLDAPTestGroups(server, ldapTestAdminsDN)
+	w := attemptLogin(authHandlers, "jane@example.com", "JanePass123")
+	var response models.AuthResponse
+	json.NewDecoder(w.Body).Decode(&response)
+
+	// Leaving the admins group does not leave the organization without an admin
+	setLDAPTestGroups(server, ldapTestMembersDN)
+	if w := attemptLogin(authHandlers, "jane@example.com", "JanePass123"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if role := ldapTestRole(db, response.User.ID, org.ID); role != models.RoleAdmin {
+		t.Errorf("Expected the last admin to keep the admin role, got %q", role)
+	}
+}
+
+func TestLDAPLogin_LocalFallback(t *testing.T) {
+	db := setupTestDBForUnit()
+	local := createUnitTestUser(db, "local@example.com")
+	authHandlers, directory, server := newLDAPTestHandlers(t, db, 1)
+
+	// Accounts outside the directory cannot sign in unless local passwords are allowed as a fallback
+	if w := attemptLogin(authHandlers, local.Email, "TestPassword123"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without the fallback, got %d", http.StatusUnauthorized, w.Code)
+	}
+	directory.LocalFallback = true
+	if w := attemptLogin(authHandlers, local.Email, "TestPassword123"); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d with the fallback, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Directory users never fall back to a local password
+	createUnitTestUser(db, "jane@example.com")
+	if w := attemptLogin(authHandlers, "jane@example.com", "TestPassword123"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a directory user's local password, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// An unreachable directory is reported as a backend failure rather than wrong credentials
+	server.Close()
+	if w := attemptLogin(authHandlers, local.Email, "TestPassword123"); w.Code != http.StatusBadGateway || decodeErrorCode(w) != "AUTHENTICATION_BACKEND_ERROR" {
+		t.Errorf("Expected 502 AUTHENTICATION_BACKEND_ERROR, got %d", w.Code)
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"tmember/internal/config"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// maxLoginDelay caps the progressive delay between failed sign-in attempts
+const maxLoginDelay = time.Minute
+
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce sync.Once
+)
+
+// loginThrottleAccountKey returns the throttle key of the account signing in with the email. It does not
+// depend on whether the account exists, so unknown emails are throttled exactly like real ones.
+func loginThrottleAccountKey(email string) string {
+	return utils.HashToken("account:" + utils.EmailKey(email))
+}
+
+// loginThrottleIPKey returns the throttle key of the client IP address
+func loginThrottleIPKey(ip string) string {
+	return utils.HashToken("ip:" + ip)
+}
+
+// loginDelay returns how long to wait after the given number of failures beyond the delay threshold
+func loginDelay(excessFailures int) time.Duration {
+	if excessFailures >= 16 {
+		return maxLoginDelay
+	}
+	delay := time.Second << excessFailures
+	if delay > maxLoginDelay {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+// checkLoginThrottle returns how long the client must wait before the next sign-in attempt and the error
+// code to report, or zero if the attempt may proceed
+func checkLoginThrottle(db *gorm.DB, email, ip string, now time.Time) (time.Duration, string, error) {
+	settings := config.LoginThrottle()
+	accountKey := loginThrottleAccountKey(email)
+
+	var records []models.LoginThrottle
+	if err := db.Where("key_hash IN ?", []string{accountKey, loginThrottleIPKey(ip)}).Find(&records).Error; err != nil {
+		return 0, "", err
+	}
+
+	for _, record := range records {
+		if record.IsLocked(now) {
+			if record.KeyHash == accountKey {
+				return record.LockedUntil.Sub(now), "ACCOUNT_LOCKED", nil
+			}
+			return record.LockedUntil.Sub(now), "TOO_MANY_ATTEMPTS", nil
+		}
+
+		// Each failure past the threshold doubles the wait before the account can be tried again
+		if record.KeyHash == accountKey && record.Failures >= settings.DelayAfterFailures && now.Sub(record.LastFailureAt) < settings.FailureWindow {
+			retryAt := record.LastFailureAt.Add(loginDelay(record.Failures - settings.DelayAfterFailures))
+			if now.Before(retryAt) {
+				return retryAt.Sub(now), "TOO_MANY_ATTEMPTS", nil
+			}
+		}
+	}
+
+	return 0, "", nil
+}
+
+// recordLoginFailure counts a failed sign-in attempt against the account and the client IP address,
+// locking either out once it reaches its threshold
+func recordLoginFailure(db *gorm.DB, email, ip string, now time.Time) error {
+	settings := config.LoginThrottle()
+
+	limits := []struct {
+		key         string
+		maxFailures int
+	}{
+		{loginThrottleAccountKey(email), settings.MaxAccountFailures},
+		{loginThrottleIPKey(ip), settings.MaxIPFailures},
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, limit := range limits {
+			record := models.LoginThrottle{KeyHash: limit.key}
+			if err := tx.Where("key_hash = ?", limit.key).Limit(1).Find(&record).Error; err != nil {
+				return err
+			}
+
+			// Start counting afresh once earlier failures are stale or a lockout has run out
+			if now.Sub(record.LastFailureAt) > settings.FailureWindow || (record.LockedUntil != nil && !record.IsLocked(now)) {
+				record.Failures = 0
+				record.LockedUntil = nil
+			}
+
+			record.Failures++
+			record.LastFailureAt = now
+			if record.Failures >= limit.maxFailures {
+				lockedUntil := now.Add(settings.LockoutDuration)
+				record.LockedUntil = &lockedUntil
+			}
+
+			if err := tx.Save(&record).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UnlockAccount clears the failed sign-in attempts and any lockout of the account with the email.
+// It reports whether there was anything to clear.
+func UnlockAccount(db *gorm.DB, email string) (bool, error) {
+	result := db.Where("key_hash = ?", loginThrottleAccountKey(email)).Delete(&models.LoginThrottle{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// checkCurrentPassword confirms the password of a signed-in user before a sensitive change. Wrong passwords
+// count against the account and client like failed sign-ins, so a stolen session cannot be used to guess it.
+func checkCurrentPassword(w http.ResponseWriter, r *http.Request, db *gorm.DB, user models.User, password string) bool {
+	now := time.Now()
+	clientIP := utils.ClientIP(r)
+	retryAfter, code, err := checkLoginThrottle(db, user.Email, clientIP, now)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to check sign-in attempts", "THROTTLE_CHECK_ERROR")
+		return false
+	}
+	if retryAfter > 0 {
+		writeLoginThrottledResponse(w, retryAfter, code)
+		return false
+	}
+
+	if utils.CheckPasswordHash(password, user.PasswordHash) {
+		return true
+	}
+	if err := recordLoginFailure(db, user.Email, clientIP, now); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to record sign-in attempt", "THROTTLE_RECORD_ERROR")
+		return false
+	}
+	writeErrorResponse(w, http.StatusUnauthorized, "Invalid password", "INVALID_CREDENTIALS")
+	return false
+}
+
+// writeLoginThrottledResponse rejects a throttled sign-in attempt, telling the client when to retry
+func writeLoginThrottledResponse(w http.ResponseWriter, retryAfter time.Duration, code string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	message := "Too many failed sign-in attempts; please try again later"
+	if code == "ACCOUNT_LOCKED" {
+		message = "This account is temporarily locked after too many failed sign-in attempts"
+	}
+	writeErrorResponse(w, http.StatusTooManyRequests, message, code)
+}
+
+// checkPasswordOfUnknownUser spends the same time as a real password check, so response times do not reveal
+// whether an email is registered
+func checkPasswordOfUnknownUser(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = utils.HashPassword("unknown-user-password")
+	})
+	utils.CheckPasswordHash(password, dummyPasswordHash)
+}
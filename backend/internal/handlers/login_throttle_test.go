@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tmember/internal/models"
+)
+
+// attemptLogin posts a login request and returns the recorder
+func attemptLogin(authHandlers *AuthHandlers, email, password string) *httptest.ResponseRecorder {
+	return postJSON(authHandlers.LoginHandler, "/api/auth/login", models.LoginRequest{Email: email, Password: password})
+}
+
+// skipLoginDelay moves the account's last failure into the past so the progressive delay has elapsed
+func skipLoginDelay(authHandlers *AuthHandlers, email string) {
+	authHandlers.DB.Model(&models.LoginThrottle{}).
+		Where("key_hash = ?", loginThrottleAccountKey(email)).
+		Update("last_failure_at", time.Now().Add(-maxLoginDelay))
+}
+
+func TestLoginThrottle_DelayAndLockout(t *testing.T) {
+	t.Setenv("LOGIN_DELAY_AFTER_FAILURES", "2")
+	t.Setenv("LOGIN_MAX_FAILURES", "4")
+
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	user := createUnitTestUser(db, "locked@example.com")
+
+	for i := 0; i < 2; i++ {
+		if w := attemptLogin(authHandlers, user.Email, "WrongPassword1"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	// Attempts past the threshold must wait
+	w := attemptLogin(authHandlers, user.Email, "TestPassword123")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" || decodeErrorCode(w) != "TOO_MANY_ATTEMPTS" {
+		t.Fatalf("Expected delayed attempt to be refused, got %d (Retry-After %q)", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Reaching the maximum locks the account, even for the correct password
+	for i := 0; i < 2; i++ {
+		skipLoginDelay(authHandlers, user.Email)
+		if w := attemptLogin(authHandlers, user.Email, "WrongPassword1"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	skipLoginDelay(authHandlers, user.Email)
+	w = attemptLogin(authHandlers, user.Email, "TestPassword123")
+	if w.Code != http.StatusTooManyRequests || decodeErrorCode(w) != "ACCOUNT_LOCKED" {
+		t.Fatalf("Expected locked account to be refused, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header on locked account")
+	}
+
+	// Unlocking restores access and a successful login clears the failures
+	if unlocked, err := UnlockAccount(db, user.Email); err != nil || !unlocked {
+		t.Fatalf("Expected account to be unlocked, got %v, %v", unlocked, err)
+	}
+	if w := attemptLogin(authHandlers, user.Email, "TestPassword123"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d after unlock, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+func TestLoginThrottle_UnknownEmailsLookTheSame(t *testing.T) {
+	t.Setenv("LOGIN_DELAY_AFTER_FAILURES", "1")
+	t.Setenv("LOGIN_MAX_FAILURES", "2")
+
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	user := createUnitTestUser(db, "known@example.com")
+
+	// Both emails go through the same sequence of responses
+	sequence := func(email string) []string {
+		var outcomes []string
+		for i := 0; i < 3; i++ {
+			w := attemptLogin(authHandlers, email, "WrongPassword1")
+			outcomes = append(outcomes, decodeErrorCode(w)+" "+w.Header().Get("Retry-After"))
+			if i == 0 {
+				skipLoginDelay(authHandlers, email)
+			}
+		}
+		return outcomes
+	}
+
+	known := sequence(user.Email)
+	unknown := sequence("nobody@example.com")
+	for i := range known {
+		if known[i] != unknown[i] {
+			t.Errorf("Attempt %d differs: known %q, unknown %q", i+1, known[i], unknown[i])
+		}
+	}
+	if known[2] != "ACCOUNT_LOCKED 900" {
+		t.Errorf("Expected lockout on the last attempt, got %q", known[2])
+	}
+}
+
+func TestLoginThrottle_ClientIPLockout(t *testing.T) {
+	t.Setenv("LOGIN_MAX_FAILURES_PER_IP", "3")
+
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	user := createUnitTestUser(db, "target@example.com")
+
+	// Spreading guesses over many accounts still trips the per-IP limit
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if w := attemptLogin(authHandlers, email, "WrongPassword1"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	w := attemptLogin(authHandlers, user.Email, "TestPassword123")
+	if w.Code != http.StatusTooManyRequests || decodeErrorCode(w) != "TOO_MANY_ATTEMPTS" {
+		t.Errorf("Expected client to be locked out, got %d", w.Code)
+	}
+}
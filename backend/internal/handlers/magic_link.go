@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"tmember/internal/config"
+	"tmember/internal/mailer"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// magicLinkTTL is how long an emailed sign-in link remains valid
+const magicLinkTTL = 15 * time.Minute
+
+// MagicLinkHandler emails a single-use sign-in link. The response is identical whether or not the email
+// belongs to an account that may sign in this way, so it cannot be used to discover registered addresses.
+func (ah *AuthHandlers) MagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var req models.MagicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	var user models.User
+	if err := ah.DB.Where("normalized_email = ?", utils.EmailKey(req.Email)).First(&user).Error; err == nil {
+		if allowed, err := magicLinkLoginAllowed(ah.DB, user.ID); err != nil {
+			log.Printf("Failed to check magic link policy of user %d: %v", user.ID, err)
+		} else if allowed {
+			if err := ah.sendMagicLinkEmail(user); err != nil {
+				log.Printf("Failed to send magic link email to user %d: %v", user.ID, err)
+			}
+		}
+	}
+
+	response := map[string]interface{}{
+		"message": "If an account exists for this email, a sign-in link has been sent",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RedeemMagicLinkHandler signs the user in with a token from an emailed sign-in link. Users with a second
+// factor get an MFA challenge, exactly as after a password sign-in.
+func (ah *AuthHandlers) RedeemMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var req models.RedeemMagicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	record, err := findUserToken(ah.DB, req.Token, models.TokenPurposeMagicLink)
+	if err != nil || record.User.ID == 0 {
+		writeMagicLinkTokenError(w, err)
+		return
+	}
+
+	// An organization may have disabled sign-in links after this one was sent
+	allowed, err := magicLinkLoginAllowed(ah.DB, record.UserID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to load security policy", "POLICY_FETCH_ERROR")
+		return
+	}
+	if !allowed {
+		writeErrorResponse(w, http.StatusForbidden, "Sign-in links are disabled by your organization; please sign in with your password", "MAGIC_LINK_DISABLED")
+		return
+	}
+
+	// Following the emailed link proves ownership of the address. Whoever registered an unverified
+	// account never did, so the credentials they set up are discarded as when an identity provider
+	// vouches for the owner.
+	user := record.User
+	newlyVerified := !user.IsEmailVerified()
+	err = ah.DB.Transaction(func(tx *gorm.DB) error {
+		if err := useUserToken(tx, record); err != nil {
+			return err
+		}
+		if newlyVerified {
+			return claimUnverifiedAccount(tx, &user, time.Now())
+		}
+		return releaseProvisionedAccount(tx, user.ID)
+	})
+	if err == errInvalidUserToken {
+		writeMagicLinkTokenError(w, err)
+		return
+	}
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify email", "UPDATE_ERROR")
+		return
+	}
+	if newlyVerified {
+		if err := joinVerifiedDomainOrganizations(ah.DB, user); err != nil {
+			log.Printf("Failed to join verified domain organizations for user %d: %v", user.ID, err)
+		}
+	}
+
+	ah.completeLogin(w, r, user)
+}
+
+// writeMagicLinkTokenError writes the response for a sign-in link token that could not be found or used
+func writeMagicLinkTokenError(w http.ResponseWriter, err error) {
+	if err != nil && err != errInvalidUserToken {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify sign-in link", "TOKEN_CHECK_ERROR")
+	} else {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid or expired sign-in link", "INVALID_MAGIC_LINK")
+	}
+}
+
+// sendMagicLinkEmail issues a sign-in token for the user and emails the sign-in link
+func (ah *AuthHandlers) sendMagicLinkEmail(user models.User) error {
+	token, err := createUserToken(ah.DB, user.ID, models.TokenPurposeMagicLink, magicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/auth/magic-link?token=%s", config.AppBaseURL(), url.QueryEscape(token))
+	return ah.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your TMember sign-in link",
+		Body: fmt.Sprintf("Use this link to sign in to your TMember account:\n\n"+
+			"%s\n\n"+
+			"This link can be used once and expires in %d minutes. If you did not request it, you can ignore this email.\n",
+			link, int(magicLinkTTL.Minutes())),
+	})
+}
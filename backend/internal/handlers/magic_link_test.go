@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tmember/internal/mailer"
+	"tmember/internal/models"
+)
+
+// requestMagicLink requests a sign-in link and returns the token emailed to the address
+func requestMagicLink(t *testing.T, authHandlers *AuthHandlers, outbox *mailer.MemoryMailer, email string) string {
+	t.Helper()
+	w := postJSON(authHandlers.MagicLinkHandler, "/api/auth/magic-link", models.MagicLinkRequest{Email: email})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	msg, ok := outbox.Last()
+	if !ok || msg.To != email {
+		t.Fatalf("Expected a sign-in link for %s, got %+v", email, msg)
+	}
+	return extractTokenFromMail(t, msg)
+}
+
+// redeemMagicLink signs in with an emailed token
+func redeemMagicLink(authHandlers *AuthHandlers, token string) *httptest.ResponseRecorder {
+	return postJSON(authHandlers.RedeemMagicLinkHandler, "/api/auth/magic-link/redeem", models.RedeemMagicLinkRequest{Token: token})
+}
+
+func TestMagicLink_SignsIn(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	user := createUnitTestUser(db, "link@example.com")
+	outbox := mailer.NewMemoryMailer()
+	authHandlers.Mailer = outbox
+
+	// Unknown emails get the same response and no mail
+	known := postJSON(authHandlers.MagicLinkHandler, "/api/auth/magic-link", models.MagicLinkRequest{Email: "link@example.com"})
+	unknown := postJSON(authHandlers.MagicLinkHandler, "/api/auth/magic-link", models.MagicLinkRequest{Email: "unknown@example.com"})
+	if known.Code != http.StatusAccepted || known.Body.String() != unknown.Body.String() {
+		t.Fatalf("Expected identical 202 responses, got %d and %d", known.Code, unknown.Code)
+	}
+	if messages := outbox.Messages(); len(messages) != 1 {
+		t.Fatalf("Expected one sign-in email, got %d", len(messages))
+	}
+
+	// Requesting a new link invalidates the previous one
+	first, _ := outbox.Last()
+	token := requestMagicLink(t, authHandlers, outbox, "link@example.com")
+	if w := redeemMagicLink(authHandlers, extractTokenFromMail(t, first)); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the superseded link to be rejected, got %d", w.Code)
+	}
+
+	w := redeemMagicLink(authHandlers, token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response models.AuthResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Token == "" || response.RefreshToken == "" || response.User.ID != user.ID {
+		t.Errorf("Expected tokens for the user, got %+v", response)
+	}
+	if response.User.EmailVerifiedAt == nil {
+		t.Error("Expected redeeming the link to verify the email")
+	}
+
+	// Links are single-use
+	if w := redeemMagicLink(authHandlers, token); w.Code != http.StatusBadRequest || decodeErrorCode(w) != "INVALID_MAGIC_LINK" {
+		t.Errorf("Expected 400 INVALID_MAGIC_LINK on reuse, got %d", w.Code)
+	}
+
+	// Expired links are rejected
+	token = requestMagicLink(t, authHandlers, outbox, "link@example.com")
+	db.Model(&models.UserToken{}).Where("purpose = ? AND used_at IS NULL", models.TokenPurposeMagicLink).Update("expires_at", time.Now().Add(-time.Minute))
+	if w := redeemMagicLink(authHandlers, token); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an expired link to be rejected, got %d", w.Code)
+	}
+
+	// Tokens of other purposes cannot be redeemed as sign-in links
+	postJSON(authHandlers.ForgotPasswordHandler, "/api/auth/password/forgot", models.ForgotPasswordRequest{Email: "link@example.com"})
+	msg, _ := outbox.Last()
+	if w := redeemMagicLink(authHandlers, extractTokenFromMail(t, msg)); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a password reset token to be rejected, got %d", w.Code)
+	}
+}
+
+func TestMagicLink_RequiresSecondFactor(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	user := createUnitTestUser(db, "mfa@example.com")
+	db.Model(&user).Updates(map[string]interface{}{"email_verified_at": time.Now(), "mfa_enabled_at": time.Now()})
+	outbox := mailer.NewMemoryMailer()
+	authHandlers.Mailer = outbox
+
+	w := redeemMagicLink(authHandlers, requestMagicLink(t, authHandlers, outbox, "mfa@example.com"))
+	var challenge models.MFAChallengeResponse
+	json.NewDecoder(w.Body).Decode(&challenge)
+	if w.Code != http.StatusOK || !challenge.MFARequired || challenge.MFAToken == "" {
+		t.Errorf("Expected an MFA challenge, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMagicLink_ClaimsUnverifiedAccount(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	outbox := mailer.NewMemoryMailer()
+	authHandlers.Mailer = outbox
+
+	// Someone registers the address and sets up a second factor without ever proving they own it
+	registered := registerForTest(t, authHandlers, "claimed@example.com", "ValidPass123")
+	db.Model(&models.User{}).Where("id = ?", registered.User.ID).Update("mfa_enabled_at", time.Now())
+
+	w := redeemMagicLink(authHandlers, requestMagicLink(t, authHandlers, outbox, "claimed@example.com"))
+	var response models.AuthResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusOK || response.Token == "" {
+		t.Fatalf("Expected the owner to be signed in without a challenge, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := attemptLogin(authHandlers, "claimed@example.com", "ValidPass123"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the registrant's password to be cleared, got %d", w.Code)
+	}
+	if refresh := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", registered.RefreshToken); refresh.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the registrant's sessions to be revoked, got %d", refresh.Code)
+	}
+	if refresh := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", response.RefreshToken); refresh.Code != http.StatusOK {
+		t.Errorf("Expected the owner's session to be valid, got %d", refresh.Code)
+	}
+}
+
+func TestMagicLink_DisabledByPolicy(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	orgHandlers := NewOrganizationHandlers(db)
+	org, admin := createTestOrgWithAdmin(db, "Strict Org", "admin@example.com")
+	outbox := mailer.NewMemoryMailer()
+	authHandlers.Mailer = outbox
+
+	// A link sent before the policy changed can no longer be redeemed
+	token := requestMagicLink(t, authHandlers, outbox, "admin@example.com")
+
+	disable := true
+	w := serveOrgRequest(orgHandlers, orgHandlers.UpdateSecurityPolicyHandler, admin, http.MethodPut,
+		fmt.Sprintf("/api/organizations/%d/security-policy", org.ID), models.UpdateSecurityPolicyRequest{DisableMagicLinkLogin: &disable})
+	var policy models.SecurityPolicyResponse
+	json.NewDecoder(w.Body).Decode(&policy)
+	if w.Code != http.StatusOK || !policy.DisableMagicLinkLogin {
+		t.Fatalf("Expected the policy to disable sign-in links, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := redeemMagicLink(authHandlers, token); w.Code != http.StatusForbidden || decodeErrorCode(w) != "MAGIC_LINK_DISABLED" {
+		t.Errorf("Expected 403 MAGIC_LINK_DISABLED, got %d", w.Code)
+	}
+
+	// Members are sent no links, with the same response as everyone else
+	sent := len(outbox.Messages())
+	if w := postJSON(authHandlers.MagicLinkHandler, "/api/auth/magic-link", models.MagicLinkRequest{Email: "admin@example.com"}); w.Code != http.StatusAccepted {
+		t.Errorf("Expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+	if len(outbox.Messages()) != sent {
+		t.Error("Expected no sign-in link for a member of an organization that disabled them")
+	}
+
+	// Users outside the organization are unaffected
+	createUnitTestUser(db, "other@example.com")
+	token = requestMagicLink(t, authHandlers, outbox, "other@example.com")
+	if w := redeemMagicLink(authHandlers, token); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"tmember/internal/config"
+	"tmember/internal/middleware"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// mfaChallengeTTL is how long a login may wait between the password and the second factor
+	mfaChallengeTTL = 5 * time.Minute
+	// maxMFAChallengeAttempts is the number of wrong codes after which a challenge is discarded
+	maxMFAChallengeAttempts = 5
+	// recoveryCodeCount is the number of recovery codes generated at a time
+	recoveryCodeCount = 10
+)
+
+var (
+	// errInvalidMFACode is returned when a TOTP or recovery code does not match or was already used
+	errInvalidMFACode = errors.New("invalid MFA code")
+	// errInvalidMFAChallenge is returned when an MFA challenge token is unknown, used, expired or exhausted
+	errInvalidMFAChallenge = errors.New("invalid MFA challenge")
+)
+
+// createMFAChallenge stores a new login challenge for the user and returns its token
+func createMFAChallenge(db *gorm.DB, userID uint) (string, error) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := models.MFAChallenge{
+		UserID:    userID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	}
+	if err := db.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// verifySecondFactor checks a TOTP code, or a recovery code, for a user with a second factor. TOTP codes
+// are only accepted once TOTP is enabled. Accepted TOTP steps and recovery codes cannot be used again.
+func verifySecondFactor(db *gorm.DB, user *models.User, code string) error {
+	if step, ok := utils.ValidateTOTPCode(user.TOTPSecret, code, time.Now()); ok && user.IsMFAEnabled() {
+		// Only accept steps newer than the last one, guarding against concurrent use of the same code
+		result := db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidMFACode
+		}
+		user.TOTPLastStep = step
+		return nil
+	}
+
+	result := db.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(utils.NormalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidMFACode
+	}
+	return nil
+}
+
+// removeSecondFactors discards the user's authenticator app, recovery codes and passkeys
+func removeSecondFactors(tx *gorm.DB, user *models.User) error {
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"totp_secret":    "",
+		"mfa_enabled_at": nil,
+	}).Error; err != nil {
+		return err
+	}
+	for _, record := range []interface{}{&models.MFARecoveryCode{}, &models.WebAuthnCredential{}, &models.WebAuthnChallenge{}} {
+		if err := tx.Where("user_id = ?", user.ID).Delete(record).Error; err != nil {
+			return err
+		}
+	}
+	user.MFAEnabledAt, user.TOTPSecret = nil, ""
+	return nil
+}
+
+// replaceRecoveryCodes discards the user's recovery codes and returns a fresh set
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	records := make([]models.MFARecoveryCode, len(codes))
+	for i, code := range codes {
+		records[i] = models.MFARecoveryCode{UserID: userID, CodeHash: utils.HashToken(code)}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// loadCurrentUser loads the authenticated user, writing an error response if that fails
+func loadCurrentUser(w http.ResponseWriter, r *http.Request, db *gorm.DB) (*models.User, bool) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
+		return nil, false
+	}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND")
+		return nil, false
+	}
+
+	return &user, true
+}
+
+// reauthenticate checks the password and second factor of a user with MFA enabled before a sensitive change
+func reauthenticate(w http.ResponseWriter, r *http.Request, db *gorm.DB, user *models.User) bool {
+	var req models.MFAReauthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return false
+	}
+
+	if !user.IsMFAEnabled() {
+		writeErrorResponse(w, http.StatusConflict, "Two-factor authentication is not enabled", "MFA_NOT_ENABLED")
+		return false
+	}
+
+	if !utils.CheckPasswordHash(req.Password, user.PasswordHash) {
+		writeErrorResponse(w, http.StatusUnauthorized, "Invalid password", "INVALID_CREDENTIALS")
+		return false
+	}
+
+	if err := verifySecondFactor(db, user, req.Code); err != nil {
+		if err == errInvalidMFACode {
+			writeErrorResponse(w, http.StatusUnauthorized, "Invalid authentication code", "INVALID_MFA_CODE")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify authentication code", "MFA_CHECK_ERROR")
+		}
+		return false
+	}
+
+	return true
+}
+
+// loadMFAChallenge returns the pending login challenge for a token, with its user
+func loadMFAChallenge(db *gorm.DB, token string) (*models.MFAChallenge, error) {
+	var challenge models.MFAChallenge
+	if err := db.Preload("User").Where("token_hash = ?", utils.HashToken(token)).First(&challenge).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidMFAChallenge
+		}
+		return nil, err
+	}
+
+	if challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= maxMFAChallengeAttempts {
+		return nil, errInvalidMFAChallenge
+	}
+	if enrolled, err := hasSecondFactor(db, challenge.User); err != nil {
+		return nil, err
+	} else if !enrolled {
+		return nil, errInvalidMFAChallenge
+	}
+
+	return &challenge, nil
+}
+
+// writeMFAChallengeError writes the response for an MFA challenge token that could not be loaded
+func writeMFAChallengeError(w http.ResponseWriter, err error) {
+	if err == errInvalidMFAChallenge {
+		writeErrorResponse(w, http.StatusUnauthorized, "Invalid or expired MFA token", "INVALID_MFA_TOKEN")
+	} else {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify MFA token", "MFA_CHECK_ERROR")
+	}
+}
+
+// MFAVerifyHandler completes a two-step login by exchanging an MFA challenge token and a code or WebAuthn
+// credential for tokens
+func (ah *AuthHandlers) MFAVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var req models.MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	challenge, err := loadMFAChallenge(ah.DB, req.MFAToken)
+	if err != nil {
+		writeMFAChallengeError(w, err)
+		return
+	}
+
+	// Refuse attempts while the account or client is throttled, before looking at the code
+	user := challenge.User
+	now := time.Now()
+	clientIP := utils.ClientIP(r)
+	retryAfter, code, err := checkLoginThrottle(ah.DB, user.Email, clientIP, now)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to check sign-in attempts", "THROTTLE_CHECK_ERROR")
+		return
+	}
+	if retryAfter > 0 {
+		writeLoginThrottledResponse(w, retryAfter, code)
+		return
+	}
+
+	// Check the WebAuthn credential or the TOTP or recovery code
+	if req.Credential != nil {
+		if _, err = verifyWebAuthnAssertion(ah.DB, ah.relyingParty(), user.ID, models.WebAuthnCeremonyMFA, *req.Credential, false); err == errInvalidWebAuthnAssertion {
+			err = errInvalidMFACode
+		}
+	} else {
+		err = verifySecondFactor(ah.DB, &user, req.Code)
+	}
+	if err != nil {
+		if err != errInvalidMFACode {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify authentication code", "MFA_CHECK_ERROR")
+			return
+		}
+		ah.DB.Model(&models.MFAChallenge{}).Where("id = ?", challenge.ID).UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+
+		// Wrong codes also count against the account, so starting new challenges does not reset the count
+		if err := recordLoginFailure(ah.DB, user.Email, clientIP, now); err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to record sign-in attempt", "THROTTLE_RECORD_ERROR")
+			return
+		}
+		writeErrorResponse(w, http.StatusUnauthorized, "Invalid authentication code", "INVALID_MFA_CODE")
+		return
+	}
+
+	// Consume the challenge, guarding against a concurrent verification of the same token
+	result := ah.DB.Model(&models.MFAChallenge{}).
+		Where("id = ? AND used_at IS NULL", challenge.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify MFA token", "MFA_CHECK_ERROR")
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeErrorResponse(w, http.StatusUnauthorized, "Invalid or expired MFA token", "INVALID_MFA_TOKEN")
+		return
+	}
+
+	// A completed sign-in clears the account's failed attempts
+	if _, err := UnlockAccount(ah.DB, user.Email); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to reset sign-in attempts", "THROTTLE_RECORD_ERROR")
+		return
+	}
+
+	response, err := startSession(ah.DB, user, r, true)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to generate token", "TOKEN_GENERATION_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// TOTPSetupHandler generates a new pending TOTP secret for the current user
+func (ah *AuthHandlers) TOTPSetupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r, ah.DB)
+	if !ok {
+		return
+	}
+
+	if user.IsMFAEnabled() {
+		writeErrorResponse(w, http.StatusConflict, "Two-factor authentication is already enabled", "MFA_ALREADY_ENABLED")
+		return
+	}
+	if _, ok := requireSecondFactorStepUp(w, r, ah.DB, *user, "set up an authenticator app"); !ok {
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to generate secret", "MFA_SETUP_ERROR")
+		return
+	}
+
+	if err := ah.DB.Model(user).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to save secret", "MFA_SETUP_ERROR")
+		return
+	}
+
+	response := models.TOTPSetupResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPProvisioningURI(config.MFAIssuer(), user.Email, secret),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// TOTPConfirmHandler enables TOTP after the user proves their authenticator works, returning recovery codes
+func (ah *AuthHandlers) TOTPConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r, ah.DB)
+	if !ok {
+		return
+	}
+
+	var req models.TOTPConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	if user.IsMFAEnabled() {
+		writeErrorResponse(w, http.StatusConflict, "Two-factor authentication is already enabled", "MFA_ALREADY_ENABLED")
+		return
+	}
+	if _, ok := requireSecondFactorStepUp(w, r, ah.DB, *user, "set up an authenticator app"); !ok {
+		return
+	}
+	if user.TOTPSecret == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "Start TOTP setup first", "MFA_SETUP_REQUIRED")
+		return
+	}
+
+	step, valid := utils.ValidateTOTPCode(user.TOTPSecret, req.Code, time.Now())
+	if !valid {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid authentication code", "INVALID_MFA_CODE")
+		return
+	}
+
+	sessionID, _ := middleware.GetSessionIDFromContext(r.Context())
+
+	var codes []string
+	err := ah.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"mfa_enabled_at": time.Now(),
+			"totp_last_step": step,
+		}).Error; err != nil {
+			return err
+		}
+
+		// The current session has just presented a second factor
+		if err := tx.Model(&models.Session{}).Where("id = ?", sessionID).Update("mfa", true).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to enable two-factor authentication", "MFA_SETUP_ERROR")
+		return
+	}
+	recordAuditEvent(ah.DB, r, user.ID, models.AuditActionMFAEnabled)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableMFAHandler turns off two-factor authentication after re-authenticating the user
+func (ah *AuthHandlers) DisableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r, ah.DB)
+	if !ok || !reauthenticate(w, r, ah.DB, user) {
+		return
+	}
+
+	err := ah.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"mfa_enabled_at": nil,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Recovery codes stay while WebAuthn credentials remain a second factor
+		var credentials int64
+		if err := tx.Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&credentials).Error; err != nil || credentials > 0 {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.MFARecoveryCode{}).Error
+	})
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to disable two-factor authentication", "UPDATE_ERROR")
+		return
+	}
+	recordAuditEvent(ah.DB, r, user.ID, models.AuditActionMFADisabled)
+
+	response := map[string]interface{}{
+		"message": "Two-factor authentication disabled",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RegenerateRecoveryCodesHandler replaces the user's recovery codes after re-authenticating them
+func (ah *AuthHandlers) RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r, ah.DB)
+	if !ok || !reauthenticate(w, r, ah.DB, user) {
+		return
+	}
+
+	var codes []string
+	err := ah.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to generate recovery codes", "RECOVERY_CODES_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tmember/internal/models"
+	"tmember/internal/utils"
+)
+
+// enrollTOTPForTest enables TOTP for the user behind the access token and returns the secret and recovery codes
+func enrollTOTPForTest(t *testing.T, authHandlers *AuthHandlers, accessToken string) (string, []string) {
+	setupReq := withSessionContext(t, httptest.NewRequest(http.MethodPost, "/api/users/me/mfa/totp/setup", nil), accessToken)
+	setupW := httptest.NewRecorder()
+	authHandlers.TOTPSetupHandler(setupW, setupReq)
+
+	if setupW.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, setupW.Code, setupW.Body.String())
+	}
+
+	var setup models.TOTPSetupResponse
+	json.NewDecoder(setupW.Body).Decode(&setup)
+
+	code, _ := utils.GenerateTOTPCode(setup.Secret, utils.TOTPStep(time.Now()))
+	confirmBody, _ := json.Marshal(models.TOTPConfirmRequest{Code: code})
+	confirmReq := withSessionContext(t, httptest.NewRequest(http.MethodPost, "/api/users/me/mfa/totp/confirm", bytes.NewBuffer(confirmBody)), accessToken)
+	confirmW := httptest.NewRecorder()
+	authHandlers.TOTPConfirmHandler(confirmW, confirmReq)
+
+	if confirmW.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, confirmW.Code, confirmW.Body.String())
+	}
+
+	var recovery models.RecoveryCodesResponse
+	json.NewDecoder(confirmW.Body).Decode(&recovery)
+	return setup.Secret, recovery.RecoveryCodes
+}
+
+// startMFALogin logs in with a password and returns the MFA challenge token
+func startMFALogin(t *testing.T, authHandlers *AuthHandlers, email, password string) string {
+	w := postJSON(authHandlers.LoginHandler, "/api/auth/login", models.LoginRequest{Email: email, Password: password})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var challenge models.MFAChallengeResponse
+	json.NewDecoder(w.Body).Decode(&challenge)
+	if !challenge.MFARequired || challenge.MFAToken == "" {
+		t.Fatalf("Expected an MFA challenge, got %s", w.Body.String())
+	}
+	return challenge.MFAToken
+}
+
+func TestTOTPEnrollmentAndLogin(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	auth := registerForTest(t, authHandlers, "mfa@example.com", "ValidPass123")
+	secret, recoveryCodes := enrollTOTPForTest(t, authHandlers, auth.Token)
+
+	if len(recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes, got %d", recoveryCodeCount, len(recoveryCodes))
+	}
+
+	// Only hashes of the recovery codes are stored
+	var stored int64
+	db.Model(&models.MFARecoveryCode{}).Where("code_hash = ?", utils.HashToken(recoveryCodes[0])).Count(&stored)
+	if stored != 1 {
+		t.Error("Expected recovery code hash to be stored")
+	}
+
+	// The enrolling session counts as MFA-authenticated
+	claims, _ := utils.ValidateJWT(auth.Token)
+	var session models.Session
+	db.First(&session, claims.SessionID)
+	if !session.MFA {
+		t.Error("Expected enrolling session to be marked as MFA-authenticated")
+	}
+
+	// The password alone no longer yields tokens
+	mfaToken := startMFALogin(t, authHandlers, "mfa@example.com", "ValidPass123")
+
+	// The code used for enrollment cannot be replayed
+	var user models.User
+	db.First(&user, auth.User.ID)
+	usedCode, _ := utils.GenerateTOTPCode(secret, user.TOTPLastStep)
+	if w := postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: usedCode}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected replayed code to be rejected, got %d", w.Code)
+	}
+
+	nextCode, _ := utils.GenerateTOTPCode(secret, user.TOTPLastStep+1)
+	w := postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: nextCode})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response models.AuthResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Token == "" || response.RefreshToken == "" {
+		t.Fatal("Expected tokens after completing MFA")
+	}
+
+	// The challenge is single-use
+	if reuse := postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: nextCode}); reuse.Code != http.StatusUnauthorized {
+		t.Errorf("Expected used challenge to be rejected, got %d", reuse.Code)
+	}
+}
+
+func TestMFAVerifyHandler_RecoveryCodesAndAttemptLimit(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	auth := registerForTest(t, authHandlers, "recovery@example.com", "ValidPass123")
+	_, recoveryCodes := enrollTOTPForTest(t, authHandlers, auth.Token)
+
+	// A recovery code completes the login once
+	mfaToken := startMFALogin(t, authHandlers, "recovery@example.com", "ValidPass123")
+	if w := postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: recoveryCodes[0]}); w.Code != http.StatusOK {
+		t.Fatalf("Expected recovery code to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+
+	mfaToken = startMFALogin(t, authHandlers, "recovery@example.com", "ValidPass123")
+	if w := postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: recoveryCodes[0]}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected used recovery code to be rejected, got %d", w.Code)
+	}
+
+	// Too many wrong codes exhaust the challenge, even for a correct code afterwards
+	for i := 1; i < maxMFAChallengeAttempts; i++ {
+		skipLoginDelay(authHandlers, "recovery@example.com")
+		postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: "000000"})
+	}
+	skipLoginDelay(authHandlers, "recovery@example.com")
+	w := postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: recoveryCodes[1]})
+
+	var errorResponse models.ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errorResponse)
+	if w.Code != http.StatusUnauthorized || errorResponse.Code != "INVALID_MFA_TOKEN" {
+		t.Errorf("Expected exhausted challenge to be rejected, got %d %s", w.Code, errorResponse.Code)
+	}
+}
+
+func TestMFAVerifyHandler_WrongCodesLockAccount(t *testing.T) {
+	t.Setenv("LOGIN_DELAY_AFTER_FAILURES", "10")
+	t.Setenv("LOGIN_MAX_FAILURES", "4")
+
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	auth := registerForTest(t, authHandlers, "guess@example.com", "ValidPass123")
+	_, recoveryCodes := enrollTOTPForTest(t, authHandlers, auth.Token)
+
+	// Signing in with the password again does not reset the count of wrong codes
+	var mfaToken string
+	for i := 0; i < 2; i++ {
+		mfaToken = startMFALogin(t, authHandlers, "guess@example.com", "ValidPass123")
+		for j := 0; j < 2; j++ {
+			if w := postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: "000000"}); w.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+			}
+		}
+	}
+
+	// The locked account can neither complete its open challenge nor start a new one
+	w := postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: recoveryCodes[0]})
+	if w.Code != http.StatusTooManyRequests || decodeErrorCode(w) != "ACCOUNT_LOCKED" {
+		t.Errorf("Expected the challenge of a locked account to be refused, got %d", w.Code)
+	}
+	if w := attemptLogin(authHandlers, "guess@example.com", "ValidPass123"); w.Code != http.StatusTooManyRequests || decodeErrorCode(w) != "ACCOUNT_LOCKED" {
+		t.Errorf("Expected the password of a locked account to be refused, got %d", w.Code)
+	}
+
+	// Once unlocked, a correct code signs the user in
+	if _, err := UnlockAccount(db, "guess@example.com"); err != nil {
+		t.Fatalf("Failed to unlock account: %v", err)
+	}
+	mfaToken = startMFALogin(t, authHandlers, "guess@example.com", "ValidPass123")
+	if w := postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: recoveryCodes[0]}); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d after unlock, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+func TestDisableMFAAndRegenerateRecoveryCodes(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	auth := registerForTest(t, authHandlers, "disable@example.com", "ValidPass123")
+	_, recoveryCodes := enrollTOTPForTest(t, authHandlers, auth.Token)
+
+	post := func(handler http.HandlerFunc, path string, body models.MFAReauthRequest) *httptest.ResponseRecorder {
+		reqBody, _ := json.Marshal(body)
+		req := withSessionContext(t, httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(reqBody)), auth.Token)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	// Re-authentication requires the password
+	if w := post(authHandlers.RegenerateRecoveryCodesHandler, "/api/users/me/mfa/recovery-codes", models.MFAReauthRequest{Password: "WrongPass123", Code: recoveryCodes[0]}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected wrong password to be rejected, got %d", w.Code)
+	}
+
+	w := post(authHandlers.RegenerateRecoveryCodesHandler, "/api/users/me/mfa/recovery-codes", models.MFAReauthRequest{Password: "ValidPass123", Code: recoveryCodes[0]})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var regenerated models.RecoveryCodesResponse
+	json.NewDecoder(w.Body).Decode(&regenerated)
+
+	// Old codes stop working once regenerated
+	if w := post(authHandlers.DisableMFAHandler, "/api/users/me/mfa/disable", models.MFAReauthRequest{Password: "ValidPass123", Code: recoveryCodes[1]}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected old recovery code to be rejected, got %d", w.Code)
+	}
+
+	if w := post(authHandlers.DisableMFAHandler, "/api/users/me/mfa/disable", models.MFAReauthRequest{Password: "ValidPass123", Code: regenerated.RecoveryCodes[0]}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Login is single-factor again
+	login := postJSON(authHandlers.LoginHandler, "/api/auth/login", models.LoginRequest{Email: "disable@example.com", Password: "ValidPass123"})
+	var response models.AuthResponse
+	json.NewDecoder(login.Body).Decode(&response)
+	if login.Code != http.StatusOK || response.Token == "" {
+		t.Errorf("Expected tokens from password login after disabling MFA, got %d", login.Code)
+	}
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"tmember/internal/models"
+	"tmember/internal/oidc"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// oidcLoginTTL is how long a user has to complete a sign-in at an external identity provider
+const oidcLoginTTL = 10 * time.Minute
+
+var (
+	// errInvalidOIDCState is returned when a sign-in state is unknown, used or expired
+	errInvalidOIDCState = errors.New("invalid OIDC state")
+	// errOIDCEmailNotVerified is returned when the identity provider does not vouch for the user's email
+	errOIDCEmailNotVerified = errors.New("identity provider did not verify the email address")
+	// errOIDCAccountNotFound is returned for unknown users of providers that do not provision accounts
+	errOIDCAccountNotFound = errors.New("no account for this identity")
+)
+
+// ListOIDCProvidersHandler returns the external identity providers users can sign in with
+func (ah *AuthHandlers) ListOIDCProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	response := []models.OIDCProviderResponse{}
+	for _, provider := range ah.OIDCProviders {
+		response = append(response, models.OIDCProviderResponse{Name: provider.Name, DisplayName: provider.DisplayName})
+	}
+	sort.Slice(response, func(i, j int) bool { return response[i].Name < response[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// OIDCAuthorizeHandler starts a sign-in with an external identity provider and returns the provider URL
+// to send the browser to
+func (ah *AuthHandlers) OIDCAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	// Extract the provider name from the URL path: /api/auth/oidc/{provider}/authorize
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) != 6 || parts[5] != "authorize" {
+		writeErrorResponse(w, http.StatusNotFound, "Not found", "NOT_FOUND")
+		return
+	}
+
+	provider, ok := ah.OIDCProviders[parts[4]]
+	if !ok {
+		writeErrorResponse(w, http.StatusNotFound, "Identity provider not found", "OIDC_PROVIDER_NOT_FOUND")
+		return
+	}
+
+	state, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to start sign-in", "OIDC_STATE_ERROR")
+		return
+	}
+	nonce, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to start sign-in", "OIDC_STATE_ERROR")
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to start sign-in", "OIDC_STATE_ERROR")
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		log.Printf("Failed to start sign-in with %s: %v", provider.Name, err)
+		writeErrorResponse(w, http.StatusBadGateway, "Identity provider is unavailable", "OIDC_PROVIDER_ERROR")
+		return
+	}
+
+	loginState := models.OIDCLoginState{
+		StateHash:    utils.HashToken(state),
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+	}
+	if err := ah.DB.Create(&loginState).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to start sign-in", "OIDC_STATE_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.OIDCAuthorizeResponse{
+		AuthorizationURL: authURL,
+		ExpiresIn:        int(oidcLoginTTL.Seconds()),
+	})
+}
+
+// OIDCCallbackHandler completes a sign-in with the code and state the identity provider redirected back
+// with. Like LoginHandler, it returns tokens or an MFA challenge.
+func (ah *AuthHandlers) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var req models.OIDCCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	loginState, err := consumeOIDCLoginState(ah.DB, req.State)
+	if err != nil {
+		if err == errInvalidOIDCState {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid or expired sign-in; please try again", "INVALID_OIDC_STATE")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify sign-in", "OIDC_STATE_ERROR")
+		}
+		return
+	}
+
+	provider, ok := ah.OIDCProviders[loginState.Provider]
+	if !ok {
+		writeErrorResponse(w, http.StatusBadRequest, "Identity provider not found", "OIDC_PROVIDER_NOT_FOUND")
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), req.Code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("Failed to complete sign-in with %s: %v", provider.Name, err)
+		if errors.Is(err, oidc.ErrInvalidIDToken) {
+			writeErrorResponse(w, http.StatusUnauthorized, "Identity provider returned an invalid ID token", "INVALID_ID_TOKEN")
+		} else {
+			writeErrorResponse(w, http.StatusBadGateway, "Failed to complete sign-in with the identity provider", "OIDC_PROVIDER_ERROR")
+		}
+		return
+	}
+
+	user, err := resolveOIDCUser(ah.DB, provider, claims)
+	if err != nil {
+		switch err {
+		case errOIDCEmailNotVerified:
+			writeErrorResponse(w, http.StatusForbidden, "The identity provider has not verified your email address", "OIDC_EMAIL_NOT_VERIFIED")
+		case errOIDCAccountNotFound:
+			writeErrorResponse(w, http.StatusForbidden, "No account exists for this email; please sign up first", "OIDC_ACCOUNT_NOT_FOUND")
+		default:
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to sign in", "OIDC_USER_ERROR")
+		}
+		return
+	}
+
+	ah.completeLogin(w, r, *user)
+}
+
+// consumeOIDCLoginState validates a sign-in state and marks it as used, so each redirect completes at most one login
+func consumeOIDCLoginState(db *gorm.DB, state string) (*models.OIDCLoginState, error) {
+	if state == "" {
+		return nil, errInvalidOIDCState
+	}
+
+	var loginState models.OIDCLoginState
+	if err := db.Where("state_hash = ?", utils.HashToken(state)).First(&loginState).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidOIDCState
+		}
+		return nil, err
+	}
+
+	if loginState.UsedAt != nil || time.Now().After(loginState.ExpiresAt) {
+		return nil, errInvalidOIDCState
+	}
+
+	// Mark the state as used, guarding against concurrent use of the same state
+	result := db.Model(&models.OIDCLoginState{}).
+		Where("id = ? AND used_at IS NULL", loginState.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errInvalidOIDCState
+	}
+
+	return &loginState, nil
+}
+
+// resolveOIDCUser finds the user behind a verified identity. Identities seen before map to their linked
+// user; new identities are linked to the user with the same verified email, or provisioned as a new user
+// if the provider allows it.
+func resolveOIDCUser(db *gorm.DB, provider *oidc.Provider, claims *oidc.IDTokenClaims) (*models.User, error) {
+	now := time.Now()
+
+	var identity models.UserIdentity
+	err := db.Preload("User").Where("provider = ? AND subject = ?", provider.Name, claims.Subject).Limit(1).Find(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	if identity.ID != 0 && identity.User.ID != 0 {
+		if err := db.Model(&identity).Updates(map[string]interface{}{"email": claims.Email, "last_login_at": now}).Error; err != nil {
+			return nil, err
+		}
+		return &identity.User, nil
+	}
+
+	// Linking by email is only safe when the provider vouches for the address
+	if claims.Email == "" || !claims.EmailVerified || !utils.ValidateEmail(claims.Email) {
+		return nil, errOIDCEmailNotVerified
+	}
+
+	var user models.User
+	newlyVerified := false
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// The identity's user was deleted; the identity may be linked again
+		if identity.ID != 0 {
+			if err := tx.Delete(&models.UserIdentity{}, identity.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("normalized_email = ?", utils.EmailKey(claims.Email)).Limit(1).Find(&user).Error; err != nil {
+			return err
+		}
+
+		switch {
+		case user.ID == 0 && !provider.AutoProvision:
+			return errOIDCAccountNotFound
+		case user.ID == 0:
+			// Provisioned users have no password until they reset one
+			user = models.User{Email: claims.Email, EmailVerifiedAt: &now}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			newlyVerified = true
+		case !user.IsEmailVerified():
+			if err := claimUnverifiedAccount(tx, &user, now); err != nil {
+				return err
+			}
+			newlyVerified = true
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    provider.Name,
+			Subject:     claims.Subject,
+			Email:       claims.Email,
+			LastLoginAt: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if newlyVerified {
+		if err := joinVerifiedDomainOrganizations(db, user); err != nil {
+			log.Printf("Failed to join verified domain organizations for user %d: %v", user.ID, err)
+		}
+	}
+
+	return &user, nil
+}
+
+// claimUnverifiedAccount hands an unverified account to the owner of its email address, whom an identity
+// provider or directory vouched for. Whoever registered the account never proved they own the address,
+// so the credentials they set up must not survive the real owner signing in.
+func claimUnverifiedAccount(tx *gorm.DB, user *models.User, now time.Time) error {
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"password_hash":     "",
+		"email_verified_at": now,
+	}).Error; err != nil {
+		return err
+	}
+	if err := removeSecondFactors(tx, user); err != nil {
+		return err
+	}
+	if err := releaseProvisionedAccount(tx, user.ID); err != nil {
+		return err
+	}
+	if _, err := revokeUserSessions(tx, user.ID, 0); err != nil {
+		return err
+	}
+	if err := tx.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", user.ID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	user.EmailVerifiedAt = &now
+	return nil
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tmember/internal/models"
+	"tmember/internal/oidc"
+	"tmember/internal/oidc/oidctest"
+
+	"gorm.io/gorm"
+)
+
+// setupOIDCTestDB creates an in-memory SQLite database with the external sign-in tables
+func setupOIDCTestDB() *gorm.DB {
+	db := setupTestDBForUnit()
+	db.AutoMigrate(&models.OIDCLoginState{}, &models.UserIdentity{})
+	return db
+}
+
+// newOIDCTestHandlers returns auth handlers that sign in with the mock identity provider as "mock"
+func newOIDCTestHandlers(db *gorm.DB, idp *oidctest.Server, autoProvision bool) *AuthHandlers {
+	authHandlers := NewAuthHandlers(db)
+	authHandlers.OIDCProviders = map[string]*oidc.Provider{
+		"mock": {
+			Name:          "mock",
+			DisplayName:   "Mock IdP",
+			Issuer:        idp.URL,
+			ClientID:      idp.ClientID,
+			ClientSecret:  idp.ClientSecret,
+			RedirectURL:   "http://localhost:5173/auth/oidc/callback",
+			AutoProvision: autoProvision,
+		},
+	}
+	return authHandlers
+}
+
+// oidcLogin runs a complete sign-in with the mock identity provider, returning the callback response and the state used
+func oidcLogin(t *testing.T, authHandlers *AuthHandlers, idp *oidctest.Server) (*httptest.ResponseRecorder, string) {
+	w := httptest.NewRecorder()
+	authHandlers.OIDCAuthorizeHandler(w, httptest.NewRequest(http.MethodPost, "/api/auth/oidc/mock/authorize", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var authorize models.OIDCAuthorizeResponse
+	json.NewDecoder(w.Body).Decode(&authorize)
+	code, state, err := idp.Authorize(authorize.AuthorizationURL)
+	if err != nil {
+		t.Fatalf("Authorization failed: %v", err)
+	}
+
+	return postJSON(authHandlers.OIDCCallbackHandler, "/api/auth/oidc/callback", models.OIDCCallbackRequest{Code: code, State: state}), state
+}
+
+func TestOIDCLogin_ProvisionsUsers(t *testing.T) {
+	idp := oidctest.NewServer()
+	defer idp.Close()
+	db := setupOIDCTestDB()
+	authHandlers := newOIDCTestHandlers(db, idp, true)
+
+	idp.SetUser(oidctest.User{Subject: "sub-1", Email: "new@example.com", EmailVerified: true})
+	w, _ := oidcLogin(t, authHandlers, idp)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response models.AuthResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Token == "" || response.User.Email != "new@example.com" || response.User.EmailVerifiedAt == nil {
+		t.Errorf("Expected a verified provisioned user with tokens, got %+v", response.User)
+	}
+
+	// Provisioned users cannot sign in with a password until they set one
+	if w := attemptLogin(authHandlers, "new@example.com", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected password login to fail, got %d", w.Code)
+	}
+
+	// Signing in again with the same identity reuses the user, even after the email changed at the provider
+	idp.SetUser(oidctest.User{Subject: "sub-1", Email: "renamed@example.com", EmailVerified: true})
+	w, _ = oidcLogin(t, authHandlers, idp)
+	var again models.AuthResponse
+	json.NewDecoder(w.Body).Decode(&again)
+	if w.Code != http.StatusOK || again.User.ID != response.User.ID {
+		t.Errorf("Expected the linked user to sign in again, got %d", w.Code)
+	}
+
+	var users int64
+	db.Model(&models.User{}).Count(&users)
+	if users != 1 {
+		t.Errorf("Expected 1 user, got %d", users)
+	}
+}
+
+func TestOIDCLogin_LinksExistingUsers(t *testing.T) {
+	idp := oidctest.NewServer()
+	defer idp.Close()
+	db := setupOIDCTestDB()
+	authHandlers := newOIDCTestHandlers(db, idp, false)
+
+	// A verified user keeps their password and second factor
+	verified := registerForTest(t, authHandlers, "verified@example.com", "ValidPass123")
+	now := time.Now()
+	db.Model(&models.User{}).Where("id = ?", verified.User.ID).Updates(map[string]interface{}{"email_verified_at": now, "mfa_enabled_at": now})
+
+	idp.SetUser(oidctest.User{Subject: "sub-verified", Email: "verified@example.com", EmailVerified: true})
+	w, _ := oidcLogin(t, authHandlers, idp)
+	var challenge models.MFAChallengeResponse
+	json.NewDecoder(w.Body).Decode(&challenge)
+	if w.Code != http.StatusOK || !challenge.MFARequired {
+		t.Errorf("Expected an MFA challenge for the linked user, got %d", w.Code)
+	}
+	if refresh := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", verified.RefreshToken); refresh.Code != http.StatusOK {
+		t.Errorf("Expected the verified user's session to survive, got %d", refresh.Code)
+	}
+
+	// An unverified account loses the credentials set up by whoever registered it
+	unverified := registerForTest(t, authHandlers, "unverified@example.com", "ValidPass123")
+	idp.SetUser(oidctest.User{Subject: "sub-unverified", Email: "unverified@example.com", EmailVerified: true})
+	if w, _ := oidcLogin(t, authHandlers, idp); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := attemptLogin(authHandlers, "unverified@example.com", "ValidPass123"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the pre-existing password to be cleared, got %d", w.Code)
+	}
+	if refresh := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", unverified.RefreshToken); refresh.Code != http.StatusUnauthorized {
+		t.Errorf("Expected pre-existing sessions to be revoked, got %d", refresh.Code)
+	}
+
+	var identities int64
+	db.Model(&models.UserIdentity{}).Count(&identities)
+	if identities != 2 {
+		t.Errorf("Expected 2 linked identities, got %d", identities)
+	}
+}
+
+func TestOIDCLogin_Rejections(t *testing.T) {
+	idp := oidctest.NewServer()
+	defer idp.Close()
+	db := setupOIDCTestDB()
+	authHandlers := newOIDCTestHandlers(db, idp, false)
+
+	// Unknown users are refused when the provider does not provision accounts
+	idp.SetUser(oidctest.User{Subject: "sub-1", Email: "stranger@example.com", EmailVerified: true})
+	w, state := oidcLogin(t, authHandlers, idp)
+	if w.Code != http.StatusForbidden || decodeErrorCode(w) != "OIDC_ACCOUNT_NOT_FOUND" {
+		t.Errorf("Expected OIDC_ACCOUNT_NOT_FOUND, got %d", w.Code)
+	}
+
+	// States are single use
+	w = postJSON(authHandlers.OIDCCallbackHandler, "/api/auth/oidc/callback", models.OIDCCallbackRequest{Code: "code", State: state})
+	if w.Code != http.StatusBadRequest || decodeErrorCode(w) != "INVALID_OIDC_STATE" {
+		t.Errorf("Expected INVALID_OIDC_STATE for a used state, got %d", w.Code)
+	}
+
+	// Unverified emails are never linked
+	registerForTest(t, authHandlers, "victim@example.com", "ValidPass123")
+	idp.SetUser(oidctest.User{Subject: "sub-2", Email: "victim@example.com", EmailVerified: false})
+	if w, _ := oidcLogin(t, authHandlers, idp); w.Code != http.StatusForbidden || decodeErrorCode(w) != "OIDC_EMAIL_NOT_VERIFIED" {
+		t.Errorf("Expected OIDC_EMAIL_NOT_VERIFIED, got %d", w.Code)
+	}
+
+	// ID tokens for another client are rejected
+	idp.SetUser(oidctest.User{Subject: "sub-3", Email: "victim@example.com", EmailVerified: true})
+	idp.IDTokenClaims = func(claims map[string]interface{}) { claims["aud"] = "another-client" }
+	if w, _ := oidcLogin(t, authHandlers, idp); w.Code != http.StatusUnauthorized || decodeErrorCode(w) != "INVALID_ID_TOKEN" {
+		t.Errorf("Expected INVALID_ID_TOKEN, got %d", w.Code)
+	}
+
+	// Unknown providers cannot be started
+	w = httptest.NewRecorder()
+	authHandlers.OIDCAuthorizeHandler(w, httptest.NewRequest(http.MethodPost, "/api/auth/oidc/unknown/authorize", nil))
+	if w.Code != http.StatusNotFound || decodeErrorCode(w) != "OIDC_PROVIDER_NOT_FOUND" {
+		t.Errorf("Expected OIDC_PROVIDER_NOT_FOUND, got %d", w.Code)
+	}
+}
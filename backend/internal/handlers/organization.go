@@ -6,20 +6,22 @@ import (
 	"strconv"
 	"strings"
 
+	"tmember/internal/domains"
 	"tmember/internal/middleware"
 	"tmember/internal/models"
 
 	"gorm.io/gorm"
 )
 
-// OrganizationHandlers contains the database connection for organization handlers
+// OrganizationHandlers contains the database connection and DNS resolver for organization handlers
 type OrganizationHandlers struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	Resolver domains.Resolver
 }
 
 // NewOrganizationHandlers creates a new OrganizationHandlers instance
 func NewOrganizationHandlers(db *gorm.DB) *OrganizationHandlers {
-	return &OrganizationHandlers{DB: db}
+	return &OrganizationHandlers{DB: db, Resolver: domains.DefaultResolver()}
 }
 
 // CreateOrganizationHandler handles organization creation
@@ -48,6 +50,23 @@ func (oh *OrganizationHandlers) CreateOrganizationHandler(w http.ResponseWriter,
 		return
 	}
 
+	// Tokens restricted to one organization cannot create others
+	if _, restricted := middleware.GetTokenOrganizationIDFromContext(r.Context()); restricted {
+		writeErrorResponse(w, http.StatusForbidden, "This token is restricted to a single organization", "TOKEN_ORGANIZATION_RESTRICTED")
+		return
+	}
+
+	// Check that the user is allowed to create organizations
+	var user models.User
+	if err := oh.DB.First(&user, userID).Error; err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND")
+		return
+	}
+
+	if !requireVerifiedEmail(w, user) {
+		return
+	}
+
 	// Check if organization name already exists
 	var existingOrg models.Organization
 	if err := oh.DB.Where("name = ?", req.Name).First(&existingOrg).Error; err == nil {
@@ -123,8 +142,14 @@ func (oh *OrganizationHandlers) ListOrganizationsHandler(w http.ResponseWriter,
 	}
 
 	// Get user's organization memberships with organization details
+	query := oh.DB.Preload("Organization").Where("user_id = ?", userID)
+	if tokenOrgID, restricted := middleware.GetTokenOrganizationIDFromContext(r.Context()); restricted {
+		// Tokens restricted to one organization only see that organization
+		query = query.Where("organization_id = ?", tokenOrgID)
+	}
+
 	var memberships []models.OrganizationMembership
-	if err := oh.DB.Preload("Organization").Where("user_id = ?", userID).Find(&memberships).Error; err != nil {
+	if err := query.Find(&memberships).Error; err != nil {
 		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch organizations", "FETCH_ERROR")
 		return
 	}
@@ -180,6 +205,10 @@ func (oh *OrganizationHandlers) SwitchOrganizationHandler(w http.ResponseWriter,
 		return
 	}
 
+	if !checkTokenOrganization(w, r, uint(orgID)) {
+		return
+	}
+
 	// Check if user has access to this organization
 	var membership models.OrganizationMembership
 	if err := oh.DB.Preload("Organization").Where("user_id = ? AND organization_id = ?", userID, uint(orgID)).First(&membership).Error; err != nil {
@@ -191,6 +220,11 @@ func (oh *OrganizationHandlers) SwitchOrganizationHandler(w http.ResponseWriter,
 		return
 	}
 
+	// Apply the organization's MFA requirement
+	if !enforceMFAPolicy(w, r, oh.DB, uint(orgID), userID) {
+		return
+	}
+
 	// Return organization details
 	response := models.SwitchOrganizationResponse{
 		Organization: models.OrganizationResponse{
@@ -209,12 +243,13 @@ func (oh *OrganizationHandlers) SwitchOrganizationHandler(w http.ResponseWriter,
 	json.NewEncoder(w).Encode(response)
 }
 
-// OrganizationAccessMiddleware validates that the user has access to the specified organization
+// OrganizationAccessMiddleware validates that the user or service account has access to the specified organization
 func (oh *OrganizationHandlers) OrganizationAccessMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get user ID from context (set by auth middleware)
-		userID, ok := middleware.GetUserIDFromContext(r.Context())
-		if !ok {
+		// Get user or service account ID from context (set by auth middleware)
+		userID, isUser := middleware.GetUserIDFromContext(r.Context())
+		serviceAccountID, isServiceAccount := middleware.GetServiceAccountIDFromContext(r.Context())
+		if !isUser && !isServiceAccount {
 			writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
 			return
 		}
@@ -246,6 +281,27 @@ func (oh *OrganizationHandlers) OrganizationAccessMiddleware(next http.Handler)
 			return
 		}
 
+		if !checkTokenOrganization(w, r, orgID) {
+			return
+		}
+
+		// Service accounts act with the role they were given in their own organization
+		if isServiceAccount {
+			var serviceAccount models.ServiceAccount
+			if err := oh.DB.Where("id = ? AND organization_id = ?", serviceAccountID, orgID).First(&serviceAccount).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					writeErrorResponse(w, http.StatusForbidden, "You don't have access to this organization", "ACCESS_DENIED")
+				} else {
+					writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify organization access", "ACCESS_CHECK_ERROR")
+				}
+				return
+			}
+
+			ctx := middleware.SetOrganizationContext(r.Context(), orgID, string(serviceAccount.Role))
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		// Check if user has access to this organization
 		var membership models.OrganizationMembership
 		if err := oh.DB.Where("user_id = ? AND organization_id = ?", userID, orgID).First(&membership).Error; err != nil {
@@ -257,6 +313,11 @@ func (oh *OrganizationHandlers) OrganizationAccessMiddleware(next http.Handler)
 			return
 		}
 
+		// Apply the organization's MFA requirement
+		if !enforceMFAPolicy(w, r, oh.DB, orgID, userID) {
+			return
+		}
+
 		// Add organization info to context
 		ctx := r.Context()
 		ctx = middleware.SetOrganizationContext(ctx, orgID, string(membership.Role))
@@ -266,6 +327,15 @@ func (oh *OrganizationHandlers) OrganizationAccessMiddleware(next http.Handler)
 	})
 }
 
+// checkTokenOrganization rejects requests made with an API token that is restricted to a different organization
+func checkTokenOrganization(w http.ResponseWriter, r *http.Request, orgID uint) bool {
+	if tokenOrgID, restricted := middleware.GetTokenOrganizationIDFromContext(r.Context()); restricted && tokenOrgID != orgID {
+		writeErrorResponse(w, http.StatusForbidden, "This token is restricted to a different organization", "TOKEN_ORGANIZATION_RESTRICTED")
+		return false
+	}
+	return true
+}
+
 // ListOrganizationMembersHandler handles listing organization members (admin only)
 func (oh *OrganizationHandlers) ListOrganizationMembersHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -273,16 +343,8 @@ func (oh *OrganizationHandlers) ListOrganizationMembersHandler(w http.ResponseWr
 		return
 	}
 
-	// Get organization ID and role from context
-	orgID, ok := middleware.GetOrganizationIDFromContext(r.Context())
+	orgID, ok := requireOrgAdmin(w, r)
 	if !ok {
-		writeErrorResponse(w, http.StatusBadRequest, "Organization ID not found", "MISSING_ORG_ID")
-		return
-	}
-
-	role, ok := middleware.GetOrganizationRoleFromContext(r.Context())
-	if !ok || role != string(models.RoleAdmin) {
-		writeErrorResponse(w, http.StatusForbidden, "Admin access required", "ADMIN_REQUIRED")
 		return
 	}
 
@@ -327,16 +389,8 @@ func (oh *OrganizationHandlers) UpdateMemberRoleHandler(w http.ResponseWriter, r
 		return
 	}
 
-	// Get organization ID and role from context
-	orgID, ok := middleware.GetOrganizationIDFromContext(r.Context())
+	orgID, ok := requireOrgAdmin(w, r)
 	if !ok {
-		writeErrorResponse(w, http.StatusBadRequest, "Organization ID not found", "MISSING_ORG_ID")
-		return
-	}
-
-	role, ok := middleware.GetOrganizationRoleFromContext(r.Context())
-	if !ok || role != string(models.RoleAdmin) {
-		writeErrorResponse(w, http.StatusForbidden, "Admin access required", "ADMIN_REQUIRED")
 		return
 	}
 
@@ -407,16 +461,8 @@ func (oh *OrganizationHandlers) RemoveMemberHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	// Get organization ID and role from context
-	orgID, ok := middleware.GetOrganizationIDFromContext(r.Context())
+	orgID, ok := requireOrgAdmin(w, r)
 	if !ok {
-		writeErrorResponse(w, http.StatusBadRequest, "Organization ID not found", "MISSING_ORG_ID")
-		return
-	}
-
-	role, ok := middleware.GetOrganizationRoleFromContext(r.Context())
-	if !ok || role != string(models.RoleAdmin) {
-		writeErrorResponse(w, http.StatusForbidden, "Admin access required", "ADMIN_REQUIRED")
 		return
 	}
 
@@ -447,13 +493,13 @@ func (oh *OrganizationHandlers) RemoveMemberHandler(w http.ResponseWriter, r *ht
 	}
 
 	// Prevent removing the last admin
-	var adminCount int64
-	if err := oh.DB.Model(&models.OrganizationMembership{}).Where("organization_id = ? AND role = ?", orgID, models.RoleAdmin).Count(&adminCount).Error; err != nil {
+	lastAdmin, err := isLastAdmin(oh.DB, orgID)
+	if err != nil {
 		writeErrorResponse(w, http.StatusInternalServerError, "Failed to check admin count", "ADMIN_COUNT_ERROR")
 		return
 	}
 
-	if membership.Role == models.RoleAdmin && adminCount <= 1 {
+	if membership.Role == models.RoleAdmin && lastAdmin {
 		writeErrorResponse(w, http.StatusBadRequest, "Cannot remove the last admin from organization", "LAST_ADMIN_ERROR")
 		return
 	}
@@ -474,3 +520,12 @@ func (oh *OrganizationHandlers) RemoveMemberHandler(w http.ResponseWriter, r *ht
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// isLastAdmin reports whether the organization has at most one admin
+func isLastAdmin(tx *gorm.DB, orgID uint) (bool, error) {
+	var adminCount int64
+	if err := tx.Model(&models.OrganizationMembership{}).Where("organization_id = ? AND role = ?", orgID, models.RoleAdmin).Count(&adminCount).Error; err != nil {
+		return false, err
+	}
+	return adminCount <= 1, nil
+}
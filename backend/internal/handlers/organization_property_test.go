@@ -28,7 +28,7 @@ func setupOrgTestDB() *gorm.DB {
 
 	// Auto-migrate the schema
 	// Note: SQLite doesn't support ENUM, so we'll use string type for Role
-	db.AutoMigrate(&models.User{}, &models.Organization{})
+	db.AutoMigrate(&models.User{}, &models.Organization{}, &models.OrganizationSecurityPolicy{}, &models.WebAuthnCredential{})
 
 	// Create organization_memberships table manually for SQLite compatibility
 	db.Exec(`CREATE TABLE organization_memberships (
@@ -59,7 +59,7 @@ func createTestUser(db *gorm.DB) (models.User, string) {
 
 	db.Create(&user)
 
-	token, _ := utils.GenerateJWT(user.ID, user.Email)
+	token, _ := utils.GenerateJWT(user.ID, user.Email, 0)
 	return user, token
 }
 
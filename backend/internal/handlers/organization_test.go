@@ -24,7 +24,7 @@ func setupOrgUnitTestDB() *gorm.DB {
 	}
 
 	// Auto-migrate the schema
-	db.AutoMigrate(&models.User{}, &models.Organization{})
+	db.AutoMigrate(&models.User{}, &models.Organization{}, &models.OrganizationSecurityPolicy{}, &models.WebAuthnCredential{})
 
 	// Create organization_memberships table manually for SQLite compatibility
 	db.Exec(`CREATE TABLE organization_memberships (
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"tmember/internal/middleware"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// ChangePasswordHandler changes the current user's password and signs out every other session and token
+func (ah *AuthHandlers) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r, ah.DB)
+	if !ok {
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	// Check the current password
+	if !checkCurrentPassword(w, r, ah.DB, *user, req.CurrentPassword) {
+		return
+	}
+
+	// Validate password security criteria against the strictest policy of the user's organizations
+	policy, err := effectivePasswordPolicy(ah.DB, user.ID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to load password policy", "POLICY_FETCH_ERROR")
+		return
+	}
+	if err := utils.ValidatePassword(req.NewPassword, policy); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error(), "WEAK_PASSWORD")
+		return
+	}
+
+	if req.NewPassword == req.CurrentPassword {
+		writeErrorResponse(w, http.StatusBadRequest, "New password must be different from the current password", "PASSWORD_UNCHANGED")
+		return
+	}
+
+	// Hash the new password
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to process password", "PASSWORD_HASH_ERROR")
+		return
+	}
+
+	currentSessionID, _ := middleware.GetSessionIDFromContext(r.Context())
+
+	var revoked int64
+	err = ah.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password_hash", hashedPassword).Error; err != nil {
+			return err
+		}
+
+		// Sign out every other session, together with its refresh tokens
+		count, err := revokeUserSessions(tx, user.ID, currentSessionID)
+		if err != nil {
+			return err
+		}
+		revoked = count
+
+		// Personal access tokens and pending reset links were issued under the old password
+		if err := tx.Model(&models.PersonalAccessToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, models.TokenPurposePasswordReset).
+			Update("used_at", time.Now()).Error
+	})
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to update password", "UPDATE_ERROR")
+		return
+	}
+	recordAuditEvent(ah.DB, r, user.ID, models.AuditActionPasswordChanged)
+
+	response := map[string]interface{}{
+		"message":                "Password changed successfully",
+		"revoked_sessions_count": revoked,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"tmember/internal/config"
+	"tmember/internal/mailer"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// passwordResetTTL is how long a password reset token remains valid
+const passwordResetTTL = time.Hour
+
+// ForgotPasswordHandler emails a password reset link. The response is identical whether or not
+// the email belongs to an account, so it cannot be used to discover registered addresses.
+func (ah *AuthHandlers) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	var user models.User
+	if err := ah.DB.Where("normalized_email = ?", utils.EmailKey(req.Email)).First(&user).Error; err == nil {
+		if err := ah.sendPasswordResetEmail(user); err != nil {
+			log.Printf("Failed to send password reset email to user %d: %v", user.ID, err)
+		}
+	}
+
+	response := map[string]interface{}{
+		"message": "If an account exists for this email, a password reset link has been sent",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ResetPasswordHandler sets a new password using a reset token and signs the user out everywhere
+func (ah *AuthHandlers) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	record, err := findUserToken(ah.DB, req.Token, models.TokenPurposePasswordReset)
+	if err != nil || record.User.ID == 0 {
+		writeResetTokenError(w, err)
+		return
+	}
+
+	// Validate password security criteria before consuming the token
+	policy, err := effectivePasswordPolicy(ah.DB, record.UserID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to load password policy", "POLICY_FETCH_ERROR")
+		return
+	}
+	if err := utils.ValidatePassword(req.Password, policy); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error(), "WEAK_PASSWORD")
+		return
+	}
+
+	// Hash the new password
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to process password", "PASSWORD_HASH_ERROR")
+		return
+	}
+
+	user := record.User
+	newlyVerified := !user.IsEmailVerified()
+	now := time.Now()
+	err = ah.DB.Transaction(func(tx *gorm.DB) error {
+		if err := useUserToken(tx, record); err != nil {
+			return err
+		}
+
+		// Following the emailed link proves ownership of the address
+		updates := map[string]interface{}{"password_hash": hashedPassword}
+		if newlyVerified {
+			updates["email_verified_at"] = now
+		}
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := releaseProvisionedAccount(tx, user.ID); err != nil {
+			return err
+		}
+
+		// Invalidate every existing session and personal access token
+		if _, err := revokeUserSessions(tx, user.ID, 0); err != nil {
+			return err
+		}
+		return tx.Model(&models.PersonalAccessToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", now).Error
+	})
+	if err == errInvalidUserToken {
+		writeResetTokenError(w, err)
+		return
+	}
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to update password", "UPDATE_ERROR")
+		return
+	}
+	if newlyVerified {
+		if err := joinVerifiedDomainOrganizations(ah.DB, user); err != nil {
+			log.Printf("Failed to join verified domain organizations for user %d: %v", user.ID, err)
+		}
+	}
+	recordAuditEvent(ah.DB, r, record.UserID, models.AuditActionPasswordReset)
+
+	response := map[string]interface{}{
+		"message": "Password has been reset successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeResetTokenError writes the response for a reset token that could not be found or used
+func writeResetTokenError(w http.ResponseWriter, err error) {
+	if err != nil && err != errInvalidUserToken {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify reset token", "TOKEN_CHECK_ERROR")
+	} else {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid or expired reset token", "INVALID_RESET_TOKEN")
+	}
+}
+
+// sendPasswordResetEmail issues a reset token for the user and emails the reset link
+func (ah *AuthHandlers) sendPasswordResetEmail(user models.User) error {
+	token, err := createUserToken(ah.DB, user.ID, models.TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.AppBaseURL(), url.QueryEscape(token))
+	return ah.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your TMember password",
+		Body: fmt.Sprintf("We received a request to reset the password for your TMember account.\n\n"+
+			"Reset your password: %s\n\n"+
+			"This link expires in %d minutes. If you did not request a reset, you can ignore this email.\n",
+			link, int(passwordResetTTL.Minutes())),
+	})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"tmember/internal/mailer"
+	"tmember/internal/models"
+)
+
+// extractTokenFromMail extracts the token query parameter from the link in an email body
+func extractTokenFromMail(t *testing.T, msg mailer.Message) string {
+	for _, field := range strings.Fields(msg.Body) {
+		if u, err := url.Parse(field); err == nil && u.Query().Get("token") != "" {
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatalf("No token link found in mail body: %s", msg.Body)
+	return ""
+}
+
+// postJSON calls a handler with a JSON body and returns the recorder
+func postJSON(handler http.HandlerFunc, path string, body interface{}) *httptest.ResponseRecorder {
+	reqBody, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(reqBody))
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestForgotPasswordHandler_DoesNotRevealAccounts(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	registerForTest(t, authHandlers, "known@example.com", "ValidPass123")
+
+	// Collect only the mail sent after registration
+	outbox := mailer.NewMemoryMailer()
+	authHandlers.Mailer = outbox
+
+	known := postJSON(authHandlers.ForgotPasswordHandler, "/api/auth/password/forgot", models.ForgotPasswordRequest{Email: "known@example.com"})
+	unknown := postJSON(authHandlers.ForgotPasswordHandler, "/api/auth/password/forgot", models.ForgotPasswordRequest{Email: "unknown@example.com"})
+
+	if known.Code != http.StatusAccepted || unknown.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d for both requests, got %d and %d", http.StatusAccepted, known.Code, unknown.Code)
+	}
+	if known.Body.String() != unknown.Body.String() {
+		t.Error("Expected identical responses for known and unknown emails")
+	}
+
+	messages := outbox.Messages()
+	if len(messages) != 1 || messages[0].To != "known@example.com" {
+		t.Fatalf("Expected one reset email to known@example.com, got %+v", messages)
+	}
+
+	// Only the hash of the token is stored
+	token := extractTokenFromMail(t, messages[0])
+	var count int64
+	db.Model(&models.UserToken{}).Where("token_hash = ?", token).Count(&count)
+	if count != 0 {
+		t.Error("Expected raw reset token not to be stored")
+	}
+}
+
+func TestResetPasswordHandler_ResetsPasswordAndRevokesSessions(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	outbox := mailer.NewMemoryMailer()
+	authHandlers.Mailer = outbox
+
+	auth := registerForTest(t, authHandlers, "reset@example.com", "ValidPass123")
+	user := models.User{}
+	db.Where("email = ?", "reset@example.com").First(&user)
+	if w := createPersonalAccessToken(authHandlers, user, models.CreatePersonalAccessTokenRequest{Name: "ci"}); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	postJSON(authHandlers.ForgotPasswordHandler, "/api/auth/password/forgot", models.ForgotPasswordRequest{Email: "reset@example.com"})
+	msg, _ := outbox.Last()
+	token := extractTokenFromMail(t, msg)
+
+	// Weak passwords are rejected without consuming the token
+	weak := postJSON(authHandlers.ResetPasswordHandler, "/api/auth/password/reset", models.ResetPasswordRequest{Token: token, Password: "weak"})
+	if weak.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for weak password, got %d", http.StatusBadRequest, weak.Code)
+	}
+
+	w := postJSON(authHandlers.ResetPasswordHandler, "/api/auth/password/reset", models.ResetPasswordRequest{Token: token, Password: "NewValidPass456"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Existing sessions and personal access tokens are invalidated
+	if refresh := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", auth.RefreshToken); refresh.Code != http.StatusUnauthorized {
+		t.Errorf("Expected existing session to be revoked, got %d", refresh.Code)
+	}
+	var activeTokens int64
+	db.Model(&models.PersonalAccessToken{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&activeTokens)
+	if activeTokens != 0 {
+		t.Errorf("Expected personal access tokens to be revoked, got %d active", activeTokens)
+	}
+
+	// The new password works and the old one does not
+	if login := postJSON(authHandlers.LoginHandler, "/api/auth/login", models.LoginRequest{Email: "reset@example.com", Password: "NewValidPass456"}); login.Code != http.StatusOK {
+		t.Errorf("Expected login with new password to succeed, got %d", login.Code)
+	}
+	if login := postJSON(authHandlers.LoginHandler, "/api/auth/login", models.LoginRequest{Email: "reset@example.com", Password: "ValidPass123"}); login.Code != http.StatusUnauthorized {
+		t.Errorf("Expected login with old password to fail, got %d", login.Code)
+	}
+
+	// The token is single-use
+	reuse := postJSON(authHandlers.ResetPasswordHandler, "/api/auth/password/reset", models.ResetPasswordRequest{Token: token, Password: "AnotherPass789"})
+	if reuse.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for reused token, got %d", http.StatusBadRequest, reuse.Code)
+	}
+}
+
+func TestResetPasswordHandler_OnlyLatestTokenIsValid(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	registerForTest(t, authHandlers, "twice@example.com", "ValidPass123")
+
+	// Collect only the mail sent after registration
+	outbox := mailer.NewMemoryMailer()
+	authHandlers.Mailer = outbox
+
+	postJSON(authHandlers.ForgotPasswordHandler, "/api/auth/password/forgot", models.ForgotPasswordRequest{Email: "twice@example.com"})
+	postJSON(authHandlers.ForgotPasswordHandler, "/api/auth/password/forgot", models.ForgotPasswordRequest{Email: "twice@example.com"})
+	messages := outbox.Messages()
+	first := extractTokenFromMail(t, messages[0])
+	second := extractTokenFromMail(t, messages[1])
+
+	if w := postJSON(authHandlers.ResetPasswordHandler, "/api/auth/password/reset", models.ResetPasswordRequest{Token: first, Password: "NewValidPass456"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected superseded token to be rejected, got %d", w.Code)
+	}
+	if w := postJSON(authHandlers.ResetPasswordHandler, "/api/auth/password/reset", models.ResetPasswordRequest{Token: second, Password: "NewValidPass456"}); w.Code != http.StatusOK {
+		t.Errorf("Expected latest token to be accepted, got %d", w.Code)
+	}
+}
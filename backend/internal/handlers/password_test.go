@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tmember/internal/mailer"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+)
+
+// changePassword calls the change password handler with the session behind the access token
+func changePassword(t *testing.T, authHandlers *AuthHandlers, accessToken, currentPassword, newPassword string) *httptest.ResponseRecorder {
+	reqBody, _ := json.Marshal(models.ChangePasswordRequest{CurrentPassword: currentPassword, NewPassword: newPassword})
+	req := withSessionContext(t, httptest.NewRequest(http.MethodPut, "/api/users/me/password", bytes.NewBuffer(reqBody)), accessToken)
+	w := httptest.NewRecorder()
+	authHandlers.ChangePasswordHandler(w, req)
+	return w
+}
+
+func TestChangePassword_RevokesOtherSessionsAndTokens(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	current := registerForTest(t, authHandlers, "change@example.com", "ValidPass123")
+	other := attemptLogin(authHandlers, "change@example.com", "ValidPass123")
+	var otherAuth models.AuthResponse
+	json.NewDecoder(other.Body).Decode(&otherAuth)
+
+	user := models.User{}
+	db.Where("email = ?", "change@example.com").First(&user)
+	if w := createPersonalAccessToken(authHandlers, user, models.CreatePersonalAccessTokenRequest{Name: "ci"}); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	w := changePassword(t, authHandlers, current.Token, "ValidPass123", "NewValidPass456")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// The old password no longer works and the new one does
+	if w := attemptLogin(authHandlers, "change@example.com", "ValidPass123"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected old password to be rejected, got %d", w.Code)
+	}
+	if w := attemptLogin(authHandlers, "change@example.com", "NewValidPass456"); w.Code != http.StatusOK {
+		t.Errorf("Expected new password to be accepted, got %d", w.Code)
+	}
+
+	// Other sessions and personal access tokens are revoked; the current session survives
+	if refresh := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", otherAuth.RefreshToken); refresh.Code != http.StatusUnauthorized {
+		t.Errorf("Expected other session to be revoked, got %d", refresh.Code)
+	}
+	if refresh := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", current.RefreshToken); refresh.Code != http.StatusOK {
+		t.Errorf("Expected current session to stay active, got %d", refresh.Code)
+	}
+
+	var activeTokens int64
+	db.Model(&models.PersonalAccessToken{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&activeTokens)
+	if activeTokens != 0 {
+		t.Errorf("Expected personal access tokens to be revoked, got %d active", activeTokens)
+	}
+}
+
+func TestChangePassword_Validation(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	current := registerForTest(t, authHandlers, "validate@example.com", "ValidPass123")
+
+	tests := []struct {
+		name            string
+		currentPassword string
+		newPassword     string
+		expectedStatus  int
+		expectedCode    string
+	}{
+		{"wrong current password", "WrongPass123", "NewValidPass456", http.StatusUnauthorized, "INVALID_CREDENTIALS"},
+		{"weak new password", "ValidPass123", "short", http.StatusBadRequest, "WEAK_PASSWORD"},
+		{"unchanged password", "ValidPass123", "ValidPass123", http.StatusBadRequest, "PASSWORD_UNCHANGED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := changePassword(t, authHandlers, current.Token, tt.currentPassword, tt.newPassword)
+			if w.Code != tt.expectedStatus || decodeErrorCode(w) != tt.expectedCode {
+				t.Errorf("Expected %d %s, got %d", tt.expectedStatus, tt.expectedCode, w.Code)
+			}
+		})
+	}
+}
+
+func TestChangePassword_WrongPasswordsAreThrottled(t *testing.T) {
+	t.Setenv("LOGIN_DELAY_AFTER_FAILURES", "10")
+	t.Setenv("LOGIN_MAX_FAILURES", "2")
+
+	authHandlers := NewAuthHandlers(setupTestDBForUnit())
+	current := registerForTest(t, authHandlers, "guess@example.com", "ValidPass123")
+
+	for i := 0; i < 2; i++ {
+		if w := changePassword(t, authHandlers, current.Token, "WrongPass123", "NewValidPass456"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	// Guessing through a session locks the account like failed sign-ins do
+	if w := changePassword(t, authHandlers, current.Token, "ValidPass123", "NewValidPass456"); w.Code != http.StatusTooManyRequests || decodeErrorCode(w) != "ACCOUNT_LOCKED" {
+		t.Errorf("Expected 429 ACCOUNT_LOCKED, got %d", w.Code)
+	}
+}
+
+func TestChangePassword_EnforcesStrictestOrganizationPolicy(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	current := registerForTest(t, authHandlers, "policy@example.com", "ValidPass123")
+	user := models.User{}
+	db.Where("email = ?", "policy@example.com").First(&user)
+
+	// One organization requires long passwords, the other requires symbols
+	longOrg := models.Organization{Name: "Long Passwords"}
+	symbolOrg := models.Organization{Name: "Symbols"}
+	db.Create(&longOrg)
+	db.Create(&symbolOrg)
+	db.Create(&models.OrganizationMembership{UserID: user.ID, OrganizationID: longOrg.ID, Role: models.RoleMember})
+	db.Create(&models.OrganizationMembership{UserID: user.ID, OrganizationID: symbolOrg.ID, Role: models.RoleMember})
+	db.Create(&models.OrganizationSecurityPolicy{OrganizationID: longOrg.ID, PasswordMinLength: 14})
+	db.Create(&models.OrganizationSecurityPolicy{OrganizationID: symbolOrg.ID, PasswordRequireSymbol: true})
+
+	for _, password := range []string{"NewValidPass456", "Short!Pass1"} {
+		if w := changePassword(t, authHandlers, current.Token, "ValidPass123", password); w.Code != http.StatusBadRequest || decodeErrorCode(w) != "WEAK_PASSWORD" {
+			t.Errorf("Expected %q to be rejected, got %d", password, w.Code)
+		}
+	}
+
+	if w := changePassword(t, authHandlers, current.Token, "ValidPass123", "NewValid!Pass456"); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+func TestBreachedPasswordsAreRejected(t *testing.T) {
+	filter, _ := utils.NewBloomFilter(1, 0.001)
+	filter.AddHash(sha1.Sum([]byte("Summer2024!")))
+	utils.SetPasswordBlocklist(filter)
+	defer utils.SetPasswordBlocklist(nil)
+
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+	outbox := mailer.NewMemoryMailer()
+	authHandlers.Mailer = outbox
+
+	// Registration
+	w := postJSON(authHandlers.RegisterHandler, "/api/auth/register", models.RegisterRequest{Email: "breach@example.com", Password: "Summer2024!"})
+	if w.Code != http.StatusBadRequest || decodeErrorCode(w) != "WEAK_PASSWORD" {
+		t.Errorf("Expected breached password to be rejected at registration, got %d", w.Code)
+	}
+
+	// Password change
+	auth := registerForTest(t, authHandlers, "breach@example.com", "ValidPass123")
+	if w := changePassword(t, authHandlers, auth.Token, "ValidPass123", "Summer2024!"); w.Code != http.StatusBadRequest || decodeErrorCode(w) != "WEAK_PASSWORD" {
+		t.Errorf("Expected breached password to be rejected on change, got %d", w.Code)
+	}
+
+	// Password reset
+	postJSON(authHandlers.ForgotPasswordHandler, "/api/auth/password/forgot", models.ForgotPasswordRequest{Email: "breach@example.com"})
+	msg, _ := outbox.Last()
+	w = postJSON(authHandlers.ResetPasswordHandler, "/api/auth/password/reset", models.ResetPasswordRequest{Token: extractTokenFromMail(t, msg), Password: "Summer2024!"})
+	if w.Code != http.StatusBadRequest || decodeErrorCode(w) != "WEAK_PASSWORD" {
+		t.Errorf("Expected breached password to be rejected on reset, got %d", w.Code)
+	}
+}
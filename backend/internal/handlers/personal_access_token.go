@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tmember/internal/middleware"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// maxTokenNameLength is the maximum length of a personal access token name
+	maxTokenNameLength = 100
+	// maxTokenExpiryDays is the longest expiry that can be requested for a personal access token
+	maxTokenExpiryDays = 365
+	// tokenHintLength is the number of leading characters of a token kept to help users recognise it
+	tokenHintLength = 8
+)
+
+// CreatePersonalAccessTokenHandler creates a personal access token for the current user and returns it once
+func (ah *AuthHandlers) CreatePersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
+		return
+	}
+
+	var req models.CreatePersonalAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	// Validate token name
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxTokenNameLength {
+		writeErrorResponse(w, http.StatusBadRequest, "Token name is required and must be at most 100 characters", "INVALID_NAME")
+		return
+	}
+
+	// Validate scope
+	scope := models.TokenScope(req.Scope)
+	if scope == "" {
+		scope = models.TokenScopeRead
+	}
+	if scope != models.TokenScopeRead && scope != models.TokenScopeReadWrite {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid scope. Must be 'read' or 'read_write'", "INVALID_SCOPE")
+		return
+	}
+
+	// Validate expiry
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil {
+		if *req.ExpiresInDays < 1 || *req.ExpiresInDays > maxTokenExpiryDays {
+			writeErrorResponse(w, http.StatusBadRequest, "Expiry must be between 1 and 365 days", "INVALID_EXPIRY")
+			return
+		}
+		expiry := time.Now().Add(time.Duration(*req.ExpiresInDays) * 24 * time.Hour)
+		expiresAt = &expiry
+	}
+
+	// Tokens can only be restricted to organizations the user belongs to
+	if req.OrganizationID != nil {
+		var membership models.OrganizationMembership
+		if err := ah.DB.Where("user_id = ? AND organization_id = ?", userID, *req.OrganizationID).First(&membership).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				writeErrorResponse(w, http.StatusForbidden, "You don't have access to this organization", "ACCESS_DENIED")
+			} else {
+				writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify organization access", "ACCESS_CHECK_ERROR")
+			}
+			return
+		}
+	}
+
+	secret, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to generate token", "TOKEN_GENERATION_ERROR")
+		return
+	}
+	token := models.PersonalAccessTokenPrefix + secret
+
+	record := models.PersonalAccessToken{
+		UserID:         userID,
+		Name:           name,
+		TokenHash:      utils.HashToken(token),
+		TokenHint:      token[:tokenHintLength],
+		Scope:          scope,
+		OrganizationID: req.OrganizationID,
+		MFA:            middleware.GetSessionMFAFromContext(r.Context()),
+		ExpiresAt:      expiresAt,
+	}
+
+	if err := ah.DB.Create(&record).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to create token", "CREATION_ERROR")
+		return
+	}
+
+	response := toPersonalAccessTokenResponse(record)
+	response.Token = token
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListPersonalAccessTokensHandler lists the current user's active personal access tokens
+func (ah *AuthHandlers) ListPersonalAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
+		return
+	}
+
+	var tokens []models.PersonalAccessToken
+	if err := ah.DB.Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch tokens", "FETCH_ERROR")
+		return
+	}
+
+	// Convert to response format
+	response := models.ListPersonalAccessTokensResponse{
+		Tokens: make([]models.PersonalAccessTokenResponse, len(tokens)),
+	}
+	for i, token := range tokens {
+		response.Tokens[i] = toPersonalAccessTokenResponse(token)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokePersonalAccessTokenHandler revokes one of the current user's personal access tokens
+func (ah *AuthHandlers) RevokePersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
+		return
+	}
+
+	// Extract token ID from URL path
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 6 {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid token ID", "INVALID_TOKEN_ID")
+		return
+	}
+
+	tokenID, err := strconv.ParseUint(parts[5], 10, 32) // /api/users/me/tokens/{token_id}
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid token ID format", "INVALID_TOKEN_ID_FORMAT")
+		return
+	}
+
+	result := ah.DB.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", uint(tokenID), userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to revoke token", "REVOKE_ERROR")
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeErrorResponse(w, http.StatusNotFound, "Token not found", "TOKEN_NOT_FOUND")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":  "Token revoked successfully",
+		"token_id": uint(tokenID),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// toPersonalAccessTokenResponse converts a personal access token to its API representation
+func toPersonalAccessTokenResponse(token models.PersonalAccessToken) models.PersonalAccessTokenResponse {
+	response := models.PersonalAccessTokenResponse{
+		ID:             token.ID,
+		Name:           token.Name,
+		TokenHint:      token.TokenHint,
+		Scope:          string(token.Scope),
+		OrganizationID: token.OrganizationID,
+		CreatedAt:      token.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if token.ExpiresAt != nil {
+		expiresAt := token.ExpiresAt.Format("2006-01-02T15:04:05Z07:00")
+		response.ExpiresAt = &expiresAt
+	}
+	if token.LastUsedAt != nil {
+		lastUsedAt := token.LastUsedAt.Format("2006-01-02T15:04:05Z07:00")
+		response.LastUsedAt = &lastUsedAt
+	}
+	return response
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tmember/internal/models"
+	"tmember/internal/utils"
+)
+
+// createPersonalAccessToken creates a token through the handler for the user and returns the response recorder
+func createPersonalAccessToken(authHandlers *AuthHandlers, user models.User, req models.CreatePersonalAccessTokenRequest) *httptest.ResponseRecorder {
+	reqBody, _ := json.Marshal(req)
+	httpReq := withUserContext(httptest.NewRequest(http.MethodPost, "/api/users/me/tokens", bytes.NewBuffer(reqBody)), user)
+	w := httptest.NewRecorder()
+	authHandlers.CreatePersonalAccessTokenHandler(w, httpReq)
+	return w
+}
+
+func TestPersonalAccessTokenLifecycle(t *testing.T) {
+	db := setupInvitationTestDB()
+	db.AutoMigrate(&models.PersonalAccessToken{})
+	authHandlers := NewAuthHandlers(db)
+
+	user := createUnitTestUser(db, "ci@example.com")
+	days := 30
+
+	w := createPersonalAccessToken(authHandlers, user, models.CreatePersonalAccessTokenRequest{Name: "Deploy bot", Scope: "read_write", ExpiresInDays: &days})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var created models.PersonalAccessTokenResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	if !strings.HasPrefix(created.Token, models.PersonalAccessTokenPrefix) || created.ExpiresAt == nil {
+		t.Fatalf("Unexpected created token: %+v", created)
+	}
+
+	// Only the hash is stored
+	var stored models.PersonalAccessToken
+	db.First(&stored, created.ID)
+	if stored.TokenHash != utils.HashToken(created.Token) || stored.Scope != models.TokenScopeReadWrite {
+		t.Errorf("Unexpected stored token: %+v", stored)
+	}
+
+	// Listing never shows the token itself
+	listReq := withUserContext(httptest.NewRequest(http.MethodGet, "/api/users/me/tokens", nil), user)
+	listW := httptest.NewRecorder()
+	authHandlers.ListPersonalAccessTokensHandler(listW, listReq)
+
+	var list models.ListPersonalAccessTokensResponse
+	json.NewDecoder(listW.Body).Decode(&list)
+	if len(list.Tokens) != 1 || list.Tokens[0].Token != "" || list.Tokens[0].TokenHint != created.Token[:tokenHintLength] {
+		t.Fatalf("Unexpected token list: %+v", list.Tokens)
+	}
+
+	// Revoking removes it from the list
+	revokeReq := withUserContext(httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/users/me/tokens/%d", created.ID), nil), user)
+	revokeW := httptest.NewRecorder()
+	authHandlers.RevokePersonalAccessTokenHandler(revokeW, revokeReq)
+	if revokeW.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, revokeW.Code)
+	}
+
+	db.First(&stored, created.ID)
+	if stored.RevokedAt == nil {
+		t.Error("Expected token to be revoked")
+	}
+}
+
+func TestPersonalAccessTokenOrganizationRestriction(t *testing.T) {
+	db := setupInvitationTestDB()
+	db.AutoMigrate(&models.PersonalAccessToken{})
+	authHandlers := NewAuthHandlers(db)
+	orgHandlers := NewOrganizationHandlers(db)
+
+	user := createUnitTestUser(db, "scoped@example.com")
+	allowed := models.Organization{Name: "Allowed Org"}
+	other := models.Organization{Name: "Other Org"}
+	foreign := models.Organization{Name: "Foreign Org"}
+	db.Create(&allowed)
+	db.Create(&other)
+	db.Create(&foreign)
+	db.Create(&models.OrganizationMembership{UserID: user.ID, OrganizationID: allowed.ID, Role: models.RoleMember})
+	db.Create(&models.OrganizationMembership{UserID: user.ID, OrganizationID: other.ID, Role: models.RoleMember})
+
+	// Tokens cannot be restricted to organizations the user does not belong to
+	if w := createPersonalAccessToken(authHandlers, user, models.CreatePersonalAccessTokenRequest{Name: "bad", OrganizationID: &foreign.ID}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Invalid scopes are rejected
+	if w := createPersonalAccessToken(authHandlers, user, models.CreatePersonalAccessTokenRequest{Name: "bad", Scope: "admin"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// A restricted token only reaches its own organization
+	withToken := func(req *http.Request) *http.Request {
+		req = withUserContext(req, user)
+		return req.WithContext(context.WithValue(req.Context(), "token_organization_id", allowed.ID))
+	}
+
+	otherW := httptest.NewRecorder()
+	orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.GetSecurityPolicyHandler)).ServeHTTP(otherW, withToken(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/organizations/%d/security", other.ID), nil)))
+	if otherW.Code != http.StatusForbidden || decodeErrorCode(otherW) != "TOKEN_ORGANIZATION_RESTRICTED" {
+		t.Errorf("Expected restricted token to be refused, got %d", otherW.Code)
+	}
+
+	allowedW := httptest.NewRecorder()
+	orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.GetSecurityPolicyHandler)).ServeHTTP(allowedW, withToken(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/organizations/%d/security", allowed.ID), nil)))
+	if allowedW.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, allowedW.Code)
+	}
+
+	listW := httptest.NewRecorder()
+	orgHandlers.ListOrganizationsHandler(listW, withToken(httptest.NewRequest(http.MethodGet, "/api/organizations", nil)))
+
+	var list models.ListOrganizationsResponse
+	json.NewDecoder(listW.Body).Decode(&list)
+	if len(list.Organizations) != 1 || list.Organizations[0].ID != allowed.ID {
+		t.Errorf("Expected only the allowed organization to be listed, got %+v", list.Organizations)
+	}
+}
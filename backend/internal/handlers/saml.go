@@ -0,0 +1,669 @@
+package handlers
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tmember/internal/config"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"github.com/crewjam/saml"
+	"gorm.io/gorm"
+)
+
+const (
+	// samlLoginTTL is how long a user has to complete a sign-in at the organization's identity provider
+	samlLoginTTL = 10 * time.Minute
+	// samlLoginCodeTTL is how long the frontend has to exchange the one-time code from a SAML sign-in for tokens
+	samlLoginCodeTTL = time.Minute
+)
+
+var (
+	// errInvalidSAMLState is returned when a sign-in state is unknown, used, expired or for another organization
+	errInvalidSAMLState = errors.New("invalid SAML state")
+	// errSAMLEmailMissing is returned when the assertion carries no usable email address
+	errSAMLEmailMissing = errors.New("assertion has no valid email address")
+	// errSAMLAccountNotFound is returned for unknown users that just-in-time provisioning does not cover
+	errSAMLAccountNotFound = errors.New("no account for this identity")
+	// errSAMLNotAMember is returned for existing users who do not belong to the organization
+	errSAMLNotAMember = errors.New("user is not a member of the organization")
+)
+
+// loadSAMLConfig returns the organization's SAML configuration, or an empty disabled configuration if none was saved
+func loadSAMLConfig(db *gorm.DB, orgID uint) (models.OrganizationSAMLConfig, error) {
+	cfg := models.OrganizationSAMLConfig{OrganizationID: orgID}
+	err := db.Where("organization_id = ?", orgID).Limit(1).Find(&cfg).Error
+	return cfg, err
+}
+
+// samlServiceProviderURL returns the URL of one of the organization's service provider endpoints
+func samlServiceProviderURL(orgID uint, endpoint string) string {
+	return fmt.Sprintf("%s/api/saml/%d/%s", config.APIBaseURL(), orgID, endpoint)
+}
+
+// samlServiceProvider returns the service provider for an organization. The identity provider is only
+// configured once its entity ID, SSO URL and certificate are all set.
+func samlServiceProvider(cfg models.OrganizationSAMLConfig) (*saml.ServiceProvider, error) {
+	metadataURL, err := url.Parse(samlServiceProviderURL(cfg.OrganizationID, "metadata"))
+	if err != nil {
+		return nil, err
+	}
+	acsURL, err := url.Parse(samlServiceProviderURL(cfg.OrganizationID, "acs"))
+	if err != nil {
+		return nil, err
+	}
+
+	sp := &saml.ServiceProvider{
+		EntityID:          metadataURL.String(),
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+	}
+
+	if cfg.IDPEntityID == "" || cfg.IDPSSOURL == "" || cfg.IDPCertificate == "" {
+		return sp, nil
+	}
+
+	cert, err := parseSAMLCertificate(cfg.IDPCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	sp.IDPMetadata = &saml.EntityDescriptor{
+		EntityID: cfg.IDPEntityID,
+		IDPSSODescriptors: []saml.IDPSSODescriptor{{
+			SSODescriptor: saml.SSODescriptor{
+				RoleDescriptor: saml.RoleDescriptor{
+					KeyDescriptors: []saml.KeyDescriptor{{
+						Use: "signing",
+						KeyInfo: saml.KeyInfo{X509Data: saml.X509Data{
+							X509Certificates: []saml.X509Certificate{{Data: base64.StdEncoding.EncodeToString(cert.Raw)}},
+						}},
+					}},
+				},
+			},
+			SingleSignOnServices: []saml.Endpoint{{Binding: saml.HTTPRedirectBinding, Location: cfg.IDPSSOURL}},
+		}},
+	}
+	return sp, nil
+}
+
+// parseSAMLCertificate parses a PEM-encoded certificate, or the bare base64 DER found in SAML metadata
+func parseSAMLCertificate(value string) (*x509.Certificate, error) {
+	value = strings.TrimSpace(value)
+
+	var der []byte
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+		if err != nil {
+			return nil, errors.New("certificate must be PEM or base64 encoded")
+		}
+		der = decoded
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// encodeSAMLCertificate returns a certificate in PEM encoding, the form it is stored in
+func encodeSAMLCertificate(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+// applySAMLMetadata fills in the identity provider's entity ID, redirect-binding SSO URL and signing
+// certificate from its metadata XML
+func applySAMLMetadata(cfg *models.OrganizationSAMLConfig, metadataXML string) error {
+	var metadata saml.EntityDescriptor
+	if err := xml.Unmarshal([]byte(metadataXML), &metadata); err != nil {
+		return errors.New("idp_metadata_xml is not a valid EntityDescriptor")
+	}
+	if metadata.EntityID == "" || len(metadata.IDPSSODescriptors) == 0 {
+		return errors.New("idp_metadata_xml does not describe an identity provider")
+	}
+
+	descriptor := metadata.IDPSSODescriptors[0]
+	ssoURL := ""
+	for _, endpoint := range descriptor.SingleSignOnServices {
+		if endpoint.Binding == saml.HTTPRedirectBinding {
+			ssoURL = endpoint.Location
+			break
+		}
+	}
+	if ssoURL == "" {
+		return errors.New("idp_metadata_xml has no HTTP-Redirect single sign-on service")
+	}
+
+	certificate := ""
+	for _, key := range descriptor.KeyDescriptors {
+		if (key.Use == "" || key.Use == "signing") && len(key.KeyInfo.X509Data.X509Certificates) > 0 {
+			certificate = key.KeyInfo.X509Data.X509Certificates[0].Data
+			break
+		}
+	}
+	if certificate == "" {
+		return errors.New("idp_metadata_xml has no signing certificate")
+	}
+
+	cfg.IDPEntityID = metadata.EntityID
+	cfg.IDPSSOURL = ssoURL
+	cfg.IDPCertificate = certificate
+	return nil
+}
+
+// toSAMLConfigResponse converts a SAML configuration model to its API response
+func toSAMLConfigResponse(cfg models.OrganizationSAMLConfig) models.SAMLConfigResponse {
+	return models.SAMLConfigResponse{
+		OrganizationID:  cfg.OrganizationID,
+		Enabled:         cfg.Enabled,
+		IDPEntityID:     cfg.IDPEntityID,
+		IDPSSOURL:       cfg.IDPSSOURL,
+		IDPCertificate:  cfg.IDPCertificate,
+		EmailAttribute:  cfg.EmailAttribute,
+		RoleAttribute:   cfg.RoleAttribute,
+		AdminRoleValue:  cfg.AdminRoleValue,
+		JITProvisioning: cfg.JITProvisioning,
+		SPEntityID:      samlServiceProviderURL(cfg.OrganizationID, "metadata"),
+		SPACSURL:        samlServiceProviderURL(cfg.OrganizationID, "acs"),
+		SPMetadataURL:   samlServiceProviderURL(cfg.OrganizationID, "metadata"),
+	}
+}
+
+// GetSAMLConfigHandler returns the organization's SAML configuration (admin only)
+func (oh *OrganizationHandlers) GetSAMLConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, ok := requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	cfg, err := loadSAMLConfig(oh.DB, orgID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to load SAML configuration", "SAML_CONFIG_FETCH_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toSAMLConfigResponse(cfg))
+}
+
+// UpdateSAMLConfigHandler changes the organization's SAML configuration (admins signed in as users only)
+func (oh *OrganizationHandlers) UpdateSAMLConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, _, ok := requireHumanAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateSAMLConfigRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	cfg, err := loadSAMLConfig(oh.DB, orgID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to load SAML configuration", "SAML_CONFIG_FETCH_ERROR")
+		return
+	}
+
+	// Metadata is applied first so explicitly provided fields take precedence
+	if req.IDPMetadataXML != nil {
+		if err := applySAMLMetadata(&cfg, *req.IDPMetadataXML); err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, err.Error(), "INVALID_SAML_CONFIG")
+			return
+		}
+	}
+	if req.IDPEntityID != nil {
+		cfg.IDPEntityID = strings.TrimSpace(*req.IDPEntityID)
+	}
+	if req.IDPSSOURL != nil {
+		cfg.IDPSSOURL = strings.TrimSpace(*req.IDPSSOURL)
+	}
+	if req.IDPCertificate != nil {
+		cfg.IDPCertificate = *req.IDPCertificate
+	}
+	if req.EmailAttribute != nil {
+		cfg.EmailAttribute = strings.TrimSpace(*req.EmailAttribute)
+	}
+	if req.RoleAttribute != nil {
+		cfg.RoleAttribute = strings.TrimSpace(*req.RoleAttribute)
+	}
+	if req.AdminRoleValue != nil {
+		cfg.AdminRoleValue = strings.TrimSpace(*req.AdminRoleValue)
+	}
+	if req.JITProvisioning != nil {
+		cfg.JITProvisioning = *req.JITProvisioning
+	}
+	if req.Enabled != nil {
+		cfg.Enabled = *req.Enabled
+	}
+
+	if cfg.IDPCertificate != "" {
+		cert, err := parseSAMLCertificate(cfg.IDPCertificate)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "idp_certificate: "+err.Error(), "INVALID_SAML_CONFIG")
+			return
+		}
+		cfg.IDPCertificate = encodeSAMLCertificate(cert)
+	}
+	if cfg.IDPSSOURL != "" {
+		if parsed, err := url.Parse(cfg.IDPSSOURL); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			writeErrorResponse(w, http.StatusBadRequest, "idp_sso_url must be an absolute HTTP(S) URL", "INVALID_SAML_CONFIG")
+			return
+		}
+	}
+	if cfg.Enabled && (cfg.IDPEntityID == "" || cfg.IDPSSOURL == "" || cfg.IDPCertificate == "") {
+		writeErrorResponse(w, http.StatusBadRequest, "SAML cannot be enabled without the identity provider's entity ID, SSO URL and certificate", "INVALID_SAML_CONFIG")
+		return
+	}
+
+	if err := oh.DB.Save(&cfg).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to update SAML configuration", "UPDATE_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toSAMLConfigResponse(cfg))
+}
+
+// parseSAMLPath extracts the organization ID and endpoint from the URL path: /api/saml/{org_id}/{endpoint}
+func parseSAMLPath(path string) (uint, string, bool) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 5 {
+		return 0, "", false
+	}
+
+	orgID, err := strconv.ParseUint(parts[3], 10, 32)
+	if err != nil {
+		return 0, "", false
+	}
+
+	return uint(orgID), parts[4], true
+}
+
+// SAMLHandler serves an organization's public service provider endpoints: metadata, login and ACS
+func (ah *AuthHandlers) SAMLHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, endpoint, ok := parseSAMLPath(r.URL.Path)
+	if !ok {
+		writeErrorResponse(w, http.StatusNotFound, "Not found", "NOT_FOUND")
+		return
+	}
+
+	switch endpoint {
+	case "metadata":
+		ah.samlMetadataHandler(w, r, orgID)
+	case "login":
+		ah.samlLoginHandler(w, r, orgID)
+	case "acs":
+		ah.samlACSHandler(w, r, orgID)
+	default:
+		writeErrorResponse(w, http.StatusNotFound, "Not found", "NOT_FOUND")
+	}
+}
+
+// samlMetadataHandler serves the service provider metadata to register at the organization's identity provider
+func (ah *AuthHandlers) samlMetadataHandler(w http.ResponseWriter, r *http.Request, orgID uint) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var organization models.Organization
+	if err := ah.DB.First(&organization, orgID).Error; err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "Organization not found", "ORGANIZATION_NOT_FOUND")
+		return
+	}
+
+	sp, err := samlServiceProvider(models.OrganizationSAMLConfig{OrganizationID: orgID})
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to build SAML metadata", "SAML_METADATA_ERROR")
+		return
+	}
+
+	metadata, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to build SAML metadata", "SAML_METADATA_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(metadata)
+}
+
+// samlLoginHandler starts a sign-in at the organization's identity provider and returns the URL to send the browser to
+func (ah *AuthHandlers) samlLoginHandler(w http.ResponseWriter, r *http.Request, orgID uint) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	cfg, err := loadSAMLConfig(ah.DB, orgID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to load SAML configuration", "SAML_CONFIG_FETCH_ERROR")
+		return
+	}
+	if !cfg.Enabled {
+		writeErrorResponse(w, http.StatusNotFound, "SAML sign-in is not enabled for this organization", "SAML_NOT_ENABLED")
+		return
+	}
+
+	sp, err := samlServiceProvider(cfg)
+	if err != nil {
+		log.Printf("Invalid SAML configuration for organization %d: %v", orgID, err)
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to start sign-in", "SAML_STATE_ERROR")
+		return
+	}
+
+	state, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to start sign-in", "SAML_STATE_ERROR")
+		return
+	}
+
+	authnRequest, err := sp.MakeAuthenticationRequest(cfg.IDPSSOURL, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to start sign-in", "SAML_STATE_ERROR")
+		return
+	}
+	redirectURL, err := authnRequest.Redirect(state, sp)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to start sign-in", "SAML_STATE_ERROR")
+		return
+	}
+
+	loginState := models.SAMLLoginState{
+		StateHash:      utils.HashToken(state),
+		OrganizationID: orgID,
+		RequestID:      authnRequest.ID,
+		ExpiresAt:      time.Now().Add(samlLoginTTL),
+	}
+	if err := ah.DB.Create(&loginState).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to start sign-in", "SAML_STATE_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.SAMLLoginResponse{
+		RedirectURL: redirectURL.String(),
+		ExpiresIn:   int(samlLoginTTL.Seconds()),
+	})
+}
+
+// samlACSHandler receives the identity provider's response, posted by the browser. The assertion is
+// validated and mapped to a user, and the browser is redirected to the frontend with a one-time code
+// to exchange for tokens, or with an error code.
+func (ah *AuthHandlers) samlACSHandler(w http.ResponseWriter, r *http.Request, orgID uint) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("SAMLResponse") == "" {
+		redirectSAMLCallback(w, r, "error", "INVALID_SAML_RESPONSE")
+		return
+	}
+
+	loginState, err := consumeSAMLLoginState(ah.DB, r.PostForm.Get("RelayState"), orgID)
+	if err != nil {
+		if err == errInvalidSAMLState {
+			redirectSAMLCallback(w, r, "error", "INVALID_SAML_STATE")
+		} else {
+			redirectSAMLCallback(w, r, "error", "SAML_STATE_ERROR")
+		}
+		return
+	}
+
+	cfg, err := loadSAMLConfig(ah.DB, orgID)
+	if err != nil || !cfg.Enabled {
+		redirectSAMLCallback(w, r, "error", "SAML_NOT_ENABLED")
+		return
+	}
+
+	sp, err := samlServiceProvider(cfg)
+	if err != nil {
+		log.Printf("Invalid SAML configuration for organization %d: %v", orgID, err)
+		redirectSAMLCallback(w, r, "error", "SAML_STATE_ERROR")
+		return
+	}
+
+	assertion, err := sp.ParseResponse(r, []string{loginState.RequestID})
+	if err != nil {
+		var invalidResponse *saml.InvalidResponseError
+		if errors.As(err, &invalidResponse) {
+			err = invalidResponse.PrivateErr
+		}
+		log.Printf("Rejected SAML response for organization %d: %v", orgID, err)
+		redirectSAMLCallback(w, r, "error", "INVALID_SAML_RESPONSE")
+		return
+	}
+
+	user, err := resolveSAMLUser(ah.DB, cfg, assertion)
+	if err != nil {
+		switch err {
+		case errSAMLEmailMissing:
+			redirectSAMLCallback(w, r, "error", "SAML_EMAIL_MISSING")
+		case errSAMLAccountNotFound:
+			redirectSAMLCallback(w, r, "error", "SAML_ACCOUNT_NOT_FOUND")
+		case errSAMLNotAMember:
+			redirectSAMLCallback(w, r, "error", "SAML_NOT_A_MEMBER")
+		default:
+			redirectSAMLCallback(w, r, "error", "SAML_USER_ERROR")
+		}
+		return
+	}
+
+	code, err := createUserToken(ah.DB, user.ID, models.TokenPurposeSAMLLogin, samlLoginCodeTTL)
+	if err != nil {
+		redirectSAMLCallback(w, r, "error", "SAML_USER_ERROR")
+		return
+	}
+
+	redirectSAMLCallback(w, r, "code", code)
+}
+
+// redirectSAMLCallback sends the browser to the frontend's SAML callback page with a single query parameter
+func redirectSAMLCallback(w http.ResponseWriter, r *http.Request, key, value string) {
+	query := url.Values{key: {value}}
+	http.Redirect(w, r, config.AppBaseURL()+"/auth/saml/callback?"+query.Encode(), http.StatusSeeOther)
+}
+
+// consumeSAMLLoginState validates a sign-in state for the organization and marks it as used, so each
+// authentication request completes at most one login
+func consumeSAMLLoginState(db *gorm.DB, state string, orgID uint) (*models.SAMLLoginState, error) {
+	if state == "" {
+		return nil, errInvalidSAMLState
+	}
+
+	var loginState models.SAMLLoginState
+	if err := db.Where("state_hash = ?", utils.HashToken(state)).First(&loginState).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidSAMLState
+		}
+		return nil, err
+	}
+
+	if loginState.OrganizationID != orgID || loginState.UsedAt != nil || time.Now().After(loginState.ExpiresAt) {
+		return nil, errInvalidSAMLState
+	}
+
+	// Mark the state as used, guarding against concurrent use of the same state
+	result := db.Model(&models.SAMLLoginState{}).
+		Where("id = ? AND used_at IS NULL", loginState.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errInvalidSAMLState
+	}
+
+	return &loginState, nil
+}
+
+// samlAttribute returns the first value of the named assertion attribute, matching its name or friendly name
+func samlAttribute(assertion *saml.Assertion, name string) string {
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if (attribute.Name == name || attribute.FriendlyName == name) && len(attribute.Values) > 0 {
+				return strings.TrimSpace(attribute.Values[0].Value)
+			}
+		}
+	}
+	return ""
+}
+
+// resolveSAMLUser finds the user behind a validated assertion. The identity provider can only sign in
+// members of the organization whose email is on a domain the organization has verified, or whom it
+// provisioned itself; unknown users on a verified domain are created together with a membership when
+// just-in-time provisioning is on. Existing accounts are never added to the organization this way, since
+// the organization's identity provider does not prove ownership of accounts outside it.
+func resolveSAMLUser(db *gorm.DB, cfg models.OrganizationSAMLConfig, assertion *saml.Assertion) (*models.User, error) {
+	email := ""
+	if cfg.EmailAttribute != "" {
+		email = samlAttribute(assertion, cfg.EmailAttribute)
+	} else if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		email = strings.TrimSpace(assertion.Subject.NameID.Value)
+	}
+	if email == "" || !utils.ValidateEmail(email) {
+		return nil, errSAMLEmailMissing
+	}
+
+	role := models.RoleMember
+	if cfg.RoleAttribute != "" && cfg.AdminRoleValue != "" && samlAttribute(assertion, cfg.RoleAttribute) == cfg.AdminRoleValue {
+		role = models.RoleAdmin
+	}
+
+	var user models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("normalized_email = ?", utils.EmailKey(email)).Limit(1).Find(&user).Error; err != nil {
+			return err
+		}
+
+		if user.ID != 0 {
+			allowed, err := samlCanSignIn(tx, cfg.OrganizationID, user)
+			if err != nil {
+				return err
+			}
+			if !allowed {
+				return errSAMLNotAMember
+			}
+			return nil
+		}
+
+		if !cfg.JITProvisioning {
+			return errSAMLAccountNotFound
+		}
+
+		// Accounts are only created for addresses the organization owns, so the identity provider cannot
+		// occupy an address before its owner registers
+		onDomain, err := emailOnVerifiedDomain(tx, cfg.OrganizationID, email)
+		if err != nil {
+			return err
+		}
+		if !onDomain {
+			return errSAMLAccountNotFound
+		}
+
+		// Provisioned users have no password until they reset one
+		user = models.User{Email: email}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.SAMLProvisionedUser{OrganizationID: cfg.OrganizationID, UserID: user.ID}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrganizationMembership{
+			UserID:         user.ID,
+			OrganizationID: cfg.OrganizationID,
+			Role:           role,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// samlCanSignIn reports whether the organization's identity provider may sign in an existing account. As
+// with SCIM linking, the asserted email alone is not enough: the user must be a member, and their email must
+// be on a domain the organization has verified or the organization must have provisioned the account.
+func samlCanSignIn(tx *gorm.DB, orgID uint, user models.User) (bool, error) {
+	var count int64
+	if err := tx.Model(&models.OrganizationMembership{}).Where("organization_id = ? AND user_id = ?", orgID, user.ID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, nil
+	}
+
+	if err := tx.Model(&models.SAMLProvisionedUser{}).Where("organization_id = ? AND user_id = ?", orgID, user.ID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	return emailOnVerifiedDomain(tx, orgID, user.Email)
+}
+
+// SAMLExchangeHandler exchanges the one-time code from a SAML sign-in for tokens. Like LoginHandler,
+// it returns tokens or an MFA challenge.
+func (ah *AuthHandlers) SAMLExchangeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var req models.SAMLExchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	record, err := consumeUserToken(ah.DB, req.Code, models.TokenPurposeSAMLLogin)
+	if err != nil {
+		if err == errInvalidUserToken {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid or expired sign-in code; please try again", "INVALID_SAML_CODE")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify sign-in code", "SAML_CODE_ERROR")
+		}
+		return
+	}
+
+	if record.User.ID == 0 {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid or expired sign-in code; please try again", "INVALID_SAML_CODE")
+		return
+	}
+
+	ah.completeLogin(w, r, record.User)
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"tmember/internal/models"
+
+	"github.com/crewjam/saml"
+	"gorm.io/gorm"
+)
+
+// samlServiceProviderLookup lets the test identity provider find the service provider of any organization
+type samlServiceProviderLookup struct{}
+
+func (samlServiceProviderLookup) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	orgID, endpoint, ok := parseSAMLPath(strings.TrimPrefix(serviceProviderID, "http://localhost:8080"))
+	if !ok || endpoint != "metadata" {
+		return nil, fmt.Errorf("unknown service provider %s", serviceProviderID)
+	}
+	sp, err := samlServiceProvider(models.OrganizationSAMLConfig{OrganizationID: orgID})
+	if err != nil {
+		return nil, err
+	}
+	return sp.Metadata(), nil
+}
+
+// newTestSAMLIdentityProvider returns an identity provider with a fresh self-signed signing certificate
+func newTestSAMLIdentityProvider(t *testing.T) *saml.IdentityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	metadataURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+	return &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		MetadataURL:             *metadataURL,
+		SSOURL:                  *ssoURL,
+		ServiceProviderProvider: samlServiceProviderLookup{},
+	}
+}
+
+// setupSAMLTestOrg creates an organization with an admin and configures the identity provider through the handler
+func setupSAMLTestOrg(t *testing.T, db *gorm.DB, idp *saml.IdentityProvider, jitProvisioning bool) models.Organization {
+	org := models.Organization{Name: "SAML Org"}
+	db.Create(&org)
+	admin := createUnitTestUser(db, "admin@example.com")
+	db.Create(&models.OrganizationMembership{UserID: admin.ID, OrganizationID: org.ID, Role: models.RoleAdmin})
+
+	metadata, _ := xml.Marshal(idp.Metadata())
+	w := updateSAMLConfig(db, admin, org.ID, map[string]interface{}{
+		"enabled":          true,
+		"idp_metadata_xml": string(metadata),
+		"role_attribute":   "groups",
+		"admin_role_value": "tmember-admins",
+		"jit_provisioning": jitProvisioning,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	return org
+}
+
+// updateSAMLConfig calls the SAML configuration endpoint as the given user
+func updateSAMLConfig(db *gorm.DB, user models.User, orgID uint, body map[string]interface{}) *httptest.ResponseRecorder {
+	orgHandlers := NewOrganizationHandlers(db)
+	reqBody, _ := json.Marshal(body)
+	req := withUserContext(httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/organizations/%d/saml", orgID), bytes.NewBuffer(reqBody)), user)
+	w := httptest.NewRecorder()
+	orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.UpdateSAMLConfigHandler)).ServeHTTP(w, req)
+	return w
+}
+
+// samlLogin starts a sign-in, lets the identity provider assert the session and posts the response to the
+// ACS endpoint. It returns the query of the frontend callback URL and the posted form.
+func samlLogin(t *testing.T, authHandlers *AuthHandlers, idp *saml.IdentityProvider, orgID uint, session *saml.Session) (url.Values, url.Values) {
+	w := httptest.NewRecorder()
+	authHandlers.SAMLHandler(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/saml/%d/login", orgID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var login models.SAMLLoginResponse
+	json.NewDecoder(w.Body).Decode(&login)
+
+	idpRequest, err := saml.NewIdpAuthnRequest(idp, httptest.NewRequest(http.MethodGet, login.RedirectURL, nil))
+	if err != nil {
+		t.Fatalf("Failed to read authentication request: %v", err)
+	}
+	if err := idpRequest.Validate(); err != nil {
+		t.Fatalf("Identity provider rejected the authentication request: %v", err)
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(idpRequest, session); err != nil {
+		t.Fatalf("Failed to make assertion: %v", err)
+	}
+	form, err := idpRequest.PostBinding()
+	if err != nil {
+		t.Fatalf("Failed to build response: %v", err)
+	}
+
+	posted := url.Values{"SAMLResponse": {form.SAMLResponse}, "RelayState": {form.RelayState}}
+	return postSAMLResponse(t, authHandlers, form.URL, posted), posted
+}
+
+// postSAMLResponse posts a form to the ACS endpoint and returns the query of the frontend callback URL
+func postSAMLResponse(t *testing.T, authHandlers *AuthHandlers, acsURL string, form url.Values) url.Values {
+	req := httptest.NewRequest(http.MethodPost, acsURL, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	authHandlers.SAMLHandler(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil || !strings.HasSuffix(location.Path, "/auth/saml/callback") {
+		t.Fatalf("Unexpected redirect: %s", w.Header().Get("Location"))
+	}
+	return location.Query()
+}
+
+// exchangeSAMLCode exchanges the one-time code from a SAML sign-in for tokens
+func exchangeSAMLCode(authHandlers *AuthHandlers, code string) *httptest.ResponseRecorder {
+	return postJSON(authHandlers.SAMLExchangeHandler, "/api/auth/saml/exchange", models.SAMLExchangeRequest{Code: code})
+}
+
+func TestSAMLConfig_Update(t *testing.T) {
+	db := setupTestDBForUnit()
+	db.AutoMigrate(&models.OrganizationSAMLConfig{}, &models.SAMLLoginState{}, &models.SAMLProvisionedUser{})
+	idp := newTestSAMLIdentityProvider(t)
+	org := setupSAMLTestOrg(t, db, idp, false)
+
+	cfg, _ := loadSAMLConfig(db, org.ID)
+	if !cfg.Enabled || cfg.IDPEntityID != "https://idp.example.com/metadata" || cfg.IDPSSOURL != "https://idp.example.com/sso" {
+		t.Errorf("Expected the identity provider to be read from its metadata, got %+v", cfg)
+	}
+	if !strings.HasPrefix(cfg.IDPCertificate, "-----BEGIN CERTIFICATE-----") {
+		t.Errorf("Expected the certificate to be stored as PEM, got %q", cfg.IDPCertificate)
+	}
+
+	var admin models.User
+	db.Where("email = ?", "admin@example.com").First(&admin)
+	member := createUnitTestUser(db, "member@example.com")
+	db.Create(&models.OrganizationMembership{UserID: member.ID, OrganizationID: org.ID, Role: models.RoleMember})
+
+	if w := updateSAMLConfig(db, member, org.ID, map[string]interface{}{"enabled": false}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected members to be refused, got %d", w.Code)
+	}
+	if w := updateSAMLConfig(db, admin, org.ID, map[string]interface{}{"idp_certificate": "not a certificate"}); w.Code != http.StatusBadRequest || decodeErrorCode(w) != "INVALID_SAML_CONFIG" {
+		t.Errorf("Expected an invalid certificate to be rejected, got %d", w.Code)
+	}
+	if w := updateSAMLConfig(db, admin, org.ID, map[string]interface{}{"idp_sso_url": ""}); w.Code != http.StatusBadRequest || decodeErrorCode(w) != "INVALID_SAML_CONFIG" {
+		t.Errorf("Expected an enabled configuration without an SSO URL to be rejected, got %d", w.Code)
+	}
+
+	// The service provider metadata names the ACS endpoint to register at the identity provider
+	authHandlers := NewAuthHandlers(db)
+	w := httptest.NewRecorder()
+	authHandlers.SAMLHandler(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/saml/%d/metadata", org.ID), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), fmt.Sprintf("/api/saml/%d/acs", org.ID)) {
+		t.Errorf("Expected service provider metadata, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSAMLLogin_ProvisionsMembers(t *testing.T) {
+	db := setupTestDBForUnit()
+	db.AutoMigrate(&models.OrganizationSAMLConfig{}, &models.SAMLLoginState{}, &models.SAMLProvisionedUser{})
+	idp := newTestSAMLIdentityProvider(t)
+	org := setupSAMLTestOrg(t, db, idp, true)
+	authHandlers := NewAuthHandlers(db)
+
+	// Only addresses on the organization's verified domains are provisioned
+	if callback, _ := samlLogin(t, authHandlers, idp, org.ID, &saml.Session{NameID: "victim@gmail.com"}); callback.Get("error") != "SAML_ACCOUNT_NOT_FOUND" {
+		t.Errorf("Expected SAML_ACCOUNT_NOT_FOUND for an unverified domain, got %v", callback)
+	}
+	domain := createVerifiedDomainForTest(db, org.ID, "example.com")
+
+	callback, _ := samlLogin(t, authHandlers, idp, org.ID, &saml.Session{
+		NameID: "jane@example.com",
+		CustomAttributes: []saml.Attribute{{
+			Name:   "groups",
+			Values: []saml.AttributeValue{{Type: "xs:string", Value: "tmember-admins"}},
+		}},
+	})
+	if callback.Get("code") == "" {
+		t.Fatalf("Expected a sign-in code, got error %q", callback.Get("error"))
+	}
+
+	w := exchangeSAMLCode(authHandlers, callback.Get("code"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response models.AuthResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Token == "" || response.User.Email != "jane@example.com" {
+		t.Errorf("Expected tokens for the provisioned user, got %+v", response.User)
+	}
+
+	var membership models.OrganizationMembership
+	db.Where("organization_id = ? AND user_id = ?", org.ID, response.User.ID).First(&membership)
+	if membership.Role != models.RoleAdmin {
+		t.Errorf("Expected the mapped admin role, got %q", membership.Role)
+	}
+
+	// Codes are single use
+	if w := exchangeSAMLCode(authHandlers, callback.Get("code")); w.Code != http.StatusBadRequest || decodeErrorCode(w) != "INVALID_SAML_CODE" {
+		t.Errorf("Expected INVALID_SAML_CODE for a used code, got %d", w.Code)
+	}
+
+	// Signing in again reuses the user and membership, even once the domain is no longer verified
+	db.Delete(&domain)
+	callback, _ = samlLogin(t, authHandlers, idp, org.ID, &saml.Session{NameID: "jane@example.com"})
+	if callback.Get("code") == "" {
+		t.Fatalf("Expected a sign-in code, got error %q", callback.Get("error"))
+	}
+	var memberships int64
+	db.Model(&models.OrganizationMembership{}).Where("organization_id = ?", org.ID).Count(&memberships)
+	if memberships != 2 {
+		t.Errorf("Expected 2 memberships, got %d", memberships)
+	}
+
+	// Once the owner of the address proves they control it, the account is no longer the organization's
+	var jane models.User
+	db.Where("email = ?", "jane@example.com").First(&jane)
+	if err := markEmailVerified(db, &jane); err != nil {
+		t.Fatalf("Failed to verify email: %v", err)
+	}
+	if callback, _ := samlLogin(t, authHandlers, idp, org.ID, &saml.Session{NameID: "jane@example.com"}); callback.Get("error") != "SAML_NOT_A_MEMBER" {
+		t.Errorf("Expected SAML_NOT_A_MEMBER after the owner took the account over, got %v", callback)
+	}
+}
+
+func TestSAMLLogin_Rejections(t *testing.T) {
+	db := setupTestDBForUnit()
+	db.AutoMigrate(&models.OrganizationSAMLConfig{}, &models.SAMLLoginState{}, &models.SAMLProvisionedUser{})
+	idp := newTestSAMLIdentityProvider(t)
+	org := setupSAMLTestOrg(t, db, idp, false)
+	authHandlers := NewAuthHandlers(db)
+
+	// Unknown users are refused without just-in-time provisioning
+	callback, posted := samlLogin(t, authHandlers, idp, org.ID, &saml.Session{NameID: "stranger@example.com"})
+	if callback.Get("error") != "SAML_ACCOUNT_NOT_FOUND" {
+		t.Errorf("Expected SAML_ACCOUNT_NOT_FOUND, got %v", callback)
+	}
+
+	// Responses cannot be replayed
+	acsURL := fmt.Sprintf("http://localhost:8080/api/saml/%d/acs", org.ID)
+	if callback := postSAMLResponse(t, authHandlers, acsURL, posted); callback.Get("error") != "INVALID_SAML_STATE" {
+		t.Errorf("Expected INVALID_SAML_STATE for a replayed response, got %v", callback)
+	}
+
+	// The identity provider cannot sign in accounts outside the organization
+	createUnitTestUser(db, "outsider@example.com")
+	if callback, _ := samlLogin(t, authHandlers, idp, org.ID, &saml.Session{NameID: "outsider@example.com"}); callback.Get("error") != "SAML_NOT_A_MEMBER" {
+		t.Errorf("Expected SAML_NOT_A_MEMBER, got %v", callback)
+	}
+
+	// Assertions signed by another key are rejected
+	impostor := newTestSAMLIdentityProvider(t)
+	if callback, _ := samlLogin(t, authHandlers, impostor, org.ID, &saml.Session{NameID: "admin@example.com"}); callback.Get("error") != "INVALID_SAML_RESPONSE" {
+		t.Errorf("Expected INVALID_SAML_RESPONSE, got %v", callback)
+	}
+
+	// Members are refused while their email is on a domain the organization has not verified
+	if callback, _ := samlLogin(t, authHandlers, idp, org.ID, &saml.Session{NameID: "admin@example.com"}); callback.Get("error") != "SAML_NOT_A_MEMBER" {
+		t.Errorf("Expected SAML_NOT_A_MEMBER for a member on an unverified domain, got %v", callback)
+	}
+
+	// Members on a verified domain sign in
+	createVerifiedDomainForTest(db, org.ID, "example.com")
+	callback, _ = samlLogin(t, authHandlers, idp, org.ID, &saml.Session{NameID: "admin@example.com"})
+	if w := exchangeSAMLCode(authHandlers, callback.Get("code")); w.Code != http.StatusOK {
+		t.Errorf("Expected the member to sign in, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Disabled organizations cannot start a sign-in
+	var admin models.User
+	db.Where("email = ?", "admin@example.com").First(&admin)
+	updateSAMLConfig(db, admin, org.ID, map[string]interface{}{"enabled": false})
+	w := httptest.NewRecorder()
+	authHandlers.SAMLHandler(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/saml/%d/login", org.ID), nil))
+	if w.Code != http.StatusNotFound || decodeErrorCode(w) != "SAML_NOT_ENABLED" {
+		t.Errorf("Expected SAML_NOT_ENABLED, got %d", w.Code)
+	}
+}
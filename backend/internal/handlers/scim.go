@@ -0,0 +1,1014 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tmember/internal/config"
+	"tmember/internal/models"
+	"tmember/internal/scim"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// scimMaxResults is the page size of SCIM list responses and the largest count a client may request
+const scimMaxResults = 100
+
+// CreateSCIMTokenHandler issues a SCIM provisioning token for the organization and returns it once (admin only)
+func (oh *OrganizationHandlers) CreateSCIMTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, userID, ok := requireHumanAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateSCIMTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	// Validate name
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxTokenNameLength {
+		writeErrorResponse(w, http.StatusBadRequest, "Token name is required and must be at most 100 characters", "INVALID_NAME")
+		return
+	}
+
+	secret, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to generate token", "TOKEN_GENERATION_ERROR")
+		return
+	}
+	token := models.SCIMTokenPrefix + secret
+
+	record := models.SCIMToken{
+		OrganizationID: orgID,
+		Name:           name,
+		TokenHash:      utils.HashToken(token),
+		TokenHint:      token[:tokenHintLength],
+		CreatedByID:    userID,
+	}
+
+	if err := oh.DB.Create(&record).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to create token", "CREATION_ERROR")
+		return
+	}
+
+	response := toSCIMTokenResponse(record)
+	response.Token = token
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListSCIMTokensHandler lists the organization's active SCIM provisioning tokens (admin only)
+func (oh *OrganizationHandlers) ListSCIMTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, _, ok := requireHumanAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var tokens []models.SCIMToken
+	if err := oh.DB.Where("organization_id = ? AND revoked_at IS NULL", orgID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch tokens", "FETCH_ERROR")
+		return
+	}
+
+	// Convert to response format
+	response := models.ListSCIMTokensResponse{
+		Tokens: make([]models.SCIMTokenResponse, len(tokens)),
+	}
+	for i, token := range tokens {
+		response.Tokens[i] = toSCIMTokenResponse(token)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeSCIMTokenHandler revokes one of the organization's SCIM provisioning tokens (admin only)
+func (oh *OrganizationHandlers) RevokeSCIMTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, _, ok := requireHumanAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	// Extract token ID from URL path
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 6 {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid token ID", "INVALID_TOKEN_ID")
+		return
+	}
+
+	tokenID, err := strconv.ParseUint(parts[5], 10, 32) // /api/organizations/{id}/scim-tokens/{token_id}
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid token ID format", "INVALID_TOKEN_ID_FORMAT")
+		return
+	}
+
+	result := oh.DB.Model(&models.SCIMToken{}).
+		Where("id = ? AND organization_id = ? AND revoked_at IS NULL", uint(tokenID), orgID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to revoke token", "REVOKE_ERROR")
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeErrorResponse(w, http.StatusNotFound, "Token not found", "TOKEN_NOT_FOUND")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":  "Token revoked successfully",
+		"token_id": uint(tokenID),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// SCIMHandler serves the SCIM 2.0 service provider under /scim/v2/. Clients authenticate with one of an
+// organization's SCIM tokens and provision that organization's users and groups.
+func (oh *OrganizationHandlers) SCIMHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, err := oh.authenticateSCIM(r)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	// /scim/v2/{resource_type}[/{id}]
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/scim/v2"), "/"), "/")
+	if len(parts) > 2 {
+		writeSCIMError(w, scim.NewError(http.StatusNotFound, "", "Resource not found"))
+		return
+	}
+	id := ""
+	if len(parts) == 2 {
+		id = parts[1]
+	}
+
+	switch {
+	case parts[0] == "Users":
+		err = oh.serveSCIMUsers(w, r, orgID, id)
+	case parts[0] == "Groups":
+		err = oh.serveSCIMGroups(w, r, orgID, id)
+	case parts[0] == "ServiceProviderConfig" && id == "" && r.Method == http.MethodGet:
+		writeSCIM(w, http.StatusOK, scimServiceProviderConfig())
+	case parts[0] == "ResourceTypes" && id == "" && r.Method == http.MethodGet:
+		writeSCIM(w, http.StatusOK, scimResourceTypes())
+	default:
+		err = scim.NewError(http.StatusNotFound, "", "Resource not found")
+	}
+	if err != nil {
+		writeSCIMError(w, err)
+	}
+}
+
+// authenticateSCIM returns the organization whose SCIM token authenticates the request
+func (oh *OrganizationHandlers) authenticateSCIM(r *http.Request) (uint, error) {
+	unauthorized := scim.NewError(http.StatusUnauthorized, "", "Invalid or missing SCIM token")
+
+	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !strings.HasPrefix(tokenString, models.SCIMTokenPrefix) {
+		return 0, unauthorized
+	}
+
+	var token models.SCIMToken
+	if err := oh.DB.Where("token_hash = ? AND revoked_at IS NULL", utils.HashToken(tokenString)).First(&token).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, unauthorized
+		}
+		return 0, err
+	}
+
+	// Record token usage, throttled to avoid a write on every request
+	if now := time.Now(); token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > models.SessionLastSeenInterval {
+		oh.DB.Model(&token).UpdateColumn("last_used_at", now)
+	}
+
+	return token.OrganizationID, nil
+}
+
+// serveSCIMUsers dispatches requests for the /Users collection and its members
+func (oh *OrganizationHandlers) serveSCIMUsers(w http.ResponseWriter, r *http.Request, orgID uint, id string) error {
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			users, err := loadSCIMUsers(oh.DB, orgID, 0)
+			if err != nil {
+				return err
+			}
+			resources := make([]interface{}, len(users))
+			for i, user := range users {
+				resources[i] = user
+			}
+			return writeSCIMList(w, r, resources)
+		case http.MethodPost:
+			return oh.createSCIMUser(w, r, orgID)
+		}
+		return scim.NewError(http.StatusMethodNotAllowed, "", "Method not allowed")
+	}
+
+	userID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return scim.NewError(http.StatusNotFound, "", "User not found")
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		user, err := getSCIMUser(oh.DB, orgID, uint(userID))
+		if err != nil {
+			return err
+		}
+		return writeSCIMResource(w, r, http.StatusOK, user)
+	case http.MethodPut:
+		var resource scim.User
+		if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+			return scim.NewError(http.StatusBadRequest, scim.ErrInvalidSyntax, "Invalid JSON payload")
+		}
+		return oh.replaceSCIMUser(w, r, orgID, uint(userID), resource)
+	case http.MethodPatch:
+		current, err := getSCIMUser(oh.DB, orgID, uint(userID))
+		if err != nil {
+			return err
+		}
+		var patched scim.User
+		if err := applySCIMPatch(r, current, &patched); err != nil {
+			return err
+		}
+		return oh.replaceSCIMUser(w, r, orgID, uint(userID), patched)
+	case http.MethodDelete:
+		return oh.deleteSCIMUser(w, orgID, uint(userID))
+	}
+	return scim.NewError(http.StatusMethodNotAllowed, "", "Method not allowed")
+}
+
+// createSCIMUser provisions a user into the organization. An existing account is only taken over if
+// the user already belongs to the organization or their email is on a domain the organization verified,
+// and new accounts are only created on such domains.
+func (oh *OrganizationHandlers) createSCIMUser(w http.ResponseWriter, r *http.Request, orgID uint) error {
+	var resource scim.User
+	if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+		return scim.NewError(http.StatusBadRequest, scim.ErrInvalidSyntax, "Invalid JSON payload")
+	}
+
+	email := strings.TrimSpace(resource.UserName)
+	if !utils.ValidateEmail(email) {
+		return scim.NewError(http.StatusBadRequest, scim.ErrInvalidValue, "userName must be an email address")
+	}
+
+	var userID uint
+	err := oh.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("normalized_email = ?", utils.EmailKey(email)).Limit(1).Find(&user).Error; err != nil {
+			return err
+		}
+
+		managed := false
+		if user.ID != 0 {
+			var links int64
+			if err := tx.Model(&models.SCIMUser{}).Where("organization_id = ? AND user_id = ?", orgID, user.ID).Count(&links).Error; err != nil {
+				return err
+			}
+			if links > 0 {
+				return scim.NewError(http.StatusConflict, scim.ErrUniqueness, "A user with this userName is already provisioned")
+			}
+
+			allowed, err := scimCanLinkUser(tx, orgID, user)
+			if err != nil {
+				return err
+			}
+			if !allowed {
+				return scim.NewError(http.StatusConflict, scim.ErrUniqueness, "A user with this userName already exists outside the organization")
+			}
+		} else {
+			if err := requireSCIMVerifiedDomain(tx, orgID, email); err != nil {
+				return err
+			}
+
+			// Provisioned users have no password until they reset one
+			user = models.User{Email: email}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			managed = true
+		}
+
+		link := models.SCIMUser{OrganizationID: orgID, UserID: user.ID, Managed: managed}
+		applySCIMUserAttributes(&link, resource)
+		if err := tx.Create(&link).Error; err != nil {
+			return err
+		}
+
+		userID = user.ID
+		return setSCIMUserActive(tx, orgID, user.ID, resource.Active == nil || bool(*resource.Active))
+	})
+	if err != nil {
+		return err
+	}
+
+	created, err := getSCIMUser(oh.DB, orgID, userID)
+	if err != nil {
+		return err
+	}
+	return writeSCIMResource(w, r, http.StatusCreated, created)
+}
+
+// replaceSCIMUser updates a provisioned user from the full resource, as sent by PUT or produced by PATCH.
+// Only accounts created by provisioning, and not yet taken over by the owner of their address, may have their
+// userName changed; the new address must be on a verified domain and is unverified.
+func (oh *OrganizationHandlers) replaceSCIMUser(w http.ResponseWriter, r *http.Request, orgID, userID uint, resource scim.User) error {
+	err := oh.DB.Transaction(func(tx *gorm.DB) error {
+		var link models.SCIMUser
+		if err := tx.Preload("User").Where("organization_id = ? AND user_id = ?", orgID, userID).Limit(1).Find(&link).Error; err != nil {
+			return err
+		}
+		if link.ID == 0 || link.User.ID == 0 {
+			return scim.NewError(http.StatusNotFound, "", "User not found")
+		}
+
+		email := strings.TrimSpace(resource.UserName)
+		if email != link.User.Email {
+			if !utils.ValidateEmail(email) {
+				return scim.NewError(http.StatusBadRequest, scim.ErrInvalidValue, "userName must be an email address")
+			}
+			if !link.Managed {
+				return scim.NewError(http.StatusBadRequest, scim.ErrMutability, "userName can only be changed for users created by provisioning")
+			}
+			if err := requireSCIMVerifiedDomain(tx, orgID, email); err != nil {
+				return err
+			}
+
+			var taken int64
+			if err := tx.Model(&models.User{}).Where("normalized_email = ? AND id <> ?", utils.EmailKey(email), userID).Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken > 0 {
+				return scim.NewError(http.StatusConflict, scim.ErrUniqueness, "A user with this userName already exists")
+			}
+
+			if err := tx.Model(&link.User).Updates(map[string]interface{}{"email": email, "email_verified_at": nil}).Error; err != nil {
+				return err
+			}
+		}
+
+		applySCIMUserAttributes(&link, resource)
+		if err := tx.Omit(clause.Associations).Save(&link).Error; err != nil {
+			return err
+		}
+
+		if resource.Active == nil {
+			return nil
+		}
+		return setSCIMUserActive(tx, orgID, userID, bool(*resource.Active))
+	})
+	if err != nil {
+		return err
+	}
+
+	updated, err := getSCIMUser(oh.DB, orgID, userID)
+	if err != nil {
+		return err
+	}
+	return writeSCIMResource(w, r, http.StatusOK, updated)
+}
+
+// deleteSCIMUser deprovisions a user: they leave the organization and its groups, but keep their account
+func (oh *OrganizationHandlers) deleteSCIMUser(w http.ResponseWriter, orgID, userID uint) error {
+	err := oh.DB.Transaction(func(tx *gorm.DB) error {
+		var link models.SCIMUser
+		if err := tx.Where("organization_id = ? AND user_id = ?", orgID, userID).Limit(1).Find(&link).Error; err != nil {
+			return err
+		}
+		if link.ID == 0 {
+			return scim.NewError(http.StatusNotFound, "", "User not found")
+		}
+
+		if err := setSCIMUserActive(tx, orgID, userID, false); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND group_id IN (?)", userID, tx.Model(&models.SCIMGroup{}).Select("id").Where("organization_id = ?", orgID)).
+			Delete(&models.SCIMGroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&link).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// requireSCIMVerifiedDomain returns a SCIM error unless the email is on a domain the organization has
+// verified, so that provisioning cannot occupy addresses the organization does not own
+func requireSCIMVerifiedDomain(tx *gorm.DB, orgID uint, email string) error {
+	onDomain, err := emailOnVerifiedDomain(tx, orgID, email)
+	if err != nil {
+		return err
+	}
+	if !onDomain {
+		return scim.NewError(http.StatusBadRequest, scim.ErrInvalidValue, "userName must be on a domain the organization has verified")
+	}
+	return nil
+}
+
+// scimCanLinkUser reports whether an existing account may be provisioned into the organization: the user
+// is a member already, or their email is on a domain the organization has verified
+func scimCanLinkUser(tx *gorm.DB, orgID uint, user models.User) (bool, error) {
+	var count int64
+	if err := tx.Model(&models.OrganizationMembership{}).Where("organization_id = ? AND user_id = ?", orgID, user.ID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	return emailOnVerifiedDomain(tx, orgID, user.Email)
+}
+
+// setSCIMUserActive maps a user's active attribute onto their membership. Deactivation removes the
+// membership; reactivation restores the most recently removed one, keeping the user's role.
+func setSCIMUserActive(tx *gorm.DB, orgID, userID uint, active bool) error {
+	var membership models.OrganizationMembership
+	if err := tx.Where("organization_id = ? AND user_id = ?", orgID, userID).Limit(1).Find(&membership).Error; err != nil {
+		return err
+	}
+
+	if active {
+		if membership.ID != 0 {
+			return nil
+		}
+
+		var previous models.OrganizationMembership
+		if err := tx.Unscoped().
+			Where("organization_id = ? AND user_id = ? AND deleted_at IS NOT NULL", orgID, userID).
+			Order("deleted_at DESC").Limit(1).Find(&previous).Error; err != nil {
+			return err
+		}
+		if previous.ID != 0 {
+			return tx.Unscoped().Model(&previous).Update("deleted_at", nil).Error
+		}
+
+		return tx.Create(&models.OrganizationMembership{
+			UserID:         userID,
+			OrganizationID: orgID,
+			Role:           models.RoleMember,
+		}).Error
+	}
+
+	if membership.ID == 0 {
+		return nil
+	}
+
+	// Prevent removing the last admin
+	if membership.Role == models.RoleAdmin {
+		var adminCount int64
+		if err := tx.Model(&models.OrganizationMembership{}).Where("organization_id = ? AND role = ?", orgID, models.RoleAdmin).Count(&adminCount).Error; err != nil {
+			return err
+		}
+		if adminCount <= 1 {
+			return scim.NewError(http.StatusBadRequest, scim.ErrInvalidValue, "Cannot deactivate the last admin of the organization")
+		}
+	}
+
+	return tx.Delete(&membership).Error
+}
+
+// applySCIMUserAttributes copies the attributes tmember stores for provisioned users from a resource
+func applySCIMUserAttributes(link *models.SCIMUser, resource scim.User) {
+	link.ExternalID = resource.ExternalID
+	link.DisplayName = resource.DisplayName
+	link.GivenName, link.FamilyName = "", ""
+	if resource.Name != nil {
+		link.GivenName = resource.Name.GivenName
+		link.FamilyName = resource.Name.FamilyName
+	}
+}
+
+// loadSCIMUsers returns the organization's provisioned users ordered by ID, or just the given user if
+// userID is not zero
+func loadSCIMUsers(db *gorm.DB, orgID, userID uint) ([]scim.User, error) {
+	query := db.Preload("User").Where("organization_id = ?", orgID).Order("user_id")
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	var links []models.SCIMUser
+	if err := query.Find(&links).Error; err != nil {
+		return nil, err
+	}
+
+	var memberIDs []uint
+	if err := db.Model(&models.OrganizationMembership{}).Where("organization_id = ?", orgID).Pluck("user_id", &memberIDs).Error; err != nil {
+		return nil, err
+	}
+	active := make(map[uint]bool, len(memberIDs))
+	for _, id := range memberIDs {
+		active[id] = true
+	}
+
+	var groupRows []struct {
+		UserID      uint
+		GroupID     uint
+		DisplayName string
+	}
+	if err := db.Table("scim_group_members").
+		Select("scim_group_members.user_id, scim_group_members.group_id, scim_groups.display_name").
+		Joins("JOIN scim_groups ON scim_groups.id = scim_group_members.group_id").
+		Where("scim_groups.organization_id = ?", orgID).
+		Order("scim_groups.id").
+		Scan(&groupRows).Error; err != nil {
+		return nil, err
+	}
+	groups := make(map[uint][]scim.MultiValuedAttribute)
+	for _, row := range groupRows {
+		groups[row.UserID] = append(groups[row.UserID], scim.MultiValuedAttribute{
+			Value:   strconv.FormatUint(uint64(row.GroupID), 10),
+			Display: row.DisplayName,
+			Ref:     scimLocation("Groups", row.GroupID),
+		})
+	}
+
+	users := make([]scim.User, 0, len(links))
+	for _, link := range links {
+		// Deleted accounts are not loaded with their link
+		if link.User.ID == 0 {
+			continue
+		}
+		users = append(users, toSCIMUser(link, active[link.UserID], groups[link.UserID]))
+	}
+	return users, nil
+}
+
+// getSCIMUser returns one of the organization's provisioned users
+func getSCIMUser(db *gorm.DB, orgID, userID uint) (scim.User, error) {
+	users, err := loadSCIMUsers(db, orgID, userID)
+	if err != nil {
+		return scim.User{}, err
+	}
+	if len(users) == 0 {
+		return scim.User{}, scim.NewError(http.StatusNotFound, "", "User not found")
+	}
+	return users[0], nil
+}
+
+// toSCIMUser converts a provisioned user to a SCIM User resource. The user's email is both their
+// userName and their only email.
+func toSCIMUser(link models.SCIMUser, active bool, groups []scim.MultiValuedAttribute) scim.User {
+	isActive := scim.Boolean(active)
+	user := scim.User{
+		Schemas:     []string{scim.UserSchema},
+		ID:          strconv.FormatUint(uint64(link.UserID), 10),
+		ExternalID:  link.ExternalID,
+		UserName:    link.User.Email,
+		DisplayName: link.DisplayName,
+		Emails:      []scim.MultiValuedAttribute{{Value: link.User.Email, Type: "work", Primary: true}},
+		Active:      &isActive,
+		Groups:      groups,
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      link.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			LastModified: link.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			Location:     scimLocation("Users", link.UserID),
+		},
+	}
+	if link.GivenName != "" || link.FamilyName != "" {
+		user.Name = &scim.Name{GivenName: link.GivenName, FamilyName: link.FamilyName}
+	}
+	return user
+}
+
+// serveSCIMGroups dispatches requests for the /Groups collection and its members
+func (oh *OrganizationHandlers) serveSCIMGroups(w http.ResponseWriter, r *http.Request, orgID uint, id string) error {
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			groups, err := loadSCIMGroups(oh.DB, orgID, 0)
+			if err != nil {
+				return err
+			}
+			resources := make([]interface{}, len(groups))
+			for i, group := range groups {
+				resources[i] = group
+			}
+			return writeSCIMList(w, r, resources)
+		case http.MethodPost:
+			var resource scim.Group
+			if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+				return scim.NewError(http.StatusBadRequest, scim.ErrInvalidSyntax, "Invalid JSON payload")
+			}
+			return oh.saveSCIMGroup(w, r, orgID, 0, resource)
+		}
+		return scim.NewError(http.StatusMethodNotAllowed, "", "Method not allowed")
+	}
+
+	groupID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return scim.NewError(http.StatusNotFound, "", "Group not found")
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		group, err := getSCIMGroup(oh.DB, orgID, uint(groupID))
+		if err != nil {
+			return err
+		}
+		return writeSCIMResource(w, r, http.StatusOK, group)
+	case http.MethodPut:
+		var resource scim.Group
+		if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+			return scim.NewError(http.StatusBadRequest, scim.ErrInvalidSyntax, "Invalid JSON payload")
+		}
+		return oh.saveSCIMGroup(w, r, orgID, uint(groupID), resource)
+	case http.MethodPatch:
+		current, err := getSCIMGroup(oh.DB, orgID, uint(groupID))
+		if err != nil {
+			return err
+		}
+		var patched scim.Group
+		if err := applySCIMPatch(r, current, &patched); err != nil {
+			return err
+		}
+		return oh.saveSCIMGroup(w, r, orgID, uint(groupID), patched)
+	case http.MethodDelete:
+		return oh.deleteSCIMGroup(w, orgID, uint(groupID))
+	}
+	return scim.NewError(http.StatusMethodNotAllowed, "", "Method not allowed")
+}
+
+// saveSCIMGroup creates a group, or replaces the group with the given ID, from a resource. Group names are
+// unique within the organization and members must be users provisioned into it.
+func (oh *OrganizationHandlers) saveSCIMGroup(w http.ResponseWriter, r *http.Request, orgID, groupID uint, resource scim.Group) error {
+	name := strings.TrimSpace(resource.DisplayName)
+	if name == "" || len(name) > 255 {
+		return scim.NewError(http.StatusBadRequest, scim.ErrInvalidValue, "displayName is required and must be at most 255 characters")
+	}
+
+	var group models.SCIMGroup
+	err := oh.DB.Transaction(func(tx *gorm.DB) error {
+		if groupID != 0 {
+			if err := tx.Where("id = ? AND organization_id = ?", groupID, orgID).Limit(1).Find(&group).Error; err != nil {
+				return err
+			}
+			if group.ID == 0 {
+				return scim.NewError(http.StatusNotFound, "", "Group not found")
+			}
+		}
+
+		var taken int64
+		if err := tx.Model(&models.SCIMGroup{}).
+			Where("organization_id = ? AND display_name = ? AND id <> ?", orgID, name, groupID).
+			Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return scim.NewError(http.StatusConflict, scim.ErrUniqueness, "A group with this displayName already exists")
+		}
+
+		group.OrganizationID = orgID
+		group.DisplayName = name
+		group.ExternalID = resource.ExternalID
+		if err := tx.Omit(clause.Associations).Save(&group).Error; err != nil {
+			return err
+		}
+		return setSCIMGroupMembers(tx, orgID, group.ID, resource.Members)
+	})
+	if err != nil {
+		return err
+	}
+
+	saved, err := getSCIMGroup(oh.DB, orgID, group.ID)
+	if err != nil {
+		return err
+	}
+	if groupID == 0 {
+		return writeSCIMResource(w, r, http.StatusCreated, saved)
+	}
+	return writeSCIMResource(w, r, http.StatusOK, saved)
+}
+
+// setSCIMGroupMembers replaces a group's members
+func setSCIMGroupMembers(tx *gorm.DB, orgID, groupID uint, members []scim.MultiValuedAttribute) error {
+	var userIDs []uint
+	seen := make(map[uint]bool)
+	for _, member := range members {
+		userID, err := strconv.ParseUint(member.Value, 10, 32)
+		if err != nil {
+			return scim.NewError(http.StatusBadRequest, scim.ErrInvalidValue, fmt.Sprintf("Unknown member %q", member.Value))
+		}
+		if !seen[uint(userID)] {
+			seen[uint(userID)] = true
+			userIDs = append(userIDs, uint(userID))
+		}
+	}
+
+	if len(userIDs) > 0 {
+		var provisioned int64
+		if err := tx.Model(&models.SCIMUser{}).Where("organization_id = ? AND user_id IN ?", orgID, userIDs).Count(&provisioned).Error; err != nil {
+			return err
+		}
+		if int(provisioned) != len(userIDs) {
+			return scim.NewError(http.StatusBadRequest, scim.ErrInvalidValue, "Group members must be users provisioned into the organization")
+		}
+	}
+
+	if err := tx.Where("group_id = ?", groupID).Delete(&models.SCIMGroupMember{}).Error; err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	rows := make([]models.SCIMGroupMember, len(userIDs))
+	for i, userID := range userIDs {
+		rows[i] = models.SCIMGroupMember{GroupID: groupID, UserID: userID}
+	}
+	return tx.Create(&rows).Error
+}
+
+// deleteSCIMGroup deletes a group and its memberships
+func (oh *OrganizationHandlers) deleteSCIMGroup(w http.ResponseWriter, orgID, groupID uint) error {
+	err := oh.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND organization_id = ?", groupID, orgID).Delete(&models.SCIMGroup{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return scim.NewError(http.StatusNotFound, "", "Group not found")
+		}
+		return tx.Where("group_id = ?", groupID).Delete(&models.SCIMGroupMember{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// loadSCIMGroups returns the organization's groups ordered by ID, or just the given group if groupID is not zero
+func loadSCIMGroups(db *gorm.DB, orgID, groupID uint) ([]scim.Group, error) {
+	query := db.Where("organization_id = ?", orgID).Order("id")
+	if groupID != 0 {
+		query = query.Where("id = ?", groupID)
+	}
+	var records []models.SCIMGroup
+	if err := query.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	var memberRows []struct {
+		GroupID uint
+		UserID  uint
+		Email   string
+	}
+	if err := db.Table("scim_group_members").
+		Select("scim_group_members.group_id, scim_group_members.user_id, users.email").
+		Joins("JOIN scim_groups ON scim_groups.id = scim_group_members.group_id").
+		Joins("JOIN users ON users.id = scim_group_members.user_id AND users.deleted_at IS NULL").
+		Where("scim_groups.organization_id = ?", orgID).
+		Order("scim_group_members.user_id").
+		Scan(&memberRows).Error; err != nil {
+		return nil, err
+	}
+	members := make(map[uint][]scim.MultiValuedAttribute)
+	for _, row := range memberRows {
+		members[row.GroupID] = append(members[row.GroupID], scim.MultiValuedAttribute{
+			Value:   strconv.FormatUint(uint64(row.UserID), 10),
+			Display: row.Email,
+			Type:    "User",
+			Ref:     scimLocation("Users", row.UserID),
+		})
+	}
+
+	groups := make([]scim.Group, len(records))
+	for i, record := range records {
+		groups[i] = scim.Group{
+			Schemas:     []string{scim.GroupSchema},
+			ID:          strconv.FormatUint(uint64(record.ID), 10),
+			ExternalID:  record.ExternalID,
+			DisplayName: record.DisplayName,
+			Members:     members[record.ID],
+			Meta: &scim.Meta{
+				ResourceType: "Group",
+				Created:      record.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+				LastModified: record.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+				Location:     scimLocation("Groups", record.ID),
+			},
+		}
+	}
+	return groups, nil
+}
+
+// getSCIMGroup returns one of the organization's groups
+func getSCIMGroup(db *gorm.DB, orgID, groupID uint) (scim.Group, error) {
+	groups, err := loadSCIMGroups(db, orgID, groupID)
+	if err != nil {
+		return scim.Group{}, err
+	}
+	if len(groups) == 0 {
+		return scim.Group{}, scim.NewError(http.StatusNotFound, "", "Group not found")
+	}
+	return groups[0], nil
+}
+
+// applySCIMPatch applies the PATCH request body to the current form of a resource and decodes the result
+// into patched
+func applySCIMPatch(r *http.Request, current interface{}, patched interface{}) error {
+	var req scim.PatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return scim.NewError(http.StatusBadRequest, scim.ErrInvalidSyntax, "Invalid JSON payload")
+	}
+
+	hasSchema := false
+	for _, schema := range req.Schemas {
+		hasSchema = hasSchema || schema == scim.PatchOpSchema
+	}
+	if !hasSchema || len(req.Operations) == 0 {
+		return scim.NewError(http.StatusBadRequest, scim.ErrInvalidSyntax, "PATCH requires the PatchOp schema and at least one operation")
+	}
+
+	resource, err := scim.ToMap(current)
+	if err != nil {
+		return err
+	}
+	if err := scim.ApplyPatch(resource, req.Operations); err != nil {
+		return err
+	}
+	return scim.FromMap(resource, patched)
+}
+
+// scimLocation returns the URL of a SCIM resource
+func scimLocation(resourceType string, id uint) string {
+	return fmt.Sprintf("%s/scim/v2/%s/%d", config.APIBaseURL(), resourceType, id)
+}
+
+// writeSCIMList writes the page of resources selected by the request's filter, startIndex and count
+func writeSCIMList(w http.ResponseWriter, r *http.Request, resources []interface{}) error {
+	query := r.URL.Query()
+
+	var filter scim.Filter
+	if expression := query.Get("filter"); expression != "" {
+		parsed, err := scim.ParseFilter(expression)
+		if err != nil {
+			return err
+		}
+		filter = parsed
+	}
+
+	matched := make([]map[string]interface{}, 0, len(resources))
+	for _, resource := range resources {
+		m, err := scim.ToMap(resource)
+		if err != nil {
+			return err
+		}
+		if filter == nil || filter.Matches(m) {
+			matched = append(matched, m)
+		}
+	}
+
+	start, end, startIndex, err := scim.Paginate(len(matched), query.Get("startIndex"), query.Get("count"), scimMaxResults)
+	if err != nil {
+		return err
+	}
+	page := make([]interface{}, 0, end-start)
+	for _, m := range matched[start:end] {
+		scim.SelectAttributes(m, query.Get("attributes"), query.Get("excludedAttributes"))
+		page = append(page, m)
+	}
+
+	writeSCIM(w, http.StatusOK, scim.ListResponse{
+		Schemas:      []string{scim.ListResponseSchema},
+		TotalResults: len(matched),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	})
+	return nil
+}
+
+// writeSCIMResource writes a single resource, applying the request's attribute selection
+func writeSCIMResource(w http.ResponseWriter, r *http.Request, status int, resource interface{}) error {
+	m, err := scim.ToMap(resource)
+	if err != nil {
+		return err
+	}
+	if meta, ok := m["meta"].(map[string]interface{}); ok {
+		if location, ok := meta["location"].(string); ok {
+			w.Header().Set("Location", location)
+		}
+	}
+	scim.SelectAttributes(m, r.URL.Query().Get("attributes"), r.URL.Query().Get("excludedAttributes"))
+
+	writeSCIM(w, status, m)
+	return nil
+}
+
+// writeSCIM writes a SCIM response body
+func writeSCIM(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", scim.ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeSCIMError writes a SCIM error response. Errors that are not SCIM errors are logged and reported
+// as internal errors.
+func writeSCIMError(w http.ResponseWriter, err error) {
+	var scimErr *scim.Error
+	if !errors.As(err, &scimErr) {
+		log.Printf("SCIM request failed: %v", err)
+		scimErr = scim.NewError(http.StatusInternalServerError, "", "Internal server error")
+	}
+	writeSCIM(w, scimErr.HTTPStatus(), scimErr)
+}
+
+// scimServiceProviderConfig describes the SCIM features tmember supports
+func scimServiceProviderConfig() map[string]interface{} {
+	unsupported := map[string]interface{}{"supported": false}
+	return map[string]interface{}{
+		"schemas":        []string{scim.ServiceProviderConfigSchema},
+		"patch":          map[string]interface{}{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": unsupported,
+		"sort":           unsupported,
+		"etag":           unsupported,
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with an organization's SCIM token",
+			"primary":     true,
+		}},
+	}
+}
+
+// scimResourceTypes lists the resource types tmember serves
+func scimResourceTypes() scim.ListResponse {
+	resourceTypes := []interface{}{
+		map[string]interface{}{
+			"schemas":  []string{scim.ResourceTypeSchema},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   scim.UserSchema,
+		},
+		map[string]interface{}{
+			"schemas":  []string{scim.ResourceTypeSchema},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   scim.GroupSchema,
+		},
+	}
+	return scim.ListResponse{
+		Schemas:      []string{scim.ListResponseSchema},
+		TotalResults: len(resourceTypes),
+		StartIndex:   1,
+		ItemsPerPage: len(resourceTypes),
+		Resources:    resourceTypes,
+	}
+}
+
+// toSCIMTokenResponse converts a SCIM token to its API representation
+func toSCIMTokenResponse(token models.SCIMToken) models.SCIMTokenResponse {
+	response := models.SCIMTokenResponse{
+		ID:             token.ID,
+		OrganizationID: token.OrganizationID,
+		Name:           token.Name,
+		TokenHint:      token.TokenHint,
+		CreatedByID:    token.CreatedByID,
+		CreatedAt:      token.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if token.LastUsedAt != nil {
+		lastUsedAt := token.LastUsedAt.Format("2006-01-02T15:04:05Z07:00")
+		response.LastUsedAt = &lastUsedAt
+	}
+	return response
+}
@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"tmember/internal/domains"
+	"tmember/internal/models"
+	"tmember/internal/scim"
+)
+
+// createSCIMTokenForTest issues a SCIM token for the organization through the token endpoint
+func createSCIMTokenForTest(t *testing.T, orgHandlers *OrganizationHandlers, admin models.User, orgID uint) models.SCIMTokenResponse {
+	w := serveOrgRequest(orgHandlers, orgHandlers.CreateSCIMTokenHandler, admin, http.MethodPost,
+		fmt.Sprintf("/api/organizations/%d/scim-tokens", orgID), models.CreateSCIMTokenRequest{Name: "Identity provider"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var token models.SCIMTokenResponse
+	json.NewDecoder(w.Body).Decode(&token)
+	return token
+}
+
+// scimRequest makes a SCIM request authenticated with the token
+func scimRequest(orgHandlers *OrganizationHandlers, token, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reqBody bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&reqBody).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &reqBody)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", scim.ContentType)
+	w := httptest.NewRecorder()
+	orgHandlers.SCIMHandler(w, req)
+	return w
+}
+
+// decodeSCIMError returns the status and scimType of a SCIM error response
+func decodeSCIMError(w *httptest.ResponseRecorder) (string, string) {
+	var scimErr scim.Error
+	json.NewDecoder(w.Body).Decode(&scimErr)
+	return scimErr.Status, scimErr.ScimType
+}
+
+// isMember reports whether the user has an active membership of the organization
+func isMember(orgHandlers *OrganizationHandlers, orgID, userID uint) bool {
+	var count int64
+	orgHandlers.DB.Model(&models.OrganizationMembership{}).Where("organization_id = ? AND user_id = ?", orgID, userID).Count(&count)
+	return count > 0
+}
+
+func TestSCIMTokens(t *testing.T) {
+	db := setupTestDBForUnit()
+	orgHandlers := NewOrganizationHandlers(db)
+	org, admin := createTestOrgWithAdmin(db, "Example", "admin@example.com")
+	tokensPath := fmt.Sprintf("/api/organizations/%d/scim-tokens", org.ID)
+
+	token := createSCIMTokenForTest(t, orgHandlers, admin, org.ID)
+	if len(token.Token) <= len(models.SCIMTokenPrefix) || token.Token[:len(models.SCIMTokenPrefix)] != models.SCIMTokenPrefix {
+		t.Fatalf("Expected a token with the SCIM prefix, got %q", token.Token)
+	}
+
+	if w := scimRequest(orgHandlers, token.Token, http.MethodGet, "/scim/v2/ServiceProviderConfig", nil); w.Code != http.StatusOK || w.Header().Get("Content-Type") != scim.ContentType {
+		t.Errorf("Expected the service provider config, got %d", w.Code)
+	}
+	if w := scimRequest(orgHandlers, "tmscim_wrong", http.MethodGet, "/scim/v2/Users", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an unknown token to be refused, got %d", w.Code)
+	}
+
+	// Members cannot manage SCIM tokens
+	member := createUnitTestUser(db, "member@example.com")
+	db.Create(&models.OrganizationMembership{UserID: member.ID, OrganizationID: org.ID, Role: models.RoleMember})
+	if w := serveOrgRequest(orgHandlers, orgHandlers.ListSCIMTokensHandler, member, http.MethodGet, tokensPath, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected members to be refused, got %d", w.Code)
+	}
+
+	w := serveOrgRequest(orgHandlers, orgHandlers.ListSCIMTokensHandler, admin, http.MethodGet, tokensPath, nil)
+	var list models.ListSCIMTokensResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Tokens) != 1 || list.Tokens[0].Token != "" || list.Tokens[0].LastUsedAt == nil {
+		t.Errorf("Expected one used token without its secret, got %+v", list.Tokens)
+	}
+
+	w = serveOrgRequest(orgHandlers, orgHandlers.RevokeSCIMTokenHandler, admin, http.MethodDelete, fmt.Sprintf("%s/%d", tokensPath, token.ID), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := scimRequest(orgHandlers, token.Token, http.MethodGet, "/scim/v2/Users", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked token to be refused, got %d", w.Code)
+	}
+}
+
+func TestSCIMUserLifecycle(t *testing.T) {
+	db := setupTestDBForUnit()
+	orgHandlers := NewOrganizationHandlers(db)
+	org, admin := createTestOrgWithAdmin(db, "Example", "admin@example.com")
+	createVerifiedDomainForTest(db, org.ID, "example.com")
+	token := createSCIMTokenForTest(t, orgHandlers, admin, org.ID).Token
+
+	w := scimRequest(orgHandlers, token, http.MethodPost, "/scim/v2/Users", map[string]interface{}{
+		"schemas":    []string{scim.UserSchema},
+		"userName":   "jane@example.com",
+		"externalId": "00u1",
+		"name":       map[string]interface{}{"givenName": "Jane", "familyName": "Doe"},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created scim.User
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.UserName != "jane@example.com" || created.Active == nil || !*created.Active || w.Header().Get("Location") == "" {
+		t.Errorf("Unexpected user: %+v", created)
+	}
+
+	var user models.User
+	db.Where("email = ?", "jane@example.com").First(&user)
+	if created.ID != fmt.Sprint(user.ID) || !isMember(orgHandlers, org.ID, user.ID) {
+		t.Fatal("Expected the provisioned user to become a member")
+	}
+	userPath := "/scim/v2/Users/" + created.ID
+
+	// Provisioning the same userName again conflicts
+	w = scimRequest(orgHandlers, token, http.MethodPost, "/scim/v2/Users", map[string]interface{}{"userName": "jane@example.com"})
+	if status, scimType := decodeSCIMError(w); w.Code != http.StatusConflict || status != "409" || scimType != scim.ErrUniqueness {
+		t.Errorf("Expected a uniqueness conflict, got %d %s", w.Code, scimType)
+	}
+
+	// Identity providers look users up by userName before creating them
+	w = scimRequest(orgHandlers, token, http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(`userName eq "JANE@example.com"`), nil)
+	var list scim.ListResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if list.TotalResults != 1 || len(list.Resources) != 1 {
+		t.Errorf("Expected the filter to find the user, got %+v", list)
+	}
+
+	// Deactivation removes the membership and reactivation restores it
+	deactivate := scim.PatchRequest{
+		Schemas:    []string{scim.PatchOpSchema},
+		Operations: []scim.PatchOperation{{Op: "Replace", Value: map[string]interface{}{"active": "False"}}},
+	}
+	if w := scimRequest(orgHandlers, token, http.MethodPatch, userPath, deactivate); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if isMember(orgHandlers, org.ID, user.ID) {
+		t.Error("Expected deactivation to remove the membership")
+	}
+	reactivate := scim.PatchRequest{
+		Schemas:    []string{scim.PatchOpSchema},
+		Operations: []scim.PatchOperation{{Op: "replace", Path: "active", Value: true}},
+	}
+	if w := scimRequest(orgHandlers, token, http.MethodPatch, userPath, reactivate); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var memberships int64
+	db.Unscoped().Model(&models.OrganizationMembership{}).Where("organization_id = ? AND user_id = ?", org.ID, user.ID).Count(&memberships)
+	if !isMember(orgHandlers, org.ID, user.ID) || memberships != 1 {
+		t.Errorf("Expected reactivation to restore the membership, got %d memberships", memberships)
+	}
+
+	// Provisioned accounts can be renamed, which unverifies the email
+	now := db.NowFunc()
+	db.Model(&user).Update("email_verified_at", &now)
+	w = scimRequest(orgHandlers, token, http.MethodPut, userPath, map[string]interface{}{
+		"schemas":     []string{scim.UserSchema},
+		"userName":    "jane.doe@example.com",
+		"displayName": "Jane Doe",
+	})
+	var replaced scim.User
+	json.NewDecoder(w.Body).Decode(&replaced)
+	if w.Code != http.StatusOK || replaced.UserName != "jane.doe@example.com" || replaced.DisplayName != "Jane Doe" || replaced.Name != nil {
+		t.Errorf("Unexpected replaced user %d: %+v", w.Code, replaced)
+	}
+	user = models.User{}
+	db.Where("email = ?", "jane.doe@example.com").First(&user)
+	if user.Email != "jane.doe@example.com" || user.IsEmailVerified() {
+		t.Errorf("Expected an unverified renamed email, got %q", user.Email)
+	}
+
+	// Provisioning cannot occupy addresses outside the organization's verified domains
+	w = scimRequest(orgHandlers, token, http.MethodPost, "/scim/v2/Users", map[string]interface{}{"userName": "victim@gmail.com"})
+	if _, scimType := decodeSCIMError(w); w.Code != http.StatusBadRequest || scimType != scim.ErrInvalidValue {
+		t.Errorf("Expected an invalid value error for an unverified domain, got %d %s", w.Code, scimType)
+	}
+	renameTo := func(email string) scim.PatchRequest {
+		return scim.PatchRequest{
+			Schemas:    []string{scim.PatchOpSchema},
+			Operations: []scim.PatchOperation{{Op: "replace", Path: "userName", Value: email}},
+		}
+	}
+	w = scimRequest(orgHandlers, token, http.MethodPatch, userPath, renameTo("victim@gmail.com"))
+	if _, scimType := decodeSCIMError(w); w.Code != http.StatusBadRequest || scimType != scim.ErrInvalidValue {
+		t.Errorf("Expected an invalid value error for a rename to an unverified domain, got %d %s", w.Code, scimType)
+	}
+
+	// Once the owner of the address takes the account over, its userName is theirs
+	if err := markEmailVerified(db, &user); err != nil {
+		t.Fatalf("Failed to verify email: %v", err)
+	}
+	w = scimRequest(orgHandlers, token, http.MethodPatch, userPath, renameTo("jane@example.com"))
+	if _, scimType := decodeSCIMError(w); w.Code != http.StatusBadRequest || scimType != scim.ErrMutability {
+		t.Errorf("Expected a mutability error after the owner took the account over, got %d %s", w.Code, scimType)
+	}
+
+	if w := scimRequest(orgHandlers, token, http.MethodDelete, userPath, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if isMember(orgHandlers, org.ID, user.ID) {
+		t.Error("Expected deletion to remove the membership")
+	}
+	if w := scimRequest(orgHandlers, token, http.MethodGet, userPath, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted user to be gone, got %d", w.Code)
+	}
+}
+
+func TestSCIMExistingAccounts(t *testing.T) {
+	db := setupTestDBForUnit()
+	orgHandlers := NewOrganizationHandlers(db)
+	resolver := domains.NewStaticResolver()
+	orgHandlers.Resolver = resolver
+	org, admin := createTestOrgWithAdmin(db, "Example", "admin@example.com")
+	token := createSCIMTokenForTest(t, orgHandlers, admin, org.ID).Token
+
+	// Accounts outside the organization cannot be taken over
+	createUnitTestUser(db, "outsider@gmail.com")
+	w := scimRequest(orgHandlers, token, http.MethodPost, "/scim/v2/Users", map[string]interface{}{"userName": "outsider@gmail.com"})
+	if _, scimType := decodeSCIMError(w); w.Code != http.StatusConflict || scimType != scim.ErrUniqueness {
+		t.Errorf("Expected a uniqueness conflict, got %d %s", w.Code, scimType)
+	}
+
+	// Existing members are linked, but their userName stays under their control
+	w = scimRequest(orgHandlers, token, http.MethodPost, "/scim/v2/Users", map[string]interface{}{"userName": "admin@example.com"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	rename := scim.PatchRequest{
+		Schemas:    []string{scim.PatchOpSchema},
+		Operations: []scim.PatchOperation{{Op: "replace", Path: "userName", Value: "boss@example.com"}},
+	}
+	w = scimRequest(orgHandlers, token, http.MethodPatch, fmt.Sprintf("/scim/v2/Users/%d", admin.ID), rename)
+	if _, scimType := decodeSCIMError(w); w.Code != http.StatusBadRequest || scimType != scim.ErrMutability {
+		t.Errorf("Expected a mutability error, got %d %s", w.Code, scimType)
+	}
+
+	// The last admin cannot be deactivated
+	deactivate := scim.PatchRequest{
+		Schemas:    []string{scim.PatchOpSchema},
+		Operations: []scim.PatchOperation{{Op: "replace", Path: "active", Value: false}},
+	}
+	if w := scimRequest(orgHandlers, token, http.MethodPatch, fmt.Sprintf("/scim/v2/Users/%d", admin.ID), deactivate); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the last admin to stay active, got %d", w.Code)
+	}
+
+	// Accounts on a verified domain are linked and join the organization
+	existing := createUnitTestUser(db, "existing@example.com")
+	verifyTestDomain(t, orgHandlers, resolver, admin, org.ID, "example.com", "disabled")
+	w = scimRequest(orgHandlers, token, http.MethodPost, "/scim/v2/Users", map[string]interface{}{"userName": "existing@example.com"})
+	if w.Code != http.StatusCreated || !isMember(orgHandlers, org.ID, existing.ID) {
+		t.Errorf("Expected the account on the verified domain to be provisioned, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSCIMGroups(t *testing.T) {
+	db := setupTestDBForUnit()
+	orgHandlers := NewOrganizationHandlers(db)
+	org, admin := createTestOrgWithAdmin(db, "Example", "admin@example.com")
+	createVerifiedDomainForTest(db, org.ID, "example.com")
+	token := createSCIMTokenForTest(t, orgHandlers, admin, org.ID).Token
+
+	var userIDs []string
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		w := scimRequest(orgHandlers, token, http.MethodPost, "/scim/v2/Users", map[string]interface{}{"userName": email})
+		var created scim.User
+		json.NewDecoder(w.Body).Decode(&created)
+		userIDs = append(userIDs, created.ID)
+	}
+
+	w := scimRequest(orgHandlers, token, http.MethodPost, "/scim/v2/Groups", map[string]interface{}{
+		"schemas":     []string{scim.GroupSchema},
+		"displayName": "Engineering",
+		"members":     []map[string]string{{"value": userIDs[0]}, {"value": userIDs[1]}},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var group scim.Group
+	json.NewDecoder(w.Body).Decode(&group)
+	if len(group.Members) != 2 || group.Members[0].Display != "a@example.com" {
+		t.Errorf("Unexpected group: %+v", group)
+	}
+	groupPath := "/scim/v2/Groups/" + group.ID
+
+	w = scimRequest(orgHandlers, token, http.MethodPost, "/scim/v2/Groups", map[string]interface{}{"displayName": "Engineering"})
+	if _, scimType := decodeSCIMError(w); w.Code != http.StatusConflict || scimType != scim.ErrUniqueness {
+		t.Errorf("Expected a uniqueness conflict, got %d %s", w.Code, scimType)
+	}
+	w = scimRequest(orgHandlers, token, http.MethodPost, "/scim/v2/Groups", map[string]interface{}{
+		"displayName": "Strangers",
+		"members":     []map[string]string{{"value": fmt.Sprint(admin.ID)}},
+	})
+	if _, scimType := decodeSCIMError(w); w.Code != http.StatusBadRequest || scimType != scim.ErrInvalidValue {
+		t.Errorf("Expected unprovisioned members to be refused, got %d %s", w.Code, scimType)
+	}
+
+	patch := scim.PatchRequest{
+		Schemas: []string{scim.PatchOpSchema},
+		Operations: []scim.PatchOperation{
+			{Op: "add", Path: "members", Value: []interface{}{map[string]interface{}{"value": userIDs[2]}}},
+			{Op: "remove", Path: fmt.Sprintf(`members[value eq "%s"]`, userIDs[0])},
+			{Op: "replace", Path: "displayName", Value: "Platform"},
+		},
+	}
+	w = scimRequest(orgHandlers, token, http.MethodPatch, groupPath, patch)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	json.NewDecoder(w.Body).Decode(&group)
+	if group.DisplayName != "Platform" || len(group.Members) != 2 || group.Members[0].Value != userIDs[1] || group.Members[1].Value != userIDs[2] {
+		t.Errorf("Unexpected patched group: %+v", group)
+	}
+
+	// Users show their groups
+	w = scimRequest(orgHandlers, token, http.MethodGet, "/scim/v2/Users/"+userIDs[2], nil)
+	var user scim.User
+	json.NewDecoder(w.Body).Decode(&user)
+	if len(user.Groups) != 1 || user.Groups[0].Display != "Platform" {
+		t.Errorf("Expected the user to be in Platform, got %+v", user.Groups)
+	}
+
+	w = scimRequest(orgHandlers, token, http.MethodGet, "/scim/v2/Groups?excludedAttributes=members&filter="+url.QueryEscape(`displayName eq "platform"`), nil)
+	var list struct {
+		TotalResults int                      `json:"totalResults"`
+		Resources    []map[string]interface{} `json:"Resources"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	if list.TotalResults != 1 || list.Resources[0]["members"] != nil {
+		t.Errorf("Expected one group without members, got %+v", list)
+	}
+
+	if w := scimRequest(orgHandlers, token, http.MethodDelete, groupPath, nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := scimRequest(orgHandlers, token, http.MethodGet, groupPath, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted group to be gone, got %d", w.Code)
+	}
+}
+
+func TestSCIMListPagination(t *testing.T) {
+	db := setupTestDBForUnit()
+	orgHandlers := NewOrganizationHandlers(db)
+	org, admin := createTestOrgWithAdmin(db, "Example", "admin@example.com")
+	createVerifiedDomainForTest(db, org.ID, "example.com")
+	token := createSCIMTokenForTest(t, orgHandlers, admin, org.ID).Token
+
+	for i := 1; i <= 5; i++ {
+		scimRequest(orgHandlers, token, http.MethodPost, "/scim/v2/Users", map[string]interface{}{"userName": fmt.Sprintf("user%d@example.com", i)})
+	}
+
+	// Another organization's users are not visible
+	other, otherAdmin := createTestOrgWithAdmin(db, "Other", "admin@other.com")
+	otherToken := createSCIMTokenForTest(t, orgHandlers, otherAdmin, other.ID).Token
+	createVerifiedDomainForTest(db, other.ID, "other.com")
+	scimRequest(orgHandlers, otherToken, http.MethodPost, "/scim/v2/Users", map[string]interface{}{"userName": "someone@other.com"})
+
+	w := scimRequest(orgHandlers, token, http.MethodGet, "/scim/v2/Users?startIndex=2&count=2", nil)
+	var list struct {
+		TotalResults int         `json:"totalResults"`
+		StartIndex   int         `json:"startIndex"`
+		ItemsPerPage int         `json:"itemsPerPage"`
+		Resources    []scim.User `json:"Resources"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	if list.TotalResults != 5 || list.StartIndex != 2 || list.ItemsPerPage != 2 {
+		t.Fatalf("Unexpected page: %+v", list)
+	}
+	if list.Resources[0].UserName != "user2@example.com" || list.Resources[1].UserName != "user3@example.com" {
+		t.Errorf("Unexpected page resources: %s, %s", list.Resources[0].UserName, list.Resources[1].UserName)
+	}
+
+	w = scimRequest(orgHandlers, token, http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(`userName eq`), nil)
+	if _, scimType := decodeSCIMError(w); w.Code != http.StatusBadRequest || scimType != scim.ErrInvalidFilter {
+		t.Errorf("Expected an invalid filter error, got %d %s", w.Code, scimType)
+	}
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"tmember/internal/middleware"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// maxPolicyPasswordMinLength bounds the minimum password length an organization can require
+	maxPolicyPasswordMinLength = 128
+	// minPolicySessionMinutes and maxPolicySessionMinutes bound the session limits an organization can set
+	minPolicySessionMinutes = 5
+	maxPolicySessionMinutes = 365 * 24 * 60
+)
+
+// loadSecurityPolicy returns the organization's security policy, or the default policy if none was saved
+func loadSecurityPolicy(db *gorm.DB, orgID uint) (models.OrganizationSecurityPolicy, error) {
+	policy := models.OrganizationSecurityPolicy{OrganizationID: orgID}
+	err := db.Where("organization_id = ?", orgID).Limit(1).Find(&policy).Error
+	return policy, err
+}
+
+// effectivePasswordPolicy returns the strictest password policy across the default policy and the
+// policies of every organization the user belongs to
+func effectivePasswordPolicy(db *gorm.DB, userID uint) (utils.PasswordPolicy, error) {
+	var policies []models.OrganizationSecurityPolicy
+	err := db.Joins("JOIN organization_memberships ON organization_memberships.organization_id = organization_security_policies.organization_id").
+		Where("organization_memberships.user_id = ? AND organization_memberships.deleted_at IS NULL", userID).
+		Find(&policies).Error
+	if err != nil {
+		return utils.PasswordPolicy{}, err
+	}
+
+	effective := utils.DefaultPasswordPolicy
+	for _, policy := range policies {
+		effective = effective.Merge(utils.PasswordPolicy{
+			MinLength:        policy.PasswordMinLength,
+			RequireUppercase: policy.PasswordRequireUppercase,
+			RequireLowercase: policy.PasswordRequireLowercase,
+			RequireDigit:     policy.PasswordRequireDigit,
+			RequireSymbol:    policy.PasswordRequireSymbol,
+		})
+	}
+	return effective, nil
+}
+
+// magicLinkLoginAllowed reports whether the user may sign in with emailed links, which any organization
+// the user belongs to can disable
+func magicLinkLoginAllowed(db *gorm.DB, userID uint) (bool, error) {
+	var disabled int64
+	err := db.Model(&models.OrganizationSecurityPolicy{}).
+		Joins("JOIN organization_memberships ON organization_memberships.organization_id = organization_security_policies.organization_id").
+		Where("organization_memberships.user_id = ? AND organization_memberships.deleted_at IS NULL AND organization_security_policies.disable_magic_link_login = ?", userID, true).
+		Count(&disabled).Error
+	return disabled == 0, err
+}
+
+// enforceMFAPolicy denies access to an organization that requires MFA when the user has not enrolled
+// a second factor or the current session was not authenticated with one. It writes the error response
+// and returns false when access is denied.
+func enforceMFAPolicy(w http.ResponseWriter, r *http.Request, db *gorm.DB, orgID, userID uint) bool {
+	policy, err := loadSecurityPolicy(db, orgID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to load security policy", "POLICY_FETCH_ERROR")
+		return false
+	}
+
+	if !policy.RequireMFA {
+		return true
+	}
+
+	return requireMFASession(w, r, db, userID)
+}
+
+// requireMFASession checks that the user has enrolled a second factor and presented it for the current session
+func requireMFASession(w http.ResponseWriter, r *http.Request, db *gorm.DB, userID uint) bool {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		writeErrorResponse(w, http.StatusNotFound, "User not found", "USER_NOT_FOUND")
+		return false
+	}
+
+	enrolled, err := hasSecondFactor(db, user)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to check second factors", "MFA_CHECK_ERROR")
+		return false
+	}
+	if !enrolled {
+		writeErrorResponse(w, http.StatusForbidden, "This organization requires two-factor authentication; please enroll a second factor", "MFA_ENROLLMENT_REQUIRED")
+		return false
+	}
+
+	if !middleware.GetSessionMFAFromContext(r.Context()) {
+		writeErrorResponse(w, http.StatusForbidden, "This organization requires two-factor authentication; please sign in again with your second factor", "MFA_STEP_UP_REQUIRED")
+		return false
+	}
+
+	return true
+}
+
+// GetSecurityPolicyHandler returns the organization's security policy
+func (oh *OrganizationHandlers) GetSecurityPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	// Get organization ID from context
+	orgID, ok := middleware.GetOrganizationIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusBadRequest, "Organization ID not found", "MISSING_ORG_ID")
+		return
+	}
+
+	policy, err := loadSecurityPolicy(oh.DB, orgID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to load security policy", "POLICY_FETCH_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toSecurityPolicyResponse(policy))
+}
+
+// UpdateSecurityPolicyHandler changes the organization's security policy (admins signed in as users only)
+func (oh *OrganizationHandlers) UpdateSecurityPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, userID, ok := requireHumanAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateSecurityPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	if msg := validateSecurityPolicyRequest(req); msg != "" {
+		writeErrorResponse(w, http.StatusBadRequest, msg, "INVALID_POLICY")
+		return
+	}
+
+	policy, err := loadSecurityPolicy(oh.DB, orgID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to load security policy", "POLICY_FETCH_ERROR")
+		return
+	}
+
+	if req.RequireMFA != nil {
+		// Admins cannot lock themselves out by requiring a factor they do not use
+		if *req.RequireMFA && !policy.RequireMFA && !requireMFASession(w, r, oh.DB, userID) {
+			return
+		}
+		policy.RequireMFA = *req.RequireMFA
+	}
+	if req.PasswordMinLength != nil {
+		policy.PasswordMinLength = *req.PasswordMinLength
+	}
+	if req.PasswordRequireUppercase != nil {
+		policy.PasswordRequireUppercase = *req.PasswordRequireUppercase
+	}
+	if req.PasswordRequireLowercase != nil {
+		policy.PasswordRequireLowercase = *req.PasswordRequireLowercase
+	}
+	if req.PasswordRequireDigit != nil {
+		policy.PasswordRequireDigit = *req.PasswordRequireDigit
+	}
+	if req.PasswordRequireSymbol != nil {
+		policy.PasswordRequireSymbol = *req.PasswordRequireSymbol
+	}
+	if req.SessionMaxAgeMinutes != nil {
+		policy.SessionMaxAgeMinutes = *req.SessionMaxAgeMinutes
+	}
+	if req.SessionIdleTimeoutMinutes != nil {
+		policy.SessionIdleTimeoutMinutes = *req.SessionIdleTimeoutMinutes
+	}
+	if req.DisableMagicLinkLogin != nil {
+		policy.DisableMagicLinkLogin = *req.DisableMagicLinkLogin
+	}
+
+	if err := oh.DB.Save(&policy).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to update security policy", "UPDATE_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toSecurityPolicyResponse(policy))
+}
+
+// MFAComplianceHandler reports the organization's members who have not enrolled a second factor (admin only)
+func (oh *OrganizationHandlers) MFAComplianceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, ok := requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	policy, err := loadSecurityPolicy(oh.DB, orgID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to load security policy", "POLICY_FETCH_ERROR")
+		return
+	}
+
+	var memberships []models.OrganizationMembership
+	if err := oh.DB.Preload("User").Where("organization_id = ?", orgID).Find(&memberships).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch organization members", "FETCH_ERROR")
+		return
+	}
+
+	// Members with a WebAuthn credential have a second factor too
+	var webauthnUserIDs []uint
+	if err := oh.DB.Model(&models.WebAuthnCredential{}).
+		Joins("JOIN organization_memberships ON organization_memberships.user_id = webauthn_credentials.user_id").
+		Where("organization_memberships.organization_id = ? AND organization_memberships.deleted_at IS NULL", orgID).
+		Distinct().Pluck("webauthn_credentials.user_id", &webauthnUserIDs).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch organization members", "FETCH_ERROR")
+		return
+	}
+
+	response := models.MFAComplianceResponse{
+		RequireMFA:          policy.RequireMFA,
+		TotalMembers:        len(memberships),
+		NonCompliantMembers: []models.MFAComplianceMember{},
+	}
+	for _, membership := range memberships {
+		if membership.User.IsMFAEnabled() || slices.Contains(webauthnUserIDs, membership.UserID) {
+			continue
+		}
+		response.NonCompliantMembers = append(response.NonCompliantMembers, models.MFAComplianceMember{
+			MembershipID: membership.ID,
+			UserID:       membership.UserID,
+			Email:        membership.User.Email,
+			Role:         string(membership.Role),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// validateSecurityPolicyRequest returns a message describing the first out-of-range value, or "" if the request is valid
+func validateSecurityPolicyRequest(req models.UpdateSecurityPolicyRequest) string {
+	if req.PasswordMinLength != nil && *req.PasswordMinLength != 0 &&
+		(*req.PasswordMinLength < utils.DefaultPasswordPolicy.MinLength || *req.PasswordMinLength > maxPolicyPasswordMinLength) {
+		return fmt.Sprintf("password_min_length must be 0 or between %d and %d", utils.DefaultPasswordPolicy.MinLength, maxPolicyPasswordMinLength)
+	}
+
+	sessionLimits := []struct {
+		field   string
+		minutes *int
+	}{
+		{"session_max_age_minutes", req.SessionMaxAgeMinutes},
+		{"session_idle_timeout_minutes", req.SessionIdleTimeoutMinutes},
+	}
+	for _, limit := range sessionLimits {
+		if limit.minutes != nil && *limit.minutes != 0 && (*limit.minutes < minPolicySessionMinutes || *limit.minutes > maxPolicySessionMinutes) {
+			return fmt.Sprintf("%s must be 0 or between %d and %d", limit.field, minPolicySessionMinutes, maxPolicySessionMinutes)
+		}
+	}
+
+	return ""
+}
+
+// toSecurityPolicyResponse converts a security policy to its API representation
+func toSecurityPolicyResponse(policy models.OrganizationSecurityPolicy) models.SecurityPolicyResponse {
+	return models.SecurityPolicyResponse{
+		OrganizationID:            policy.OrganizationID,
+		RequireMFA:                policy.RequireMFA,
+		PasswordMinLength:         policy.PasswordMinLength,
+		PasswordRequireUppercase:  policy.PasswordRequireUppercase,
+		PasswordRequireLowercase:  policy.PasswordRequireLowercase,
+		PasswordRequireDigit:      policy.PasswordRequireDigit,
+		PasswordRequireSymbol:     policy.PasswordRequireSymbol,
+		SessionMaxAgeMinutes:      policy.SessionMaxAgeMinutes,
+		SessionIdleTimeoutMinutes: policy.SessionIdleTimeoutMinutes,
+		DisableMagicLinkLogin:     policy.DisableMagicLinkLogin,
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tmember/internal/models"
+)
+
+// withMFASessionContext adds authentication context for the user, marking whether the session presented a second factor
+func withMFASessionContext(req *http.Request, user models.User, mfa bool) *http.Request {
+	req = withUserContext(req, user)
+	return req.WithContext(context.WithValue(req.Context(), "session_mfa", mfa))
+}
+
+// enableMFAForTest marks the user as enrolled in MFA
+func enableMFAForTest(t *testing.T, orgHandlers *OrganizationHandlers, user *models.User) {
+	now := time.Now()
+	if err := orgHandlers.DB.Model(user).Update("mfa_enabled_at", &now).Error; err != nil {
+		t.Fatalf("Failed to enable MFA: %v", err)
+	}
+}
+
+// decodeErrorCode returns the error code of a JSON error response
+func decodeErrorCode(w *httptest.ResponseRecorder) string {
+	var errorResponse models.ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errorResponse)
+	return errorResponse.Code
+}
+
+func TestSecurityPolicy_RequireMFA(t *testing.T) {
+	db := setupInvitationTestDB()
+	orgHandlers := NewOrganizationHandlers(db)
+
+	admin := createUnitTestUser(db, "admin@example.com")
+	member := createUnitTestUser(db, "member@example.com")
+	org := models.Organization{Name: "Secure Org"}
+	db.Create(&org)
+	db.Create(&models.OrganizationMembership{UserID: admin.ID, OrganizationID: org.ID, Role: models.RoleAdmin})
+	db.Create(&models.OrganizationMembership{UserID: member.ID, OrganizationID: org.ID, Role: models.RoleMember})
+
+	securityPath := fmt.Sprintf("/api/organizations/%d/security", org.ID)
+	updatePolicy := func(user models.User, mfa bool) *httptest.ResponseRecorder {
+		reqBody, _ := json.Marshal(map[string]bool{"require_mfa": true})
+		req := withMFASessionContext(httptest.NewRequest(http.MethodPut, securityPath, bytes.NewBuffer(reqBody)), user, mfa)
+		w := httptest.NewRecorder()
+		orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.UpdateSecurityPolicyHandler)).ServeHTTP(w, req)
+		return w
+	}
+
+	// Admins without a second factor cannot require one
+	if w := updatePolicy(admin, false); w.Code != http.StatusForbidden || decodeErrorCode(w) != "MFA_ENROLLMENT_REQUIRED" {
+		t.Errorf("Expected admin without MFA to be refused, got %d", w.Code)
+	}
+
+	enableMFAForTest(t, orgHandlers, &admin)
+	if w := updatePolicy(admin, true); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Members who have not enrolled are routed to enrollment
+	switchPath := fmt.Sprintf("/api/organizations/%d/switch", org.ID)
+	switchW := httptest.NewRecorder()
+	orgHandlers.SwitchOrganizationHandler(switchW, withMFASessionContext(httptest.NewRequest(http.MethodPost, switchPath, nil), member, false))
+	if switchW.Code != http.StatusForbidden || decodeErrorCode(switchW) != "MFA_ENROLLMENT_REQUIRED" {
+		t.Errorf("Expected unenrolled member to be refused on switch, got %d", switchW.Code)
+	}
+
+	// Enrolled members must sign in with their second factor
+	enableMFAForTest(t, orgHandlers, &member)
+	accessW := httptest.NewRecorder()
+	orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.GetSecurityPolicyHandler)).ServeHTTP(accessW, withMFASessionContext(httptest.NewRequest(http.MethodGet, securityPath, nil), member, false))
+	if accessW.Code != http.StatusForbidden || decodeErrorCode(accessW) != "MFA_STEP_UP_REQUIRED" {
+		t.Errorf("Expected password-only session to be refused, got %d", accessW.Code)
+	}
+
+	switchW = httptest.NewRecorder()
+	orgHandlers.SwitchOrganizationHandler(switchW, withMFASessionContext(httptest.NewRequest(http.MethodPost, switchPath, nil), member, true))
+	if switchW.Code != http.StatusOK {
+		t.Errorf("Expected MFA session to be allowed, got %d: %s", switchW.Code, switchW.Body.String())
+	}
+}
+
+func TestMFAComplianceHandler(t *testing.T) {
+	db := setupInvitationTestDB()
+	orgHandlers := NewOrganizationHandlers(db)
+
+	admin := createUnitTestUser(db, "admin@example.com")
+	enrolled := createUnitTestUser(db, "enrolled@example.com")
+	lagging := createUnitTestUser(db, "lagging@example.com")
+	enableMFAForTest(t, orgHandlers, &admin)
+	enableMFAForTest(t, orgHandlers, &enrolled)
+	org := models.Organization{Name: "Audited Org"}
+	db.Create(&org)
+	db.Create(&models.OrganizationMembership{UserID: admin.ID, OrganizationID: org.ID, Role: models.RoleAdmin})
+	db.Create(&models.OrganizationMembership{UserID: enrolled.ID, OrganizationID: org.ID, Role: models.RoleMember})
+	db.Create(&models.OrganizationMembership{UserID: lagging.ID, OrganizationID: org.ID, Role: models.RoleMember})
+
+	reportPath := fmt.Sprintf("/api/organizations/%d/security/mfa-compliance", org.ID)
+
+	// Members cannot view the report
+	memberW := httptest.NewRecorder()
+	orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.MFAComplianceHandler)).ServeHTTP(memberW, withMFASessionContext(httptest.NewRequest(http.MethodGet, reportPath, nil), enrolled, true))
+	if memberW.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, memberW.Code)
+	}
+
+	w := httptest.NewRecorder()
+	orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.MFAComplianceHandler)).ServeHTTP(w, withMFASessionContext(httptest.NewRequest(http.MethodGet, reportPath, nil), admin, true))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var report models.MFAComplianceResponse
+	json.NewDecoder(w.Body).Decode(&report)
+	if report.TotalMembers != 3 || len(report.NonCompliantMembers) != 1 || report.NonCompliantMembers[0].Email != lagging.Email {
+		t.Errorf("Unexpected compliance report: %+v", report)
+	}
+}
+
+func TestSecurityPolicy_PasswordAndSessionRules(t *testing.T) {
+	db := setupInvitationTestDB()
+	orgHandlers := NewOrganizationHandlers(db)
+
+	admin := createUnitTestUser(db, "admin@example.com")
+	member := createUnitTestUser(db, "member@example.com")
+	org := models.Organization{Name: "Strict Org"}
+	db.Create(&org)
+	db.Create(&models.OrganizationMembership{UserID: admin.ID, OrganizationID: org.ID, Role: models.RoleAdmin})
+	db.Create(&models.OrganizationMembership{UserID: member.ID, OrganizationID: org.ID, Role: models.RoleMember})
+
+	securityPath := fmt.Sprintf("/api/organizations/%d/security", org.ID)
+	updatePolicy := func(user models.User, body map[string]interface{}) *httptest.ResponseRecorder {
+		reqBody, _ := json.Marshal(body)
+		req := withUserContext(httptest.NewRequest(http.MethodPut, securityPath, bytes.NewBuffer(reqBody)), user)
+		w := httptest.NewRecorder()
+		orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(orgHandlers.UpdateSecurityPolicyHandler)).ServeHTTP(w, req)
+		return w
+	}
+
+	w := updatePolicy(admin, map[string]interface{}{
+		"password_min_length":          12,
+		"password_require_symbol":      true,
+		"session_max_age_minutes":      480,
+		"session_idle_timeout_minutes": 30,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response models.SecurityPolicyResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.PasswordMinLength != 12 || !response.PasswordRequireSymbol || response.SessionMaxAgeMinutes != 480 || response.SessionIdleTimeoutMinutes != 30 {
+		t.Errorf("Expected updated policy in response, got %+v", response)
+	}
+
+	// Omitted fields are left unchanged
+	if w := updatePolicy(admin, map[string]interface{}{"session_idle_timeout_minutes": 0}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	policy, _ := loadSecurityPolicy(db, org.ID)
+	if policy.PasswordMinLength != 12 || policy.SessionMaxAgeMinutes != 480 || policy.SessionIdleTimeoutMinutes != 0 {
+		t.Errorf("Expected partial update, got %+v", policy)
+	}
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+	}{
+		{"min length below default", map[string]interface{}{"password_min_length": 6}},
+		{"min length too long", map[string]interface{}{"password_min_length": 500}},
+		{"max age too short", map[string]interface{}{"session_max_age_minutes": 1}},
+		{"negative idle timeout", map[string]interface{}{"session_idle_timeout_minutes": -5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := updatePolicy(admin, tt.body); w.Code != http.StatusBadRequest || decodeErrorCode(w) != "INVALID_POLICY" {
+				t.Errorf("Expected status %d INVALID_POLICY, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+
+	// Members cannot change the policy
+	if w := updatePolicy(member, map[string]interface{}{"password_min_length": 8}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for member, got %d", http.StatusForbidden, w.Code)
+	}
+}
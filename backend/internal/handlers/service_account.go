@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tmember/internal/middleware"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// requireHumanAdmin checks that the caller is an organization admin signed in as a user. Service accounts
+// cannot manage service accounts or the organization's sign-in settings, so a leaked key can neither mint
+// further keys nor weaken how members sign in.
+func requireHumanAdmin(w http.ResponseWriter, r *http.Request) (uint, uint, bool) {
+	orgID, ok := requireOrgAdmin(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusForbidden, "Service accounts cannot perform this action", "USER_REQUIRED")
+		return 0, 0, false
+	}
+
+	return orgID, userID, true
+}
+
+// findServiceAccount loads the service account addressed by the URL path within the organization
+func (oh *OrganizationHandlers) findServiceAccount(w http.ResponseWriter, r *http.Request, orgID uint) (*models.ServiceAccount, bool) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 6 {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid service account ID", "INVALID_SERVICE_ACCOUNT_ID")
+		return nil, false
+	}
+
+	serviceAccountID, err := strconv.ParseUint(parts[5], 10, 32) // /api/organizations/{id}/service-accounts/{service_account_id}
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid service account ID format", "INVALID_SERVICE_ACCOUNT_ID_FORMAT")
+		return nil, false
+	}
+
+	var serviceAccount models.ServiceAccount
+	if err := oh.DB.Where("id = ? AND organization_id = ?", uint(serviceAccountID), orgID).First(&serviceAccount).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeErrorResponse(w, http.StatusNotFound, "Service account not found", "SERVICE_ACCOUNT_NOT_FOUND")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to find service account", "SERVICE_ACCOUNT_FETCH_ERROR")
+		}
+		return nil, false
+	}
+
+	return &serviceAccount, true
+}
+
+// CreateServiceAccountHandler creates a service account in the organization (admin only)
+func (oh *OrganizationHandlers) CreateServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, userID, ok := requireHumanAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	// Validate name
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxTokenNameLength {
+		writeErrorResponse(w, http.StatusBadRequest, "Service account name is required and must be at most 100 characters", "INVALID_NAME")
+		return
+	}
+
+	// Validate role, defaulting to member
+	if req.Role == "" {
+		req.Role = string(models.RoleMember)
+	}
+	if req.Role != string(models.RoleAdmin) && req.Role != string(models.RoleMember) {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid role. Must be 'admin' or 'member'", "INVALID_ROLE")
+		return
+	}
+
+	serviceAccount := models.ServiceAccount{
+		OrganizationID: orgID,
+		Name:           name,
+		Role:           models.Role(req.Role),
+		CreatedByID:    userID,
+	}
+
+	if err := oh.DB.Create(&serviceAccount).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to create service account", "CREATION_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toServiceAccountResponse(serviceAccount))
+}
+
+// ListServiceAccountsHandler lists the organization's service accounts (admin only)
+func (oh *OrganizationHandlers) ListServiceAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, _, ok := requireHumanAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var serviceAccounts []models.ServiceAccount
+	if err := oh.DB.Where("organization_id = ?", orgID).Order("created_at DESC").Find(&serviceAccounts).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch service accounts", "FETCH_ERROR")
+		return
+	}
+
+	// Convert to response format
+	response := models.ListServiceAccountsResponse{
+		ServiceAccounts: make([]models.ServiceAccountResponse, len(serviceAccounts)),
+	}
+	for i, serviceAccount := range serviceAccounts {
+		response.ServiceAccounts[i] = toServiceAccountResponse(serviceAccount)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateServiceAccountHandler renames a service account or changes its role (admin only)
+func (oh *OrganizationHandlers) UpdateServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, _, ok := requireHumanAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	serviceAccount, ok := oh.findServiceAccount(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > maxTokenNameLength {
+			writeErrorResponse(w, http.StatusBadRequest, "Service account name is required and must be at most 100 characters", "INVALID_NAME")
+			return
+		}
+		serviceAccount.Name = name
+	}
+
+	if req.Role != nil {
+		if *req.Role != string(models.RoleAdmin) && *req.Role != string(models.RoleMember) {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid role. Must be 'admin' or 'member'", "INVALID_ROLE")
+			return
+		}
+		serviceAccount.Role = models.Role(*req.Role)
+	}
+
+	if err := oh.DB.Save(serviceAccount).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to update service account", "UPDATE_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toServiceAccountResponse(*serviceAccount))
+}
+
+// DeleteServiceAccountHandler deletes a service account and revokes all of its keys (admin only)
+func (oh *OrganizationHandlers) DeleteServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, _, ok := requireHumanAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	serviceAccount, ok := oh.findServiceAccount(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	err := oh.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.ServiceAccountKey{}).
+			Where("service_account_id = ? AND revoked_at IS NULL", serviceAccount.ID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Delete(serviceAccount).Error
+	})
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to delete service account", "REMOVAL_ERROR")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":            "Service account deleted successfully",
+		"service_account_id": serviceAccount.ID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// CreateServiceAccountKeyHandler issues a new API key for a service account and returns it once (admin only)
+func (oh *OrganizationHandlers) CreateServiceAccountKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, _, ok := requireHumanAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	serviceAccount, ok := oh.findServiceAccount(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	var req models.CreateServiceAccountKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	// Validate expiry
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil {
+		if *req.ExpiresInDays < 1 || *req.ExpiresInDays > maxTokenExpiryDays {
+			writeErrorResponse(w, http.StatusBadRequest, "Expiry must be between 1 and 365 days", "INVALID_EXPIRY")
+			return
+		}
+		expiry := time.Now().Add(time.Duration(*req.ExpiresInDays) * 24 * time.Hour)
+		expiresAt = &expiry
+	}
+
+	secret, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to generate key", "TOKEN_GENERATION_ERROR")
+		return
+	}
+	key := models.ServiceAccountKeyPrefix + secret
+
+	record := models.ServiceAccountKey{
+		ServiceAccountID: serviceAccount.ID,
+		TokenHash:        utils.HashToken(key),
+		TokenHint:        key[:tokenHintLength],
+		ExpiresAt:        expiresAt,
+	}
+
+	if err := oh.DB.Create(&record).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to create key", "CREATION_ERROR")
+		return
+	}
+
+	response := toServiceAccountKeyResponse(record)
+	response.Key = key
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListServiceAccountKeysHandler lists a service account's active API keys (admin only)
+func (oh *OrganizationHandlers) ListServiceAccountKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, _, ok := requireHumanAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	serviceAccount, ok := oh.findServiceAccount(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	var keys []models.ServiceAccountKey
+	if err := oh.DB.Where("service_account_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", serviceAccount.ID, time.Now()).
+		Order("created_at DESC").
+		Find(&keys).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch keys", "FETCH_ERROR")
+		return
+	}
+
+	// Convert to response format
+	response := models.ListServiceAccountKeysResponse{
+		Keys: make([]models.ServiceAccountKeyResponse, len(keys)),
+	}
+	for i, key := range keys {
+		response.Keys[i] = toServiceAccountKeyResponse(key)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeServiceAccountKeyHandler revokes one of a service account's API keys (admin only)
+func (oh *OrganizationHandlers) RevokeServiceAccountKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	orgID, _, ok := requireHumanAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	serviceAccount, ok := oh.findServiceAccount(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	// Extract key ID from URL path
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 8 {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid key ID", "INVALID_KEY_ID")
+		return
+	}
+
+	keyID, err := strconv.ParseUint(parts[7], 10, 32) // /api/organizations/{id}/service-accounts/{service_account_id}/keys/{key_id}
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid key ID format", "INVALID_KEY_ID_FORMAT")
+		return
+	}
+
+	result := oh.DB.Model(&models.ServiceAccountKey{}).
+		Where("id = ? AND service_account_id = ? AND revoked_at IS NULL", uint(keyID), serviceAccount.ID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to revoke key", "REVOKE_ERROR")
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeErrorResponse(w, http.StatusNotFound, "Key not found", "KEY_NOT_FOUND")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Key revoked successfully",
+		"key_id":  uint(keyID),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// toServiceAccountResponse converts a service account to its API representation
+func toServiceAccountResponse(serviceAccount models.ServiceAccount) models.ServiceAccountResponse {
+	return models.ServiceAccountResponse{
+		ID:             serviceAccount.ID,
+		OrganizationID: serviceAccount.OrganizationID,
+		Name:           serviceAccount.Name,
+		Role:           string(serviceAccount.Role),
+		CreatedByID:    serviceAccount.CreatedByID,
+		CreatedAt:      serviceAccount.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// toServiceAccountKeyResponse converts a service account key to its API representation
+func toServiceAccountKeyResponse(key models.ServiceAccountKey) models.ServiceAccountKeyResponse {
+	response := models.ServiceAccountKeyResponse{
+		ID:               key.ID,
+		ServiceAccountID: key.ServiceAccountID,
+		TokenHint:        key.TokenHint,
+		CreatedAt:        key.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if key.ExpiresAt != nil {
+		expiresAt := key.ExpiresAt.Format("2006-01-02T15:04:05Z07:00")
+		response.ExpiresAt = &expiresAt
+	}
+	if key.LastUsedAt != nil {
+		lastUsedAt := key.LastUsedAt.Format("2006-01-02T15:04:05Z07:00")
+		response.LastUsedAt = &lastUsedAt
+	}
+	return response
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// setupServiceAccountTestDB creates an in-memory SQLite database with the service account schema
+func setupServiceAccountTestDB() *gorm.DB {
+	db := setupInvitationTestDB()
+	db.AutoMigrate(&models.ServiceAccount{}, &models.ServiceAccountKey{})
+	return db
+}
+
+// withServiceAccountContext adds the authentication context of a service account key to a request
+func withServiceAccountContext(req *http.Request, serviceAccount models.ServiceAccount) *http.Request {
+	ctx := context.WithValue(req.Context(), "service_account_id", serviceAccount.ID)
+	ctx = context.WithValue(ctx, "token_organization_id", serviceAccount.OrganizationID)
+	return req.WithContext(ctx)
+}
+
+// serveServiceAccountRequest runs an organization-scoped handler behind the organization access middleware
+func serveServiceAccountRequest(orgHandlers *OrganizationHandlers, handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	orgHandlers.OrganizationAccessMiddleware(handler).ServeHTTP(w, req)
+	return w
+}
+
+func TestServiceAccountLifecycle(t *testing.T) {
+	db := setupServiceAccountTestDB()
+	orgHandlers := NewOrganizationHandlers(db)
+
+	admin := createUnitTestUser(db, "admin@example.com")
+	org := models.Organization{Name: "Integrations Org"}
+	db.Create(&org)
+	db.Create(&models.OrganizationMembership{UserID: admin.ID, OrganizationID: org.ID, Role: models.RoleAdmin})
+
+	basePath := fmt.Sprintf("/api/organizations/%d/service-accounts", org.ID)
+
+	// Create a service account
+	reqBody, _ := json.Marshal(models.CreateServiceAccountRequest{Name: "Deploy bot"})
+	req := withUserContext(httptest.NewRequest(http.MethodPost, basePath, bytes.NewBuffer(reqBody)), admin)
+	w := serveServiceAccountRequest(orgHandlers, orgHandlers.CreateServiceAccountHandler, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var serviceAccount models.ServiceAccountResponse
+	json.NewDecoder(w.Body).Decode(&serviceAccount)
+	if serviceAccount.Role != string(models.RoleMember) || serviceAccount.CreatedByID != admin.ID {
+		t.Fatalf("Unexpected service account: %+v", serviceAccount)
+	}
+
+	// Issue two keys so they can be rotated
+	keysPath := fmt.Sprintf("%s/%d/keys", basePath, serviceAccount.ID)
+	createKey := func() models.ServiceAccountKeyResponse {
+		req := withUserContext(httptest.NewRequest(http.MethodPost, keysPath, bytes.NewBufferString("{}")), admin)
+		w := serveServiceAccountRequest(orgHandlers, orgHandlers.CreateServiceAccountKeyHandler, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+		}
+		var key models.ServiceAccountKeyResponse
+		json.NewDecoder(w.Body).Decode(&key)
+		return key
+	}
+	oldKey := createKey()
+	newKey := createKey()
+
+	if !strings.HasPrefix(oldKey.Key, models.ServiceAccountKeyPrefix) {
+		t.Fatalf("Unexpected key: %+v", oldKey)
+	}
+
+	// Only the hash is stored
+	var stored models.ServiceAccountKey
+	db.First(&stored, oldKey.ID)
+	if stored.TokenHash != utils.HashToken(oldKey.Key) {
+		t.Error("Expected key to be stored hashed")
+	}
+
+	// Revoke the old key; the new one stays active and listing never shows the key itself
+	req = withUserContext(httptest.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%d", keysPath, oldKey.ID), nil), admin)
+	if w := serveServiceAccountRequest(orgHandlers, orgHandlers.RevokeServiceAccountKeyHandler, req); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	req = withUserContext(httptest.NewRequest(http.MethodGet, keysPath, nil), admin)
+	w = serveServiceAccountRequest(orgHandlers, orgHandlers.ListServiceAccountKeysHandler, req)
+
+	var keys models.ListServiceAccountKeysResponse
+	json.NewDecoder(w.Body).Decode(&keys)
+	if len(keys.Keys) != 1 || keys.Keys[0].ID != newKey.ID || keys.Keys[0].Key != "" {
+		t.Fatalf("Unexpected key list: %+v", keys.Keys)
+	}
+
+	// Promote the service account to admin
+	reqBody, _ = json.Marshal(map[string]string{"role": "admin"})
+	req = withUserContext(httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/%d", basePath, serviceAccount.ID), bytes.NewBuffer(reqBody)), admin)
+	w = serveServiceAccountRequest(orgHandlers, orgHandlers.UpdateServiceAccountHandler, req)
+	json.NewDecoder(w.Body).Decode(&serviceAccount)
+	if w.Code != http.StatusOK || serviceAccount.Role != string(models.RoleAdmin) {
+		t.Fatalf("Expected service account to be promoted, got %d: %+v", w.Code, serviceAccount)
+	}
+
+	// Deleting the service account revokes its remaining keys
+	req = withUserContext(httptest.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%d", basePath, serviceAccount.ID), nil), admin)
+	if w := serveServiceAccountRequest(orgHandlers, orgHandlers.DeleteServiceAccountHandler, req); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var remaining models.ServiceAccountKey
+	db.First(&remaining, newKey.ID)
+	if remaining.RevokedAt == nil {
+		t.Error("Expected keys of the deleted service account to be revoked")
+	}
+
+	req = withUserContext(httptest.NewRequest(http.MethodGet, basePath, nil), admin)
+	w = serveServiceAccountRequest(orgHandlers, orgHandlers.ListServiceAccountsHandler, req)
+
+	var list models.ListServiceAccountsResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.ServiceAccounts) != 0 {
+		t.Errorf("Expected no service accounts, got %+v", list.ServiceAccounts)
+	}
+}
+
+func TestServiceAccountManagementRequiresHumanAdmin(t *testing.T) {
+	db := setupServiceAccountTestDB()
+	orgHandlers := NewOrganizationHandlers(db)
+
+	member := createUnitTestUser(db, "member@example.com")
+	org := models.Organization{Name: "Integrations Org"}
+	db.Create(&org)
+	db.Create(&models.OrganizationMembership{UserID: member.ID, OrganizationID: org.ID, Role: models.RoleMember})
+
+	serviceAccount := models.ServiceAccount{OrganizationID: org.ID, Name: "Admin bot", Role: models.RoleAdmin, CreatedByID: member.ID}
+	db.Create(&serviceAccount)
+
+	basePath := fmt.Sprintf("/api/organizations/%d/service-accounts", org.ID)
+	reqBody, _ := json.Marshal(models.CreateServiceAccountRequest{Name: "Another bot"})
+
+	// Members cannot manage service accounts
+	req := withUserContext(httptest.NewRequest(http.MethodPost, basePath, bytes.NewBuffer(reqBody)), member)
+	if w := serveServiceAccountRequest(orgHandlers, orgHandlers.CreateServiceAccountHandler, req); w.Code != http.StatusForbidden || decodeErrorCode(w) != "ADMIN_REQUIRED" {
+		t.Errorf("Expected member to be refused, got %d", w.Code)
+	}
+
+	// Nor can service accounts, even with the admin role
+	req = withServiceAccountContext(httptest.NewRequest(http.MethodPost, basePath, bytes.NewBuffer(reqBody)), serviceAccount)
+	if w := serveServiceAccountRequest(orgHandlers, orgHandlers.CreateServiceAccountHandler, req); w.Code != http.StatusForbidden || decodeErrorCode(w) != "USER_REQUIRED" {
+		t.Errorf("Expected service account to be refused, got %d", w.Code)
+	}
+
+	// Nor change how the organization's members sign in
+	disable := false
+	policyBody, _ := json.Marshal(models.UpdateSecurityPolicyRequest{RequireMFA: &disable})
+	req = withServiceAccountContext(httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/organizations/%d/security", org.ID), bytes.NewBuffer(policyBody)), serviceAccount)
+	if w := serveServiceAccountRequest(orgHandlers, orgHandlers.UpdateSecurityPolicyHandler, req); w.Code != http.StatusForbidden || decodeErrorCode(w) != "USER_REQUIRED" {
+		t.Errorf("Expected service account to be refused the security policy, got %d", w.Code)
+	}
+	samlBody, _ := json.Marshal(models.UpdateSAMLConfigRequest{})
+	req = withServiceAccountContext(httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/organizations/%d/saml", org.ID), bytes.NewBuffer(samlBody)), serviceAccount)
+	if w := serveServiceAccountRequest(orgHandlers, orgHandlers.UpdateSAMLConfigHandler, req); w.Code != http.StatusForbidden || decodeErrorCode(w) != "USER_REQUIRED" {
+		t.Errorf("Expected service account to be refused the SAML configuration, got %d", w.Code)
+	}
+}
+
+func TestServiceAccountCallsOrganizationHandlers(t *testing.T) {
+	db := setupServiceAccountTestDB()
+	orgHandlers := NewOrganizationHandlers(db)
+
+	admin := createUnitTestUser(db, "admin@example.com")
+	org := models.Organization{Name: "Integrations Org"}
+	otherOrg := models.Organization{Name: "Other Org"}
+	db.Create(&org)
+	db.Create(&otherOrg)
+	db.Create(&models.OrganizationMembership{UserID: admin.ID, OrganizationID: org.ID, Role: models.RoleAdmin})
+	db.Create(&models.OrganizationMembership{UserID: admin.ID, OrganizationID: otherOrg.ID, Role: models.RoleAdmin})
+
+	serviceAccount := models.ServiceAccount{OrganizationID: org.ID, Name: "Provisioner", Role: models.RoleAdmin, CreatedByID: admin.ID}
+	db.Create(&serviceAccount)
+
+	// Service accounts can use the organization's handlers with their role
+	req := withServiceAccountContext(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/organizations/%d/members", org.ID), nil), serviceAccount)
+	w := serveServiceAccountRequest(orgHandlers, orgHandlers.ListOrganizationMembersHandler, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	reqBody, _ := json.Marshal(models.CreateInvitationRequest{Email: "new@example.com"})
+	req = withServiceAccountContext(httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/organizations/%d/invitations", org.ID), bytes.NewBuffer(reqBody)), serviceAccount)
+	w = serveServiceAccountRequest(orgHandlers, orgHandlers.CreateInvitationHandler, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var invitation models.InvitationResponse
+	json.NewDecoder(w.Body).Decode(&invitation)
+	if invitation.InvitedByServiceAccountID == nil || *invitation.InvitedByServiceAccountID != serviceAccount.ID {
+		t.Errorf("Expected invitation to record the service account, got %+v", invitation)
+	}
+
+	// Other organizations are out of reach
+	req = withServiceAccountContext(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/organizations/%d/members", otherOrg.ID), nil), serviceAccount)
+	if w := serveServiceAccountRequest(orgHandlers, orgHandlers.ListOrganizationMembersHandler, req); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for another organization, got %d", http.StatusForbidden, w.Code)
+	}
+}
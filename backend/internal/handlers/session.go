@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tmember/internal/middleware"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// errInvalidRefreshToken is returned when a refresh token is unknown, expired or its session is revoked
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	// errRefreshTokenReused is returned when an already rotated refresh token is presented again
+	errRefreshTokenReused = errors.New("refresh token reused")
+	// errSessionExpired is returned when a session has outlived its organizations' session limits
+	errSessionExpired = errors.New("session expired")
+)
+
+// maxUserAgentLength is the maximum stored length of a session's user agent
+const maxUserAgentLength = 512
+
+// startSession creates a new session for the user and issues its first access and refresh tokens.
+// mfa records whether the user presented a second factor when signing in. Signing in cancels a pending
+// account deletion.
+func startSession(db *gorm.DB, user models.User, r *http.Request, mfa bool) (*models.AuthResponse, error) {
+	var response *models.AuthResponse
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	var restored bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Signing in during the deletion grace period keeps the account
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND deletion_scheduled_at IS NOT NULL", user.ID).
+			Update("deletion_scheduled_at", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		restored = result.RowsAffected > 0
+		user.DeletionScheduledAt = nil
+
+		session := models.Session{
+			UserID:     user.ID,
+			UserAgent:  userAgent,
+			IPAddress:  utils.ClientIP(r),
+			LastSeenAt: time.Now(),
+			MFA:        mfa,
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		response, err = issueTokens(tx, user, session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recordAuditEvent(db, r, user.ID, models.AuditActionLogin)
+	if restored {
+		recordAuditEvent(db, r, user.ID, models.AuditActionDeletionCancelled)
+	}
+	return response, nil
+}
+
+// issueTokens creates a new refresh token in the session's family along with a matching access token
+func issueTokens(tx *gorm.DB, user models.User, session models.Session) (*models.AuthResponse, error) {
+	refreshToken, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	record := models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	accessToken, err := utils.GenerateJWT(user.ID, user.Email, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		User:         user,
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// rotateRefreshToken consumes a refresh token and issues its successor. Presenting a token
+// that was already rotated revokes the whole session, since the family has been compromised.
+func rotateRefreshToken(db *gorm.DB, refreshToken string) (*models.AuthResponse, error) {
+	var record models.RefreshToken
+	if err := db.Preload("Session.User").Where("token_hash = ?", utils.HashToken(refreshToken)).First(&record).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if !record.Session.IsActive() {
+		return nil, errInvalidRefreshToken
+	}
+
+	if record.UsedAt != nil {
+		if err := revokeSession(db, record.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, errRefreshTokenReused
+	}
+
+	if time.Now().After(record.ExpiresAt) {
+		return nil, errInvalidRefreshToken
+	}
+
+	// Enforce the strictest session limits of the user's organizations before the refresh counts as activity
+	expired, err := middleware.SessionExpired(db, record.Session)
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		if err := revokeSession(db, record.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, errSessionExpired
+	}
+
+	var response *models.AuthResponse
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Mark the token as used, guarding against a concurrent rotation of the same token
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", record.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+
+		if err := tx.Model(&models.Session{}).Where("id = ?", record.SessionID).Update("last_seen_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		var err error
+		response, err = issueTokens(tx, record.Session.User, record.Session)
+		return err
+	})
+
+	if err == errRefreshTokenReused {
+		if revokeErr := revokeSession(db, record.SessionID); revokeErr != nil {
+			return nil, revokeErr
+		}
+	}
+
+	return response, err
+}
+
+// revokeSession revokes a session and with it every token in its family
+func revokeSession(db *gorm.DB, sessionID uint) error {
+	return db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeUserSessions revokes all active sessions of a user except the given one and returns how many were revoked
+func revokeUserSessions(db *gorm.DB, userID, exceptSessionID uint) (int64, error) {
+	result := db.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptSessionID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// RefreshHandler exchanges a refresh token for a new access and refresh token pair
+func (ah *AuthHandlers) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	if req.RefreshToken == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "Refresh token is required", "MISSING_REFRESH_TOKEN")
+		return
+	}
+
+	response, err := rotateRefreshToken(ah.DB, req.RefreshToken)
+	if err != nil {
+		switch err {
+		case errInvalidRefreshToken:
+			writeErrorResponse(w, http.StatusUnauthorized, "Invalid or expired refresh token", "INVALID_REFRESH_TOKEN")
+		case errRefreshTokenReused:
+			writeErrorResponse(w, http.StatusUnauthorized, "Refresh token has already been used; session revoked", "REFRESH_TOKEN_REUSED")
+		case errSessionExpired:
+			writeErrorResponse(w, http.StatusUnauthorized, "Session has expired; please sign in again", "SESSION_EXPIRED")
+		default:
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to refresh token", "TOKEN_REFRESH_ERROR")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// LogoutHandler revokes the session that owns the given refresh token
+func (ah *AuthHandlers) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	if req.RefreshToken == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "Refresh token is required", "MISSING_REFRESH_TOKEN")
+		return
+	}
+
+	// Unknown tokens are treated as already logged out so logout stays idempotent
+	var record models.RefreshToken
+	if err := ah.DB.Where("token_hash = ?", utils.HashToken(req.RefreshToken)).First(&record).Error; err == nil {
+		if err := revokeSession(ah.DB, record.SessionID); err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to revoke session", "LOGOUT_ERROR")
+			return
+		}
+	} else if err != gorm.ErrRecordNotFound {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to revoke session", "LOGOUT_ERROR")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Logged out successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListSessionsHandler lists the current user's active sessions
+func (ah *AuthHandlers) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
+		return
+	}
+	currentSessionID, _ := middleware.GetSessionIDFromContext(r.Context())
+
+	var sessions []models.Session
+	if err := ah.DB.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch sessions", "FETCH_ERROR")
+		return
+	}
+
+	// Convert to response format
+	response := models.ListSessionsResponse{
+		Sessions: make([]models.SessionResponse, len(sessions)),
+	}
+	for i, session := range sessions {
+		response.Sessions[i] = models.SessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			LastSeenAt: session.LastSeenAt.Format("2006-01-02T15:04:05Z07:00"),
+			MFA:        session.MFA,
+			Current:    session.ID == currentSessionID,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeSessionHandler signs out one of the current user's sessions
+func (ah *AuthHandlers) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
+		return
+	}
+
+	// Extract session ID from URL path
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 6 {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid session ID", "INVALID_SESSION_ID")
+		return
+	}
+
+	sessionID, err := strconv.ParseUint(parts[5], 10, 32) // /api/users/me/sessions/{session_id}
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid session ID format", "INVALID_SESSION_ID_FORMAT")
+		return
+	}
+
+	// Find the session, scoped to the current user
+	var session models.Session
+	if err := ah.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", uint(sessionID), userID).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeErrorResponse(w, http.StatusNotFound, "Session not found", "SESSION_NOT_FOUND")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to find session", "SESSION_FETCH_ERROR")
+		}
+		return
+	}
+
+	if err := revokeSession(ah.DB, session.ID); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to revoke session", "REVOKE_ERROR")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":    "Session revoked successfully",
+		"session_id": session.ID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeOtherSessionsHandler signs out every session of the current user except the one making the request
+func (ah *AuthHandlers) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	// Get user and session ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
+		return
+	}
+	currentSessionID, _ := middleware.GetSessionIDFromContext(r.Context())
+
+	revoked, err := revokeUserSessions(ah.DB, userID, currentSessionID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to revoke sessions", "REVOKE_ERROR")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":       "Signed out of all other sessions",
+		"revoked_count": revoked,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tmember/internal/models"
+	"tmember/internal/utils"
+)
+
+// registerForTest registers a user through the handlers and returns the auth response
+func registerForTest(t *testing.T, authHandlers *AuthHandlers, email, password string) models.AuthResponse {
+	t.Helper()
+	reqBody, _ := json.Marshal(models.RegisterRequest{Email: email, Password: password})
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/register", bytes.NewBuffer(reqBody))
+	w := httptest.NewRecorder()
+
+	authHandlers.RegisterHandler(w, req)
+
+	return decodeAuthResponse(t, w, http.StatusCreated)
+}
+
+// loginForTest signs an existing user in with their password and returns the auth response
+func loginForTest(t *testing.T, authHandlers *AuthHandlers, email, password string) models.AuthResponse {
+	t.Helper()
+	return decodeAuthResponse(t, attemptLogin(authHandlers, email, password), http.StatusOK)
+}
+
+// decodeAuthResponse checks the status of a response carrying tokens and decodes it
+func decodeAuthResponse(t *testing.T, w *httptest.ResponseRecorder, status int) models.AuthResponse {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("Expected status %d, got %d: %s", status, w.Code, w.Body.String())
+	}
+
+	var response models.AuthResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return response
+}
+
+// postRefreshToken calls the given refresh-token handler and returns the recorder
+func postRefreshToken(handler http.HandlerFunc, path, refreshToken string) *httptest.ResponseRecorder {
+	reqBody, _ := json.Marshal(models.RefreshRequest{RefreshToken: refreshToken})
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(reqBody))
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestRefreshHandler_RotatesTokens(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	auth := registerForTest(t, authHandlers, "refresh@example.com", "ValidPass123")
+	if auth.RefreshToken == "" {
+		t.Fatal("Expected refresh token in auth response")
+	}
+
+	claims, err := utils.ValidateJWT(auth.Token)
+	if err != nil {
+		t.Fatalf("Failed to validate access token: %v", err)
+	}
+	if claims.SessionID == 0 {
+		t.Error("Expected access token to be bound to a session")
+	}
+
+	w := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", auth.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var refreshed models.AuthResponse
+	json.NewDecoder(w.Body).Decode(&refreshed)
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == auth.RefreshToken {
+		t.Error("Expected a new refresh token after rotation")
+	}
+
+	refreshedClaims, err := utils.ValidateJWT(refreshed.Token)
+	if err != nil {
+		t.Fatalf("Failed to validate refreshed access token: %v", err)
+	}
+	if refreshedClaims.SessionID != claims.SessionID {
+		t.Error("Expected rotated tokens to stay in the same session")
+	}
+}
+
+func TestRefreshHandler_ReuseRevokesFamily(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	auth := registerForTest(t, authHandlers, "reuse@example.com", "ValidPass123")
+
+	first := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", auth.RefreshToken)
+	var rotated models.AuthResponse
+	json.NewDecoder(first.Body).Decode(&rotated)
+
+	// Replaying the rotated token is detected as reuse
+	replay := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", auth.RefreshToken)
+	if replay.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, replay.Code)
+	}
+
+	var errorResponse models.ErrorResponse
+	json.NewDecoder(replay.Body).Decode(&errorResponse)
+	if errorResponse.Code != "REFRESH_TOKEN_REUSED" {
+		t.Errorf("Expected code REFRESH_TOKEN_REUSED, got %s", errorResponse.Code)
+	}
+
+	// The whole family is revoked, including the legitimately rotated token
+	latest := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", rotated.RefreshToken)
+	if latest.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d after family revocation, got %d", http.StatusUnauthorized, latest.Code)
+	}
+}
+
+func TestRefreshHandler_EnforcesSessionLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy models.OrganizationSecurityPolicy
+		column string
+	}{
+		{"idle", models.OrganizationSecurityPolicy{SessionIdleTimeoutMinutes: 30}, "last_seen_at"},
+		{"max age", models.OrganizationSecurityPolicy{SessionMaxAgeMinutes: 480}, "created_at"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db := setupTestDBForUnit()
+			authHandlers := NewAuthHandlers(db)
+
+			auth := registerForTest(t, authHandlers, "limited@example.com", "ValidPass123")
+			claims, err := utils.ValidateJWT(auth.Token)
+			if err != nil {
+				t.Fatalf("Failed to validate access token: %v", err)
+			}
+
+			org := models.Organization{Name: "Strict Org"}
+			db.Create(&org)
+			db.Create(&models.OrganizationMembership{UserID: claims.UserID, OrganizationID: org.ID, Role: models.RoleMember})
+			c.policy.OrganizationID = org.ID
+			db.Create(&c.policy)
+
+			// A session within its limits can still be refreshed
+			first := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", auth.RefreshToken)
+			if first.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, first.Code, first.Body.String())
+			}
+			var rotated models.AuthResponse
+			json.NewDecoder(first.Body).Decode(&rotated)
+
+			db.Model(&models.Session{}).Where("id = ?", claims.SessionID).UpdateColumn(c.column, time.Now().Add(-9*time.Hour))
+			w := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", rotated.RefreshToken)
+			if w.Code != http.StatusUnauthorized || decodeErrorCode(w) != "SESSION_EXPIRED" {
+				t.Fatalf("Expected expired session to be refused, got %d", w.Code)
+			}
+
+			var session models.Session
+			db.First(&session, claims.SessionID)
+			if session.IsActive() {
+				t.Error("Expected the expired session to be revoked")
+			}
+		})
+	}
+}
+
+func TestLogoutHandler_RevokesSession(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	auth := registerForTest(t, authHandlers, "logout@example.com", "ValidPass123")
+
+	w := postRefreshToken(authHandlers.LogoutHandler, "/api/auth/logout", auth.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	claims, _ := utils.ValidateJWT(auth.Token)
+	var session models.Session
+	db.First(&session, claims.SessionID)
+	if session.IsActive() {
+		t.Error("Expected session to be revoked after logout")
+	}
+
+	refresh := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", auth.RefreshToken)
+	if refresh.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d after logout, got %d", http.StatusUnauthorized, refresh.Code)
+	}
+}
+
+// withSessionContext adds authentication context for the session behind an access token
+func withSessionContext(t *testing.T, req *http.Request, accessToken string) *http.Request {
+	claims, err := utils.ValidateJWT(accessToken)
+	if err != nil {
+		t.Fatalf("Failed to validate access token: %v", err)
+	}
+	ctx := context.WithValue(req.Context(), "user_id", claims.UserID)
+	ctx = context.WithValue(ctx, "user_email", claims.Email)
+	ctx = context.WithValue(ctx, "session_id", claims.SessionID)
+	return req.WithContext(ctx)
+}
+
+func TestSessionsRecordDeviceDetails(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	registerForTest(t, authHandlers, "device@example.com", "ValidPass123")
+
+	// Log in again from a second device
+	loginBody, _ := json.Marshal(models.LoginRequest{Email: "device@example.com", Password: "ValidPass123"})
+	loginReq := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(loginBody))
+	loginReq.Header.Set("User-Agent", "LostLaptop/1.0")
+	loginReq.RemoteAddr = "203.0.113.7:54321"
+	loginW := httptest.NewRecorder()
+	authHandlers.LoginHandler(loginW, loginReq)
+
+	var laptop models.AuthResponse
+	json.NewDecoder(loginW.Body).Decode(&laptop)
+
+	req := withSessionContext(t, httptest.NewRequest(http.MethodGet, "/api/users/me/sessions", nil), laptop.Token)
+	w := httptest.NewRecorder()
+	authHandlers.ListSessionsHandler(w, req)
+
+	var response models.ListSessionsResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if len(response.Sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(response.Sessions))
+	}
+
+	var current *models.SessionResponse
+	for i := range response.Sessions {
+		if response.Sessions[i].Current {
+			current = &response.Sessions[i]
+		}
+	}
+	if current == nil {
+		t.Fatal("Expected the requesting session to be marked current")
+	}
+	if current.UserAgent != "LostLaptop/1.0" || current.IPAddress != "203.0.113.7" {
+		t.Errorf("Unexpected device details: %+v", current)
+	}
+}
+
+func TestRevokeSessionHandlers(t *testing.T) {
+	db := setupTestDBForUnit()
+	authHandlers := NewAuthHandlers(db)
+
+	phone := registerForTest(t, authHandlers, "revoke@example.com", "ValidPass123")
+
+	loginBody, _ := json.Marshal(models.LoginRequest{Email: "revoke@example.com", Password: "ValidPass123"})
+	newSession := func() models.AuthResponse {
+		w := httptest.NewRecorder()
+		authHandlers.LoginHandler(w, httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(loginBody)))
+		var response models.AuthResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		return response
+	}
+	laptop := newSession()
+	tablet := newSession()
+
+	// Sign out the laptop remotely from the phone
+	laptopClaims, _ := utils.ValidateJWT(laptop.Token)
+	req := withSessionContext(t, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/users/me/sessions/%d", laptopClaims.SessionID), nil), phone.Token)
+	w := httptest.NewRecorder()
+	authHandlers.RevokeSessionHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if refresh := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", laptop.RefreshToken); refresh.Code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked laptop session to be unable to refresh, got %d", refresh.Code)
+	}
+
+	// Sign out everywhere else keeps only the phone
+	othersReq := withSessionContext(t, httptest.NewRequest(http.MethodDelete, "/api/users/me/sessions", nil), phone.Token)
+	othersW := httptest.NewRecorder()
+	authHandlers.RevokeOtherSessionsHandler(othersW, othersReq)
+
+	if othersW.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, othersW.Code)
+	}
+	if refresh := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", tablet.RefreshToken); refresh.Code != http.StatusUnauthorized {
+		t.Errorf("Expected tablet session to be revoked, got %d", refresh.Code)
+	}
+	if refresh := postRefreshToken(authHandlers.RefreshHandler, "/api/auth/refresh", phone.RefreshToken); refresh.Code != http.StatusOK {
+		t.Errorf("Expected current session to survive, got %d", refresh.Code)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// errInvalidUserToken is returned when a user token is unknown, expired, already used or for another purpose
+var errInvalidUserToken = errors.New("invalid or expired token")
+
+// createUserToken issues a new one-time token for the user, invalidating earlier unused tokens of the same purpose
+func createUserToken(db *gorm.DB, userID uint, purpose models.TokenPurpose, ttl time.Duration) (string, error) {
+	return createUserTokenWithData(db, userID, purpose, ttl, "")
+}
+
+// createUserTokenWithData is createUserToken for tokens bound to a value, such as the new address of an email change
+func createUserTokenWithData(db *gorm.DB, userID uint, purpose models.TokenPurpose, ttl time.Duration, data string) (string, error) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Revert links stay valid when newer changes are requested, so whoever makes them cannot take away the
+		// previous owner's way back
+		if purpose != models.TokenPurposeEmailChangeRevert {
+			if err := tx.Model(&models.UserToken{}).
+				Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+				Update("used_at", time.Now()).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&models.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: utils.HashToken(token),
+			Data:      data,
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeUserToken validates a one-time token for the given purpose and marks it as used
+func consumeUserToken(db *gorm.DB, token string, purpose models.TokenPurpose) (*models.UserToken, error) {
+	record, err := findUserToken(db, token, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := useUserToken(db, record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// findUserToken returns the unused, unexpired one-time token for the given purpose without consuming it
+func findUserToken(db *gorm.DB, token string, purpose models.TokenPurpose) (*models.UserToken, error) {
+	var record models.UserToken
+	if err := db.Preload("User").Where("token_hash = ? AND purpose = ?", utils.HashToken(token), purpose).First(&record).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidUserToken
+		}
+		return nil, err
+	}
+
+	if record.UsedAt != nil || time.Now().After(record.ExpiresAt) {
+		return nil, errInvalidUserToken
+	}
+
+	return &record, nil
+}
+
+// useUserToken marks a token found by findUserToken as used, guarding against concurrent use of the same token
+func useUserToken(db *gorm.DB, record *models.UserToken) error {
+	result := db.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", record.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidUserToken
+	}
+
+	return nil
+}
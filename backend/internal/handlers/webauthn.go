@@ -0,0 +1,641 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tmember/internal/config"
+	"tmember/internal/middleware"
+	"tmember/internal/models"
+	"tmember/internal/utils"
+	"tmember/internal/webauthn"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// webauthnChallengeTTL is how long a WebAuthn ceremony may take
+	webauthnChallengeTTL = 5 * time.Minute
+	// maxCredentialNameLength is the maximum length of a WebAuthn credential name
+	maxCredentialNameLength = 100
+	// webauthnUserHandleLength is the number of random bytes in a user handle
+	webauthnUserHandleLength = 32
+)
+
+// errInvalidWebAuthnAssertion is returned when a WebAuthn assertion does not match a pending ceremony and a registered credential
+var errInvalidWebAuthnAssertion = errors.New("invalid WebAuthn assertion")
+
+// newWebAuthnRelyingParty returns the relying party configured for this deployment
+func newWebAuthnRelyingParty() *webauthn.RelyingParty {
+	cfg := config.WebAuthn()
+	return &webauthn.RelyingParty{ID: cfg.RPID, Name: cfg.RPName, Origins: cfg.Origins, Timeout: webauthnChallengeTTL}
+}
+
+// secondFactorMethods returns the second factors the user has set up
+func secondFactorMethods(db *gorm.DB, user models.User) ([]string, error) {
+	methods := []string{}
+	if user.IsMFAEnabled() {
+		methods = append(methods, "totp")
+	}
+
+	var credentials int64
+	if err := db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&credentials).Error; err != nil {
+		return nil, err
+	}
+	if credentials > 0 {
+		methods = append(methods, "webauthn")
+	}
+	return methods, nil
+}
+
+// hasSecondFactor reports whether the user has set up TOTP or registered a WebAuthn credential
+func hasSecondFactor(db *gorm.DB, user models.User) (bool, error) {
+	methods, err := secondFactorMethods(db, user)
+	return len(methods) > 0, err
+}
+
+// requireSecondFactorStepUp refuses sessions that did not present a second factor when the user has one, so
+// that a password alone, or a stolen access token, cannot be used for the action. It returns whether the user
+// has a second factor, and false once it has written an error response.
+func requireSecondFactorStepUp(w http.ResponseWriter, r *http.Request, db *gorm.DB, user models.User, action string) (bool, bool) {
+	enrolled, err := hasSecondFactor(db, user)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to check second factors", "MFA_CHECK_ERROR")
+		return false, false
+	}
+	if enrolled && !middleware.GetSessionMFAFromContext(r.Context()) {
+		writeErrorResponse(w, http.StatusForbidden, "Please sign in again with your second factor to "+action, "MFA_STEP_UP_REQUIRED")
+		return enrolled, false
+	}
+	return enrolled, true
+}
+
+// createWebAuthnChallenge starts a ceremony for the user and returns its challenge
+func createWebAuthnChallenge(db *gorm.DB, userID uint, ceremony models.WebAuthnCeremony, userHandle string) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	record := models.WebAuthnChallenge{
+		UserID:        userID,
+		Ceremony:      ceremony,
+		ChallengeHash: utils.HashToken(base64.RawURLEncoding.EncodeToString(challenge)),
+		UserHandle:    userHandle,
+		ExpiresAt:     time.Now().Add(webauthnChallengeTTL),
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge finds the user's pending ceremony a response was made for and marks it as used, so
+// that each challenge is answered at most once
+func consumeWebAuthnChallenge(db *gorm.DB, clientDataJSON []byte, userID uint, ceremony models.WebAuthnCeremony) ([]byte, *models.WebAuthnChallenge, error) {
+	challenge, err := webauthn.ClientChallenge(clientDataJSON)
+	if err != nil {
+		return nil, nil, errInvalidWebAuthnAssertion
+	}
+
+	var record models.WebAuthnChallenge
+	if err := db.Where("challenge_hash = ? AND user_id = ? AND ceremony = ?",
+		utils.HashToken(base64.RawURLEncoding.EncodeToString(challenge)), userID, ceremony).First(&record).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, errInvalidWebAuthnAssertion
+		}
+		return nil, nil, err
+	}
+	if record.UsedAt != nil || time.Now().After(record.ExpiresAt) {
+		return nil, nil, errInvalidWebAuthnAssertion
+	}
+
+	result := db.Model(&models.WebAuthnChallenge{}).
+		Where("id = ? AND used_at IS NULL", record.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, errInvalidWebAuthnAssertion
+	}
+	return challenge, &record, nil
+}
+
+// verifyWebAuthnAssertion verifies an assertion answering a ceremony of the user, or of anyone for passkey
+// sign-ins (userID zero), and records the credential's new signature counter
+func verifyWebAuthnAssertion(db *gorm.DB, rp *webauthn.RelyingParty, userID uint, ceremony models.WebAuthnCeremony, response webauthn.AssertionResponse, requireUserVerification bool) (*models.WebAuthnCredential, error) {
+	challenge, _, err := consumeWebAuthnChallenge(db, response.Response.ClientDataJSON, userID, ceremony)
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Where("credential_id = ?", base64.RawURLEncoding.EncodeToString(response.RawID))
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	var credential models.WebAuthnCredential
+	if err := query.First(&credential).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidWebAuthnAssertion
+		}
+		return nil, err
+	}
+
+	// Discoverable credentials name the user they were registered for
+	if len(response.Response.UserHandle) > 0 && base64.RawURLEncoding.EncodeToString(response.Response.UserHandle) != credential.UserHandle {
+		return nil, errInvalidWebAuthnAssertion
+	}
+
+	assertion, err := rp.VerifyAssertion(challenge, credential.PublicKey, credential.SignCount, response, requireUserVerification)
+	if errors.Is(err, webauthn.ErrSignCountRegression) {
+		log.Printf("WebAuthn credential %d of user %d reported a signature counter that did not increase; it may have been cloned", credential.ID, credential.UserID)
+	}
+	if err != nil {
+		return nil, errInvalidWebAuthnAssertion
+	}
+
+	// Guard against a concurrent assertion with the same counter
+	now := time.Now()
+	result := db.Model(&models.WebAuthnCredential{}).
+		Where("id = ? AND sign_count = ?", credential.ID, credential.SignCount).
+		Updates(map[string]interface{}{"sign_count": assertion.SignCount, "last_used_at": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errInvalidWebAuthnAssertion
+	}
+	credential.SignCount = assertion.SignCount
+	credential.LastUsedAt = &now
+
+	return &credential, nil
+}
+
+// WebAuthnRegistrationOptionsHandler starts registering a passkey or security key for the current user
+func (ah *AuthHandlers) WebAuthnRegistrationOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r, ah.DB)
+	if !ok {
+		return
+	}
+
+	var existing []models.WebAuthnCredential
+	if err := ah.DB.Where("user_id = ?", user.ID).Order("created_at ASC").Find(&existing).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch credentials", "FETCH_ERROR")
+		return
+	}
+
+	// All of a user's credentials share one random handle, which identifies the user at passkey sign-in
+	var userHandle []byte
+	if len(existing) > 0 {
+		userHandle, _ = base64.RawURLEncoding.DecodeString(existing[0].UserHandle)
+	}
+	if len(userHandle) == 0 {
+		userHandle = make([]byte, webauthnUserHandleLength)
+		if _, err := rand.Read(userHandle); err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to start registration", "WEBAUTHN_ERROR")
+			return
+		}
+	}
+
+	exclude := make([]webauthn.CredentialDescriptor, 0, len(existing))
+	for _, credential := range existing {
+		exclude = append(exclude, toCredentialDescriptor(credential))
+	}
+
+	challenge, err := createWebAuthnChallenge(ah.DB, user.ID, models.WebAuthnCeremonyRegistration, base64.RawURLEncoding.EncodeToString(userHandle))
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to start registration", "WEBAUTHN_ERROR")
+		return
+	}
+
+	options := ah.relyingParty().CreationOptions(challenge, webauthn.UserEntity{ID: userHandle, Name: user.Email, DisplayName: user.Email}, exclude)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.WebAuthnCreationOptionsResponse{PublicKey: options})
+}
+
+// RegisterWebAuthnCredentialHandler completes registering a passkey or security key. Users registering their
+// first second factor also get recovery codes, shown only once.
+func (ah *AuthHandlers) RegisterWebAuthnCredentialHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r, ah.DB)
+	if !ok {
+		return
+	}
+
+	// Adding a credential to an account that has a second factor needs that factor
+	hadSecondFactor, ok := requireSecondFactorStepUp(w, r, ah.DB, *user, "add a passkey")
+	if !ok {
+		return
+	}
+
+	var req models.RegisterWebAuthnCredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > maxCredentialNameLength {
+		writeErrorResponse(w, http.StatusBadRequest, "Credential name must be at most 100 characters", "INVALID_NAME")
+		return
+	}
+
+	challenge, ceremony, err := consumeWebAuthnChallenge(ah.DB, req.Credential.Response.ClientDataJSON, user.ID, models.WebAuthnCeremonyRegistration)
+	if err != nil {
+		writeWebAuthnError(w, err, "Invalid or expired registration", "INVALID_WEBAUTHN_REGISTRATION")
+		return
+	}
+
+	registered, err := ah.relyingParty().VerifyRegistration(challenge, req.Credential, false)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error(), "INVALID_WEBAUTHN_REGISTRATION")
+		return
+	}
+
+	credential := models.WebAuthnCredential{
+		UserID:       user.ID,
+		Name:         name,
+		CredentialID: base64.RawURLEncoding.EncodeToString(registered.ID),
+		UserHandle:   ceremony.UserHandle,
+		PublicKey:    registered.PublicKey,
+		SignCount:    registered.SignCount,
+		Transports:   strings.Join(knownTransports(registered.Transports), ","),
+	}
+
+	var exists int64
+	if err := ah.DB.Model(&models.WebAuthnCredential{}).Where("credential_id = ?", credential.CredentialID).Count(&exists).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to register credential", "WEBAUTHN_ERROR")
+		return
+	}
+	if exists > 0 {
+		writeErrorResponse(w, http.StatusConflict, "This credential is already registered", "CREDENTIAL_EXISTS")
+		return
+	}
+
+	sessionID, _ := middleware.GetSessionIDFromContext(r.Context())
+
+	var codes []string
+	err = ah.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&credential).Error; err != nil {
+			return err
+		}
+
+		// The current session has just presented a second factor
+		if err := tx.Model(&models.Session{}).Where("id = ?", sessionID).Update("mfa", true).Error; err != nil {
+			return err
+		}
+
+		if hadSecondFactor {
+			return nil
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to register credential", "WEBAUTHN_ERROR")
+		return
+	}
+	recordAuditEvent(ah.DB, r, user.ID, models.AuditActionPasskeyAdded)
+
+	response := toWebAuthnCredentialResponse(credential)
+	response.RecoveryCodes = codes
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListWebAuthnCredentialsHandler lists the current user's WebAuthn credentials
+func (ah *AuthHandlers) ListWebAuthnCredentialsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
+		return
+	}
+
+	var credentials []models.WebAuthnCredential
+	if err := ah.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&credentials).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch credentials", "FETCH_ERROR")
+		return
+	}
+
+	response := models.ListWebAuthnCredentialsResponse{Credentials: make([]models.WebAuthnCredentialResponse, 0, len(credentials))}
+	for _, credential := range credentials {
+		response.Credentials = append(response.Credentials, toWebAuthnCredentialResponse(credential))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateWebAuthnCredentialHandler renames one of the current user's WebAuthn credentials
+func (ah *AuthHandlers) UpdateWebAuthnCredentialHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	credential, ok := ah.loadOwnWebAuthnCredential(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateWebAuthnCredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxCredentialNameLength {
+		writeErrorResponse(w, http.StatusBadRequest, "Credential name is required and must be at most 100 characters", "INVALID_NAME")
+		return
+	}
+
+	if err := ah.DB.Model(credential).Update("name", name).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to update credential", "UPDATE_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toWebAuthnCredentialResponse(*credential))
+}
+
+// DeleteWebAuthnCredentialHandler removes one of the current user's WebAuthn credentials. Removing a second
+// factor requires a session that presented one; recovery codes go with the user's last second factor.
+func (ah *AuthHandlers) DeleteWebAuthnCredentialHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	credential, ok := ah.loadOwnWebAuthnCredential(w, r)
+	if !ok {
+		return
+	}
+
+	if !middleware.GetSessionMFAFromContext(r.Context()) {
+		writeErrorResponse(w, http.StatusForbidden, "Please sign in again with your second factor to remove it", "MFA_STEP_UP_REQUIRED")
+		return
+	}
+
+	err := ah.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(credential).Error; err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := tx.First(&user, credential.UserID).Error; err != nil {
+			return err
+		}
+		remaining, err := hasSecondFactor(tx, user)
+		if err != nil || remaining {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.MFARecoveryCode{}).Error
+	})
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to remove credential", "DELETE_ERROR")
+		return
+	}
+	recordAuditEvent(ah.DB, r, credential.UserID, models.AuditActionPasskeyRemoved)
+
+	response := map[string]interface{}{
+		"message":       "Credential removed successfully",
+		"credential_id": credential.ID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// WebAuthnLoginOptionsHandler starts a passwordless sign-in with a passkey
+func (ah *AuthHandlers) WebAuthnLoginOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	// The user is not known yet: the browser offers the passkeys it holds for this site
+	challenge, err := createWebAuthnChallenge(ah.DB, 0, models.WebAuthnCeremonyLogin, "")
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to start sign-in", "WEBAUTHN_ERROR")
+		return
+	}
+
+	options := ah.relyingParty().RequestOptions(challenge, nil, webauthn.UserVerificationRequired)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.WebAuthnRequestOptionsResponse{PublicKey: options})
+}
+
+// WebAuthnLoginHandler completes a passwordless sign-in. Passkeys verify the user themselves, so the new
+// session counts as authenticated with a second factor.
+func (ah *AuthHandlers) WebAuthnLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var req models.WebAuthnLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	credential, err := verifyWebAuthnAssertion(ah.DB, ah.relyingParty(), 0, models.WebAuthnCeremonyLogin, req.Credential, true)
+	if err != nil {
+		writeWebAuthnError(w, err, "Invalid passkey", "INVALID_WEBAUTHN_ASSERTION")
+		return
+	}
+
+	var user models.User
+	if err := ah.DB.First(&user, credential.UserID).Error; err != nil {
+		writeErrorResponse(w, http.StatusUnauthorized, "Invalid passkey", "INVALID_WEBAUTHN_ASSERTION")
+		return
+	}
+
+	response, err := startSession(ah.DB, user, r, true)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to generate token", "TOKEN_GENERATION_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// WebAuthnMFAOptionsHandler starts presenting a WebAuthn credential as the second factor of a login
+func (ah *AuthHandlers) WebAuthnMFAOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED")
+		return
+	}
+
+	var req models.WebAuthnMFAOptionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", "INVALID_JSON")
+		return
+	}
+
+	challenge, err := loadMFAChallenge(ah.DB, req.MFAToken)
+	if err != nil {
+		writeMFAChallengeError(w, err)
+		return
+	}
+
+	var credentials []models.WebAuthnCredential
+	if err := ah.DB.Where("user_id = ?", challenge.UserID).Find(&credentials).Error; err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch credentials", "FETCH_ERROR")
+		return
+	}
+	if len(credentials) == 0 {
+		writeErrorResponse(w, http.StatusConflict, "No passkeys or security keys are registered", "WEBAUTHN_NOT_ENABLED")
+		return
+	}
+
+	allow := make([]webauthn.CredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		allow = append(allow, toCredentialDescriptor(credential))
+	}
+
+	webauthnChallenge, err := createWebAuthnChallenge(ah.DB, challenge.UserID, models.WebAuthnCeremonyMFA, "")
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to start verification", "WEBAUTHN_ERROR")
+		return
+	}
+
+	options := ah.relyingParty().RequestOptions(webauthnChallenge, allow, webauthn.UserVerificationPreferred)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.WebAuthnRequestOptionsResponse{PublicKey: options})
+}
+
+// relyingParty returns the configured relying party, or the one described by the environment
+func (ah *AuthHandlers) relyingParty() *webauthn.RelyingParty {
+	if ah.WebAuthn != nil {
+		return ah.WebAuthn
+	}
+	return newWebAuthnRelyingParty()
+}
+
+// loadOwnWebAuthnCredential loads the current user's credential named by the URL path, writing an error
+// response if that fails
+func (ah *AuthHandlers) loadOwnWebAuthnCredential(w http.ResponseWriter, r *http.Request) (*models.WebAuthnCredential, bool) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeErrorResponse(w, http.StatusUnauthorized, "User not authenticated", "NOT_AUTHENTICATED")
+		return nil, false
+	}
+
+	// Extract credential ID from URL path
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 7 {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid credential ID", "INVALID_CREDENTIAL_ID")
+		return nil, false
+	}
+
+	credentialID, err := strconv.ParseUint(parts[6], 10, 32) // /api/users/me/webauthn/credentials/{credential_id}
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid credential ID format", "INVALID_CREDENTIAL_ID_FORMAT")
+		return nil, false
+	}
+
+	var credential models.WebAuthnCredential
+	if err := ah.DB.Where("id = ? AND user_id = ?", uint(credentialID), userID).First(&credential).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeErrorResponse(w, http.StatusNotFound, "Credential not found", "CREDENTIAL_NOT_FOUND")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to fetch credential", "FETCH_ERROR")
+		}
+		return nil, false
+	}
+	return &credential, true
+}
+
+// writeWebAuthnError writes the response for a ceremony response that could not be matched or verified
+func writeWebAuthnError(w http.ResponseWriter, err error, message, code string) {
+	if err == errInvalidWebAuthnAssertion {
+		writeErrorResponse(w, http.StatusUnauthorized, message, code)
+	} else {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to verify credential", "WEBAUTHN_ERROR")
+	}
+}
+
+// knownTransports returns the transport hints defined by WebAuthn, dropping unknown or repeated values
+func knownTransports(transports []string) []string {
+	known := []string{}
+	for _, transport := range transports {
+		switch transport {
+		case "usb", "nfc", "ble", "smart-card", "hybrid", "internal":
+			if !slices.Contains(known, transport) {
+				known = append(known, transport)
+			}
+		}
+	}
+	return known
+}
+
+// toCredentialDescriptor describes a registered credential to the browser
+func toCredentialDescriptor(credential models.WebAuthnCredential) webauthn.CredentialDescriptor {
+	id, _ := base64.RawURLEncoding.DecodeString(credential.CredentialID)
+	descriptor := webauthn.CredentialDescriptor{Type: "public-key", ID: id}
+	if credential.Transports != "" {
+		descriptor.Transports = strings.Split(credential.Transports, ",")
+	}
+	return descriptor
+}
+
+// toWebAuthnCredentialResponse converts a WebAuthn credential to its API representation
+func toWebAuthnCredentialResponse(credential models.WebAuthnCredential) models.WebAuthnCredentialResponse {
+	response := models.WebAuthnCredentialResponse{
+		ID:           credential.ID,
+		Name:         credential.Name,
+		CredentialID: credential.CredentialID,
+		Transports:   []string{},
+		CreatedAt:    credential.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if credential.Transports != "" {
+		response.Transports = strings.Split(credential.Transports, ",")
+	}
+	if credential.LastUsedAt != nil {
+		lastUsedAt := credential.LastUsedAt.Format("2006-01-02T15:04:05Z07:00")
+		response.LastUsedAt = &lastUsedAt
+	}
+	return response
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tmember/internal/models"
+	"tmember/internal/utils"
+	"tmember/internal/webauthn"
+	"tmember/internal/webauthn/webauthntest"
+
+	"gorm.io/gorm"
+)
+
+const webauthnTestOrigin = "http://localhost:5173"
+
+// newWebAuthnTestHandlers returns auth handlers for a relying party at localhost and a software authenticator
+func newWebAuthnTestHandlers() (*AuthHandlers, *webauthntest.Authenticator) {
+	authHandlers := NewAuthHandlers(setupTestDBForUnit())
+	authHandlers.WebAuthn = &webauthn.RelyingParty{ID: "localhost", Name: "TMember", Origins: []string{webauthnTestOrigin}}
+	return authHandlers, webauthntest.NewAuthenticator(webauthnTestOrigin)
+}
+
+// serveSessionRequest calls a handler as the session behind the access token
+func serveSessionRequest(t *testing.T, handler http.HandlerFunc, accessToken, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reqBody bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&reqBody).Encode(body)
+	}
+	req := withSessionContext(t, httptest.NewRequest(method, path, &reqBody), accessToken)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+// registerPasskeyForTest registers a credential of the authenticator for the user behind the access token
+func registerPasskeyForTest(t *testing.T, authHandlers *AuthHandlers, authenticator *webauthntest.Authenticator, accessToken, name string) models.WebAuthnCredentialResponse {
+	t.Helper()
+	w := serveSessionRequest(t, authHandlers.WebAuthnRegistrationOptionsHandler, accessToken, http.MethodPost, "/api/users/me/webauthn/credentials/options", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var options models.WebAuthnCreationOptionsResponse
+	json.NewDecoder(w.Body).Decode(&options)
+
+	credential, err := authenticator.Register(options.PublicKey)
+	if err != nil {
+		t.Fatalf("Authenticator failed to register: %v", err)
+	}
+	w = registerPasskeyRequest(t, authHandlers, accessToken, models.RegisterWebAuthnCredentialRequest{Name: name, Credential: credential})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var response models.WebAuthnCredentialResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	return response
+}
+
+// registerPasskeyRequest posts a credential registration as the session behind the access token, marking
+// whether the session presented a second factor the way the auth middleware does
+func registerPasskeyRequest(t *testing.T, authHandlers *AuthHandlers, accessToken string, body models.RegisterWebAuthnCredentialRequest) *httptest.ResponseRecorder {
+	reqBody, _ := json.Marshal(body)
+	req := withSessionContext(t, httptest.NewRequest(http.MethodPost, "/api/users/me/webauthn/credentials", bytes.NewBuffer(reqBody)), accessToken)
+	req = req.WithContext(context.WithValue(req.Context(), "session_mfa", sessionMFA(authHandlers, accessToken)))
+	w := httptest.NewRecorder()
+	authHandlers.RegisterWebAuthnCredentialHandler(w, req)
+	return w
+}
+
+// passkeyLogin signs in with a passkey of the authenticator
+func passkeyLogin(t *testing.T, authHandlers *AuthHandlers, authenticator *webauthntest.Authenticator) *httptest.ResponseRecorder {
+	t.Helper()
+	w := postJSON(authHandlers.WebAuthnLoginOptionsHandler, "/api/auth/webauthn/login/options", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var options models.WebAuthnRequestOptionsResponse
+	json.NewDecoder(w.Body).Decode(&options)
+
+	assertion, err := authenticator.Assert(options.PublicKey)
+	if err != nil {
+		t.Fatalf("Authenticator failed to sign in: %v", err)
+	}
+	return postJSON(authHandlers.WebAuthnLoginHandler, "/api/auth/webauthn/login", models.WebAuthnLoginRequest{Credential: assertion})
+}
+
+// sessionMFA reports whether the session behind the access token was authenticated with a second factor
+func sessionMFA(authHandlers *AuthHandlers, accessToken string) bool {
+	claims, _ := utils.ValidateJWT(accessToken)
+	var session models.Session
+	authHandlers.DB.First(&session, claims.SessionID)
+	return session.MFA
+}
+
+func TestWebAuthnRegistrationAndPasskeyLogin(t *testing.T) {
+	authHandlers, authenticator := newWebAuthnTestHandlers()
+	auth := registerForTest(t, authHandlers, "passkey@example.com", "ValidPass123")
+
+	// The first second factor comes with recovery codes, and the registering session counts as MFA-authenticated
+	first := registerPasskeyForTest(t, authHandlers, authenticator, auth.Token, "Laptop")
+	if first.Name != "Laptop" || first.CredentialID == "" || len(first.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("Expected a named credential with recovery codes, got %+v", first)
+	}
+	if !sessionMFA(authHandlers, auth.Token) {
+		t.Error("Expected the registering session to count as MFA-authenticated")
+	}
+
+	// Further credentials exclude the registered ones and come without new recovery codes
+	phone := webauthntest.NewAuthenticator(webauthnTestOrigin)
+	second := registerPasskeyForTest(t, authHandlers, phone, auth.Token, "")
+	if second.Name != "Passkey" || len(second.RecoveryCodes) != 0 {
+		t.Errorf("Expected a default name and no recovery codes, got %+v", second)
+	}
+	w := serveSessionRequest(t, authHandlers.WebAuthnRegistrationOptionsHandler, auth.Token, http.MethodPost, "/api/users/me/webauthn/credentials/options", nil)
+	var options models.WebAuthnCreationOptionsResponse
+	json.NewDecoder(w.Body).Decode(&options)
+	if len(options.PublicKey.ExcludeCredentials) != 2 {
+		t.Errorf("Expected 2 excluded credentials, got %d", len(options.PublicKey.ExcludeCredentials))
+	}
+	if _, err := authenticator.Register(options.PublicKey); err == nil {
+		t.Error("Expected the authenticator to refuse registering twice")
+	}
+
+	w = serveSessionRequest(t, authHandlers.UpdateWebAuthnCredentialHandler, auth.Token, http.MethodPut,
+		fmt.Sprintf("/api/users/me/webauthn/credentials/%d", second.ID), models.UpdateWebAuthnCredentialRequest{Name: "Phone"})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = serveSessionRequest(t, authHandlers.ListWebAuthnCredentialsHandler, auth.Token, http.MethodGet, "/api/users/me/webauthn/credentials", nil)
+	var list models.ListWebAuthnCredentialsResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Credentials) != 2 || list.Credentials[0].Name != "Phone" || list.Credentials[1].Name != "Laptop" {
+		t.Fatalf("Expected the renamed and original credentials, got %+v", list.Credentials)
+	}
+
+	// Signing in with a passkey needs no password and counts as MFA-authenticated
+	w = passkeyLogin(t, authHandlers, phone)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response models.AuthResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Token == "" || response.User.Email != "passkey@example.com" || !sessionMFA(authHandlers, response.Token) {
+		t.Errorf("Expected an MFA-authenticated session for the user, got %+v", response.User)
+	}
+
+	var credential models.WebAuthnCredential
+	authHandlers.DB.First(&credential, second.ID)
+	if credential.SignCount == 0 || credential.LastUsedAt == nil {
+		t.Errorf("Expected the signature counter and last use to be recorded, got %+v", credential)
+	}
+}
+
+func TestWebAuthnLoginRejections(t *testing.T) {
+	authHandlers, authenticator := newWebAuthnTestHandlers()
+	auth := registerForTest(t, authHandlers, "passkey@example.com", "ValidPass123")
+	registered := registerPasskeyForTest(t, authHandlers, authenticator, auth.Token, "Laptop")
+
+	// Each challenge can be answered once
+	w := postJSON(authHandlers.WebAuthnLoginOptionsHandler, "/api/auth/webauthn/login/options", nil)
+	var options models.WebAuthnRequestOptionsResponse
+	json.NewDecoder(w.Body).Decode(&options)
+	assertion, _ := authenticator.Assert(options.PublicKey)
+	if w := postJSON(authHandlers.WebAuthnLoginHandler, "/api/auth/webauthn/login", models.WebAuthnLoginRequest{Credential: assertion}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := postJSON(authHandlers.WebAuthnLoginHandler, "/api/auth/webauthn/login", models.WebAuthnLoginRequest{Credential: assertion}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a replayed assertion to be rejected, got %d", w.Code)
+	}
+
+	// Phishing sites get assertions for their own origin, which are useless here
+	authenticator.Origin = "http://localhost.evil.example"
+	if w := passkeyLogin(t, authHandlers, authenticator); w.Code != http.StatusUnauthorized || decodeErrorCode(w) != "INVALID_WEBAUTHN_ASSERTION" {
+		t.Errorf("Expected 401 INVALID_WEBAUTHN_ASSERTION for a foreign origin, got %d", w.Code)
+	}
+	authenticator.Origin = webauthnTestOrigin
+
+	// A counter that went backwards suggests a cloned authenticator
+	credentialID, _ := base64.RawURLEncoding.DecodeString(registered.CredentialID)
+	authenticator.SetSignCount(credentialID, 0)
+	if w := passkeyLogin(t, authHandlers, authenticator); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a cloned authenticator to be rejected, got %d", w.Code)
+	}
+
+	// Removed credentials cannot sign in; removing one needs an MFA-authenticated session
+	path := fmt.Sprintf("/api/users/me/webauthn/credentials/%d", registered.ID)
+	req := withSessionContext(t, httptest.NewRequest(http.MethodDelete, path, nil), auth.Token)
+	w = httptest.NewRecorder()
+	authHandlers.DeleteWebAuthnCredentialHandler(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without a second factor on the session, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	authHandlers.DeleteWebAuthnCredentialHandler(w, req.WithContext(context.WithValue(req.Context(), "session_mfa", true)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := passkeyLogin(t, authHandlers, authenticator); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a removed credential to be rejected, got %d", w.Code)
+	}
+
+	// Recovery codes go with the last second factor
+	var codes int64
+	authHandlers.DB.Model(&models.MFARecoveryCode{}).Count(&codes)
+	if codes != 0 {
+		t.Errorf("Expected recovery codes to be removed with the last second factor, got %d", codes)
+	}
+}
+
+func TestWebAuthnEnrollmentRequiresStepUp(t *testing.T) {
+	authHandlers, authenticator := newWebAuthnTestHandlers()
+	enrolling := registerForTest(t, authHandlers, "stepup@example.com", "ValidPass123")
+	stale := loginForTest(t, authHandlers, "stepup@example.com", "ValidPass123")
+	registerPasskeyForTest(t, authHandlers, authenticator, enrolling.Token, "Laptop")
+
+	// A session from before enrollment cannot add another passkey or an authenticator app
+	w := serveSessionRequest(t, authHandlers.WebAuthnRegistrationOptionsHandler, stale.Token, http.MethodPost, "/api/users/me/webauthn/credentials/options", nil)
+	var options models.WebAuthnCreationOptionsResponse
+	json.NewDecoder(w.Body).Decode(&options)
+	credential, err := webauthntest.NewAuthenticator(webauthnTestOrigin).Register(options.PublicKey)
+	if err != nil {
+		t.Fatalf("Authenticator failed to register: %v", err)
+	}
+	w = registerPasskeyRequest(t, authHandlers, stale.Token, models.RegisterWebAuthnCredentialRequest{Name: "Attacker", Credential: credential})
+	if w.Code != http.StatusForbidden || decodeErrorCode(w) != "MFA_STEP_UP_REQUIRED" {
+		t.Errorf("Expected 403 MFA_STEP_UP_REQUIRED for a passkey, got %d: %s", w.Code, w.Body.String())
+	}
+	if sessionMFA(authHandlers, stale.Token) {
+		t.Error("Expected the stale session not to be upgraded")
+	}
+
+	if w := serveSessionRequest(t, authHandlers.TOTPSetupHandler, stale.Token, http.MethodPost, "/api/auth/mfa/totp/setup", nil); w.Code != http.StatusForbidden || decodeErrorCode(w) != "MFA_STEP_UP_REQUIRED" {
+		t.Errorf("Expected 403 MFA_STEP_UP_REQUIRED for TOTP setup, got %d", w.Code)
+	}
+	if w := serveSessionRequest(t, authHandlers.TOTPConfirmHandler, stale.Token, http.MethodPost, "/api/auth/mfa/totp/confirm", models.TOTPConfirmRequest{Code: "000000"}); w.Code != http.StatusForbidden || decodeErrorCode(w) != "MFA_STEP_UP_REQUIRED" {
+		t.Errorf("Expected 403 MFA_STEP_UP_REQUIRED for TOTP confirmation, got %d", w.Code)
+	}
+}
+
+func TestWebAuthnCredentialsRemovedWhenAccountClaimed(t *testing.T) {
+	authHandlers, authenticator := newWebAuthnTestHandlers()
+	squatter := registerForTest(t, authHandlers, "victim@example.com", "ValidPass123")
+	registerPasskeyForTest(t, authHandlers, authenticator, squatter.Token, "Squatter")
+
+	// The owner of the address signs in through an identity provider that vouches for it
+	err := authHandlers.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, squatter.User.ID).Error; err != nil {
+			return err
+		}
+		return claimUnverifiedAccount(tx, &user, time.Now())
+	})
+	if err != nil {
+		t.Fatalf("Failed to claim account: %v", err)
+	}
+
+	var credentials int64
+	authHandlers.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", squatter.User.ID).Count(&credentials)
+	if credentials != 0 {
+		t.Errorf("Expected the squatter's passkeys to be removed, got %d", credentials)
+	}
+	if w := passkeyLogin(t, authHandlers, authenticator); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the squatter's passkey to be rejected, got %d", w.Code)
+	}
+}
+
+func TestWebAuthnAsSecondFactor(t *testing.T) {
+	authHandlers, authenticator := newWebAuthnTestHandlers()
+	auth := registerForTest(t, authHandlers, "second@example.com", "ValidPass123")
+	registered := registerPasskeyForTest(t, authHandlers, authenticator, auth.Token, "Security key")
+
+	// Password sign-ins now ask for the passkey
+	w := attemptLogin(authHandlers, "second@example.com", "ValidPass123")
+	var challenge models.MFAChallengeResponse
+	json.NewDecoder(w.Body).Decode(&challenge)
+	if !challenge.MFARequired || len(challenge.Methods) != 1 || challenge.Methods[0] != "webauthn" {
+		t.Fatalf("Expected a WebAuthn MFA challenge, got %s", w.Body.String())
+	}
+
+	w = postJSON(authHandlers.WebAuthnMFAOptionsHandler, "/api/auth/mfa/webauthn/options", models.WebAuthnMFAOptionsRequest{MFAToken: challenge.MFAToken})
+	var options models.WebAuthnRequestOptionsResponse
+	json.NewDecoder(w.Body).Decode(&options)
+	if w.Code != http.StatusOK || len(options.PublicKey.AllowCredentials) != 1 {
+		t.Fatalf("Expected options allowing the registered credential, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Assertions for another ceremony do not count
+	loginOptions := postJSON(authHandlers.WebAuthnLoginOptionsHandler, "/api/auth/webauthn/login/options", nil)
+	var passwordless models.WebAuthnRequestOptionsResponse
+	json.NewDecoder(loginOptions.Body).Decode(&passwordless)
+	wrongCeremony, _ := authenticator.Assert(passwordless.PublicKey)
+	if w := postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: challenge.MFAToken, Credential: &wrongCeremony}); w.Code != http.StatusUnauthorized || decodeErrorCode(w) != "INVALID_MFA_CODE" {
+		t.Errorf("Expected 401 INVALID_MFA_CODE for another ceremony, got %d", w.Code)
+	}
+
+	assertion, err := authenticator.Assert(options.PublicKey)
+	if err != nil {
+		t.Fatalf("Authenticator failed to sign in: %v", err)
+	}
+	w = postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: challenge.MFAToken, Credential: &assertion})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response models.AuthResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if !sessionMFA(authHandlers, response.Token) {
+		t.Error("Expected the session to count as MFA-authenticated")
+	}
+
+	// Users without TOTP cannot pass with a TOTP code, even with a pending secret
+	setup := serveSessionRequest(t, authHandlers.TOTPSetupHandler, auth.Token, http.MethodPost, "/api/users/me/mfa/totp/setup", nil)
+	var totp models.TOTPSetupResponse
+	json.NewDecoder(setup.Body).Decode(&totp)
+	code, _ := utils.GenerateTOTPCode(totp.Secret, utils.TOTPStep(time.Now()))
+	mfaToken := startMFALogin(t, authHandlers, "second@example.com", "ValidPass123")
+	if w := postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: code}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a pending TOTP secret to be rejected, got %d", w.Code)
+	}
+
+	// Users without credentials cannot start a WebAuthn check
+	other := registerForTest(t, authHandlers, "other@example.com", "ValidPass123")
+	enrollTOTPForTest(t, authHandlers, other.Token)
+	otherToken := startMFALogin(t, authHandlers, "other@example.com", "ValidPass123")
+	if w := postJSON(authHandlers.WebAuthnMFAOptionsHandler, "/api/auth/mfa/webauthn/options", models.WebAuthnMFAOptionsRequest{MFAToken: otherToken}); w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d without credentials, got %d", http.StatusConflict, w.Code)
+	}
+
+	// Another user's credential does not pass someone else's challenge
+	credentialID, _ := base64.RawURLEncoding.DecodeString(registered.CredentialID)
+	webauthnChallenge, _ := createWebAuthnChallenge(authHandlers.DB, other.User.ID, models.WebAuthnCeremonyMFA, "")
+	foreign, _ := authenticator.Assert(authHandlers.WebAuthn.RequestOptions(webauthnChallenge, []webauthn.CredentialDescriptor{{Type: "public-key", ID: credentialID}}, webauthn.UserVerificationPreferred))
+	if w := postJSON(authHandlers.MFAVerifyHandler, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: otherToken, Credential: &foreign}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected another user's credential to be rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,202 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// DefaultUserFilter finds users by their email address
+const DefaultUserFilter = "(&(objectClass=person)(mail={email}))"
+
+// defaultTimeout bounds connecting to the directory and each request made to it
+const defaultTimeout = 10 * time.Second
+
+var (
+	// ErrInvalidCredentials is returned when the directory refuses the user's password
+	ErrInvalidCredentials = errors.New("ldap: invalid credentials")
+
+	// ErrUserNotFound is returned when no directory entry matches the sign-in email
+	ErrUserNotFound = errors.New("ldap: user not found")
+)
+
+// GroupRole maps members of a directory group to a role in an organization
+type GroupRole struct {
+	GroupDN        string
+	OrganizationID uint
+	Role           string // "admin" or "member"
+}
+
+// Entry is a user authenticated by the directory
+type Entry struct {
+	DN     string
+	Email  string
+	Groups []string // DNs of the groups the user belongs to
+}
+
+// Directory is an LDAP server users authenticate against. Users are found with a search, made as the
+// bind account, and their password is verified by binding as them.
+type Directory struct {
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	BindDN             string // Empty for an anonymous search
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string // {email} is replaced by the escaped sign-in email
+	EmailAttribute     string
+	GroupAttribute     string // Attribute listing the DNs of a user's groups, such as memberOf
+	GroupRoles         []GroupRole
+	LocalFallback      bool // Users missing from the directory may sign in with a local password
+	Timeout            time.Duration
+}
+
+// Authenticate verifies a user's email and password against the directory
+func (d *Directory) Authenticate(email, password string) (*Entry, error) {
+	// An empty password would make the bind an unauthenticated one, which servers accept
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if d.BindDN != "" {
+		if err := conn.Bind(d.BindDN, d.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap: failed to bind as %s: %w", d.BindDN, err)
+		}
+	}
+
+	emailAttribute := orDefault(d.EmailAttribute, "mail")
+	groupAttribute := orDefault(d.GroupAttribute, "memberOf")
+	filter := strings.ReplaceAll(orDefault(d.UserFilter, DefaultUserFilter), "{email}", goldap.EscapeFilter(email))
+	result, err := conn.Search(goldap.NewSearchRequest(
+		d.BaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, int(d.timeout().Seconds()), false,
+		filter, []string{emailAttribute, groupAttribute}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap: failed to search for user: %w", err)
+	}
+	if len(result.Entries) == 0 {
+		return nil, ErrUserNotFound
+	}
+	if len(result.Entries) > 1 {
+		return nil, fmt.Errorf("ldap: %d entries match %s", len(result.Entries), filter)
+	}
+	found := result.Entries[0]
+
+	if err := conn.Bind(found.DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap: failed to bind as user: %w", err)
+	}
+
+	entry := &Entry{
+		DN:     found.DN,
+		Email:  found.GetAttributeValue(emailAttribute),
+		Groups: found.GetAttributeValues(groupAttribute),
+	}
+	if entry.Email == "" {
+		entry.Email = email
+	}
+	return entry, nil
+}
+
+// Roles returns the role each organization mapped from the entry's groups grants. Admin wins when
+// several groups map to the same organization.
+func (d *Directory) Roles(entry *Entry) map[uint]string {
+	roles := map[uint]string{}
+	for _, groupRole := range d.GroupRoles {
+		if !entry.MemberOf(groupRole.GroupDN) {
+			continue
+		}
+		if roles[groupRole.OrganizationID] != "admin" {
+			roles[groupRole.OrganizationID] = groupRole.Role
+		}
+	}
+	return roles
+}
+
+// ManagedOrganizations returns the organizations whose memberships the group role mappings manage
+func (d *Directory) ManagedOrganizations() []uint {
+	seen := map[uint]bool{}
+	var orgIDs []uint
+	for _, groupRole := range d.GroupRoles {
+		if !seen[groupRole.OrganizationID] {
+			seen[groupRole.OrganizationID] = true
+			orgIDs = append(orgIDs, groupRole.OrganizationID)
+		}
+	}
+	return orgIDs
+}
+
+// MemberOf reports whether the entry belongs to a group, comparing DNs the way LDAP does
+func (e *Entry) MemberOf(groupDN string) bool {
+	want, err := goldap.ParseDN(groupDN)
+	for _, group := range e.Groups {
+		if err != nil {
+			if strings.EqualFold(group, groupDN) {
+				return true
+			}
+			continue
+		}
+		if have, parseErr := goldap.ParseDN(group); parseErr == nil && want.EqualFold(have) {
+			return true
+		}
+	}
+	return false
+}
+
+// connect opens a connection to the directory, upgrading it with StartTLS if configured
+func (d *Directory) connect() (*goldap.Conn, error) {
+	serverURL, err := url.Parse(d.URL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid URL: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         serverURL.Hostname(),
+		InsecureSkipVerify: d.InsecureSkipVerify,
+	}
+
+	conn, err := goldap.DialURL(d.URL,
+		goldap.DialWithDialer(&net.Dialer{Timeout: d.timeout()}),
+		goldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: failed to connect: %w", err)
+	}
+	conn.SetTimeout(d.timeout())
+
+	if d.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap: failed to start TLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// orDefault returns value, or defaultValue if it is empty
+func orDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func (d *Directory) timeout() time.Duration {
+	if d.Timeout <= 0 {
+		return defaultTimeout
+	}
+	return d.Timeout
+}
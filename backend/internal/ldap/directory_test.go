@@ -0,0 +1,122 @@
+package ldap
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"tmember/internal/ldap/ldaptest"
+)
+
+const (
+	testBaseDN       = "dc=example,dc=com"
+	testBindDN       = "cn=tmember,ou=services,dc=example,dc=com"
+	testAdminsDN     = "cn=admins,ou=groups,dc=example,dc=com"
+	testUsersDN      = "cn=users,ou=groups,dc=example,dc=com"
+	testBindPassword = "service-secret"
+)
+
+// newTestDirectory starts an LDAP server with a service account and one user
+func newTestDirectory(t *testing.T) (*Directory, *ldaptest.Server) {
+	t.Helper()
+	server := ldaptest.NewServer()
+	t.Cleanup(server.Close)
+
+	server.AddEntry(testBindDN, testBindPassword, map[string][]string{"objectClass": {"applicationProcess"}})
+	server.AddEntry("uid=jane,ou=people,dc=example,dc=com", "JanePass123", map[string][]string{
+		"objectClass": {"person", "inetOrgPerson"},
+		"mail":        {"Jane@Example.com"},
+		"memberOf":    {"CN=Admins,OU=Groups,DC=example,DC=com", testUsersDN},
+	})
+
+	return &Directory{
+		URL:          server.URL,
+		BindDN:       testBindDN,
+		BindPassword: testBindPassword,
+		BaseDN:       testBaseDN,
+		GroupRoles: []GroupRole{
+			{GroupDN: testUsersDN, OrganizationID: 1, Role: "member"},
+			{GroupDN: testAdminsDN, OrganizationID: 1, Role: "admin"},
+			{GroupDN: testUsersDN, OrganizationID: 2, Role: "member"},
+			{GroupDN: "cn=other,ou=groups,dc=example,dc=com", OrganizationID: 3, Role: "admin"},
+		},
+	}, server
+}
+
+// TestDirectoryAuthenticate tests binding as a user found by email
+func TestDirectoryAuthenticate(t *testing.T) {
+	directory, _ := newTestDirectory(t)
+
+	entry, err := directory.Authenticate("jane@example.com", "JanePass123")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if entry.DN != "uid=jane,ou=people,dc=example,dc=com" || entry.Email != "Jane@Example.com" || len(entry.Groups) != 2 {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+
+	// Admin wins over member for the same organization, and unmatched groups grant nothing
+	if roles := directory.Roles(entry); !reflect.DeepEqual(roles, map[uint]string{1: "admin", 2: "member"}) {
+		t.Errorf("Unexpected roles: %v", roles)
+	}
+	if orgIDs := directory.ManagedOrganizations(); !reflect.DeepEqual(orgIDs, []uint{1, 2, 3}) {
+		t.Errorf("Unexpected managed organizations: %v", orgIDs)
+	}
+}
+
+// TestDirectoryAuthenticateFailures tests wrong passwords, unknown users and filter injection
+func TestDirectoryAuthenticateFailures(t *testing.T) {
+	directory, server := newTestDirectory(t)
+
+	if _, err := directory.Authenticate("jane@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials for a wrong password, got %v", err)
+	}
+	if _, err := directory.Authenticate("nobody@example.com", "JanePass123"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := directory.Authenticate("*", "JanePass123"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected the email to be escaped in the filter, got %v", err)
+	}
+
+	// An empty password must never reach the server, where it would be an unauthenticated bind
+	binds := server.Binds()
+	if _, err := directory.Authenticate("jane@example.com", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials for an empty password, got %v", err)
+	}
+	if server.Binds() != binds {
+		t.Error("Expected no bind for an empty password")
+	}
+
+	// A misconfigured service account is an error, not a failed sign-in
+	directory.BindPassword = "wrong"
+	if _, err := directory.Authenticate("jane@example.com", "JanePass123"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a bind error, got %v", err)
+	}
+
+	// Anonymous searches are refused by the server
+	directory.BindDN = ""
+	if _, err := directory.Authenticate("jane@example.com", "JanePass123"); err == nil || errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected a search error, got %v", err)
+	}
+}
+
+// TestParseGroupRoles tests parsing group role mappings
+func TestParseGroupRoles(t *testing.T) {
+	groupRoles, err := ParseGroupRoles(" cn=admins,dc=example,dc=com=1:admin ; cn=staff,dc=example,dc=com=2:member;")
+	if err != nil {
+		t.Fatalf("ParseGroupRoles failed: %v", err)
+	}
+	expected := []GroupRole{
+		{GroupDN: "cn=admins,dc=example,dc=com", OrganizationID: 1, Role: "admin"},
+		{GroupDN: "cn=staff,dc=example,dc=com", OrganizationID: 2, Role: "member"},
+	}
+	if !reflect.DeepEqual(groupRoles, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, groupRoles)
+	}
+
+	for _, invalid := range []string{"cn=admins", "cn=admins,dc=example=x:admin", "cn=admins,dc=example=1:owner", "cn=admins=1"} {
+		if _, err := ParseGroupRoles(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Package ldap authenticates users against an LDAP or Active Directory server and reads the groups that
+// map to organization roles
+package ldap
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"tmember/internal/config"
+)
+
+// defaultDirectory holds the directory configured at startup
+var defaultDirectory *Directory
+
+// Initialize configures the directory from config.LDAP. LDAP is enabled by LDAP_URL and LDAP_BASE_DN.
+// Users are searched for with LDAP_USER_FILTER, in which {email} stands for the sign-in email, after
+// binding as LDAP_BIND_DN with LDAP_BIND_PASSWORD. LDAP_GROUP_ROLES maps groups to organization roles.
+func Initialize() error {
+	cfg := config.LDAP()
+	if cfg.URL == "" {
+		defaultDirectory = nil
+		return nil
+	}
+
+	directory := &Directory{
+		URL:                cfg.URL,
+		StartTLS:           cfg.StartTLS,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		BindDN:             cfg.BindDN,
+		BindPassword:       cfg.BindPassword,
+		BaseDN:             cfg.BaseDN,
+		UserFilter:         orDefault(cfg.UserFilter, DefaultUserFilter),
+		EmailAttribute:     orDefault(cfg.EmailAttribute, "mail"),
+		GroupAttribute:     orDefault(cfg.GroupAttribute, "memberOf"),
+		LocalFallback:      cfg.LocalFallback,
+	}
+	if directory.BaseDN == "" {
+		return fmt.Errorf("LDAP_URL is set but LDAP_BASE_DN is not")
+	}
+	if !strings.Contains(directory.UserFilter, "{email}") {
+		return fmt.Errorf("LDAP_USER_FILTER must contain {email}")
+	}
+	if cfg.TimeoutSeconds != "" {
+		seconds, err := strconv.Atoi(cfg.TimeoutSeconds)
+		if err != nil || seconds < 1 {
+			return fmt.Errorf("invalid LDAP_TIMEOUT_SECONDS %q", cfg.TimeoutSeconds)
+		}
+		directory.Timeout = time.Duration(seconds) * time.Second
+	}
+
+	groupRoles, err := ParseGroupRoles(cfg.GroupRoles)
+	if err != nil {
+		return err
+	}
+	directory.GroupRoles = groupRoles
+
+	defaultDirectory = directory
+	log.Printf("LDAP initialized with %s and %d group role mapping(s)", cfg.URL, len(groupRoles))
+	return nil
+}
+
+// GetDirectory returns the directory configured at startup, or nil if LDAP is not enabled
+func GetDirectory() *Directory {
+	return defaultDirectory
+}
+
+// ParseGroupRoles parses group role mappings written as "group DN=organization ID:role" entries separated
+// by semicolons, e.g. "cn=admins,ou=groups,dc=example,dc=com=1:admin". Since DNs contain "=", the
+// organization and role are taken from after the last one.
+func ParseGroupRoles(value string) ([]GroupRole, error) {
+	var groupRoles []GroupRole
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		separator := strings.LastIndex(entry, "=")
+		if separator <= 0 {
+			return nil, fmt.Errorf("invalid LDAP group role mapping %q", entry)
+		}
+		orgID, role, ok := strings.Cut(entry[separator+1:], ":")
+		id, err := strconv.ParseUint(strings.TrimSpace(orgID), 10, 32)
+		role = strings.TrimSpace(role)
+		if !ok || err != nil || id == 0 || (role != "admin" && role != "member") {
+			return nil, fmt.Errorf("invalid LDAP group role mapping %q: expected \"group DN=organization ID:admin|member\"", entry)
+		}
+
+		groupRoles = append(groupRoles, GroupRole{
+			GroupDN:        strings.TrimSpace(entry[:separator]),
+			OrganizationID: uint(id),
+			Role:           role,
+		})
+	}
+	return groupRoles, nil
+}
@@ -0,0 +1,312 @@
+// Package ldaptest provides an in-process LDAP server for tests
+package ldaptest
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// Entry is a directory entry. Entries with a password can be bound as.
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Server is a minimal LDAP server supporting simple binds and searches with and, or, not, equality and
+// presence filters. Like real servers, it treats a bind with an empty password as an anonymous bind,
+// and only bound connections may search.
+type Server struct {
+	URL string
+
+	listener net.Listener
+	mu       sync.Mutex
+	entries  []Entry
+	conns    map[net.Conn]bool
+	binds    int
+}
+
+// NewServer starts a server on a loopback port
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("ldaptest: failed to listen: %v", err))
+	}
+
+	s := &Server{
+		URL:      "ldap://" + listener.Addr().String(),
+		listener: listener,
+		conns:    map[net.Conn]bool{},
+	}
+	go s.serve()
+	return s
+}
+
+// AddEntry adds an entry to the directory, replacing any entry with the same DN
+func (s *Server) AddEntry(dn, password string, attributes map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := Entry{DN: dn, Password: password, Attributes: attributes}
+	for i := range s.entries {
+		if sameDN(s.entries[i].DN, dn) {
+			s.entries[i] = entry
+			return
+		}
+	}
+	s.entries = append(s.entries, entry)
+}
+
+// SetPassword changes the password of an entry
+func (s *Server) SetPassword(dn, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.entries {
+		if sameDN(s.entries[i].DN, dn) {
+			s.entries[i].Password = password
+		}
+	}
+}
+
+// Binds returns the number of successful authenticated binds
+func (s *Server) Binds() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.binds
+}
+
+// Close stops the server and closes its connections
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// handle serves the requests of one connection until it unbinds or closes
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	bound := false
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID, _ := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		switch request.Tag {
+		case goldap.ApplicationBindRequest:
+			var code uint16
+			code, bound = s.bind(request)
+			conn.Write(result(messageID, goldap.ApplicationBindResponse, code).Bytes())
+		case goldap.ApplicationSearchRequest:
+			if !bound {
+				conn.Write(result(messageID, goldap.ApplicationSearchResultDone, goldap.LDAPResultInsufficientAccessRights).Bytes())
+				continue
+			}
+			for _, entry := range s.search(messageID, request) {
+				conn.Write(entry.Bytes())
+			}
+			conn.Write(result(messageID, goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess).Bytes())
+		case goldap.ApplicationExtendedRequest:
+			conn.Write(result(messageID, goldap.ApplicationExtendedResponse, goldap.LDAPResultUnwillingToPerform).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+// bind checks a simple bind request, returning its result code and whether the connection is now authenticated
+func (s *Server) bind(request *ber.Packet) (uint16, bool) {
+	if len(request.Children) < 3 {
+		return goldap.LDAPResultProtocolError, false
+	}
+	dn, _ := request.Children[1].Value.(string)
+	password := request.Children[2].Data.String()
+	if password == "" {
+		return goldap.LDAPResultSuccess, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		if sameDN(entry.DN, dn) && entry.Password != "" && entry.Password == password {
+			s.binds++
+			return goldap.LDAPResultSuccess, true
+		}
+	}
+	return goldap.LDAPResultInvalidCredentials, false
+}
+
+// search returns the result entries of a search request
+func (s *Server) search(messageID int64, request *ber.Packet) []*ber.Packet {
+	if len(request.Children) < 8 {
+		return nil
+	}
+	baseDN, _ := request.Children[0].Value.(string)
+	scope, _ := request.Children[1].Value.(int64)
+	filter := request.Children[6]
+	var attributes []string
+	for _, attribute := range request.Children[7].Children {
+		if name, ok := attribute.Value.(string); ok {
+			attributes = append(attributes, name)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var results []*ber.Packet
+	for _, entry := range s.entries {
+		if inScope(entry.DN, baseDN, scope) && matches(filter, entry) {
+			results = append(results, resultEntry(messageID, entry, attributes))
+		}
+	}
+	return results
+}
+
+// inScope reports whether an entry is within a search's base and scope
+func inScope(dn, baseDN string, scope int64) bool {
+	if sameDN(dn, baseDN) {
+		return scope != goldap.ScopeSingleLevel
+	}
+	parent, ok := strings.CutSuffix(strings.ToLower(dn), ","+strings.ToLower(baseDN))
+	if !ok || scope == goldap.ScopeBaseObject {
+		return false
+	}
+	return scope == goldap.ScopeWholeSubtree || !strings.Contains(parent, ",")
+}
+
+// matches evaluates a search filter against an entry
+func matches(filter *ber.Packet, entry Entry) bool {
+	switch filter.Tag {
+	case goldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matches(child, entry) {
+				return false
+			}
+		}
+		return true
+	case goldap.FilterOr:
+		for _, child := range filter.Children {
+			if matches(child, entry) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterNot:
+		return len(filter.Children) == 1 && !matches(filter.Children[0], entry)
+	case goldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		name, _ := filter.Children[0].Value.(string)
+		value, _ := filter.Children[1].Value.(string)
+		for _, candidate := range attributeValues(entry, name) {
+			if strings.EqualFold(candidate, value) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterPresent:
+		return len(attributeValues(entry, filter.Data.String())) > 0
+	}
+	return false
+}
+
+// attributeValues returns the values of an entry's attribute, matching its name case-insensitively
+func attributeValues(entry Entry, name string) []string {
+	for attribute, values := range entry.Attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// sameDN compares DNs the way LDAP does, ignoring case and spacing
+func sameDN(a, b string) bool {
+	aDN, aErr := goldap.ParseDN(a)
+	bDN, bErr := goldap.ParseDN(b)
+	if aErr != nil || bErr != nil {
+		return strings.EqualFold(a, b)
+	}
+	return aDN.EqualFold(bDN)
+}
+
+// envelope wraps a protocol operation in an LDAP message
+func envelope(messageID int64, operation *ber.Packet) *ber.Packet {
+	message := ber.NewSequence("LDAP Message")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	message.AppendChild(operation)
+	return message
+}
+
+// result builds a response carrying an LDAPResult
+func result(messageID int64, tag ber.Tag, code uint16) *ber.Packet {
+	operation := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	operation.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	operation.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	operation.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, goldap.LDAPResultCodeMap[code], "Diagnostic Message"))
+	return envelope(messageID, operation)
+}
+
+// resultEntry builds a search result entry with the requested attributes, or all of them if none were requested
+func resultEntry(messageID int64, entry Entry, requested []string) *ber.Packet {
+	operation := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	operation.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "Object Name"))
+
+	attributes := ber.NewSequence("Attributes")
+	for name, values := range entry.Attributes {
+		if !isRequested(name, requested) {
+			continue
+		}
+		attribute := ber.NewSequence("Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	operation.AppendChild(attributes)
+	return envelope(messageID, operation)
+}
+
+func isRequested(name string, requested []string) bool {
+	if len(requested) == 0 {
+		return true
+	}
+	for _, candidate := range requested {
+		if strings.EqualFold(candidate, name) || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
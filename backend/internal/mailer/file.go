@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// fileCounter disambiguates messages written within the same nanosecond
+var fileCounter atomic.Uint64
+
+// FileMailer writes each message as an .eml file into a directory, for local development
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send writes the message to a new file in the mailer's directory
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	recipient := strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To)
+	name := fmt.Sprintf("%d-%d-%s.eml", time.Now().UnixNano(), fileCounter.Add(1), recipient)
+
+	if err := os.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg), 0o600); err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"tmember/internal/config"
+)
+
+// Message represents a plain-text email message
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// defaultMailer holds the mailer configured at startup
+var defaultMailer Mailer
+
+// Initialize configures the default mailer from config.Mailer, whose driver selects the implementation:
+// "smtp", "file" (default) or "memory".
+func Initialize() error {
+	cfg := config.Mailer()
+
+	switch cfg.Driver {
+	case "smtp":
+		defaultMailer = &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}
+	case "file":
+		defaultMailer = &FileMailer{Dir: cfg.FileDir, From: cfg.From}
+	case "memory":
+		defaultMailer = NewMemoryMailer()
+	default:
+		return fmt.Errorf("unknown mailer driver: %s", cfg.Driver)
+	}
+
+	log.Printf("Mailer initialized with %T", defaultMailer)
+	return nil
+}
+
+// GetMailer returns the default mailer, falling back to an in-memory mailer if none was configured
+func GetMailer() Mailer {
+	if defaultMailer == nil {
+		return NewMemoryMailer()
+	}
+	return defaultMailer
+}
+
+// format renders a message in RFC 5322 format
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFileMailerWritesMessages tests that the file mailer writes one .eml file per message
+func TestFileMailerWritesMessages(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: filepath.Join(dir, "mail"), From: "no-reply@example.com"}
+
+	for i := 0; i < 2; i++ {
+		if err := m.Send(Message{To: "user@example.com", Subject: "Hello", Body: "line one\nline two"}); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+
+	files, err := os.ReadDir(m.Dir)
+	if err != nil {
+		t.Fatalf("Failed to read mail directory: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 mail files, got %d", len(files))
+	}
+
+	content, _ := os.ReadFile(filepath.Join(m.Dir, files[0].Name()))
+	for _, expected := range []string{"From: no-reply@example.com\r\n", "To: user@example.com\r\n", "Subject: Hello\r\n", "line one\r\nline two"} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected mail file to contain %q", expected)
+		}
+	}
+}
+
+// TestMemoryMailerRecordsMessages tests that the memory mailer keeps messages in order
+func TestMemoryMailerRecordsMessages(t *testing.T) {
+	m := NewMemoryMailer()
+
+	if _, ok := m.Last(); ok {
+		t.Error("Expected no messages on a new mailer")
+	}
+
+	m.Send(Message{To: "first@example.com"})
+	m.Send(Message{To: "second@example.com"})
+
+	if len(m.Messages()) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(m.Messages()))
+	}
+	if last, _ := m.Last(); last.To != "second@example.com" {
+		t.Errorf("Expected last message to second@example.com, got %s", last.To)
+	}
+}
+
+// TestInitializeSelectsDriver tests that the mailer driver is selected from the environment
+func TestInitializeSelectsDriver(t *testing.T) {
+	t.Setenv("MAILER_DRIVER", "memory")
+	if err := Initialize(); err != nil {
+		t.Fatalf("Failed to initialize mailer: %v", err)
+	}
+	if _, ok := GetMailer().(*MemoryMailer); !ok {
+		t.Errorf("Expected memory mailer, got %T", GetMailer())
+	}
+
+	t.Setenv("MAILER_DRIVER", "carrier-pigeon")
+	if err := Initialize(); err == nil {
+		t.Error("Expected error for unknown mailer driver")
+	}
+}
@@ -5,13 +5,26 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"time"
 
 	"tmember/internal/models"
 	"tmember/internal/utils"
+
+	"gorm.io/gorm"
 )
 
-// AuthMiddleware validates JWT tokens and adds user context to requests
-func AuthMiddleware(next http.Handler) http.Handler {
+// Auth contains the database connection used to validate sessions behind access tokens
+type Auth struct {
+	DB *gorm.DB
+}
+
+// NewAuth creates a new Auth instance
+func NewAuth(db *gorm.DB) *Auth {
+	return &Auth{DB: db}
+}
+
+// AuthMiddleware validates JWT tokens and their sessions and adds user context to requests
+func (a *Auth) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Get the Authorization header
 		authHeader := r.Header.Get("Authorization")
@@ -33,6 +46,18 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Personal access tokens are opaque and looked up by their hash
+		if strings.HasPrefix(tokenString, models.PersonalAccessTokenPrefix) {
+			a.servePersonalAccessToken(w, r, next, tokenString)
+			return
+		}
+
+		// Service account keys authenticate a non-human principal of one organization
+		if strings.HasPrefix(tokenString, models.ServiceAccountKeyPrefix) {
+			a.serveServiceAccountKey(w, r, next, tokenString)
+			return
+		}
+
 		// Validate the token
 		claims, err := utils.ValidateJWT(tokenString)
 		if err != nil {
@@ -40,15 +65,165 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Validate that the token's session has not been revoked
+		var session models.Session
+		if err := a.DB.Where("id = ? AND user_id = ?", claims.SessionID, claims.UserID).First(&session).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				writeErrorResponse(w, http.StatusUnauthorized, "Invalid or expired token", "INVALID_TOKEN")
+			} else {
+				writeErrorResponse(w, http.StatusInternalServerError, "Failed to validate session", "SESSION_CHECK_ERROR")
+			}
+			return
+		}
+
+		if !session.IsActive() {
+			writeErrorResponse(w, http.StatusUnauthorized, "Session has been revoked", "SESSION_REVOKED")
+			return
+		}
+
+		// Enforce the strictest session limits of the user's organizations
+		expired, err := SessionExpired(a.DB, session)
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to validate session", "SESSION_CHECK_ERROR")
+			return
+		}
+		if expired {
+			a.DB.Model(&session).UpdateColumn("revoked_at", time.Now())
+			writeErrorResponse(w, http.StatusUnauthorized, "Session has expired; please sign in again", "SESSION_EXPIRED")
+			return
+		}
+
+		// Record session activity, throttled to avoid a write on every request
+		if now := time.Now(); now.Sub(session.LastSeenAt) > models.SessionLastSeenInterval {
+			a.DB.Model(&session).UpdateColumn("last_seen_at", now)
+		}
+
 		// Add user information to the request context
 		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
 		ctx = context.WithValue(ctx, "user_email", claims.Email)
+		ctx = context.WithValue(ctx, "session_id", session.ID)
+		ctx = context.WithValue(ctx, "session_mfa", session.MFA)
 
 		// Call the next handler with the updated context
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// SessionExpired reports whether the session has outlived the strictest maximum age or idle timeout
+// set by the organizations its user belongs to. Both authenticated requests and refreshes check it.
+func SessionExpired(db *gorm.DB, session models.Session) (bool, error) {
+	var limits struct {
+		MaxAge      *int
+		IdleTimeout *int
+	}
+	err := db.Model(&models.OrganizationSecurityPolicy{}).
+		Select("MIN(NULLIF(session_max_age_minutes, 0)) AS max_age, MIN(NULLIF(session_idle_timeout_minutes, 0)) AS idle_timeout").
+		Joins("JOIN organization_memberships ON organization_memberships.organization_id = organization_security_policies.organization_id").
+		Where("organization_memberships.user_id = ? AND organization_memberships.deleted_at IS NULL", session.UserID).
+		Scan(&limits).Error
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	if limits.MaxAge != nil && now.Sub(session.CreatedAt) > time.Duration(*limits.MaxAge)*time.Minute {
+		return true, nil
+	}
+	if limits.IdleTimeout != nil && now.Sub(session.LastSeenAt) > time.Duration(*limits.IdleTimeout)*time.Minute {
+		return true, nil
+	}
+	return false, nil
+}
+
+// servePersonalAccessToken authenticates a request made with a personal access token and enforces its scope
+func (a *Auth) servePersonalAccessToken(w http.ResponseWriter, r *http.Request, next http.Handler, tokenString string) {
+	var token models.PersonalAccessToken
+	if err := a.DB.Preload("User").Where("token_hash = ?", utils.HashToken(tokenString)).First(&token).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeErrorResponse(w, http.StatusUnauthorized, "Invalid or expired token", "INVALID_TOKEN")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to validate token", "TOKEN_CHECK_ERROR")
+		}
+		return
+	}
+
+	// Tokens of deleted users are not loaded with their user
+	now := time.Now()
+	if !token.IsActive(now) || token.User.ID == 0 {
+		writeErrorResponse(w, http.StatusUnauthorized, "Invalid or expired token", "INVALID_TOKEN")
+		return
+	}
+
+	if token.Scope != models.TokenScopeReadWrite && !isReadOnlyMethod(r.Method) {
+		writeErrorResponse(w, http.StatusForbidden, "This token only allows read access", "INSUFFICIENT_SCOPE")
+		return
+	}
+
+	// Record token usage, throttled to avoid a write on every request
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > models.SessionLastSeenInterval {
+		a.DB.Model(&token).UpdateColumn("last_used_at", now)
+	}
+
+	// Add user and token information to the request context
+	ctx := context.WithValue(r.Context(), "user_id", token.UserID)
+	ctx = context.WithValue(ctx, "user_email", token.User.Email)
+	ctx = context.WithValue(ctx, "session_mfa", token.MFA)
+	ctx = context.WithValue(ctx, "token_scope", token.Scope)
+	if token.OrganizationID != nil {
+		ctx = context.WithValue(ctx, "token_organization_id", *token.OrganizationID)
+	}
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// serveServiceAccountKey authenticates a request made with a service account API key
+func (a *Auth) serveServiceAccountKey(w http.ResponseWriter, r *http.Request, next http.Handler, tokenString string) {
+	var key models.ServiceAccountKey
+	if err := a.DB.Preload("ServiceAccount").Where("token_hash = ?", utils.HashToken(tokenString)).First(&key).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeErrorResponse(w, http.StatusUnauthorized, "Invalid or expired token", "INVALID_TOKEN")
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to validate token", "TOKEN_CHECK_ERROR")
+		}
+		return
+	}
+
+	// Keys of deleted service accounts are not loaded with their account
+	now := time.Now()
+	if !key.IsActive(now) || key.ServiceAccount.ID == 0 {
+		writeErrorResponse(w, http.StatusUnauthorized, "Invalid or expired token", "INVALID_TOKEN")
+		return
+	}
+
+	// Record key usage, throttled to avoid a write on every request
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > models.SessionLastSeenInterval {
+		a.DB.Model(&key).UpdateColumn("last_used_at", now)
+	}
+
+	// Service accounts are confined to the organization that owns them
+	ctx := context.WithValue(r.Context(), "service_account_id", key.ServiceAccountID)
+	ctx = context.WithValue(ctx, "token_organization_id", key.ServiceAccount.OrganizationID)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequireSession rejects requests that were not made from an interactive login session,
+// such as requests authenticated with a personal access token
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := GetSessionIDFromContext(r.Context()); !ok {
+			writeErrorResponse(w, http.StatusForbidden, "This endpoint requires signing in; API tokens cannot be used", "SESSION_REQUIRED")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isReadOnlyMethod reports whether an HTTP method does not modify state
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
 // writeErrorResponse writes a JSON error response
 func writeErrorResponse(w http.ResponseWriter, statusCode int, message, code string) {
 	w.Header().Set("Content-Type", "application/json")
@@ -75,6 +250,38 @@ func GetUserEmailFromContext(ctx context.Context) (string, bool) {
 	return email, ok
 }
 
+// GetSessionIDFromContext extracts the session ID from request context
+func GetSessionIDFromContext(ctx context.Context) (uint, bool) {
+	sessionID, ok := ctx.Value("session_id").(uint)
+	return sessionID, ok
+}
+
+// GetSessionMFAFromContext reports whether the request's session was authenticated with a second factor
+func GetSessionMFAFromContext(ctx context.Context) bool {
+	mfa, _ := ctx.Value("session_mfa").(bool)
+	return mfa
+}
+
+// GetServiceAccountIDFromContext extracts the calling service account's ID from request context. It is only
+// set for requests authenticated with a service account key, which carry no user ID.
+func GetServiceAccountIDFromContext(ctx context.Context) (uint, bool) {
+	serviceAccountID, ok := ctx.Value("service_account_id").(uint)
+	return serviceAccountID, ok
+}
+
+// GetTokenScopeFromContext extracts the API token scope from request context. It is only set for requests
+// authenticated with a token rather than a login session.
+func GetTokenScopeFromContext(ctx context.Context) (models.TokenScope, bool) {
+	scope, ok := ctx.Value("token_scope").(models.TokenScope)
+	return scope, ok
+}
+
+// GetTokenOrganizationIDFromContext extracts the organization an API token is restricted to from request context
+func GetTokenOrganizationIDFromContext(ctx context.Context) (uint, bool) {
+	orgID, ok := ctx.Value("token_organization_id").(uint)
+	return orgID, ok
+}
+
 // SetOrganizationContext adds organization information to the context
 func SetOrganizationContext(ctx context.Context, orgID uint, role string) context.Context {
 	ctx = context.WithValue(ctx, "organization_id", orgID)
@@ -0,0 +1,250 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tmember/internal/models"
+	"tmember/internal/utils"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupAuthTestDB creates an in-memory SQLite database for auth middleware testing
+func setupAuthTestDB() *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect to test database")
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Session{}, &models.RefreshToken{}, &models.PersonalAccessToken{})
+	db.AutoMigrate(&models.ServiceAccount{}, &models.ServiceAccountKey{}, &models.Organization{}, &models.OrganizationSecurityPolicy{})
+
+	// Create organization_memberships table manually for SQLite compatibility
+	db.Exec(`CREATE TABLE organization_memberships (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		organization_id INTEGER NOT NULL,
+		role TEXT NOT NULL,
+		created_at DATETIME,
+		updated_at DATETIME,
+		deleted_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id),
+		FOREIGN KEY (organization_id) REFERENCES organizations(id)
+	)`)
+
+	return db
+}
+
+// serveWithToken runs the auth middleware for a request carrying the given bearer token
+func serveWithToken(auth *Auth, token string) *httptest.ResponseRecorder {
+	handler := auth.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := GetSessionIDFromContext(r.Context()); !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+// TestAuthMiddlewareSessionValidation tests that tokens are only accepted while their session is active
+func TestAuthMiddlewareSessionValidation(t *testing.T) {
+	db := setupAuthTestDB()
+	auth := NewAuth(db)
+
+	user := models.User{Email: "session@example.com", PasswordHash: "hash"}
+	db.Create(&user)
+	session := models.Session{UserID: user.ID}
+	db.Create(&session)
+
+	token, err := utils.GenerateJWT(user.ID, user.Email, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	// Active session is accepted
+	if w := serveWithToken(auth, token); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// Tokens without a session are rejected
+	sessionless, _ := utils.GenerateJWT(user.ID, user.Email, 0)
+	if w := serveWithToken(auth, sessionless); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for sessionless token, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// Revoked session is rejected
+	now := time.Now()
+	db.Model(&session).Update("revoked_at", &now)
+	if w := serveWithToken(auth, token); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for revoked session, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// TestAuthMiddlewareSessionPolicy tests that sessions outliving an organization's session limits are revoked
+func TestAuthMiddlewareSessionPolicy(t *testing.T) {
+	db := setupAuthTestDB()
+	auth := NewAuth(db)
+
+	user := models.User{Email: "limits@example.com", PasswordHash: "hash"}
+	db.Create(&user)
+	org := models.Organization{Name: "Strict Org"}
+	db.Create(&org)
+	db.Exec("INSERT INTO organization_memberships (user_id, organization_id, role) VALUES (?, ?, ?)", user.ID, org.ID, models.RoleMember)
+	db.Create(&models.OrganizationSecurityPolicy{OrganizationID: org.ID, SessionMaxAgeMinutes: 480, SessionIdleTimeoutMinutes: 30})
+
+	newSession := func(createdAt, lastSeenAt time.Time) (models.Session, string) {
+		session := models.Session{UserID: user.ID, CreatedAt: createdAt, LastSeenAt: lastSeenAt}
+		db.Create(&session)
+		token, err := utils.GenerateJWT(user.ID, user.Email, session.ID)
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		return session, token
+	}
+
+	now := time.Now()
+	tests := []struct {
+		name           string
+		createdAt      time.Time
+		lastSeenAt     time.Time
+		expectedStatus int
+	}{
+		{"within limits", now.Add(-2 * time.Hour), now.Add(-10 * time.Minute), http.StatusOK},
+		{"idle too long", now.Add(-2 * time.Hour), now.Add(-45 * time.Minute), http.StatusUnauthorized},
+		{"older than max age", now.Add(-9 * time.Hour), now, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, token := newSession(tt.createdAt, tt.lastSeenAt)
+			if w := serveWithToken(auth, token); w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			db.First(&session, session.ID)
+			if expired := tt.expectedStatus == http.StatusUnauthorized; session.IsActive() == expired {
+				t.Errorf("Expected session active=%v, got %v", !expired, session.IsActive())
+			}
+		})
+	}
+}
+
+// TestAuthMiddlewarePersonalAccessToken tests authentication, scope and expiry of personal access tokens
+func TestAuthMiddlewarePersonalAccessToken(t *testing.T) {
+	db := setupAuthTestDB()
+	auth := NewAuth(db)
+
+	user := models.User{Email: "pat@example.com", PasswordHash: "hash"}
+	db.Create(&user)
+
+	orgID := uint(42)
+	token := models.PersonalAccessTokenPrefix + "read-only-secret"
+	record := models.PersonalAccessToken{UserID: user.ID, Name: "ci", TokenHash: utils.HashToken(token), Scope: models.TokenScopeRead, OrganizationID: &orgID}
+	db.Create(&record)
+
+	serve := func(method string, handler http.Handler) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/organizations", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		auth.AuthMiddleware(handler).ServeHTTP(w, req)
+		return w
+	}
+
+	// Read requests are accepted with the owner and restriction in context
+	w := serve(http.MethodGet, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := GetUserIDFromContext(r.Context())
+		restrictedTo, _ := GetTokenOrganizationIDFromContext(r.Context())
+		if userID != user.ID || restrictedTo != orgID {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	db.First(&record, record.ID)
+	if record.LastUsedAt == nil {
+		t.Error("Expected last used time to be recorded")
+	}
+
+	// Read-only tokens cannot write
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	if w := serve(http.MethodPost, ok); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for write with read-only token, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Tokens cannot reach session-only endpoints
+	if w := serve(http.MethodGet, RequireSession(ok)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for session-only endpoint, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Expired tokens are rejected
+	past := time.Now().Add(-time.Hour)
+	db.Model(&record).Update("expires_at", &past)
+	if w := serve(http.MethodGet, ok); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for expired token, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestAuthMiddlewareServiceAccountKey(t *testing.T) {
+	db := setupAuthTestDB()
+	auth := NewAuth(db)
+
+	serviceAccount := models.ServiceAccount{OrganizationID: 7, Name: "ci", Role: models.RoleMember, CreatedByID: 1}
+	db.Create(&serviceAccount)
+
+	key := models.ServiceAccountKeyPrefix + "service-account-secret"
+	record := models.ServiceAccountKey{ServiceAccountID: serviceAccount.ID, TokenHash: utils.HashToken(key)}
+	db.Create(&record)
+
+	// Keys authenticate the service account, confined to its organization and without a user
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serviceAccountID, _ := GetServiceAccountIDFromContext(r.Context())
+		restrictedTo, _ := GetTokenOrganizationIDFromContext(r.Context())
+		if _, isUser := GetUserIDFromContext(r.Context()); isUser || serviceAccountID != serviceAccount.ID || restrictedTo != serviceAccount.OrganizationID {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(handler http.Handler) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/organizations/7/members", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		auth.AuthMiddleware(handler).ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve(handler); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	db.First(&record, record.ID)
+	if record.LastUsedAt == nil {
+		t.Error("Expected last used time to be recorded")
+	}
+
+	// Service accounts cannot reach session-only endpoints
+	if w := serve(RequireSession(handler)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for session-only endpoint, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Keys stop working once their service account is deleted
+	db.Delete(&serviceAccount)
+	if w := serve(handler); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for deleted service account, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -37,3 +37,224 @@ type SwitchOrganizationResponse struct {
 	Organization OrganizationResponse `json:"organization"`
 	Message      string               `json:"message"`
 }
+
+// CreateInvitationRequest represents the request to invite an email address to an organization
+type CreateInvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"omitempty,oneof=admin member"`
+	// AllowExternalDomain invites an email outside the organization's verified domains
+	AllowExternalDomain bool `json:"allow_external_domain"`
+}
+
+// AcceptInvitationRequest represents the request to accept an organization invitation
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// InvitationResponse represents an invitation in API responses
+type InvitationResponse struct {
+	ID                        uint   `json:"id"`
+	OrganizationID            uint   `json:"organization_id"`
+	Email                     string `json:"email"`
+	Role                      string `json:"role"`
+	InvitedByID               uint   `json:"invited_by_id"`
+	InvitedByServiceAccountID *uint  `json:"invited_by_service_account_id,omitempty"`
+	ExpiresAt                 string `json:"expires_at"`
+	CreatedAt                 string `json:"created_at"`
+	Token                     string `json:"token,omitempty"` // Only returned once, when the invitation is created
+}
+
+// ListInvitationsResponse represents the response for listing pending invitations
+type ListInvitationsResponse struct {
+	Invitations []InvitationResponse `json:"invitations"`
+}
+
+// CreateDomainRequest represents the request to claim an email domain for an organization
+type CreateDomainRequest struct {
+	Domain   string `json:"domain" binding:"required"`
+	JoinMode string `json:"join_mode" binding:"omitempty,oneof=automatic request disabled"`
+}
+
+// UpdateDomainRequest represents the request to change what happens when users join on a domain
+type UpdateDomainRequest struct {
+	JoinMode string `json:"join_mode" binding:"required,oneof=automatic request disabled"`
+}
+
+// DomainResponse represents an organization's domain in API responses
+type DomainResponse struct {
+	ID             uint    `json:"id"`
+	OrganizationID uint    `json:"organization_id"`
+	Domain         string  `json:"domain"`
+	JoinMode       string  `json:"join_mode"`
+	Verified       bool    `json:"verified"`
+	VerifiedAt     *string `json:"verified_at,omitempty"`
+	RecordName     string  `json:"record_name"`  // Name of the TXT record to publish
+	RecordValue    string  `json:"record_value"` // Value of the TXT record to publish
+	CreatedAt      string  `json:"created_at"`
+}
+
+// ListDomainsResponse represents the response for listing an organization's domains
+type ListDomainsResponse struct {
+	Domains []DomainResponse `json:"domains"`
+}
+
+// JoinRequestResponse represents a request to join an organization in API responses
+type JoinRequestResponse struct {
+	ID               uint   `json:"id"`
+	OrganizationID   uint   `json:"organization_id"`
+	OrganizationName string `json:"organization_name"`
+	UserID           uint   `json:"user_id"`
+	Email            string `json:"email"`
+	Status           string `json:"status"`
+	CreatedAt        string `json:"created_at"`
+}
+
+// ListJoinRequestsResponse represents the response for listing join requests
+type ListJoinRequestsResponse struct {
+	JoinRequests []JoinRequestResponse `json:"join_requests"`
+}
+
+// SecurityPolicyResponse represents an organization's security policy in API responses
+type SecurityPolicyResponse struct {
+	OrganizationID            uint `json:"organization_id"`
+	RequireMFA                bool `json:"require_mfa"`
+	PasswordMinLength         int  `json:"password_min_length"`
+	PasswordRequireUppercase  bool `json:"password_require_uppercase"`
+	PasswordRequireLowercase  bool `json:"password_require_lowercase"`
+	PasswordRequireDigit      bool `json:"password_require_digit"`
+	PasswordRequireSymbol     bool `json:"password_require_symbol"`
+	SessionMaxAgeMinutes      int  `json:"session_max_age_minutes"`
+	SessionIdleTimeoutMinutes int  `json:"session_idle_timeout_minutes"`
+	DisableMagicLinkLogin     bool `json:"disable_magic_link_login"`
+}
+
+// UpdateSecurityPolicyRequest represents the request to change an organization's security policy.
+// Omitted fields are left unchanged.
+type UpdateSecurityPolicyRequest struct {
+	RequireMFA                *bool `json:"require_mfa"`
+	PasswordMinLength         *int  `json:"password_min_length"`
+	PasswordRequireUppercase  *bool `json:"password_require_uppercase"`
+	PasswordRequireLowercase  *bool `json:"password_require_lowercase"`
+	PasswordRequireDigit      *bool `json:"password_require_digit"`
+	PasswordRequireSymbol     *bool `json:"password_require_symbol"`
+	SessionMaxAgeMinutes      *int  `json:"session_max_age_minutes"`
+	SessionIdleTimeoutMinutes *int  `json:"session_idle_timeout_minutes"`
+	DisableMagicLinkLogin     *bool `json:"disable_magic_link_login"`
+}
+
+// SAMLConfigResponse represents an organization's SAML configuration, together with the service provider
+// details to register at the identity provider
+type SAMLConfigResponse struct {
+	OrganizationID  uint   `json:"organization_id"`
+	Enabled         bool   `json:"enabled"`
+	IDPEntityID     string `json:"idp_entity_id"`
+	IDPSSOURL       string `json:"idp_sso_url"`
+	IDPCertificate  string `json:"idp_certificate"`
+	EmailAttribute  string `json:"email_attribute"`
+	RoleAttribute   string `json:"role_attribute"`
+	AdminRoleValue  string `json:"admin_role_value"`
+	JITProvisioning bool   `json:"jit_provisioning"`
+	SPEntityID      string `json:"sp_entity_id"`
+	SPACSURL        string `json:"sp_acs_url"`
+	SPMetadataURL   string `json:"sp_metadata_url"`
+}
+
+// UpdateSAMLConfigRequest represents the request to change an organization's SAML configuration.
+// IdP metadata XML, if given, fills in the entity ID, SSO URL and certificate. Omitted fields are left unchanged.
+type UpdateSAMLConfigRequest struct {
+	Enabled         *bool   `json:"enabled"`
+	IDPMetadataXML  *string `json:"idp_metadata_xml"`
+	IDPEntityID     *string `json:"idp_entity_id"`
+	IDPSSOURL       *string `json:"idp_sso_url"`
+	IDPCertificate  *string `json:"idp_certificate"`
+	EmailAttribute  *string `json:"email_attribute"`
+	RoleAttribute   *string `json:"role_attribute"`
+	AdminRoleValue  *string `json:"admin_role_value"`
+	JITProvisioning *bool   `json:"jit_provisioning"`
+}
+
+// MFAComplianceMember represents a member who has not enrolled a second factor
+type MFAComplianceMember struct {
+	MembershipID uint   `json:"membership_id"`
+	UserID       uint   `json:"user_id"`
+	Email        string `json:"email"`
+	Role         string `json:"role"`
+}
+
+// MFAComplianceResponse represents the report of members who do not satisfy an organization's MFA requirement
+type MFAComplianceResponse struct {
+	RequireMFA          bool                  `json:"require_mfa"`
+	TotalMembers        int                   `json:"total_members"`
+	NonCompliantMembers []MFAComplianceMember `json:"non_compliant_members"`
+}
+
+// CreateServiceAccountRequest represents the request to create an organization service account
+type CreateServiceAccountRequest struct {
+	Name string `json:"name" binding:"required"`
+	Role string `json:"role" binding:"omitempty,oneof=admin member"` // Defaults to member
+}
+
+// UpdateServiceAccountRequest represents the request to rename a service account or change its role.
+// Omitted fields are left unchanged.
+type UpdateServiceAccountRequest struct {
+	Name *string `json:"name"`
+	Role *string `json:"role" binding:"omitempty,oneof=admin member"`
+}
+
+// ServiceAccountResponse represents a service account in API responses
+type ServiceAccountResponse struct {
+	ID             uint   `json:"id"`
+	OrganizationID uint   `json:"organization_id"`
+	Name           string `json:"name"`
+	Role           string `json:"role"`
+	CreatedByID    uint   `json:"created_by_id"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// ListServiceAccountsResponse represents the response for listing an organization's service accounts
+type ListServiceAccountsResponse struct {
+	ServiceAccounts []ServiceAccountResponse `json:"service_accounts"`
+}
+
+// CreateServiceAccountKeyRequest represents the request to issue a new API key for a service account
+type CreateServiceAccountKeyRequest struct {
+	ExpiresInDays *int `json:"expires_in_days"` // Omit for a key that does not expire
+}
+
+// ServiceAccountKeyResponse represents a service account API key in API responses
+type ServiceAccountKeyResponse struct {
+	ID               uint    `json:"id"`
+	ServiceAccountID uint    `json:"service_account_id"`
+	TokenHint        string  `json:"token_hint"`
+	ExpiresAt        *string `json:"expires_at"`
+	LastUsedAt       *string `json:"last_used_at"`
+	CreatedAt        string  `json:"created_at"`
+	Key              string  `json:"key,omitempty"` // Only returned once, when the key is created
+}
+
+// ListServiceAccountKeysResponse represents the response for listing a service account's active keys
+type ListServiceAccountKeysResponse struct {
+	Keys []ServiceAccountKeyResponse `json:"keys"`
+}
+
+// CreateSCIMTokenRequest represents the request to issue a SCIM provisioning token for an organization
+type CreateSCIMTokenRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// SCIMTokenResponse represents a SCIM provisioning token in API responses
+type SCIMTokenResponse struct {
+	ID             uint    `json:"id"`
+	OrganizationID uint    `json:"organization_id"`
+	Name           string  `json:"name"`
+	TokenHint      string  `json:"token_hint"`
+	CreatedByID    uint    `json:"created_by_id"`
+	LastUsedAt     *string `json:"last_used_at"`
+	CreatedAt      string  `json:"created_at"`
+	Token          string  `json:"token,omitempty"` // Only returned once, when the token is created
+}
+
+// ListSCIMTokensResponse represents the response for listing an organization's active SCIM tokens
+type ListSCIMTokensResponse struct {
+	Tokens []SCIMTokenResponse `json:"tokens"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditAction identifies a security-relevant action recorded in a user's audit log
+type AuditAction string
+
+const (
+	// AuditActionLogin is recorded when a session is started
+	AuditActionLogin AuditAction = "login"
+	// AuditActionPasswordChanged is recorded when the user changes their password
+	AuditActionPasswordChanged AuditAction = "password_changed"
+	// AuditActionPasswordReset is recorded when the password is reset through an emailed link
+	AuditActionPasswordReset AuditAction = "password_reset"
+	// AuditActionMFAEnabled is recorded when an authenticator app is confirmed
+	AuditActionMFAEnabled AuditAction = "mfa_enabled"
+	// AuditActionMFADisabled is recorded when an authenticator app is removed
+	AuditActionMFADisabled AuditAction = "mfa_disabled"
+	// AuditActionPasskeyAdded is recorded when a WebAuthn credential is registered
+	AuditActionPasskeyAdded AuditAction = "passkey_added"
+	// AuditActionPasskeyRemoved is recorded when a WebAuthn credential is removed
+	AuditActionPasskeyRemoved AuditAction = "passkey_removed"
+	// AuditActionEmailChanged is recorded when a new email address is confirmed
+	AuditActionEmailChanged AuditAction = "email_changed"
+	// AuditActionEmailChangeReverted is recorded when the previous email address is restored from a revert link
+	AuditActionEmailChangeReverted AuditAction = "email_change_reverted"
+	// AuditActionDeletionRequested is recorded when the user schedules their account for deletion
+	AuditActionDeletionRequested AuditAction = "account_deletion_requested"
+	// AuditActionDeletionCancelled is recorded when signing in during the grace period keeps the account
+	AuditActionDeletionCancelled AuditAction = "account_deletion_cancelled"
+)
+
+// AuditEvent records a security-relevant action on a user's account, along with the client it came from
+type AuditEvent struct {
+	ID        uint        `json:"id" gorm:"primaryKey"`
+	UserID    uint        `json:"user_id" gorm:"not null;index"`
+	Action    AuditAction `json:"action" gorm:"type:varchar(64);not null"`
+	IPAddress string      `json:"ip_address" gorm:"type:varchar(45)"`
+	UserAgent string      `json:"user_agent" gorm:"type:varchar(512)"`
+	CreatedAt time.Time   `json:"created_at"`
+
+	// Associations
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName specifies the table name for the AuditEvent model
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
@@ -1,5 +1,11 @@
 package models
 
+import (
+	"time"
+
+	"tmember/internal/webauthn"
+)
+
 // RegisterRequest represents the request payload for user registration
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
@@ -12,8 +18,245 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// ForgotPasswordRequest represents the request payload for requesting a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents the request payload for setting a new password with a reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// ChangePasswordRequest represents the request payload for changing the current user's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+// VerifyEmailRequest represents the request payload for confirming an email address
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ChangeEmailRequest represents the request payload for changing the current user's email address
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ConfirmEmailChangeRequest represents the request payload for confirming a new email address
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// RevertEmailChangeRequest represents the request payload for restoring the previous email address
+type RevertEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// MagicLinkRequest represents the request payload for requesting a sign-in link by email
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// RedeemMagicLinkRequest represents the request payload for signing in with an emailed sign-in link
+type RedeemMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// OIDCProviderResponse represents an external identity provider users can sign in with
+type OIDCProviderResponse struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+// OIDCAuthorizeResponse represents the provider URL the browser is sent to in order to sign in
+type OIDCAuthorizeResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	ExpiresIn        int    `json:"expires_in"` // Seconds until the sign-in must be completed
+}
+
+// OIDCCallbackRequest represents the request payload for completing a sign-in with the code and state
+// the identity provider redirected back with
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// SAMLLoginResponse represents the identity provider URL the browser is sent to in order to sign in with SAML
+type SAMLLoginResponse struct {
+	RedirectURL string `json:"redirect_url"`
+	ExpiresIn   int    `json:"expires_in"` // Seconds until the sign-in must be completed
+}
+
+// SAMLExchangeRequest represents the request payload for exchanging the one-time code from a SAML sign-in for tokens
+type SAMLExchangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
 // AuthResponse represents the response payload for successful authentication
 type AuthResponse struct {
-	User  User   `json:"user"`
-	Token string `json:"token"`
+	User         User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Access token lifetime in seconds
+}
+
+// MFAChallengeResponse represents the response to a correct password when a second factor is still required
+type MFAChallengeResponse struct {
+	MFARequired bool     `json:"mfa_required"`
+	MFAToken    string   `json:"mfa_token"`
+	Methods     []string `json:"methods"`    // Second factors the user has set up: "totp" and/or "webauthn"
+	ExpiresIn   int      `json:"expires_in"` // Challenge lifetime in seconds
+}
+
+// MFAVerifyRequest represents the request payload for completing a login with a TOTP code, a recovery code
+// or a WebAuthn credential
+type MFAVerifyRequest struct {
+	MFAToken   string                      `json:"mfa_token" binding:"required"`
+	Code       string                      `json:"code" binding:"required_without=Credential"`
+	Credential *webauthn.AssertionResponse `json:"credential"`
+}
+
+// TOTPSetupResponse represents the response for starting TOTP enrollment
+type TOTPSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// TOTPConfirmRequest represents the request payload for confirming TOTP enrollment with a first code
+type TOTPConfirmRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAReauthRequest represents the request payload for MFA changes that require re-authentication
+type MFAReauthRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"` // TOTP or recovery code
+}
+
+// RecoveryCodesResponse represents a freshly generated set of recovery codes, shown only once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// RefreshRequest represents the request payload for exchanging or revoking a refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// SessionResponse represents an active session in API responses
+type SessionResponse struct {
+	ID         uint   `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	MFA        bool   `json:"mfa"`
+	Current    bool   `json:"current"` // Whether this is the session making the request
+}
+
+// ListSessionsResponse represents the response for listing a user's active sessions
+type ListSessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// CreatePersonalAccessTokenRequest represents the request payload for creating a personal access token
+type CreatePersonalAccessTokenRequest struct {
+	Name           string `json:"name" binding:"required"`
+	Scope          string `json:"scope" binding:"omitempty,oneof=read read_write"` // Defaults to read
+	OrganizationID *uint  `json:"organization_id"`                                 // Optional organization restriction
+	ExpiresInDays  *int   `json:"expires_in_days"`                                 // Omit for a token that does not expire
+}
+
+// PersonalAccessTokenResponse represents a personal access token in API responses
+type PersonalAccessTokenResponse struct {
+	ID             uint    `json:"id"`
+	Name           string  `json:"name"`
+	TokenHint      string  `json:"token_hint"`
+	Scope          string  `json:"scope"`
+	OrganizationID *uint   `json:"organization_id"`
+	ExpiresAt      *string `json:"expires_at"`
+	LastUsedAt     *string `json:"last_used_at"`
+	CreatedAt      string  `json:"created_at"`
+	Token          string  `json:"token,omitempty"` // Only returned once, when the token is created
+}
+
+// ListPersonalAccessTokensResponse represents the response for listing a user's personal access tokens
+type ListPersonalAccessTokensResponse struct {
+	Tokens []PersonalAccessTokenResponse `json:"tokens"`
+}
+
+// WebAuthnCreationOptionsResponse represents the options to pass to navigator.credentials.create as publicKey
+type WebAuthnCreationOptionsResponse struct {
+	PublicKey webauthn.CreationOptions `json:"public_key"`
+}
+
+// WebAuthnRequestOptionsResponse represents the options to pass to navigator.credentials.get as publicKey
+type WebAuthnRequestOptionsResponse struct {
+	PublicKey webauthn.RequestOptions `json:"public_key"`
+}
+
+// RegisterWebAuthnCredentialRequest represents the request payload for registering a passkey or security key
+type RegisterWebAuthnCredentialRequest struct {
+	Name       string                       `json:"name"` // Defaults to "Passkey"
+	Credential webauthn.AttestationResponse `json:"credential" binding:"required"`
+}
+
+// UpdateWebAuthnCredentialRequest represents the request payload for renaming a WebAuthn credential
+type UpdateWebAuthnCredentialRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// WebAuthnCredentialResponse represents a registered WebAuthn credential in API responses
+type WebAuthnCredentialResponse struct {
+	ID            uint     `json:"id"`
+	Name          string   `json:"name"`
+	CredentialID  string   `json:"credential_id"`
+	Transports    []string `json:"transports"`
+	LastUsedAt    *string  `json:"last_used_at"`
+	CreatedAt     string   `json:"created_at"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"` // Only returned when the credential is the user's first second factor
+}
+
+// ListWebAuthnCredentialsResponse represents the response for listing a user's WebAuthn credentials
+type ListWebAuthnCredentialsResponse struct {
+	Credentials []WebAuthnCredentialResponse `json:"credentials"`
+}
+
+// WebAuthnLoginRequest represents the request payload for signing in with a passkey
+type WebAuthnLoginRequest struct {
+	Credential webauthn.AssertionResponse `json:"credential" binding:"required"`
+}
+
+// WebAuthnMFAOptionsRequest represents the request payload for starting a WebAuthn second-factor check
+type WebAuthnMFAOptionsRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// DeleteAccountRequest represents the request payload for deleting the current user's account
+type DeleteAccountRequest struct {
+	Password string `json:"password"` // Required for accounts that have a password
+}
+
+// AccountExport represents the archive of a user's personal data
+type AccountExport struct {
+	ExportedAt           time.Time                     `json:"exported_at"`
+	User                 User                          `json:"user"`
+	Memberships          []AccountExportMembership     `json:"memberships"`
+	Sessions             []Session                     `json:"sessions"`
+	Identities           []UserIdentity                `json:"identities"`
+	PasskeyCredentials   []WebAuthnCredentialResponse  `json:"passkey_credentials"`
+	PersonalAccessTokens []PersonalAccessTokenResponse `json:"personal_access_tokens"`
+	AuditEvents          []AuditEvent                  `json:"audit_events"`
+}
+
+// AccountExportMembership represents one of the user's organization memberships in an account export
+type AccountExportMembership struct {
+	OrganizationID   uint      `json:"organization_id"`
+	OrganizationName string    `json:"organization_name"`
+	Role             Role      `json:"role"`
+	JoinedAt         time.Time `json:"joined_at"`
 }
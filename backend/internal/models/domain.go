@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+)
+
+// DomainJoinMode controls what happens when a user verifies an email address on an organization's domain
+type DomainJoinMode string
+
+const (
+	DomainJoinAutomatic DomainJoinMode = "automatic" // The user becomes a member
+	DomainJoinRequest   DomainJoinMode = "request"   // A join request awaits an admin's decision
+	DomainJoinDisabled  DomainJoinMode = "disabled"  // The domain only restricts invitations
+)
+
+// OrganizationDomain represents an email domain claimed by an organization. The claim takes effect once
+// the organization proves control of the domain with a DNS TXT record.
+type OrganizationDomain struct {
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	OrganizationID    uint           `json:"organization_id" gorm:"not null;uniqueIndex:idx_organization_domains_org_domain"`
+	Domain            string         `json:"domain" gorm:"type:varchar(253);not null;uniqueIndex:idx_organization_domains_org_domain;index"`
+	VerificationToken string         `json:"-" gorm:"type:varchar(64);not null"`
+	JoinMode          DomainJoinMode `json:"join_mode" gorm:"type:varchar(20);not null"`
+	VerifiedAt        *time.Time     `json:"verified_at,omitempty"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+
+	// Associations
+	Organization Organization `json:"-" gorm:"foreignKey:OrganizationID"`
+}
+
+// TableName specifies the table name for the OrganizationDomain model
+func (OrganizationDomain) TableName() string {
+	return "organization_domains"
+}
+
+// IsVerified reports whether the organization has proven control of the domain
+func (d *OrganizationDomain) IsVerified() bool {
+	return d.VerifiedAt != nil
+}
+
+// JoinRequestStatus represents the state of a request to join an organization
+type JoinRequestStatus string
+
+const (
+	JoinRequestPending  JoinRequestStatus = "pending"
+	JoinRequestApproved JoinRequestStatus = "approved"
+	JoinRequestRejected JoinRequestStatus = "rejected"
+)
+
+// OrganizationJoinRequest represents a user's request to join an organization that claims their email domain
+type OrganizationJoinRequest struct {
+	ID             uint              `json:"id" gorm:"primaryKey"`
+	OrganizationID uint              `json:"organization_id" gorm:"not null;index"`
+	UserID         uint              `json:"user_id" gorm:"not null;index"`
+	Status         JoinRequestStatus `json:"status" gorm:"type:varchar(20);not null;index"`
+	DecidedByID    *uint             `json:"decided_by_id,omitempty"`
+	DecidedAt      *time.Time        `json:"decided_at,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+
+	// Associations
+	Organization Organization `json:"-" gorm:"foreignKey:OrganizationID"`
+	User         User         `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName specifies the table name for the OrganizationJoinRequest model
+func (OrganizationJoinRequest) TableName() string {
+	return "organization_join_requests"
+}
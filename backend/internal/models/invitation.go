@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Invitation represents an invitation for an email address to join an organization
+type Invitation struct {
+	ID                        uint       `json:"id" gorm:"primaryKey"`
+	OrganizationID            uint       `json:"organization_id" gorm:"not null;index"`
+	Email                     string     `json:"email" gorm:"type:varchar(255);not null;index"`
+	Role                      Role       `json:"role" gorm:"type:varchar(20);not null"`
+	TokenHash                 string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	InvitedByID               uint       `json:"invited_by_id" gorm:"not null"` // Zero when invited by a service account
+	InvitedByServiceAccountID *uint      `json:"invited_by_service_account_id,omitempty"`
+	ExpiresAt                 time.Time  `json:"expires_at" gorm:"not null"`
+	AcceptedAt                *time.Time `json:"accepted_at,omitempty"`
+	AcceptedByID              *uint      `json:"accepted_by_id,omitempty"`
+	RevokedAt                 *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt                 time.Time  `json:"created_at"`
+	UpdatedAt                 time.Time  `json:"updated_at"`
+
+	// Associations
+	Organization Organization `json:"-" gorm:"foreignKey:OrganizationID"`
+}
+
+// TableName specifies the table name for the Invitation model
+func (Invitation) TableName() string {
+	return "invitations"
+}
+
+// IsPending reports whether the invitation can still be accepted at the given time
+func (i *Invitation) IsPending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
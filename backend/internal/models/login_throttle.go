@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginThrottle tracks recent failed sign-in attempts for one account or one client IP address.
+// Records are keyed by a hash so attempts against unknown emails are tracked the same way as real accounts.
+type LoginThrottle struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	KeyHash       string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for the LoginThrottle model
+func (LoginThrottle) TableName() string {
+	return "login_throttles"
+}
+
+// IsLocked reports whether sign-in is locked out at the given time
+func (l *LoginThrottle) IsLocked(now time.Time) bool {
+	return l.LockedUntil != nil && now.Before(*l.LockedUntil)
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// MFARecoveryCode represents a hashed one-time recovery code for a user's second factor
+type MFARecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"type:char(64);not null;index"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Associations
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName specifies the table name for the MFARecoveryCode model
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// MFAChallenge represents a pending second-factor step of a login, issued after the password was verified
+type MFAChallenge struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	Attempts  int        `json:"attempts" gorm:"not null;default:0"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Associations
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName specifies the table name for the MFAChallenge model
+func (MFAChallenge) TableName() string {
+	return "mfa_challenges"
+}
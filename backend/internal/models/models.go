@@ -6,5 +6,30 @@ func AllModels() []interface{} {
 		&User{},
 		&Organization{},
 		&OrganizationMembership{},
+		&Invitation{},
+		&Session{},
+		&RefreshToken{},
+		&UserToken{},
+		&MFARecoveryCode{},
+		&MFAChallenge{},
+		&OrganizationSecurityPolicy{},
+		&PersonalAccessToken{},
+		&ServiceAccount{},
+		&ServiceAccountKey{},
+		&LoginThrottle{},
+		&OIDCLoginState{},
+		&UserIdentity{},
+		&OrganizationSAMLConfig{},
+		&SAMLLoginState{},
+		&SAMLProvisionedUser{},
+		&OrganizationDomain{},
+		&OrganizationJoinRequest{},
+		&SCIMToken{},
+		&SCIMUser{},
+		&SCIMGroup{},
+		&SCIMGroupMember{},
+		&WebAuthnCredential{},
+		&WebAuthnChallenge{},
+		&AuditEvent{},
 	}
 }
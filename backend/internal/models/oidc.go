@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+// OIDCLoginState represents a pending sign-in with an external identity provider, created when the user is
+// sent to the provider and consumed when the provider redirects back
+type OIDCLoginState struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	StateHash    string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	Provider     string     `json:"provider" gorm:"type:varchar(64);not null"`
+	Nonce        string     `json:"-" gorm:"type:varchar(64);not null"`
+	CodeVerifier string     `json:"-" gorm:"type:varchar(64);not null"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt       *time.Time `json:"used_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for the OIDCLoginState model
+func (OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
+
+// UserIdentity links a user to their account at an external identity provider
+type UserIdentity struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"not null;index"`
+	Provider    string    `json:"provider" gorm:"type:varchar(64);not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Subject     string    `json:"subject" gorm:"type:varchar(255);not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Email       string    `json:"email" gorm:"type:varchar(255)"`
+	LastLoginAt time.Time `json:"last_login_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Associations
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName specifies the table name for the UserIdentity model
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// PersonalAccessTokenPrefix marks bearer tokens that are personal access tokens rather than JWTs
+const PersonalAccessTokenPrefix = "tmp_"
+
+// TokenScope represents what an API token may do
+type TokenScope string
+
+const (
+	// TokenScopeRead allows only safe (read-only) requests
+	TokenScopeRead TokenScope = "read"
+	// TokenScopeReadWrite allows every request the owner could make
+	TokenScopeReadWrite TokenScope = "read_write"
+)
+
+// PersonalAccessToken represents a long-lived, user-scoped API token for scripts and CI
+type PersonalAccessToken struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	Name           string     `json:"name" gorm:"type:varchar(100);not null"`
+	TokenHash      string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	TokenHint      string     `json:"token_hint" gorm:"type:varchar(16)"` // Leading characters, to help users recognise the token
+	Scope          TokenScope `json:"scope" gorm:"type:varchar(20);not null"`
+	OrganizationID *uint      `json:"organization_id"`                   // Restricts the token to one organization when set
+	MFA            bool       `json:"mfa" gorm:"not null;default:false"` // Whether it was created from an MFA-authenticated session
+	ExpiresAt      *time.Time `json:"expires_at"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Associations
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName specifies the table name for the PersonalAccessToken model
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+// IsActive reports whether the token has not been revoked and has not expired
+func (t *PersonalAccessToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+)
+
+// SCIMTokenPrefix marks bearer tokens that authenticate an organization's SCIM provisioning client
+const SCIMTokenPrefix = "tmscim_"
+
+// SCIMToken represents a bearer token with which an identity provider provisions an organization's users
+// and groups over SCIM
+type SCIMToken struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	OrganizationID uint       `json:"organization_id" gorm:"not null;index"`
+	Name           string     `json:"name" gorm:"type:varchar(100);not null"`
+	TokenHash      string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	TokenHint      string     `json:"token_hint" gorm:"type:varchar(16)"` // Leading characters, to help admins recognise the token
+	CreatedByID    uint       `json:"created_by_id" gorm:"not null"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+
+	// Associations
+	Organization Organization `json:"-" gorm:"foreignKey:OrganizationID"`
+}
+
+// TableName specifies the table name for the SCIMToken model
+func (SCIMToken) TableName() string {
+	return "scim_tokens"
+}
+
+// SCIMUser links a user to an organization's SCIM provisioning, holding the attributes the identity
+// provider manages that tmember has no column for. Whether the user is active is their membership.
+type SCIMUser struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	OrganizationID uint      `json:"organization_id" gorm:"not null;uniqueIndex:idx_scim_users_org_user"`
+	UserID         uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_scim_users_org_user;index"`
+	ExternalID     string    `json:"external_id" gorm:"type:varchar(255)"`
+	GivenName      string    `json:"given_name" gorm:"type:varchar(255)"`
+	FamilyName     string    `json:"family_name" gorm:"type:varchar(255)"`
+	DisplayName    string    `json:"display_name" gorm:"type:varchar(255)"`
+	Managed        bool      `json:"managed" gorm:"not null;default:false"` // The account was created by provisioning and its owner has not taken it over, so its email may be changed
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Associations
+	Organization Organization `json:"-" gorm:"foreignKey:OrganizationID"`
+	User         User         `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName specifies the table name for the SCIMUser model
+func (SCIMUser) TableName() string {
+	return "scim_users"
+}
+
+// SCIMGroup represents a group provisioned into an organization over SCIM. tmember keeps groups so
+// identity providers can manage them, but they do not grant access.
+type SCIMGroup struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	OrganizationID uint      `json:"organization_id" gorm:"not null;index"`
+	DisplayName    string    `json:"display_name" gorm:"type:varchar(255);not null"`
+	ExternalID     string    `json:"external_id" gorm:"type:varchar(255)"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Associations
+	Organization Organization      `json:"-" gorm:"foreignKey:OrganizationID"`
+	Members      []SCIMGroupMember `json:"-" gorm:"foreignKey:GroupID"`
+}
+
+// TableName specifies the table name for the SCIMGroup model
+func (SCIMGroup) TableName() string {
+	return "scim_groups"
+}
+
+// SCIMGroupMember represents a user's membership of a SCIM group
+type SCIMGroupMember struct {
+	ID      uint `json:"id" gorm:"primaryKey"`
+	GroupID uint `json:"group_id" gorm:"not null;uniqueIndex:idx_scim_group_members_group_user"`
+	UserID  uint `json:"user_id" gorm:"not null;uniqueIndex:idx_scim_group_members_group_user;index"`
+}
+
+// TableName specifies the table name for the SCIMGroupMember model
+func (SCIMGroupMember) TableName() string {
+	return "scim_group_members"
+}
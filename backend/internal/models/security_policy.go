@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// OrganizationSecurityPolicy represents the security settings an organization enforces on its members
+type OrganizationSecurityPolicy struct {
+	ID             uint `json:"id" gorm:"primaryKey"`
+	OrganizationID uint `json:"organization_id" gorm:"not null;uniqueIndex"`
+	RequireMFA     bool `json:"require_mfa" gorm:"not null;default:false"`
+
+	// Stops members from signing in with emailed links instead of their password
+	DisableMagicLinkLogin bool `json:"disable_magic_link_login" gorm:"not null;default:false"`
+
+	// Password rules members must satisfy when they set a password, on top of the global defaults
+	PasswordMinLength        int  `json:"password_min_length" gorm:"not null;default:0"`
+	PasswordRequireUppercase bool `json:"password_require_uppercase" gorm:"not null;default:false"`
+	PasswordRequireLowercase bool `json:"password_require_lowercase" gorm:"not null;default:false"`
+	PasswordRequireDigit     bool `json:"password_require_digit" gorm:"not null;default:false"`
+	PasswordRequireSymbol    bool `json:"password_require_symbol" gorm:"not null;default:false"`
+
+	// Session limits for members in minutes; zero means no limit
+	SessionMaxAgeMinutes      int `json:"session_max_age_minutes" gorm:"not null;default:0"`
+	SessionIdleTimeoutMinutes int `json:"session_idle_timeout_minutes" gorm:"not null;default:0"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Associations
+	Organization Organization `json:"-" gorm:"foreignKey:OrganizationID"`
+}
+
+// TableName specifies the table name for the OrganizationSecurityPolicy model
+func (OrganizationSecurityPolicy) TableName() string {
+	return "organization_security_policies"
+}
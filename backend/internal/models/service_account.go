@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ServiceAccountKeyPrefix marks bearer tokens that are service account API keys
+const ServiceAccountKeyPrefix = "tmsa_"
+
+// ServiceAccount represents a non-human principal owned by an organization, used by integrations
+type ServiceAccount struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	OrganizationID uint           `json:"organization_id" gorm:"not null;index"`
+	Name           string         `json:"name" gorm:"type:varchar(100);not null"`
+	Role           Role           `json:"role" gorm:"type:varchar(20);not null"`
+	CreatedByID    uint           `json:"created_by_id" gorm:"not null"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Associations
+	Organization Organization        `json:"-" gorm:"foreignKey:OrganizationID"`
+	Keys         []ServiceAccountKey `json:"-" gorm:"foreignKey:ServiceAccountID"`
+}
+
+// TableName specifies the table name for the ServiceAccount model
+func (ServiceAccount) TableName() string {
+	return "service_accounts"
+}
+
+// ServiceAccountKey represents one of a service account's API keys. Several keys can be active at once
+// so integrations can rotate without downtime.
+type ServiceAccountKey struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	ServiceAccountID uint       `json:"service_account_id" gorm:"not null;index"`
+	TokenHash        string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	TokenHint        string     `json:"token_hint" gorm:"type:varchar(16)"` // Leading characters, to help admins recognise the key
+	ExpiresAt        *time.Time `json:"expires_at"`
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+
+	// Associations
+	ServiceAccount ServiceAccount `json:"-" gorm:"foreignKey:ServiceAccountID"`
+}
+
+// TableName specifies the table name for the ServiceAccountKey model
+func (ServiceAccountKey) TableName() string {
+	return "service_account_keys"
+}
+
+// IsActive reports whether the key has not been revoked and has not expired
+func (k *ServiceAccountKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+)
+
+// Session represents a login session which owns a family of rotating refresh tokens
+type Session struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	UserAgent  string     `json:"user_agent" gorm:"type:varchar(512)"`
+	IPAddress  string     `json:"ip_address" gorm:"type:varchar(45)"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	MFA        bool       `json:"mfa" gorm:"not null;default:false"` // Whether a second factor was presented for this session
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// Associations
+	User          User           `json:"-" gorm:"foreignKey:UserID"`
+	RefreshTokens []RefreshToken `json:"-" gorm:"foreignKey:SessionID"`
+}
+
+// TableName specifies the table name for the Session model
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// SessionLastSeenInterval is the minimum interval between last-seen updates of a session
+const SessionLastSeenInterval = time.Minute
+
+// IsActive reports whether the session has not been revoked
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil
+}
+
+// RefreshToken represents a single-use refresh token belonging to a session's token family
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	SessionID uint       `json:"session_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"` // Set when the token is rotated
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Associations
+	Session Session `json:"-" gorm:"foreignKey:SessionID"`
+}
+
+// TableName specifies the table name for the RefreshToken model
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
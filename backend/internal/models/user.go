@@ -3,22 +3,80 @@ package models
 import (
 	"time"
 
+	"tmember/internal/utils"
+
 	"gorm.io/gorm"
 )
 
 // User represents a user in the system
 type User struct {
-	ID           uint           `json:"id" gorm:"primaryKey"`
-	Email        string         `json:"email" gorm:"type:varchar(255);uniqueIndex;not null" binding:"required,email"`
-	PasswordHash string         `json:"-" gorm:"not null"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+	ID                  uint           `json:"id" gorm:"primaryKey"`
+	Email               string         `json:"email" gorm:"type:varchar(255);uniqueIndex;not null" binding:"required,email"`
+	NormalizedEmail     *string        `json:"-" gorm:"type:varchar(255);uniqueIndex"` // utils.EmailKey of Email, which accounts are told apart by; set by the save hook
+	PasswordHash        string         `json:"-" gorm:"not null"`
+	EmailVerifiedAt     *time.Time     `json:"email_verified_at"`
+	TOTPSecret          string         `json:"-" gorm:"type:varchar(64)"`   // Pending until MFAEnabledAt is set
+	TOTPLastStep        int64          `json:"-" gorm:"not null;default:0"` // Last accepted TOTP time step, prevents code replay
+	MFAEnabledAt        *time.Time     `json:"mfa_enabled_at"`
+	DeletionScheduledAt *time.Time     `json:"deletion_scheduled_at"` // When the account will be anonymized, unless the user signs in before then
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	DeletedAt           gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Associations
 	Memberships []OrganizationMembership `json:"memberships,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// IsEmailVerified reports whether the user has confirmed ownership of their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// IsMFAEnabled reports whether the user has a confirmed second factor
+func (u *User) IsMFAEnabled() bool {
+	return u.MFAEnabledAt != nil
+}
+
+// IsDeletionScheduled reports whether the user has asked for their account to be deleted
+func (u *User) IsDeletionScheduled() bool {
+	return u.DeletionScheduledAt != nil
+}
+
+// BeforeSave is a GORM hook that stores the email address in canonical form and keeps its normalized key in step
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	email, ok := u.emailBeingSaved(tx.Statement)
+	if !ok {
+		return nil
+	}
+	if canonical, err := utils.CanonicalizeEmail(email); err == nil {
+		email = canonical
+	}
+	key := utils.EmailKey(email)
+	tx.Statement.SetColumn("Email", email)
+	tx.Statement.SetColumn("NormalizedEmail", &key)
+	return nil
+}
+
+// emailBeingSaved returns the email address a create or update writes, if it writes one
+func (u *User) emailBeingSaved(stmt *gorm.Statement) (string, bool) {
+	switch dest := stmt.Dest.(type) {
+	case map[string]interface{}:
+		for _, column := range []string{"email", "Email"} {
+			if email, ok := dest[column].(string); ok {
+				return email, true
+			}
+		}
+		return "", false
+	case User:
+		return dest.Email, dest.Email != ""
+	case *User:
+		if dest != u {
+			return dest.Email, dest.Email != ""
+		}
+	}
+	return u.Email, true
+}
+
 // TableName specifies the table name for the User model
 func (User) TableName() string {
 	return "users"
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// TokenPurpose identifies what a one-time user token can be used for
+type TokenPurpose string
+
+const (
+	TokenPurposePasswordReset     TokenPurpose = "password_reset"
+	TokenPurposeEmailVerification TokenPurpose = "email_verification"
+	TokenPurposeSAMLLogin         TokenPurpose = "saml_login"
+	TokenPurposeMagicLink         TokenPurpose = "magic_link"
+	TokenPurposeEmailChange       TokenPurpose = "email_change"
+	TokenPurposeEmailChangeRevert TokenPurpose = "email_change_revert"
+)
+
+// UserToken represents a hashed, single-use, expiring token emailed to a user
+type UserToken struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	UserID    uint         `json:"user_id" gorm:"not null;index"`
+	Purpose   TokenPurpose `json:"purpose" gorm:"type:varchar(32);not null;index"`
+	TokenHash string       `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	Data      string       `json:"-" gorm:"type:varchar(255)"` // Value the token is bound to, such as the email address of an email change
+	ExpiresAt time.Time    `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time   `json:"used_at,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+
+	// Associations
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName specifies the table name for the UserToken model
+func (UserToken) TableName() string {
+	return "user_tokens"
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+)
+
+// WebAuthnCeremony identifies what a WebAuthn challenge was issued for
+type WebAuthnCeremony string
+
+const (
+	// WebAuthnCeremonyRegistration registers a new credential for a signed-in user
+	WebAuthnCeremonyRegistration WebAuthnCeremony = "registration"
+	// WebAuthnCeremonyLogin signs in with a passkey instead of a password
+	WebAuthnCeremonyLogin WebAuthnCeremony = "login"
+	// WebAuthnCeremonyMFA presents a credential as the second factor of a login
+	WebAuthnCeremonyMFA WebAuthnCeremony = "mfa"
+)
+
+// WebAuthnCredential represents a passkey or security key registered by a user
+type WebAuthnCredential struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"not null;index"`
+	Name         string     `json:"name" gorm:"type:varchar(100);not null"`
+	CredentialID string     `json:"credential_id" gorm:"type:varchar(255);uniqueIndex;not null"` // Base64url, as browsers report it
+	UserHandle   string     `json:"-" gorm:"type:varchar(64);not null;index"`                    // Base64url handle the user's credentials are registered with
+	PublicKey    []byte     `json:"-" gorm:"not null"`                                           // COSE_Key encoding
+	SignCount    uint32     `json:"sign_count" gorm:"not null;default:0"`
+	Transports   string     `json:"transports" gorm:"type:varchar(100)"` // Comma-separated transport hints
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// Associations
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName specifies the table name for the WebAuthnCredential model
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// WebAuthnChallenge represents a pending WebAuthn ceremony, identified by the hash of its random challenge
+type WebAuthnChallenge struct {
+	ID            uint             `json:"id" gorm:"primaryKey"`
+	UserID        uint             `json:"user_id" gorm:"not null;index"` // Zero for passkey sign-ins, where the user is not known yet
+	Ceremony      WebAuthnCeremony `json:"ceremony" gorm:"type:varchar(32);not null"`
+	ChallengeHash string           `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	UserHandle    string           `json:"-" gorm:"type:varchar(64)"` // Handle offered to the authenticator when registering
+	ExpiresAt     time.Time        `json:"expires_at" gorm:"not null"`
+	UsedAt        *time.Time       `json:"used_at,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+}
+
+// TableName specifies the table name for the WebAuthnChallenge model
+func (WebAuthnChallenge) TableName() string {
+	return "webauthn_challenges"
+}
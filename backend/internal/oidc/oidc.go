@@ -0,0 +1,70 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"regexp"
+
+	"tmember/internal/config"
+	"tmember/internal/utils"
+)
+
+// providerNameRegex restricts provider names to values that are safe in URLs and environment variable names
+var providerNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// defaultProviders holds the identity providers configured at startup
+var defaultProviders map[string]*Provider
+
+// Initialize configures the identity providers listed by config.OIDCProviders. Providers redirect back
+// to redirectURL.
+func Initialize(redirectURL string) error {
+	providers := map[string]*Provider{}
+
+	for _, cfg := range config.OIDCProviders() {
+		if !providerNameRegex.MatchString(cfg.Name) {
+			return fmt.Errorf("invalid OIDC provider name %q", cfg.Name)
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return fmt.Errorf("OIDC provider %s needs %sISSUER and %sCLIENT_ID", cfg.Name, cfg.EnvPrefix, cfg.EnvPrefix)
+		}
+
+		providers[cfg.Name] = &Provider{
+			Name:          cfg.Name,
+			DisplayName:   cfg.DisplayName,
+			Issuer:        cfg.Issuer,
+			ClientID:      cfg.ClientID,
+			ClientSecret:  cfg.ClientSecret,
+			Scopes:        cfg.Scopes,
+			RedirectURL:   redirectURL,
+			AutoProvision: cfg.AutoProvision,
+		}
+	}
+
+	defaultProviders = providers
+	if len(providers) > 0 {
+		log.Printf("OIDC initialized with %d identity provider(s)", len(providers))
+	}
+	return nil
+}
+
+// GetProviders returns the identity providers configured at startup, keyed by name
+func GetProviders() map[string]*Provider {
+	return defaultProviders
+}
+
+// NewPKCE generates a PKCE code verifier and its S256 code challenge (RFC 7636)
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return verifier, PKCEChallenge(verifier), nil
+}
+
+// PKCEChallenge returns the S256 code challenge for a code verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
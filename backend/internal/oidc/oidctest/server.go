@@ -0,0 +1,219 @@
+// Package oidctest provides a local OpenID Connect identity provider for tests
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyID is the "kid" of the identity provider's signing key
+const keyID = "oidctest-key"
+
+// User is the identity the provider signs in as
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// Server is a minimal identity provider serving discovery, JWKS and token endpoints. Browser
+// interaction is replaced by Authorize, which approves an authorization URL for the current user.
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	mu    sync.Mutex
+	key   *rsa.PrivateKey
+	user  User
+	codes map[string]authorization
+
+	// IDTokenClaims, if set, may modify the claims of each issued ID token
+	IDTokenClaims func(claims map[string]interface{})
+}
+
+// authorization is an issued authorization code waiting to be redeemed
+type authorization struct {
+	user          User
+	nonce         string
+	redirectURI   string
+	codeChallenge string
+}
+
+// NewServer starts an identity provider with a fresh signing key
+func NewServer() *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: failed to generate key: %v", err))
+	}
+
+	s := &Server{
+		ClientID:     "tmember-test-client",
+		ClientSecret: "tmember-test-secret",
+		key:          key,
+		codes:        map[string]authorization{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.handleDiscovery)
+	mux.HandleFunc("/jwks", s.handleJWKS)
+	mux.HandleFunc("/token", s.handleToken)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// SetUser changes the identity that subsequent authorizations sign in as
+func (s *Server) SetUser(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = user
+}
+
+// Authorize approves an authorization URL built by the relying party and returns the code and state
+// the provider would send to the redirect URI
+func (s *Server) Authorize(authURL string) (code, state string, err error) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+
+	if query.Get("client_id") != s.ClientID || query.Get("response_type") != "code" {
+		return "", "", errors.New("oidctest: unexpected client or response type")
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		return "", "", errors.New("oidctest: PKCE is required")
+	}
+
+	code = base64.RawURLEncoding.EncodeToString(randomBytes(16))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[code] = authorization{
+		user:          s.user,
+		nonce:         query.Get("nonce"),
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	return code, query.Get("state"), nil
+}
+
+// handleDiscovery serves the discovery document
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.URL,
+		"authorization_endpoint":                s.URL + "/authorize",
+		"token_endpoint":                        s.URL + "/token",
+		"jwks_uri":                              s.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// handleJWKS serves the public signing key
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+		}},
+	})
+}
+
+// handleToken redeems an authorization code, checking client credentials, redirect URI and PKCE verifier
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+		writeTokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	clientID, clientSecret, _ := r.BasicAuth()
+	clientID, _ = url.QueryUnescape(clientID)
+	clientSecret, _ = url.QueryUnescape(clientSecret)
+	if clientID != s.ClientID || clientSecret != s.ClientSecret {
+		writeTokenError(w, "invalid_client")
+		return
+	}
+
+	s.mu.Lock()
+	auth, ok := s.codes[r.Form.Get("code")]
+	delete(s.codes, r.Form.Get("code"))
+	s.mu.Unlock()
+
+	verifierHash := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || auth.redirectURI != r.Form.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(verifierHash[:]) != auth.codeChallenge {
+		writeTokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.URL,
+		"sub":            auth.user.Subject,
+		"aud":            s.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          auth.nonce,
+		"email":          auth.user.Email,
+		"email_verified": auth.user.EmailVerified,
+	}
+	if s.IDTokenClaims != nil {
+		s.IDTokenClaims(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(s.key)
+	if err != nil {
+		writeTokenError(w, "server_error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": base64.RawURLEncoding.EncodeToString(randomBytes(16)),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// writeTokenError writes an OAuth 2.0 error response
+func writeTokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// randomBytes returns n random bytes
+func randomBytes(n int) []byte {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("oidctest: failed to read random bytes: %v", err))
+	}
+	return buf
+}
@@ -0,0 +1,149 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"tmember/internal/oidc/oidctest"
+)
+
+// newTestProvider returns a provider configured for the mock identity provider
+func newTestProvider(idp *oidctest.Server) *Provider {
+	return &Provider{
+		Name:         "mock",
+		Issuer:       idp.URL,
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  "http://localhost:5173/auth/oidc/callback",
+	}
+}
+
+// authorize runs the browser part of the flow and returns the code, verifier and nonce
+func authorize(t *testing.T, idp *oidctest.Server, provider *Provider) (code, verifier, nonce string) {
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("Failed to generate PKCE: %v", err)
+	}
+	nonce = "nonce-" + verifier[:8]
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-123", nonce, challenge)
+	if err != nil {
+		t.Fatalf("Failed to build authorization URL: %v", err)
+	}
+	if !strings.HasPrefix(authURL, idp.URL+"/authorize?") || !strings.Contains(authURL, "scope=openid+email+profile") {
+		t.Errorf("Unexpected authorization URL: %s", authURL)
+	}
+
+	code, state, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorization failed: %v", err)
+	}
+	if state != "state-123" {
+		t.Errorf("Expected state to round-trip, got %q", state)
+	}
+	return code, verifier, nonce
+}
+
+// TestProviderAuthorizationCodeFlow tests a complete login against the mock identity provider
+func TestProviderAuthorizationCodeFlow(t *testing.T) {
+	idp := oidctest.NewServer()
+	defer idp.Close()
+	idp.SetUser(oidctest.User{Subject: "user-1", Email: "oidc@example.com", EmailVerified: true})
+	provider := newTestProvider(idp)
+
+	code, verifier, nonce := authorize(t, idp, provider)
+	claims, err := provider.Exchange(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "oidc@example.com" || !claims.EmailVerified {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+
+	// Authorization codes are single use
+	if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err == nil {
+		t.Error("Expected a redeemed code to be rejected")
+	}
+}
+
+// TestProviderRejectsInvalidLogins tests PKCE, nonce and ID token claim checks
+func TestProviderRejectsInvalidLogins(t *testing.T) {
+	idp := oidctest.NewServer()
+	defer idp.Close()
+	idp.SetUser(oidctest.User{Subject: "user-1", Email: "oidc@example.com", EmailVerified: true})
+	provider := newTestProvider(idp)
+
+	tests := []struct {
+		name          string
+		modifyClaims  func(claims map[string]interface{})
+		wrongVerifier bool
+		wrongNonce    bool
+		idTokenError  bool
+	}{
+		{name: "wrong PKCE verifier", wrongVerifier: true},
+		{name: "wrong nonce", wrongNonce: true, idTokenError: true},
+		{name: "other audience", modifyClaims: func(c map[string]interface{}) { c["aud"] = "another-client" }, idTokenError: true},
+		{name: "other issuer", modifyClaims: func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }, idTokenError: true},
+		{name: "expired", modifyClaims: func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, idTokenError: true},
+		{name: "missing subject", modifyClaims: func(c map[string]interface{}) { delete(c, "sub") }, idTokenError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp.IDTokenClaims = tt.modifyClaims
+			defer func() { idp.IDTokenClaims = nil }()
+
+			code, verifier, nonce := authorize(t, idp, provider)
+			if tt.wrongVerifier {
+				verifier += "x"
+			}
+			if tt.wrongNonce {
+				nonce += "x"
+			}
+
+			_, err := provider.Exchange(context.Background(), code, verifier, nonce)
+			if err == nil {
+				t.Fatal("Expected the login to be rejected")
+			}
+			if errors.Is(err, ErrInvalidIDToken) != tt.idTokenError {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// TestInitialize tests provider configuration from environment variables
+func TestInitialize(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "google, okta-prod")
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "google-client")
+	t.Setenv("OIDC_GOOGLE_DISPLAY_NAME", "Google")
+	t.Setenv("OIDC_OKTA_PROD_ISSUER", "https://example.okta.com")
+	t.Setenv("OIDC_OKTA_PROD_CLIENT_ID", "okta-client")
+	t.Setenv("OIDC_OKTA_PROD_AUTO_PROVISION", "true")
+
+	if err := Initialize("http://localhost:5173/auth/oidc/callback"); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer func() { defaultProviders = nil }()
+
+	providers := GetProviders()
+	if len(providers) != 2 {
+		t.Fatalf("Expected 2 providers, got %d", len(providers))
+	}
+	if google := providers["google"]; google.DisplayName != "Google" || google.AutoProvision {
+		t.Errorf("Unexpected google provider: %+v", google)
+	}
+	if okta := providers["okta-prod"]; okta.ClientID != "okta-client" || !okta.AutoProvision || okta.RedirectURL == "" {
+		t.Errorf("Unexpected okta provider: %+v", okta)
+	}
+
+	// Providers need an issuer and client ID
+	t.Setenv("OIDC_PROVIDERS", "keycloak")
+	if err := Initialize("http://localhost:5173/auth/oidc/callback"); err == nil {
+		t.Error("Expected incomplete provider configuration to be rejected")
+	}
+}
@@ -0,0 +1,405 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Filter is a parsed filter expression (RFC 7644 section 3.4.2.2)
+type Filter interface {
+	// Matches reports whether the JSON form of a resource satisfies the filter
+	Matches(resource map[string]interface{}) bool
+}
+
+// ParseFilter parses a filter expression such as `userName eq "jane@example.com" and active eq true`.
+// String comparisons are case-insensitive.
+func ParseFilter(expression string) (Filter, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, invalidFilter("unexpected %q", p.peek().text)
+	}
+	return filter, nil
+}
+
+// invalidFilter returns an invalidFilter error
+func invalidFilter(format string, args ...interface{}) error {
+	return NewError(http.StatusBadRequest, ErrInvalidFilter, fmt.Sprintf(format, args...))
+}
+
+// token is a lexical element of a filter
+type token struct {
+	text   string
+	quoted bool // A string literal, with text holding its decoded value
+}
+
+// tokenize splits a filter into words, string literals and the punctuation ( ) [ ]
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, token{text: string(c)})
+			i++
+		case c == '"':
+			// Find the closing quote, skipping escaped characters
+			j := i + 1
+			for ; j < len(expression) && expression[j] != '"'; j++ {
+				if expression[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(expression) {
+				return nil, invalidFilter("unterminated string")
+			}
+			var value string
+			if err := json.Unmarshal([]byte(expression[i:j+1]), &value); err != nil {
+				return nil, invalidFilter("invalid string %s", expression[i:j+1])
+			}
+			tokens = append(tokens, token{text: value, quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for j < len(expression) && !strings.ContainsRune(" \t\n\r()[]\"", rune(expression[j])) {
+				j++
+			}
+			tokens = append(tokens, token{text: expression[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser is a recursive descent parser over filter tokens. "and" binds tighter than "or".
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *filterParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *filterParser) peek() token {
+	if p.done() {
+		return token{}
+	}
+	return p.tokens[p.pos]
+}
+
+// keyword reports whether the next token is the given unquoted keyword, consuming it if so
+func (p *filterParser) keyword(word string) bool {
+	if next := p.peek(); !p.done() && !next.quoted && strings.EqualFold(next.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.keyword(text) {
+		if p.done() {
+			return invalidFilter("expected %q at end of filter", text)
+		}
+		return invalidFilter("expected %q, got %q", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (Filter, error) {
+	if p.keyword("not") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return notFilter{inner}, nil
+	}
+
+	if p.keyword("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+
+	return p.parseAttributeExpression()
+}
+
+// parseAttributeExpression parses `attrPath op value`, `attrPath pr` or `attrPath[valFilter]`
+func (p *filterParser) parseAttributeExpression() (Filter, error) {
+	if p.done() {
+		return nil, invalidFilter("expected an attribute at end of filter")
+	}
+	attr := p.peek()
+	if attr.quoted || strings.ContainsAny(attr.text, "()[]") {
+		return nil, invalidFilter("expected an attribute, got %q", attr.text)
+	}
+	p.pos++
+	path := splitAttributePath(attributeName(attr.text))
+
+	if p.keyword("[") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return valuePathFilter{attribute: path[0], filter: inner}, nil
+	}
+
+	if p.done() {
+		return nil, invalidFilter("expected an operator after %q", attr.text)
+	}
+	op := strings.ToLower(p.peek().text)
+	p.pos++
+
+	switch op {
+	case "pr":
+		return presentFilter{path: path}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "lt", "ge", "le":
+	default:
+		return nil, invalidFilter("unknown operator %q", op)
+	}
+
+	if p.done() {
+		return nil, invalidFilter("expected a value after %q", op)
+	}
+	literal := p.peek()
+	p.pos++
+
+	var value interface{}
+	if literal.quoted {
+		value = literal.text
+	} else if err := json.Unmarshal([]byte(literal.text), &value); err != nil {
+		return nil, invalidFilter("invalid value %q", literal.text)
+	}
+	if _, isString := value.(string); !isString && (op == "co" || op == "sw" || op == "ew") {
+		return nil, invalidFilter("operator %q requires a string", op)
+	}
+
+	return compareFilter{path: path, op: op, value: value}, nil
+}
+
+// splitAttributePath splits "name.givenName" into its attribute and sub-attribute
+func splitAttributePath(path string) []string {
+	if attr, sub, ok := strings.Cut(path, "."); ok {
+		return []string{attr, sub}
+	}
+	return []string{path}
+}
+
+// resolve returns the values at an attribute path, flattening multi-valued attributes
+func resolve(resource map[string]interface{}, path []string) []interface{} {
+	key, ok := lookupKey(resource, path[0])
+	if !ok || resource[key] == nil {
+		return nil
+	}
+
+	var values []interface{}
+	if list, isList := resource[key].([]interface{}); isList {
+		values = list
+	} else {
+		values = []interface{}{resource[key]}
+	}
+	if len(path) == 1 {
+		return values
+	}
+
+	var subValues []interface{}
+	for _, value := range values {
+		if complexValue, isMap := value.(map[string]interface{}); isMap {
+			subValues = append(subValues, resolve(complexValue, path[1:])...)
+		}
+	}
+	return subValues
+}
+
+type andFilter struct{ left, right Filter }
+
+func (f andFilter) Matches(resource map[string]interface{}) bool {
+	return f.left.Matches(resource) && f.right.Matches(resource)
+}
+
+type orFilter struct{ left, right Filter }
+
+func (f orFilter) Matches(resource map[string]interface{}) bool {
+	return f.left.Matches(resource) || f.right.Matches(resource)
+}
+
+type notFilter struct{ inner Filter }
+
+func (f notFilter) Matches(resource map[string]interface{}) bool {
+	return !f.inner.Matches(resource)
+}
+
+// presentFilter matches resources with a non-empty value at the path
+type presentFilter struct{ path []string }
+
+func (f presentFilter) Matches(resource map[string]interface{}) bool {
+	for _, value := range resolve(resource, f.path) {
+		switch v := value.(type) {
+		case string:
+			if v != "" {
+				return true
+			}
+		case []interface{}:
+			if len(v) > 0 {
+				return true
+			}
+		case map[string]interface{}:
+			if len(v) > 0 {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// valuePathFilter matches resources with an element of a multi-valued attribute that satisfies the inner filter
+type valuePathFilter struct {
+	attribute string
+	filter    Filter
+}
+
+func (f valuePathFilter) Matches(resource map[string]interface{}) bool {
+	for _, value := range resolve(resource, []string{f.attribute}) {
+		if element, isMap := value.(map[string]interface{}); isMap && f.filter.Matches(element) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareFilter matches resources with a value at the path that compares to the literal with the operator
+type compareFilter struct {
+	path  []string
+	op    string
+	value interface{}
+}
+
+func (f compareFilter) Matches(resource map[string]interface{}) bool {
+	values := resolve(resource, f.path)
+	if f.op == "ne" {
+		for _, value := range values {
+			if compare(value, "eq", f.value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, value := range values {
+		if compare(value, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare applies a comparison operator to an attribute value and a literal of the same type
+func compare(attribute interface{}, op string, literal interface{}) bool {
+	switch lit := literal.(type) {
+	case nil:
+		return op == "eq" && attribute == nil
+	case string:
+		attr, ok := attribute.(string)
+		if !ok {
+			return false
+		}
+		attr, lit = strings.ToLower(attr), strings.ToLower(lit)
+		switch op {
+		case "eq":
+			return attr == lit
+		case "co":
+			return strings.Contains(attr, lit)
+		case "sw":
+			return strings.HasPrefix(attr, lit)
+		case "ew":
+			return strings.HasSuffix(attr, lit)
+		case "gt":
+			return attr > lit
+		case "lt":
+			return attr < lit
+		case "ge":
+			return attr >= lit
+		case "le":
+			return attr <= lit
+		}
+	case bool:
+		attr, ok := attribute.(bool)
+		return ok && op == "eq" && attr == lit
+	case float64:
+		attr, ok := attribute.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return attr == lit
+		case "gt":
+			return attr > lit
+		case "lt":
+			return attr < lit
+		case "ge":
+			return attr >= lit
+		case "le":
+			return attr <= lit
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package scim
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestParseFilter tests filter evaluation against a user resource
+func TestParseFilter(t *testing.T) {
+	user := map[string]interface{}{
+		"userName":    "Jane@Example.com",
+		"displayName": "Jane Doe",
+		"active":      true,
+		"name":        map[string]interface{}{"givenName": "Jane", "familyName": "Doe"},
+		"emails": []interface{}{
+			map[string]interface{}{"value": "jane@example.com", "type": "work", "primary": true},
+			map[string]interface{}{"value": "jane@home.example", "type": "home"},
+		},
+	}
+
+	tests := []struct {
+		filter   string
+		expected bool
+	}{
+		{`userName eq "jane@example.com"`, true},
+		{`UserName Eq "JANE@EXAMPLE.COM"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "jane@example.com"`, true},
+		{`userName ne "jane@example.com"`, false},
+		{`userName sw "jane"`, true},
+		{`userName ew "example.com"`, true},
+		{`displayName co "ne D"`, true},
+		{`name.familyName eq "Doe"`, true},
+		{`emails.value eq "jane@home.example"`, true},
+		{`emails[type eq "work" and value co "example.com"]`, true},
+		{`emails[type eq "work" and value co "home"]`, false},
+		{`active eq true and userName pr`, true},
+		{`active eq false or displayName eq "Jane Doe"`, true},
+		{`not (active eq true)`, false},
+		{`(active eq false or userName sw "j") and name.givenName gt "A"`, true},
+		{`title pr`, false},
+		{`title eq null`, false},
+	}
+
+	for _, tt := range tests {
+		filter, err := ParseFilter(tt.filter)
+		if err != nil {
+			t.Errorf("ParseFilter(%q) failed: %v", tt.filter, err)
+			continue
+		}
+		if matched := filter.Matches(user); matched != tt.expected {
+			t.Errorf("%q matched %v, expected %v", tt.filter, matched, tt.expected)
+		}
+	}
+}
+
+// TestParseFilterErrors tests that malformed filters are rejected with invalidFilter
+func TestParseFilterErrors(t *testing.T) {
+	for _, expression := range []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName xx "a"`,
+		`userName eq "unterminated`,
+		`(userName eq "a"`,
+		`emails[type eq "work"`,
+		`userName eq "a" extra`,
+		`active co true`,
+		`userName eq jane`,
+	} {
+		_, err := ParseFilter(expression)
+		var scimErr *Error
+		if !errors.As(err, &scimErr) || scimErr.ScimType != ErrInvalidFilter || scimErr.HTTPStatus() != 400 {
+			t.Errorf("ParseFilter(%q) = %v; expected an invalidFilter error", expression, err)
+		}
+	}
+}
+
+// TestSelectAttributes tests the attributes and excludedAttributes parameters
+func TestSelectAttributes(t *testing.T) {
+	group := map[string]interface{}{"schemas": []interface{}{GroupSchema}, "id": "1", "displayName": "Engineering", "members": []interface{}{}}
+	SelectAttributes(group, "", "members,id")
+	if _, ok := group["members"]; ok {
+		t.Error("Expected members to be excluded")
+	}
+	if _, ok := group["id"]; !ok {
+		t.Error("Expected id to always be returned")
+	}
+
+	user := map[string]interface{}{"schemas": []interface{}{UserSchema}, "id": "1", "userName": "jane@example.com", "name": map[string]interface{}{}, "active": true}
+	SelectAttributes(user, "userName,name.givenName", "")
+	if len(user) != 4 || user["userName"] == nil || user["name"] == nil {
+		t.Errorf("Unexpected attributes %v", user)
+	}
+}
@@ -0,0 +1,314 @@
+package scim
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// ApplyPatch applies PATCH operations (RFC 7644 section 3.5.2) to the JSON form of a resource. Operation
+// names and attribute names are case-insensitive. Paths have the form `attr`, `attr.sub`, `attr[filter]` or
+// `attr[filter].sub`, optionally prefixed by the schema URN.
+func ApplyPatch(resource map[string]interface{}, operations []PatchOperation) error {
+	for _, operation := range operations {
+		var err error
+		switch strings.ToLower(operation.Op) {
+		case "add":
+			err = applyAdd(resource, operation)
+		case "replace":
+			err = applyReplace(resource, operation)
+		case "remove":
+			err = applyRemove(resource, operation)
+		default:
+			err = NewError(http.StatusBadRequest, ErrInvalidSyntax, fmt.Sprintf("unknown operation %q", operation.Op))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchPath is a parsed PATCH path
+type patchPath struct {
+	attribute    string
+	filter       Filter // Selects elements of a multi-valued attribute; nil for none
+	subAttribute string
+}
+
+// parsePatchPath parses a PATCH path
+func parsePatchPath(path string) (patchPath, error) {
+	invalid := NewError(http.StatusBadRequest, ErrInvalidPath, fmt.Sprintf("invalid path %q", path))
+
+	open := strings.Index(path, "[")
+	if open < 0 {
+		attr, sub, _ := strings.Cut(attributeName(path), ".")
+		if attr == "" {
+			return patchPath{}, invalid
+		}
+		return patchPath{attribute: attr, subAttribute: sub}, nil
+	}
+
+	closing := strings.LastIndex(path, "]")
+	if closing < open {
+		return patchPath{}, invalid
+	}
+	attr := attributeName(path[:open])
+	rest := path[closing+1:]
+	if attr == "" || strings.Contains(attr, ".") || (rest != "" && !strings.HasPrefix(rest, ".")) {
+		return patchPath{}, invalid
+	}
+
+	filter, err := ParseFilter(path[open+1 : closing])
+	if err != nil {
+		return patchPath{}, NewError(http.StatusBadRequest, ErrInvalidPath, err.Error())
+	}
+	return patchPath{attribute: attr, filter: filter, subAttribute: strings.TrimPrefix(rest, ".")}, nil
+}
+
+func applyAdd(resource map[string]interface{}, operation PatchOperation) error {
+	if operation.Value == nil {
+		return NewError(http.StatusBadRequest, ErrInvalidValue, "add requires a value")
+	}
+	if operation.Path == "" {
+		values, ok := operation.Value.(map[string]interface{})
+		if !ok {
+			return NewError(http.StatusBadRequest, ErrInvalidValue, "add without a path requires an object value")
+		}
+		for name, value := range values {
+			addValue(resource, attributeName(name), value)
+		}
+		return nil
+	}
+
+	path, err := parsePatchPath(operation.Path)
+	if err != nil {
+		return err
+	}
+	if path.filter != nil {
+		return updateMatching(resource, path, func(element map[string]interface{}) {
+			if path.subAttribute != "" {
+				addValue(element, path.subAttribute, operation.Value)
+			} else if values, ok := operation.Value.(map[string]interface{}); ok {
+				for name, value := range values {
+					addValue(element, name, value)
+				}
+			}
+		})
+	}
+	if path.subAttribute != "" {
+		addValue(complexAttribute(resource, path.attribute), path.subAttribute, operation.Value)
+		return nil
+	}
+	addValue(resource, path.attribute, operation.Value)
+	return nil
+}
+
+func applyReplace(resource map[string]interface{}, operation PatchOperation) error {
+	if operation.Path == "" {
+		values, ok := operation.Value.(map[string]interface{})
+		if !ok {
+			return NewError(http.StatusBadRequest, ErrInvalidValue, "replace without a path requires an object value")
+		}
+		for name, value := range values {
+			path, err := parsePatchPath(name)
+			if err != nil {
+				return err
+			}
+			if path.subAttribute != "" {
+				setValue(complexAttribute(resource, path.attribute), path.subAttribute, value)
+			} else {
+				setValue(resource, path.attribute, value)
+			}
+		}
+		return nil
+	}
+
+	path, err := parsePatchPath(operation.Path)
+	if err != nil {
+		return err
+	}
+	if path.filter != nil {
+		key, _ := lookupKey(resource, path.attribute)
+		list, _ := resource[key].([]interface{})
+		matched := false
+		for i, value := range list {
+			element, ok := value.(map[string]interface{})
+			if !ok || !path.filter.Matches(element) {
+				continue
+			}
+			matched = true
+			if path.subAttribute != "" {
+				setValue(element, path.subAttribute, operation.Value)
+			} else {
+				list[i] = operation.Value
+			}
+		}
+		if !matched {
+			return NewError(http.StatusBadRequest, ErrNoTarget, fmt.Sprintf("no values match %q", operation.Path))
+		}
+		return nil
+	}
+	if path.subAttribute != "" {
+		setValue(complexAttribute(resource, path.attribute), path.subAttribute, operation.Value)
+		return nil
+	}
+	setValue(resource, path.attribute, operation.Value)
+	return nil
+}
+
+func applyRemove(resource map[string]interface{}, operation PatchOperation) error {
+	if operation.Path == "" {
+		return NewError(http.StatusBadRequest, ErrNoTarget, "remove requires a path")
+	}
+	path, err := parsePatchPath(operation.Path)
+	if err != nil {
+		return err
+	}
+	key, _ := lookupKey(resource, path.attribute)
+
+	if path.filter != nil {
+		list, _ := resource[key].([]interface{})
+		if path.subAttribute != "" {
+			return updateMatching(resource, path, func(element map[string]interface{}) {
+				subKey, _ := lookupKey(element, path.subAttribute)
+				delete(element, subKey)
+			})
+		}
+		remaining := make([]interface{}, 0, len(list))
+		for _, value := range list {
+			if element, ok := value.(map[string]interface{}); ok && path.filter.Matches(element) {
+				continue
+			}
+			remaining = append(remaining, value)
+		}
+		resource[key] = remaining
+		return nil
+	}
+
+	if path.subAttribute != "" {
+		if complexValue, ok := resource[key].(map[string]interface{}); ok {
+			subKey, _ := lookupKey(complexValue, path.subAttribute)
+			delete(complexValue, subKey)
+		}
+		return nil
+	}
+
+	// Some identity providers remove members by value instead of with a filter
+	if list, ok := resource[key].([]interface{}); ok && operation.Value != nil {
+		resource[key] = removeValues(list, operation.Value)
+		return nil
+	}
+	delete(resource, key)
+	return nil
+}
+
+// updateMatching calls update for the elements of a multi-valued attribute that match the path's filter,
+// failing with noTarget if none match
+func updateMatching(resource map[string]interface{}, path patchPath, update func(map[string]interface{})) error {
+	key, _ := lookupKey(resource, path.attribute)
+	list, _ := resource[key].([]interface{})
+	matched := false
+	for _, value := range list {
+		if element, ok := value.(map[string]interface{}); ok && path.filter.Matches(element) {
+			update(element)
+			matched = true
+		}
+	}
+	if !matched {
+		return NewError(http.StatusBadRequest, ErrNoTarget, fmt.Sprintf("no values match the filter on %q", path.attribute))
+	}
+	return nil
+}
+
+// complexAttribute returns the object value of an attribute, creating it if absent
+func complexAttribute(resource map[string]interface{}, name string) map[string]interface{} {
+	key, _ := lookupKey(resource, name)
+	if complexValue, ok := resource[key].(map[string]interface{}); ok {
+		return complexValue
+	}
+	complexValue := map[string]interface{}{}
+	resource[key] = complexValue
+	return complexValue
+}
+
+// setValue sets an attribute, keeping the existing spelling of its name
+func setValue(m map[string]interface{}, name string, value interface{}) {
+	key, _ := lookupKey(m, name)
+	m[key] = value
+}
+
+// addValue adds a value to an attribute: values are appended to multi-valued attributes, skipping
+// duplicates, objects are merged into complex attributes and other attributes are replaced
+func addValue(m map[string]interface{}, name string, value interface{}) {
+	key, exists := lookupKey(m, name)
+	if !exists || m[key] == nil {
+		m[key] = value
+		return
+	}
+
+	switch existing := m[key].(type) {
+	case []interface{}:
+		additions, ok := value.([]interface{})
+		if !ok {
+			additions = []interface{}{value}
+		}
+		for _, addition := range additions {
+			if !containsValue(existing, addition) {
+				existing = append(existing, addition)
+			}
+		}
+		m[key] = existing
+	case map[string]interface{}:
+		if values, ok := value.(map[string]interface{}); ok {
+			for subName, subValue := range values {
+				addValue(existing, subName, subValue)
+			}
+			return
+		}
+		m[key] = value
+	default:
+		m[key] = value
+	}
+}
+
+// containsValue reports whether a multi-valued attribute already holds a value, comparing elements by
+// their "value" sub-attribute when they have one
+func containsValue(list []interface{}, value interface{}) bool {
+	for _, element := range list {
+		if sameValue(element, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeValues returns the elements of a multi-valued attribute that do not match any of the given values
+func removeValues(list []interface{}, values interface{}) []interface{} {
+	removals, ok := values.([]interface{})
+	if !ok {
+		removals = []interface{}{values}
+	}
+	remaining := make([]interface{}, 0, len(list))
+	for _, element := range list {
+		if !containsValue(removals, element) {
+			remaining = append(remaining, element)
+		}
+	}
+	return remaining
+}
+
+// sameValue compares two elements of a multi-valued attribute
+func sameValue(a, b interface{}) bool {
+	aMap, aIsMap := a.(map[string]interface{})
+	bMap, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		aKey, aHas := lookupKey(aMap, "value")
+		bKey, bHas := lookupKey(bMap, "value")
+		if aHas && bHas {
+			return reflect.DeepEqual(aMap[aKey], bMap[bKey])
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,146 @@
+package scim
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testUser(t *testing.T) map[string]interface{} {
+	t.Helper()
+	active := Boolean(true)
+	user, err := ToMap(User{
+		Schemas:  []string{UserSchema},
+		UserName: "jane@example.com",
+		Name:     &Name{GivenName: "Jane", FamilyName: "Doe"},
+		Emails: []MultiValuedAttribute{
+			{Value: "jane@example.com", Type: "work", Primary: true},
+			{Value: "jane@home.example", Type: "home"},
+		},
+		Active: &active,
+	})
+	if err != nil {
+		t.Fatalf("Failed to convert user: %v", err)
+	}
+	return user
+}
+
+// TestApplyPatch tests add, replace and remove operations
+func TestApplyPatch(t *testing.T) {
+	user := testUser(t)
+	err := ApplyPatch(user, []PatchOperation{
+		{Op: "Replace", Path: "active", Value: "False"},
+		{Op: "replace", Path: "name.givenName", Value: "Janet"},
+		{Op: "replace", Path: `emails[type eq "work"].value`, Value: "janet@example.com"},
+		{Op: "add", Value: map[string]interface{}{"displayName": "Janet Doe"}},
+		{Op: "add", Path: "emails", Value: []interface{}{
+			map[string]interface{}{"value": "janet@example.com", "type": "work"},
+			map[string]interface{}{"value": "janet@other.example", "type": "other"},
+		}},
+		{Op: "remove", Path: `emails[type eq "home"]`},
+		{Op: "remove", Path: "urn:ietf:params:scim:schemas:core:2.0:User:name.familyName"},
+	})
+	if err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+
+	var patched User
+	if err := FromMap(user, &patched); err != nil {
+		t.Fatalf("FromMap failed: %v", err)
+	}
+	if patched.Active == nil || *patched.Active {
+		t.Error("Expected active to be false")
+	}
+	if patched.Name == nil || patched.Name.GivenName != "Janet" || patched.Name.FamilyName != "" {
+		t.Errorf("Unexpected name %+v", patched.Name)
+	}
+	if patched.DisplayName != "Janet Doe" {
+		t.Errorf("Expected display name Janet Doe, got %q", patched.DisplayName)
+	}
+	var emails []string
+	for _, email := range patched.Emails {
+		emails = append(emails, email.Value)
+	}
+	if expected := []string{"janet@example.com", "janet@other.example"}; !reflect.DeepEqual(emails, expected) {
+		t.Errorf("Expected emails %v, got %v", expected, emails)
+	}
+}
+
+// TestApplyPatchRemoveMembersByValue tests removing elements of a multi-valued attribute by value
+func TestApplyPatchRemoveMembersByValue(t *testing.T) {
+	group, err := ToMap(Group{
+		Schemas:     []string{GroupSchema},
+		DisplayName: "Engineering",
+		Members:     []MultiValuedAttribute{{Value: "1"}, {Value: "2"}, {Value: "3"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to convert group: %v", err)
+	}
+
+	err = ApplyPatch(group, []PatchOperation{
+		{Op: "remove", Path: "members", Value: []interface{}{map[string]interface{}{"value": "2"}}},
+		{Op: "remove", Path: `members[value eq "3"]`},
+	})
+	if err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+
+	var patched Group
+	if err := FromMap(group, &patched); err != nil {
+		t.Fatalf("FromMap failed: %v", err)
+	}
+	if len(patched.Members) != 1 || patched.Members[0].Value != "1" {
+		t.Errorf("Expected only member 1 to remain, got %+v", patched.Members)
+	}
+}
+
+// TestApplyPatchErrors tests the error types of invalid operations
+func TestApplyPatchErrors(t *testing.T) {
+	tests := []struct {
+		operation PatchOperation
+		scimType  string
+	}{
+		{PatchOperation{Op: "move", Path: "userName"}, ErrInvalidSyntax},
+		{PatchOperation{Op: "remove"}, ErrNoTarget},
+		{PatchOperation{Op: "replace", Path: `emails[type eq "missing"].value`, Value: "x"}, ErrNoTarget},
+		{PatchOperation{Op: "replace", Path: `emails[type eq`, Value: "x"}, ErrInvalidPath},
+		{PatchOperation{Op: "replace", Path: `emails[type eq "work"]value`, Value: "x"}, ErrInvalidPath},
+		{PatchOperation{Op: "add", Path: "displayName"}, ErrInvalidValue},
+		{PatchOperation{Op: "replace", Value: "not an object"}, ErrInvalidValue},
+	}
+
+	for _, tt := range tests {
+		err := ApplyPatch(testUser(t), []PatchOperation{tt.operation})
+		var scimErr *Error
+		if !errors.As(err, &scimErr) || scimErr.ScimType != tt.scimType {
+			t.Errorf("%+v returned %v; expected %s", tt.operation, err, tt.scimType)
+		}
+	}
+}
+
+// TestPaginate tests startIndex and count handling
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		startIndex, count       string
+		start, end, resultIndex int
+	}{
+		{"", "", 0, 10, 1},
+		{"3", "4", 2, 6, 3},
+		{"0", "2", 0, 2, 1},
+		{"9", "", 8, 10, 9},
+		{"20", "5", 10, 10, 20},
+		{"1", "-1", 0, 0, 1},
+		{"1", "500", 0, 10, 1},
+	}
+
+	for _, tt := range tests {
+		start, end, startIndex, err := Paginate(10, tt.startIndex, tt.count, 100)
+		if err != nil || start != tt.start || end != tt.end || startIndex != tt.resultIndex {
+			t.Errorf("Paginate(10, %q, %q) = %d, %d, %d, %v", tt.startIndex, tt.count, start, end, startIndex, err)
+		}
+	}
+
+	if _, _, _, err := Paginate(10, "abc", "", 100); err == nil {
+		t.Error("Expected an error for a non-integer startIndex")
+	}
+}
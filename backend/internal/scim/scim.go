@@ -0,0 +1,277 @@
+// Package scim implements the protocol parts of SCIM 2.0 (RFC 7643 and RFC 7644): resource and message
+// types, filter expressions and PATCH operations. Filters and patches work on the JSON form of a resource,
+// so they apply to any resource type.
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Schema URNs
+const (
+	UserSchema                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupSchema                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ListResponseSchema          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ResourceTypeSchema          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// ContentType is the media type of SCIM requests and responses
+const ContentType = "application/scim+json"
+
+// Error types (scimType) defined by RFC 7644 section 3.12
+const (
+	ErrInvalidFilter = "invalidFilter"
+	ErrTooMany       = "tooMany"
+	ErrUniqueness    = "uniqueness"
+	ErrMutability    = "mutability"
+	ErrInvalidSyntax = "invalidSyntax"
+	ErrInvalidPath   = "invalidPath"
+	ErrNoTarget      = "noTarget"
+	ErrInvalidValue  = "invalidValue"
+)
+
+// Error is a SCIM error response
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// NewError creates an error response with the given HTTP status
+func NewError(status int, scimType, detail string) *Error {
+	return &Error{Schemas: []string{ErrorSchema}, Status: strconv.Itoa(status), ScimType: scimType, Detail: detail}
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	if e.ScimType != "" {
+		return fmt.Sprintf("scim: %s: %s", e.ScimType, e.Detail)
+	}
+	return "scim: " + e.Detail
+}
+
+// HTTPStatus returns the error's HTTP status code
+func (e *Error) HTTPStatus() int {
+	status, err := strconv.Atoi(e.Status)
+	if err != nil {
+		return http.StatusBadRequest
+	}
+	return status
+}
+
+// Meta holds a resource's metadata
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+// Boolean is a boolean that also accepts the strings "true" and "false", which some identity providers send
+type Boolean bool
+
+// UnmarshalJSON implements json.Unmarshaler
+func (b *Boolean) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case bool:
+		*b = Boolean(v)
+	case string:
+		parsed, err := strconv.ParseBool(strings.ToLower(v))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		*b = Boolean(parsed)
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+// Name is the components of a user's name
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// MultiValuedAttribute is an element of a multi-valued attribute such as emails
+type MultiValuedAttribute struct {
+	Value   string  `json:"value"`
+	Display string  `json:"display,omitempty"`
+	Type    string  `json:"type,omitempty"`
+	Primary Boolean `json:"primary,omitempty"`
+	Ref     string  `json:"$ref,omitempty"`
+}
+
+// User is the core User resource
+type User struct {
+	Schemas     []string               `json:"schemas"`
+	ID          string                 `json:"id,omitempty"`
+	ExternalID  string                 `json:"externalId,omitempty"`
+	UserName    string                 `json:"userName"`
+	Name        *Name                  `json:"name,omitempty"`
+	DisplayName string                 `json:"displayName,omitempty"`
+	Emails      []MultiValuedAttribute `json:"emails,omitempty"`
+	Active      *Boolean               `json:"active,omitempty"`
+	Groups      []MultiValuedAttribute `json:"groups,omitempty"` // Read-only
+	Meta        *Meta                  `json:"meta,omitempty"`
+}
+
+// Group is the core Group resource
+type Group struct {
+	Schemas     []string               `json:"schemas"`
+	ID          string                 `json:"id,omitempty"`
+	ExternalID  string                 `json:"externalId,omitempty"`
+	DisplayName string                 `json:"displayName"`
+	Members     []MultiValuedAttribute `json:"members,omitempty"`
+	Meta        *Meta                  `json:"meta,omitempty"`
+}
+
+// ListResponse is the response to a query
+type ListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// PatchRequest is the body of a PATCH request
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is a single add, replace or remove operation
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// ToMap returns the JSON object form of a resource, which filters and patches operate on
+func ToMap(resource interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FromMap decodes the JSON object form of a resource into a resource type
+func FromMap(m map[string]interface{}, resource interface{}) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, resource); err != nil {
+		return NewError(http.StatusBadRequest, ErrInvalidValue, err.Error())
+	}
+	return nil
+}
+
+// Paginate returns the page of n results selected by the startIndex and count query parameters. startIndex
+// is 1-based; values below 1 mean 1. Negative counts mean 0 and counts above maxCount are capped.
+func Paginate(n int, startIndexParam, countParam string, maxCount int) (start, end, startIndex int, err error) {
+	startIndex = 1
+	if startIndexParam != "" {
+		if startIndex, err = strconv.Atoi(startIndexParam); err != nil {
+			return 0, 0, 0, NewError(http.StatusBadRequest, ErrInvalidValue, "startIndex must be an integer")
+		}
+		if startIndex < 1 {
+			startIndex = 1
+		}
+	}
+
+	count := maxCount
+	if countParam != "" {
+		if count, err = strconv.Atoi(countParam); err != nil {
+			return 0, 0, 0, NewError(http.StatusBadRequest, ErrInvalidValue, "count must be an integer")
+		}
+		if count < 0 {
+			count = 0
+		}
+		if count > maxCount {
+			count = maxCount
+		}
+	}
+
+	start = startIndex - 1
+	if start > n {
+		start = n
+	}
+	end = start + count
+	if end > n {
+		end = n
+	}
+	return start, end, startIndex, nil
+}
+
+// SelectAttributes applies the attributes and excludedAttributes query parameters (RFC 7644 section 3.4.2.5)
+// to the JSON form of a resource. Both are comma-separated lists of top-level attribute names; "id" and
+// "schemas" are always returned.
+func SelectAttributes(resource map[string]interface{}, attributes, excludedAttributes string) {
+	alwaysReturned := func(key string) bool {
+		return strings.EqualFold(key, "id") || strings.EqualFold(key, "schemas")
+	}
+
+	if attributes != "" {
+		keep := map[string]bool{}
+		for _, name := range strings.Split(attributes, ",") {
+			attr, _, _ := strings.Cut(attributeName(strings.TrimSpace(name)), ".")
+			keep[strings.ToLower(attr)] = true
+		}
+		for key := range resource {
+			if !keep[strings.ToLower(key)] && !alwaysReturned(key) {
+				delete(resource, key)
+			}
+		}
+	}
+
+	for _, name := range strings.Split(excludedAttributes, ",") {
+		attr := attributeName(strings.TrimSpace(name))
+		if key, ok := lookupKey(resource, attr); ok && !alwaysReturned(key) {
+			delete(resource, key)
+		}
+	}
+}
+
+// attributeName strips the schema URN from a fully qualified attribute name, such as
+// "urn:ietf:params:scim:schemas:core:2.0:User:name.givenName"
+func attributeName(path string) string {
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		if i := strings.LastIndex(path, ":"); i >= 0 {
+			return path[i+1:]
+		}
+	}
+	return path
+}
+
+// lookupKey returns the key of m matching name case-insensitively, as attribute names are case-insensitive
+func lookupKey(m map[string]interface{}, name string) (string, bool) {
+	if _, ok := m[name]; ok {
+		return name, true
+	}
+	for key := range m {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return name, false
+}
@@ -2,55 +2,85 @@ package utils
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"regexp"
 	"strings"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword hashes a password using bcrypt
+// HashPassword hashes a password with the configured password hasher
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+	return getPasswordHasher().Hash(password)
 }
 
-// CheckPasswordHash compares a password with its hash
+// CheckPasswordHash compares a password with its hash, whichever supported algorithm produced the hash
 func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	for _, verifier := range passwordVerifiers {
+		if verifier.Identifies(hash) {
+			return verifier.Verify(password, hash)
+		}
+	}
+	return false
+}
+
+// PasswordPolicy describes the rules a new password must satisfy
+type PasswordPolicy struct {
+	MinLength        int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
 }
 
-// ValidateEmail validates email format using regex
-func ValidateEmail(email string) bool {
-	// Basic email validation regex
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	return emailRegex.MatchString(email)
+// DefaultPasswordPolicy is the baseline every password must satisfy
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:        8,
+	RequireUppercase: true,
+	RequireLowercase: true,
+	RequireDigit:     true,
 }
 
-// ValidatePassword validates password security criteria
-func ValidatePassword(password string) error {
-	if len(password) < 8 {
-		return errors.New("password must be at least 8 characters long")
+var (
+	uppercaseRegex = regexp.MustCompile(`[A-Z]`)
+	lowercaseRegex = regexp.MustCompile(`[a-z]`)
+	digitRegex     = regexp.MustCompile(`[0-9]`)
+	symbolRegex    = regexp.MustCompile(`[^A-Za-z0-9]`)
+)
+
+// Merge returns the strictest combination of both policies
+func (p PasswordPolicy) Merge(other PasswordPolicy) PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:        max(p.MinLength, other.MinLength),
+		RequireUppercase: p.RequireUppercase || other.RequireUppercase,
+		RequireLowercase: p.RequireLowercase || other.RequireLowercase,
+		RequireDigit:     p.RequireDigit || other.RequireDigit,
+		RequireSymbol:    p.RequireSymbol || other.RequireSymbol,
 	}
+}
 
-	// Check for at least one uppercase letter
-	hasUpper := regexp.MustCompile(`[A-Z]`).MatchString(password)
-	if !hasUpper {
+// ValidatePassword validates a password against the policy, common weak passwords and the breached
+// password blocklist
+func ValidatePassword(password string, policy PasswordPolicy) error {
+	if len(password) < policy.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", policy.MinLength)
+	}
+
+	if policy.RequireUppercase && !uppercaseRegex.MatchString(password) {
 		return errors.New("password must contain at least one uppercase letter")
 	}
 
-	// Check for at least one lowercase letter
-	hasLower := regexp.MustCompile(`[a-z]`).MatchString(password)
-	if !hasLower {
+	if policy.RequireLowercase && !lowercaseRegex.MatchString(password) {
 		return errors.New("password must contain at least one lowercase letter")
 	}
 
-	// Check for at least one digit
-	hasDigit := regexp.MustCompile(`[0-9]`).MatchString(password)
-	if !hasDigit {
+	if policy.RequireDigit && !digitRegex.MatchString(password) {
 		return errors.New("password must contain at least one digit")
 	}
 
+	if policy.RequireSymbol && !symbolRegex.MatchString(password) {
+		return errors.New("password must contain at least one symbol")
+	}
+
 	// Check for common weak patterns
 	if strings.ToLower(password) == "password" ||
 		strings.ToLower(password) == "12345678" ||
@@ -58,5 +88,12 @@ func ValidatePassword(password string) error {
 		return errors.New("password is too common and weak")
 	}
 
+	// Check the breached password blocklist; a blocklist that cannot be read does not block sign-ups
+	if err := CheckPasswordBlocklist(password); err == ErrBreachedPassword {
+		return err
+	} else if err != nil {
+		log.Printf("Skipping breached password check: %v", err)
+	}
+
 	return nil
 }
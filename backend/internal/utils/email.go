@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrInvalidEmail is returned for strings that are not a usable email address
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// EmailLocalPartPolicy decides which local parts (the part before the @) identify the same mailbox
+type EmailLocalPartPolicy string
+
+const (
+	// EmailLocalPartCaseSensitive compares local parts exactly, as RFC 5321 permits mail servers to
+	EmailLocalPartCaseSensitive EmailLocalPartPolicy = "case_sensitive"
+	// EmailLocalPartCaseInsensitive compares local parts ignoring case, as practically every mail server does
+	EmailLocalPartCaseInsensitive EmailLocalPartPolicy = "case_insensitive"
+	// EmailLocalPartIgnoreSubaddress also ignores a "+tag" suffix, so user+tag@ is the same mailbox as user@
+	EmailLocalPartIgnoreSubaddress EmailLocalPartPolicy = "ignore_subaddress"
+)
+
+const (
+	maxEmailLength     = 254
+	maxLocalPartLength = 64
+	maxDomainLength    = 253
+	maxLabelLength     = 63
+)
+
+var (
+	emailPolicyMu         sync.RWMutex
+	emailLocalPartPolicy  = EmailLocalPartCaseInsensitive
+	emailSpecialCharacter = "!#$%&'*+-/=?^_`{|}~"
+)
+
+// InitializeEmailNormalization selects how local parts are compared from EMAIL_LOCAL_PART_POLICY
+// ("case_insensitive", "case_sensitive" or "ignore_subaddress")
+func InitializeEmailNormalization() error {
+	switch policy := EmailLocalPartPolicy(os.Getenv("EMAIL_LOCAL_PART_POLICY")); policy {
+	case "":
+		SetEmailLocalPartPolicy(EmailLocalPartCaseInsensitive)
+	case EmailLocalPartCaseSensitive, EmailLocalPartCaseInsensitive, EmailLocalPartIgnoreSubaddress:
+		SetEmailLocalPartPolicy(policy)
+	default:
+		return fmt.Errorf("unknown EMAIL_LOCAL_PART_POLICY %q", policy)
+	}
+	return nil
+}
+
+// SetEmailLocalPartPolicy replaces the policy used by NormalizeEmail
+func SetEmailLocalPartPolicy(policy EmailLocalPartPolicy) {
+	emailPolicyMu.Lock()
+	defer emailPolicyMu.Unlock()
+	emailLocalPartPolicy = policy
+}
+
+func getEmailLocalPartPolicy() EmailLocalPartPolicy {
+	emailPolicyMu.RLock()
+	defer emailPolicyMu.RUnlock()
+	return emailLocalPartPolicy
+}
+
+// ValidateEmail reports whether the string is a usable email address. Internationalized addresses are accepted.
+func ValidateEmail(email string) bool {
+	_, err := CanonicalizeEmail(email)
+	return err == nil
+}
+
+// CanonicalizeEmail returns the form of an email address to store and send mail to: surrounding space is
+// trimmed, the local part is NFC-normalized but otherwise kept as entered, and the domain is lowercased and,
+// if internationalized, converted to its ASCII (punycode) form
+func CanonicalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return "", ErrInvalidEmail
+	}
+
+	local := norm.NFC.String(email[:at])
+	if !validLocalPart(local) {
+		return "", ErrInvalidEmail
+	}
+	domain, err := canonicalDomain(email[at+1:])
+	if err != nil {
+		return "", err
+	}
+
+	canonical := local + "@" + domain
+	if len(canonical) > maxEmailLength {
+		return "", ErrInvalidEmail
+	}
+	return canonical, nil
+}
+
+// NormalizeEmail returns the form of an email address that accounts are told apart by: the canonical address
+// with its local part folded according to the configured local-part policy
+func NormalizeEmail(email string) (string, error) {
+	canonical, err := CanonicalizeEmail(email)
+	if err != nil {
+		return "", err
+	}
+
+	at := strings.LastIndex(canonical, "@")
+	local, domain := canonical[:at], canonical[at:]
+	switch getEmailLocalPartPolicy() {
+	case EmailLocalPartCaseInsensitive:
+		local = strings.ToLower(local)
+	case EmailLocalPartIgnoreSubaddress:
+		local = strings.ToLower(local)
+		if plus := strings.Index(local, "+"); plus > 0 {
+			local = local[:plus]
+		}
+	}
+	return local + domain, nil
+}
+
+// EmailKey returns the normalized form of an email address for storing and looking up accounts. Strings that
+// are not valid addresses, such as ones stored before validation was stricter, are trimmed and lowercased
+// instead, so they still match themselves.
+func EmailKey(email string) string {
+	if normalized, err := NormalizeEmail(email); err == nil {
+		return normalized
+	}
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validLocalPart checks a dot-atom local part, allowing UTF-8 as RFC 6531 does. Quoted local parts are not
+// supported.
+func validLocalPart(local string) bool {
+	if local == "" || len(local) > maxLocalPartLength {
+		return false
+	}
+	for _, atom := range strings.Split(local, ".") {
+		if atom == "" {
+			return false
+		}
+		for _, r := range atom {
+			isASCIIAlphanumeric := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+			if !isASCIIAlphanumeric && !strings.ContainsRune(emailSpecialCharacter, r) && (r < 0x80 || r == 0xFFFD) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// canonicalDomain converts a domain to lowercase ASCII with IDNA, requiring a hostname with at least two labels
+func canonicalDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(domain, ".")
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil || ascii == "" || len(ascii) > maxDomainLength {
+		return "", ErrInvalidEmail
+	}
+
+	labels := strings.Split(ascii, ".")
+	if len(labels) < 2 {
+		return "", ErrInvalidEmail
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > maxLabelLength || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", ErrInvalidEmail
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') && r != '-' {
+				return "", ErrInvalidEmail
+			}
+		}
+	}
+	if strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		return "", ErrInvalidEmail
+	}
+	return ascii, nil
+}
@@ -0,0 +1,73 @@
+package utils
+
+import "testing"
+
+// TestCanonicalizeEmail tests which addresses are accepted and the form they are stored in
+func TestCanonicalizeEmail(t *testing.T) {
+	valid := map[string]string{
+		"user@example.com":          "user@example.com",
+		"  Alice@Example.COM ":      "Alice@example.com",
+		"first.last+tag@mail.co.uk": "first.last+tag@mail.co.uk",
+		"user@example.com.":         "user@example.com",
+		"josé@bücher.de":            "josé@xn--bcher-kva.de",
+		"user@xn--bcher-kva.de":     "user@xn--bcher-kva.de",
+		"o'brien@example.org":       "o'brien@example.org",
+	}
+	for input, expected := range valid {
+		canonical, err := CanonicalizeEmail(input)
+		if err != nil || canonical != expected {
+			t.Errorf("CanonicalizeEmail(%q) = %q, %v, expected %q", input, canonical, err, expected)
+		}
+	}
+
+	invalid := []string{
+		"", "invalid-email", "@example.com", "user@", "user.example.com", "user@.com", "user@com",
+		"user name@example.com", "user@exam ple.com", ".user@example.com", "us..er@example.com",
+		"\"quoted\"@example.com", "user@example.123", "user@-example.com",
+	}
+	for _, input := range invalid {
+		if canonical, err := CanonicalizeEmail(input); err == nil {
+			t.Errorf("Expected CanonicalizeEmail(%q) to fail, got %q", input, canonical)
+		}
+	}
+}
+
+// TestNormalizeEmailPolicies tests how each local-part policy folds addresses
+func TestNormalizeEmailPolicies(t *testing.T) {
+	t.Cleanup(func() { SetEmailLocalPartPolicy(EmailLocalPartCaseInsensitive) })
+
+	cases := []struct {
+		policy   EmailLocalPartPolicy
+		expected string
+	}{
+		{EmailLocalPartCaseSensitive, "Alice+News@example.com"},
+		{EmailLocalPartCaseInsensitive, "alice+news@example.com"},
+		{EmailLocalPartIgnoreSubaddress, "alice@example.com"},
+	}
+	for _, c := range cases {
+		SetEmailLocalPartPolicy(c.policy)
+		if normalized, err := NormalizeEmail(" Alice+News@EXAMPLE.com"); err != nil || normalized != c.expected {
+			t.Errorf("Policy %s: expected %q, got %q, %v", c.policy, c.expected, normalized, err)
+		}
+	}
+
+	// A local part that is only a tag is kept whole rather than emptied
+	if normalized, _ := NormalizeEmail("+tag@example.com"); normalized != "+tag@example.com" {
+		t.Errorf("Expected tag-only local part to be kept, got %q", normalized)
+	}
+
+	t.Setenv("EMAIL_LOCAL_PART_POLICY", "fuzzy")
+	if err := InitializeEmailNormalization(); err == nil {
+		t.Error("Expected unknown policy to be rejected")
+	}
+}
+
+// TestEmailKey tests that invalid stored addresses still produce a stable key
+func TestEmailKey(t *testing.T) {
+	if key := EmailKey("Alice@Bücher.de"); key != "alice@xn--bcher-kva.de" {
+		t.Errorf("Unexpected key for valid address: %q", key)
+	}
+	if key := EmailKey(" Legacy@Localhost "); key != "legacy@localhost" {
+		t.Errorf("Unexpected key for invalid address: %q", key)
+	}
+}
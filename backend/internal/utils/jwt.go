@@ -2,16 +2,25 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	// AccessTokenTTL is the lifetime of an access token
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is the lifetime of a refresh token
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
 // Claims represents the JWT claims
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID uint   `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -20,18 +29,19 @@ func GetJWTSecret() string {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
 		// Default secret for development - should be set via environment in production
-		secret = "tmember-dev-secret-key-change-in-production"
+		secret = defaultJWTSecret
 	}
 	return secret
 }
 
-// GenerateJWT generates a JWT token for a user
-func GenerateJWT(userID uint, email string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour) // Token expires in 24 hours
+// GenerateJWT generates a short-lived access token for a user bound to a session
+func GenerateJWT(userID uint, email string, sessionID uint) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL)
 
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -39,6 +49,13 @@ func GenerateJWT(userID uint, email string) (string, error) {
 		},
 	}
 
+	// Sign with the current asymmetric key if one is configured, otherwise with the shared secret
+	if key := getJWTKeySet().Signing; key != nil {
+		token := jwt.NewWithClaims(key.Method, claims)
+		token.Header["kid"] = key.ID
+		return token.SignedString(key.Private)
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(GetJWTSecret()))
 }
@@ -47,9 +64,7 @@ func GenerateJWT(userID uint, email string) (string, error) {
 func ValidateJWT(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(GetJWTSecret()), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, jwtVerificationKey)
 
 	if err != nil {
 		return nil, err
@@ -61,3 +76,26 @@ func ValidateJWT(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// jwtVerificationKey selects the key for a token by its "kid" header, making sure the token's algorithm
+// matches the key. Once asymmetric keys are configured, HS256 tokens are no longer accepted.
+func jwtVerificationKey(token *jwt.Token) (interface{}, error) {
+	keySet := getJWTKeySet()
+
+	if keySet.Signing == nil && len(keySet.Verification) == 0 {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return []byte(GetJWTSecret()), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := keySet.Verification[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.Public, nil
+}
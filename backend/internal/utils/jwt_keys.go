@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultJWTSecret is the development-only HS256 secret used when nothing else is configured
+const defaultJWTSecret = "tmember-dev-secret-key-change-in-production"
+
+// JWTKey is an asymmetric key used to sign or verify access tokens
+type JWTKey struct {
+	ID      string            // The "kid" header value, the RFC 7638 thumbprint of the public key
+	Method  jwt.SigningMethod // RS256 for RSA keys, EdDSA for Ed25519 keys
+	Public  crypto.PublicKey
+	Private crypto.Signer // Nil for verification-only keys
+}
+
+// JWTKeySet holds the key used to sign new access tokens and every key still accepted for verification.
+// A set without a signing key falls back to HS256 with the shared JWT secret.
+type JWTKeySet struct {
+	Signing      *JWTKey
+	Verification map[string]*JWTKey
+}
+
+// JSONWebKey represents a public key in JWKS format (RFC 7517)
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // OKP curve
+	X         string `json:"x,omitempty"`   // OKP public key
+}
+
+// JSONWebKeySet represents the document published at /.well-known/jwks.json
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+var (
+	jwtKeys   *JWTKeySet
+	jwtKeysMu sync.RWMutex
+)
+
+// InitializeJWTKeys loads the signing key from JWT_SIGNING_KEY_FILE and any keys that are being rotated out
+// from the comma-separated JWT_VERIFICATION_KEY_FILES. In production it refuses to fall back to the
+// default HS256 secret.
+func InitializeJWTKeys(production bool) error {
+	keySet, err := LoadJWTKeySet(os.Getenv("JWT_SIGNING_KEY_FILE"), splitList(os.Getenv("JWT_VERIFICATION_KEY_FILES")))
+	if err != nil {
+		return err
+	}
+
+	if keySet.Signing == nil && production && GetJWTSecret() == defaultJWTSecret {
+		return errors.New("refusing to start in production with the default JWT secret; set JWT_SIGNING_KEY_FILE or JWT_SECRET")
+	}
+
+	SetJWTKeySet(keySet)
+	return nil
+}
+
+// LoadJWTKeySet builds a key set from PEM files. The signing key must be a private key; verification keys
+// may be public or private keys.
+func LoadJWTKeySet(signingKeyFile string, verificationKeyFiles []string) (*JWTKeySet, error) {
+	keySet := &JWTKeySet{Verification: map[string]*JWTKey{}}
+
+	if signingKeyFile != "" {
+		key, err := loadJWTKeyFile(signingKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if key.Private == nil {
+			return nil, fmt.Errorf("JWT signing key %s is not a private key", signingKeyFile)
+		}
+		keySet.Signing = key
+		keySet.Verification[key.ID] = key
+	}
+
+	if keySet.Signing == nil && len(verificationKeyFiles) > 0 {
+		return nil, errors.New("JWT verification keys require a JWT signing key")
+	}
+
+	for _, file := range verificationKeyFiles {
+		key, err := loadJWTKeyFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := keySet.Verification[key.ID]; !exists {
+			key.Private = nil
+			keySet.Verification[key.ID] = key
+		}
+	}
+
+	return keySet, nil
+}
+
+// SetJWTKeySet replaces the key set used to sign and verify access tokens
+func SetJWTKeySet(keySet *JWTKeySet) {
+	jwtKeysMu.Lock()
+	defer jwtKeysMu.Unlock()
+	jwtKeys = keySet
+}
+
+// getJWTKeySet returns the configured key set, or an HS256-only set if keys were never initialized
+func getJWTKeySet() *JWTKeySet {
+	jwtKeysMu.RLock()
+	defer jwtKeysMu.RUnlock()
+	if jwtKeys == nil {
+		return &JWTKeySet{}
+	}
+	return jwtKeys
+}
+
+// NewJWTKey wraps a private or public RSA or Ed25519 key
+func NewJWTKey(key interface{}) (*JWTKey, error) {
+	jwtKey := &JWTKey{}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		jwtKey.Method, jwtKey.Public, jwtKey.Private = jwt.SigningMethodRS256, &k.PublicKey, k
+	case *rsa.PublicKey:
+		jwtKey.Method, jwtKey.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		jwtKey.Method, jwtKey.Public, jwtKey.Private = jwt.SigningMethodEdDSA, k.Public(), k
+	case ed25519.PublicKey:
+		jwtKey.Method, jwtKey.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported JWT key type %T; use RSA or Ed25519", key)
+	}
+
+	jwk := jwtKey.JSONWebKey()
+	jwtKey.ID = jwk.KeyID
+	return jwtKey, nil
+}
+
+// JSONWebKey returns the public half of the key in JWKS format
+func (k *JWTKey) JSONWebKey() JSONWebKey {
+	var jwk JSONWebKey
+	var thumbprintInput string
+
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk = JSONWebKey{
+			KeyType: "RSA",
+			N:       base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+		thumbprintInput = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case ed25519.PublicKey:
+		jwk = JSONWebKey{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       base64.RawURLEncoding.EncodeToString(pub),
+		}
+		thumbprintInput = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":%q}`, jwk.X)
+	}
+
+	// The key ID is the RFC 7638 thumbprint, so it is stable across restarts and hosts
+	thumbprint := sha256.Sum256([]byte(thumbprintInput))
+	jwk.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+	jwk.Use = "sig"
+	jwk.Algorithm = k.Method.Alg()
+	return jwk
+}
+
+// JWKS returns the public verification keys for publishing. HS256 secrets are never published.
+func JWKS() JSONWebKeySet {
+	keySet := getJWTKeySet()
+
+	jwks := JSONWebKeySet{Keys: []JSONWebKey{}}
+	if keySet.Signing != nil {
+		jwks.Keys = append(jwks.Keys, keySet.Signing.JSONWebKey())
+	}
+	for id, key := range keySet.Verification {
+		if keySet.Signing != nil && id == keySet.Signing.ID {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, key.JSONWebKey())
+	}
+	return jwks
+}
+
+// loadJWTKeyFile reads a PEM-encoded RSA or Ed25519 key
+func loadJWTKeyFile(path string) (*JWTKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in JWT key file %s", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in JWT key file %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT key file %s: %w", path, err)
+	}
+
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA JWT key %s must be at least 2048 bits", path)
+	}
+
+	return NewJWTKey(key)
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKeyFile writes a private key as PKCS#8 PEM into a temporary directory and returns its path
+func writeKeyFile(t *testing.T, name string, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return path
+}
+
+// useJWTKeySet installs a key set for the duration of a test
+func useJWTKeySet(t *testing.T, keySet *JWTKeySet) {
+	SetJWTKeySet(keySet)
+	t.Cleanup(func() { SetJWTKeySet(nil) })
+}
+
+// TestAsymmetricJWTRotation tests signing with RS256 and EdDSA keys and verifying across a key rotation
+func TestAsymmetricJWTRotation(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaFile := writeKeyFile(t, "rsa.pem", rsaKey)
+	edFile := writeKeyFile(t, "ed25519.pem", edKey)
+
+	// Sign with the RSA key first
+	oldKeys, err := LoadJWTKeySet(rsaFile, nil)
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	useJWTKeySet(t, oldKeys)
+
+	oldToken, err := GenerateJWT(1, "rotate@example.com", 7)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	parsed, _, _ := jwt.NewParser().ParseUnverified(oldToken, &Claims{})
+	if parsed.Method.Alg() != "RS256" || parsed.Header["kid"] != oldKeys.Signing.ID {
+		t.Errorf("Expected RS256 token with kid %s, got %s %v", oldKeys.Signing.ID, parsed.Method.Alg(), parsed.Header["kid"])
+	}
+
+	// Rotate to the Ed25519 key while the RSA key remains valid for verification
+	newKeys, err := LoadJWTKeySet(edFile, []string{rsaFile})
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	useJWTKeySet(t, newKeys)
+
+	newToken, _ := GenerateJWT(1, "rotate@example.com", 7)
+	for _, token := range []string{oldToken, newToken} {
+		claims, err := ValidateJWT(token)
+		if err != nil {
+			t.Fatalf("Failed to validate token during rotation: %v", err)
+		}
+		if claims.SessionID != 7 {
+			t.Errorf("Expected session 7, got %d", claims.SessionID)
+		}
+	}
+
+	jwks := JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].KeyID != newKeys.Signing.ID || jwks.Keys[0].Algorithm != "EdDSA" {
+		t.Errorf("Expected the signing key first among 2 published keys, got %+v", jwks.Keys)
+	}
+	for _, key := range jwks.Keys {
+		if key.KeyType == "RSA" && (key.N == "" || key.E != "AQAB") {
+			t.Errorf("Unexpected RSA JWK: %+v", key)
+		}
+	}
+
+	// Once the RSA key is retired, its tokens are rejected
+	retired, _ := LoadJWTKeySet(edFile, nil)
+	useJWTKeySet(t, retired)
+	if _, err := ValidateJWT(oldToken); err == nil {
+		t.Error("Expected token signed by a retired key to be rejected")
+	}
+}
+
+// TestAsymmetricJWTRejectsSharedSecret tests that HS256 tokens stop working once asymmetric keys are configured
+func TestAsymmetricJWTRejectsSharedSecret(t *testing.T) {
+	hsToken, _ := GenerateJWT(1, "legacy@example.com", 0)
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	keys, _ := LoadJWTKeySet(writeKeyFile(t, "ed25519.pem", edKey), nil)
+	useJWTKeySet(t, keys)
+
+	if _, err := ValidateJWT(hsToken); err == nil {
+		t.Error("Expected HS256 token to be rejected")
+	}
+
+	// A token claiming the signing key's kid but signed with the public key as an HMAC secret is rejected
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: 1})
+	forged.Header["kid"] = keys.Signing.ID
+	forgedString, _ := forged.SignedString([]byte(keys.Signing.Public.(ed25519.PublicKey)))
+	if _, err := ValidateJWT(forgedString); err == nil {
+		t.Error("Expected algorithm confusion token to be rejected")
+	}
+}
+
+// TestInitializeJWTKeysProduction tests that production refuses the default secret
+func TestInitializeJWTKeysProduction(t *testing.T) {
+	t.Cleanup(func() { SetJWTKeySet(nil) })
+	t.Setenv("JWT_SIGNING_KEY_FILE", "")
+	t.Setenv("JWT_VERIFICATION_KEY_FILES", "")
+	t.Setenv("JWT_SECRET", "")
+
+	if err := InitializeJWTKeys(true); err == nil {
+		t.Error("Expected production to refuse the default secret")
+	}
+	if err := InitializeJWTKeys(false); err != nil {
+		t.Errorf("Expected development to allow the default secret: %v", err)
+	}
+
+	t.Setenv("JWT_SECRET", "a-real-production-secret")
+	if err := InitializeJWTKeys(true); err != nil {
+		t.Errorf("Expected production to accept a configured secret: %v", err)
+	}
+}
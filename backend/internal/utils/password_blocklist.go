@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// bloomFilterMagic starts every password blocklist bloom filter file
+const bloomFilterMagic = "TMBLOOM1"
+
+// ErrBreachedPassword is returned for passwords found in the breached password blocklist
+var ErrBreachedPassword = errors.New("password has appeared in a known data breach; please choose a different password")
+
+// PasswordBlocklist reports whether a password is known to be compromised. Implementations are keyed by the
+// SHA-1 hash of the password, like the Pwned Passwords dataset, so no plaintext passwords are stored.
+type PasswordBlocklist interface {
+	Contains(password string) (bool, error)
+}
+
+// HashPrefixBlocklist looks passwords up in a directory of Pwned Passwords range files. Each file is named
+// after the first five hex digits of the SHA-1 hash (e.g. "5BAA6.txt") and holds "SUFFIX:COUNT" lines.
+type HashPrefixBlocklist struct {
+	Dir string
+}
+
+// BloomFilter is a probabilistic set of SHA-1 password hashes. It never misses a blocked password but
+// may reject a small fraction of unlisted ones.
+type BloomFilter struct {
+	hashes uint32
+	bits   uint64
+	data   []byte
+}
+
+var (
+	passwordBlocklist   PasswordBlocklist
+	passwordBlocklistMu sync.RWMutex
+)
+
+// InitializePasswordBlocklist loads the breached password blocklist from PASSWORD_BLOCKLIST_DIR (a directory
+// of SHA-1 prefix files) or PASSWORD_BLOCKLIST_BLOOM_FILE (a bloom filter built with the admin tool).
+// Without either, only the built-in weak password rules apply.
+func InitializePasswordBlocklist() error {
+	dir := os.Getenv("PASSWORD_BLOCKLIST_DIR")
+	bloomFile := os.Getenv("PASSWORD_BLOCKLIST_BLOOM_FILE")
+
+	switch {
+	case dir != "" && bloomFile != "":
+		return errors.New("set only one of PASSWORD_BLOCKLIST_DIR and PASSWORD_BLOCKLIST_BLOOM_FILE")
+	case dir != "":
+		info, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("failed to open password blocklist directory: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("password blocklist %s is not a directory", dir)
+		}
+		SetPasswordBlocklist(&HashPrefixBlocklist{Dir: dir})
+	case bloomFile != "":
+		filter, err := LoadBloomFilter(bloomFile)
+		if err != nil {
+			return err
+		}
+		SetPasswordBlocklist(filter)
+	}
+	return nil
+}
+
+// SetPasswordBlocklist replaces the breached password blocklist; nil disables the check
+func SetPasswordBlocklist(blocklist PasswordBlocklist) {
+	passwordBlocklistMu.Lock()
+	defer passwordBlocklistMu.Unlock()
+	passwordBlocklist = blocklist
+}
+
+// CheckPasswordBlocklist returns ErrBreachedPassword if the password is in the configured blocklist
+func CheckPasswordBlocklist(password string) error {
+	passwordBlocklistMu.RLock()
+	blocklist := passwordBlocklist
+	passwordBlocklistMu.RUnlock()
+
+	if blocklist == nil {
+		return nil
+	}
+
+	breached, err := blocklist.Contains(password)
+	if err != nil {
+		return fmt.Errorf("failed to check password blocklist: %w", err)
+	}
+	if breached {
+		return ErrBreachedPassword
+	}
+	return nil
+}
+
+// passwordSHA1 returns the SHA-1 hash of a password
+func passwordSHA1(password string) [sha1.Size]byte {
+	return sha1.Sum([]byte(password))
+}
+
+// Contains reports whether the password's hash suffix is listed in the range file for its prefix
+func (b *HashPrefixBlocklist) Contains(password string) (bool, error) {
+	digest := passwordSHA1(password)
+	hash := strings.ToUpper(hex.EncodeToString(digest[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(b.Dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(b.Dir, prefix))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if entry, _, _ := strings.Cut(line, ":"); strings.EqualFold(entry, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// NewBloomFilter creates an empty bloom filter sized for the expected number of hashes and false positive rate
+func NewBloomFilter(expected uint64, falsePositiveRate float64) (*BloomFilter, error) {
+	if expected == 0 || falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, errors.New("bloom filter needs a positive size and a false positive rate between 0 and 1")
+	}
+
+	bits := uint64(math.Ceil(-float64(expected) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint32(math.Max(1, math.Round(float64(bits)/float64(expected)*math.Ln2)))
+	return &BloomFilter{hashes: hashes, bits: bits, data: make([]byte, (bits+7)/8)}, nil
+}
+
+// LoadBloomFilter reads a bloom filter file written by BloomFilter.WriteTo
+func LoadBloomFilter(path string) (*BloomFilter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password blocklist bloom filter: %w", err)
+	}
+
+	header := len(bloomFilterMagic) + 4 + 8
+	if len(data) < header || string(data[:len(bloomFilterMagic)]) != bloomFilterMagic {
+		return nil, fmt.Errorf("%s is not a password blocklist bloom filter", path)
+	}
+
+	filter := &BloomFilter{
+		hashes: binary.BigEndian.Uint32(data[len(bloomFilterMagic):]),
+		bits:   binary.BigEndian.Uint64(data[len(bloomFilterMagic)+4:]),
+		data:   data[header:],
+	}
+	if filter.hashes == 0 || filter.bits == 0 || uint64(len(filter.data)) != (filter.bits+7)/8 {
+		return nil, fmt.Errorf("password blocklist bloom filter %s is corrupt", path)
+	}
+	return filter, nil
+}
+
+// AddHash adds a SHA-1 password hash to the filter
+func (f *BloomFilter) AddHash(digest [sha1.Size]byte) {
+	for _, bit := range f.positions(digest) {
+		f.data[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// ContainsHash reports whether the SHA-1 password hash may be in the filter
+func (f *BloomFilter) ContainsHash(digest [sha1.Size]byte) bool {
+	for _, bit := range f.positions(digest) {
+		if f.data[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Contains reports whether the password may be in the filter
+func (f *BloomFilter) Contains(password string) (bool, error) {
+	return f.ContainsHash(passwordSHA1(password)), nil
+}
+
+// WriteTo writes the filter in the format read by LoadBloomFilter
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	var header bytes.Buffer
+	header.WriteString(bloomFilterMagic)
+	binary.Write(&header, binary.BigEndian, f.hashes)
+	binary.Write(&header, binary.BigEndian, f.bits)
+
+	n, err := w.Write(header.Bytes())
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(f.data)
+	return int64(n + m), err
+}
+
+// positions derives the filter's bit positions from the hash by double hashing. SHA-1 output is already
+// uniformly distributed, so its bytes serve as the two base hashes.
+func (f *BloomFilter) positions(digest [sha1.Size]byte) []uint64 {
+	h1 := binary.BigEndian.Uint64(digest[0:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16]) | 1
+
+	positions := make([]uint64, f.hashes)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % f.bits
+	}
+	return positions
+}
+
+// ParsePasswordHashLine parses a line of a Pwned Passwords file ("HASH" or "HASH:COUNT") into a SHA-1 hash
+func ParsePasswordHashLine(line string) ([sha1.Size]byte, bool) {
+	var digest [sha1.Size]byte
+
+	entry, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+	decoded, err := hex.DecodeString(entry)
+	if err != nil || len(decoded) != sha1.Size {
+		return digest, false
+	}
+	copy(digest[:], decoded)
+	return digest, true
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestHashPrefixBlocklist tests looking passwords up in a directory of SHA-1 range files
+func TestHashPrefixBlocklist(t *testing.T) {
+	dir := t.TempDir()
+
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	content := "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"
+	if err := os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write range file: %v", err)
+	}
+
+	blocklist := &HashPrefixBlocklist{Dir: dir}
+	if breached, err := blocklist.Contains("password"); err != nil || !breached {
+		t.Errorf("Expected listed password to be found, got %v, %v", breached, err)
+	}
+	if breached, err := blocklist.Contains("Correct-Horse-Battery-Staple-42"); err != nil || breached {
+		t.Errorf("Expected unlisted password not to be found, got %v, %v", breached, err)
+	}
+}
+
+// TestBloomFilterRoundTrip tests building, saving and loading a bloom filter
+func TestBloomFilterRoundTrip(t *testing.T) {
+	breached := []string{"Summer2024!", "Welcome123", "Password1"}
+
+	filter, err := NewBloomFilter(uint64(len(breached)), 0.001)
+	if err != nil {
+		t.Fatalf("Failed to create bloom filter: %v", err)
+	}
+	for _, password := range breached {
+		digest := sha1.Sum([]byte(password))
+		parsed, ok := ParsePasswordHashLine(strings.ToUpper(hex.EncodeToString(digest[:])) + ":3")
+		if !ok || parsed != digest {
+			t.Fatalf("Failed to parse hash line for %s", password)
+		}
+		filter.AddHash(parsed)
+	}
+
+	path := filepath.Join(t.TempDir(), "blocklist.bloom")
+	file, _ := os.Create(path)
+	if _, err := filter.WriteTo(file); err != nil {
+		t.Fatalf("Failed to write bloom filter: %v", err)
+	}
+	file.Close()
+
+	loaded, err := LoadBloomFilter(path)
+	if err != nil {
+		t.Fatalf("Failed to load bloom filter: %v", err)
+	}
+	for _, password := range breached {
+		if found, _ := loaded.Contains(password); !found {
+			t.Errorf("Expected %s to be in the filter", password)
+		}
+	}
+	if found, _ := loaded.Contains("Correct-Horse-Battery-Staple-42"); found {
+		t.Error("Expected unlisted password not to be in the filter")
+	}
+
+	// Files that are not bloom filters are rejected
+	bogus := filepath.Join(t.TempDir(), "bogus")
+	os.WriteFile(bogus, []byte("not a filter"), 0o600)
+	if _, err := LoadBloomFilter(bogus); err == nil {
+		t.Error("Expected invalid bloom filter file to be rejected")
+	}
+}
+
+// TestValidatePasswordRejectsBreachedPasswords tests that ValidatePassword consults the blocklist
+func TestValidatePasswordRejectsBreachedPasswords(t *testing.T) {
+	filter, _ := NewBloomFilter(1, 0.001)
+	filter.AddHash(sha1.Sum([]byte("Summer2024!")))
+
+	SetPasswordBlocklist(filter)
+	defer SetPasswordBlocklist(nil)
+
+	if err := ValidatePassword("Summer2024!", DefaultPasswordPolicy); err != ErrBreachedPassword {
+		t.Errorf("Expected breached password error, got %v", err)
+	}
+	if err := ValidatePassword("Autumn2024!", DefaultPasswordPolicy); err != nil {
+		t.Errorf("Expected unlisted password to be accepted, got %v", err)
+	}
+}
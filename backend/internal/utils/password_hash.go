@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes passwords into a self-describing string, so hashes made by earlier algorithms or
+// parameters can still be verified and recognised as outdated
+type PasswordHasher interface {
+	// Hash hashes the password with the hasher's current parameters
+	Hash(password string) (string, error)
+	// Identifies reports whether the hash was produced by this hasher's algorithm
+	Identifies(hash string) bool
+	// Verify reports whether the password matches a hash of this hasher's algorithm
+	Verify(password, hash string) bool
+	// NeedsRehash reports whether a hash of this hasher's algorithm uses other parameters than the current ones
+	NeedsRehash(hash string) bool
+}
+
+// Argon2Params are the argon2id cost parameters
+type Argon2Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the OWASP password storage recommendation for argon2id
+var DefaultArgon2Params = Argon2Params{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher hashes passwords with argon2id in the PHC string format
+type Argon2idHasher struct {
+	Params Argon2Params
+}
+
+// BcryptHasher hashes passwords with bcrypt. Bcrypt only uses the first 72 bytes of a password, so it is
+// kept for verifying existing hashes and as a fallback algorithm.
+type BcryptHasher struct {
+	Cost int
+}
+
+var (
+	passwordHasher   PasswordHasher = &Argon2idHasher{Params: DefaultArgon2Params}
+	passwordHasherMu sync.RWMutex
+
+	// passwordVerifiers are every algorithm that stored hashes may use
+	passwordVerifiers = []PasswordHasher{&Argon2idHasher{}, &BcryptHasher{}}
+)
+
+// InitializePasswordHasher selects the algorithm for new password hashes from PASSWORD_HASH_ALGORITHM
+// ("argon2id" or "bcrypt") and its parameters from ARGON2_MEMORY_KIB, ARGON2_ITERATIONS, ARGON2_PARALLELISM
+// and BCRYPT_COST
+func InitializePasswordHasher() error {
+	switch algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM"); algorithm {
+	case "", "argon2id":
+		params := DefaultArgon2Params
+		if err := parseUintEnv("ARGON2_MEMORY_KIB", &params.Memory); err != nil {
+			return err
+		}
+		if err := parseUintEnv("ARGON2_ITERATIONS", &params.Iterations); err != nil {
+			return err
+		}
+		parallelism := uint32(params.Parallelism)
+		if err := parseUintEnv("ARGON2_PARALLELISM", &parallelism); err != nil {
+			return err
+		}
+		if parallelism < 1 || parallelism > 255 {
+			return errors.New("ARGON2_PARALLELISM must be between 1 and 255")
+		}
+		params.Parallelism = uint8(parallelism)
+		if params.Iterations < 1 || params.Memory < 8*uint32(params.Parallelism) {
+			return errors.New("argon2id needs at least one iteration and 8 KiB of memory per lane")
+		}
+		SetPasswordHasher(&Argon2idHasher{Params: params})
+	case "bcrypt":
+		cost := uint32(bcrypt.DefaultCost)
+		if err := parseUintEnv("BCRYPT_COST", &cost); err != nil {
+			return err
+		}
+		if cost < uint32(bcrypt.MinCost) || cost > uint32(bcrypt.MaxCost) {
+			return fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		SetPasswordHasher(&BcryptHasher{Cost: int(cost)})
+	default:
+		return fmt.Errorf("unsupported PASSWORD_HASH_ALGORITHM %q; use argon2id or bcrypt", algorithm)
+	}
+	return nil
+}
+
+// SetPasswordHasher replaces the hasher used for new password hashes
+func SetPasswordHasher(hasher PasswordHasher) {
+	passwordHasherMu.Lock()
+	defer passwordHasherMu.Unlock()
+	passwordHasher = hasher
+}
+
+// getPasswordHasher returns the hasher used for new password hashes
+func getPasswordHasher() PasswordHasher {
+	passwordHasherMu.RLock()
+	defer passwordHasherMu.RUnlock()
+	return passwordHasher
+}
+
+// PasswordNeedsRehash reports whether a stored hash uses an outdated algorithm or parameters and should be
+// replaced the next time the password is known
+func PasswordNeedsRehash(hash string) bool {
+	hasher := getPasswordHasher()
+	return !hasher.Identifies(hash) || hasher.NeedsRehash(hash)
+}
+
+// Hash hashes the password with argon2id and a random salt
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Params.Memory, h.Params.Iterations, h.Params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Identifies reports whether the hash is an argon2id hash
+func (h *Argon2idHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+// Verify reports whether the password matches the argon2id hash, using the parameters stored in the hash
+func (h *Argon2idHasher) Verify(password, hash string) bool {
+	params, salt, key, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return false
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(candidate, key) == 1
+}
+
+// NeedsRehash reports whether the argon2id hash was made with other cost parameters than the current ones
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	params, _, _, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.Params.Memory ||
+		params.Iterations != h.Params.Iterations ||
+		params.Parallelism != h.Params.Parallelism ||
+		params.KeyLength != h.Params.KeyLength
+}
+
+// decodeArgon2idHash parses a hash in the format $argon2id$v=19$m=...,t=...,p=...$salt$key
+func decodeArgon2idHash(hash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("invalid argon2id hash format")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil ||
+		params.Iterations < 1 || params.Parallelism < 1 {
+		return params, nil, nil, errors.New("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errors.New("invalid argon2id salt")
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("invalid argon2id key")
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// Hash hashes the password with bcrypt. Passwords longer than 72 bytes are rejected rather than truncated.
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(bytes), err
+}
+
+// Identifies reports whether the hash is a bcrypt hash
+func (h *BcryptHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// Verify reports whether the password matches the bcrypt hash
+func (h *BcryptHasher) Verify(password, hash string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NeedsRehash reports whether the bcrypt hash was made with another cost than the current one
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+// parseUintEnv overrides value with the environment variable if it is set
+func parseUintEnv(key string, value *uint32) error {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	*value = uint32(parsed)
+	return nil
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestArgon2idHashing tests that argon2id hashes verify and use the full password
+func TestArgon2idHashing(t *testing.T) {
+	hasher := &Argon2idHasher{Params: DefaultArgon2Params}
+
+	// Longer than bcrypt's 72-byte limit, differing only at the end
+	long := strings.Repeat("a", 80) + "Tail1"
+	hash, err := hasher.Hash(long)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("Unexpected hash format: %s", hash)
+	}
+	if !CheckPasswordHash(long, hash) {
+		t.Error("Expected password to match its hash")
+	}
+	if CheckPasswordHash(strings.Repeat("a", 80)+"Tail2", hash) {
+		t.Error("Expected a password differing after 72 bytes not to match")
+	}
+
+	// Salts are random
+	other, _ := hasher.Hash(long)
+	if other == hash {
+		t.Error("Expected hashes of the same password to differ")
+	}
+}
+
+// TestLegacyBcryptHashes tests that bcrypt hashes still verify and are flagged for rehashing
+func TestLegacyBcryptHashes(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("LegacyPass1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	if !CheckPasswordHash("LegacyPass1", string(legacy)) || CheckPasswordHash("WrongPass1", string(legacy)) {
+		t.Error("Expected bcrypt hash to verify only the right password")
+	}
+	if !PasswordNeedsRehash(string(legacy)) {
+		t.Error("Expected bcrypt hash to need rehashing while argon2id is configured")
+	}
+
+	// With bcrypt configured only the cost decides
+	SetPasswordHasher(&BcryptHasher{Cost: bcrypt.MinCost})
+	defer SetPasswordHasher(&Argon2idHasher{Params: DefaultArgon2Params})
+
+	if PasswordNeedsRehash(string(legacy)) {
+		t.Error("Expected bcrypt hash with the current cost not to need rehashing")
+	}
+	SetPasswordHasher(&BcryptHasher{Cost: bcrypt.MinCost + 1})
+	if !PasswordNeedsRehash(string(legacy)) {
+		t.Error("Expected bcrypt hash with an outdated cost to need rehashing")
+	}
+}
+
+// TestArgon2idNeedsRehash tests that changed argon2id parameters are detected
+func TestArgon2idNeedsRehash(t *testing.T) {
+	weaker := DefaultArgon2Params
+	weaker.Iterations = 1
+	hash, _ := (&Argon2idHasher{Params: weaker}).Hash("ValidPass123")
+
+	if !CheckPasswordHash("ValidPass123", hash) {
+		t.Error("Expected hash with other parameters to verify")
+	}
+	if !PasswordNeedsRehash(hash) {
+		t.Error("Expected hash with outdated parameters to need rehashing")
+	}
+
+	current, _ := HashPassword("ValidPass123")
+	if PasswordNeedsRehash(current) {
+		t.Error("Expected hash with current parameters not to need rehashing")
+	}
+}
+
+// TestCheckPasswordHashRejectsMalformedHashes tests that unknown or corrupt hashes never match
+func TestCheckPasswordHashRejectsMalformedHashes(t *testing.T) {
+	for _, hash := range []string{"", "plaintext", "$argon2id$v=19$m=19456,t=0,p=1$c2FsdA$a2V5", "$argon2id$v=19$broken"} {
+		if CheckPasswordHash("plaintext", hash) {
+			t.Errorf("Expected malformed hash %q not to match", hash)
+		}
+	}
+}
+
+// TestInitializePasswordHasher tests selecting the algorithm and parameters from the environment
+func TestInitializePasswordHasher(t *testing.T) {
+	defer SetPasswordHasher(&Argon2idHasher{Params: DefaultArgon2Params})
+
+	t.Setenv("PASSWORD_HASH_ALGORITHM", "bcrypt")
+	t.Setenv("BCRYPT_COST", "5")
+	if err := InitializePasswordHasher(); err != nil {
+		t.Fatalf("Failed to initialize bcrypt hasher: %v", err)
+	}
+	if hasher, ok := getPasswordHasher().(*BcryptHasher); !ok || hasher.Cost != 5 {
+		t.Errorf("Unexpected hasher: %#v", getPasswordHasher())
+	}
+
+	t.Setenv("PASSWORD_HASH_ALGORITHM", "argon2id")
+	t.Setenv("ARGON2_ITERATIONS", "3")
+	if err := InitializePasswordHasher(); err != nil {
+		t.Fatalf("Failed to initialize argon2id hasher: %v", err)
+	}
+	if hasher, ok := getPasswordHasher().(*Argon2idHasher); !ok || hasher.Params.Iterations != 3 {
+		t.Errorf("Unexpected hasher: %#v", getPasswordHasher())
+	}
+
+	t.Setenv("PASSWORD_HASH_ALGORITHM", "md5")
+	if err := InitializePasswordHasher(); err == nil {
+		t.Error("Expected unsupported algorithm to be rejected")
+	}
+}
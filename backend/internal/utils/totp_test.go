@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTOTPRFC6238Vectors tests the SHA-1 test vectors from RFC 6238 Appendix B (last six digits)
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	// "12345678901234567890" in base32
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, expected := range vectors {
+		code, err := GenerateTOTPCode(secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("Failed to generate code: %v", err)
+		}
+		if code != expected {
+			t.Errorf("At %d expected %s, got %s", unix, expected, code)
+		}
+	}
+}
+
+// TestValidateTOTPCodeWindow tests that codes are accepted within one step of clock skew only
+func TestValidateTOTPCodeWindow(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Failed to generate secret: %v", err)
+	}
+
+	now := time.Now()
+	step := TOTPStep(now)
+
+	for offset, valid := range map[int64]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		code, _ := GenerateTOTPCode(secret, step+offset)
+		matched, ok := ValidateTOTPCode(secret, code, now)
+		if ok != valid {
+			t.Errorf("Offset %d: expected valid=%v, got %v", offset, valid, ok)
+		}
+		if ok && matched != step+offset {
+			t.Errorf("Offset %d: expected matched step %d, got %d", offset, step+offset, matched)
+		}
+	}
+
+	if _, ok := ValidateTOTPCode(secret, "12345", now); ok {
+		t.Error("Expected short code to be rejected")
+	}
+}
+
+// TestTOTPProvisioningURI tests the otpauth URI format
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("TMember", "alice@example.com", "JBSWY3DPEHPK3PXP")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/TMember:alice@example.com?") {
+		t.Errorf("Unexpected URI prefix: %s", uri)
+	}
+	for _, param := range []string{"secret=JBSWY3DPEHPK3PXP", "issuer=TMember", "digits=6", "period=30"} {
+		if !strings.Contains(uri, param) {
+			t.Errorf("Expected URI to contain %s: %s", param, uri)
+		}
+	}
+}
+
+// TestRecoveryCodes tests recovery code generation and normalization
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("Failed to generate recovery codes: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("Unexpected recovery code format: %s", code)
+		}
+		if seen[code] {
+			t.Errorf("Duplicate recovery code: %s", code)
+		}
+		seen[code] = true
+
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", ""))
+		if NormalizeRecoveryCode(typed) != code {
+			t.Errorf("Expected %s to normalize to %s", typed, code)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxCBORDepth bounds the nesting of decoded CBOR items
+const maxCBORDepth = 16
+
+// errTruncatedCBOR is returned when CBOR data ends in the middle of an item
+var errTruncatedCBOR = errors.New("truncated CBOR data")
+
+// decodeCBOR decodes the first CBOR item (RFC 8949) in data and returns it with the bytes that follow.
+// Only the subset used by WebAuthn is supported: integers, byte and text strings, arrays, maps, booleans
+// and null, all with definite lengths. Integers decode to int64, maps to map[interface{}]interface{}.
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, errors.New("CBOR data is nested too deeply")
+	}
+	if len(data) == 0 {
+		return nil, nil, errTruncatedCBOR
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	// Simple values carry their value in the additional information
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22:
+			return nil, data, nil
+		default:
+			return nil, nil, fmt.Errorf("unsupported CBOR simple value %d", info)
+		}
+	}
+
+	argument, data, err := decodeCBORArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if argument > math.MaxInt64 {
+			return nil, nil, errors.New("CBOR integer overflows int64")
+		}
+		return int64(argument), data, nil
+	case 1:
+		if argument > math.MaxInt64 {
+			return nil, nil, errors.New("CBOR integer overflows int64")
+		}
+		return -1 - int64(argument), data, nil
+	case 2, 3:
+		if argument > uint64(len(data)) {
+			return nil, nil, errTruncatedCBOR
+		}
+		value := data[:argument]
+		if major == 3 {
+			return string(value), data[argument:], nil
+		}
+		return append([]byte(nil), value...), data[argument:], nil
+	case 4:
+		// Every item takes at least one byte, which bounds the length before allocating
+		if argument > uint64(len(data)) {
+			return nil, nil, errTruncatedCBOR
+		}
+		items := make([]interface{}, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			var item interface{}
+			if item, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+	case 5:
+		if argument > uint64(len(data))/2 {
+			return nil, nil, errTruncatedCBOR
+		}
+		entries := make(map[interface{}]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			var key, value interface{}
+			if key, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errors.New("unsupported CBOR map key type")
+			}
+			if value, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			if _, duplicate := entries[key]; duplicate {
+				return nil, nil, fmt.Errorf("duplicate CBOR map key %v", key)
+			}
+			entries[key] = value
+		}
+		return entries, data, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported CBOR major type %d", major)
+	}
+}
+
+// decodeCBORArgument reads the argument of an item header from its additional information and the bytes that follow
+func decodeCBORArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24:
+		if len(data) < 1 {
+			return 0, nil, errTruncatedCBOR
+		}
+		return uint64(data[0]), data[1:], nil
+	case info == 25:
+		if len(data) < 2 {
+			return 0, nil, errTruncatedCBOR
+		}
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26:
+		if len(data) < 4 {
+			return 0, nil, errTruncatedCBOR
+		}
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27:
+		if len(data) < 8 {
+			return 0, nil, errTruncatedCBOR
+		}
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	default:
+		return 0, nil, errors.New("indefinite-length CBOR items are not supported")
+	}
+}
@@ -0,0 +1,113 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053) of the supported credential key types
+const (
+	AlgorithmES256 = -7   // ECDSA with P-256 and SHA-256
+	AlgorithmEdDSA = -8   // Ed25519
+	AlgorithmRS256 = -257 // RSASSA-PKCS1-v1_5 with SHA-256
+)
+
+// COSE key parameters
+const (
+	coseKeyType      = 1
+	coseKeyAlgorithm = 3
+	coseKeyCurve     = -1 // For EC2 and OKP keys
+	coseKeyX         = -2 // For EC2 and OKP keys
+	coseKeyY         = -3 // For EC2 keys
+	coseKeyModulus   = -1 // For RSA keys
+	coseKeyExponent  = -2 // For RSA keys
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// publicKey is a credential public key parsed from its COSE encoding
+type publicKey struct {
+	algorithm int64
+	key       crypto.PublicKey
+}
+
+// parsePublicKey parses a COSE_Key (RFC 9052 section 7) holding an ES256, EdDSA or RS256 public key
+func parsePublicKey(data []byte) (*publicKey, error) {
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("invalid credential public key: trailing data")
+	}
+	params, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid credential public key: not a map")
+	}
+
+	keyType, _ := params[int64(coseKeyType)].(int64)
+	algorithm, _ := params[int64(coseKeyAlgorithm)].(int64)
+
+	switch {
+	case keyType == coseKeyTypeEC2 && algorithm == AlgorithmES256:
+		curve, _ := params[int64(coseKeyCurve)].(int64)
+		x, _ := params[int64(coseKeyX)].([]byte)
+		y, _ := params[int64(coseKeyY)].([]byte)
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid credential public key: malformed P-256 key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("invalid credential public key: point is not on the curve")
+		}
+		return &publicKey{algorithm: algorithm, key: key}, nil
+
+	case keyType == coseKeyTypeOKP && algorithm == AlgorithmEdDSA:
+		curve, _ := params[int64(coseKeyCurve)].(int64)
+		x, _ := params[int64(coseKeyX)].([]byte)
+		if curve != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid credential public key: malformed Ed25519 key")
+		}
+		return &publicKey{algorithm: algorithm, key: ed25519.PublicKey(x)}, nil
+
+	case keyType == coseKeyTypeRSA && algorithm == AlgorithmRS256:
+		n, _ := params[int64(coseKeyModulus)].([]byte)
+		e, _ := params[int64(coseKeyExponent)].([]byte)
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) < 256 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid credential public key: malformed RSA key")
+		}
+		return &publicKey{algorithm: algorithm, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported credential public key type %d with algorithm %d", keyType, algorithm)
+	}
+}
+
+// verify checks a signature made by the credential over data
+func (k *publicKey) verify(data, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
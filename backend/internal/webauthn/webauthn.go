@@ -0,0 +1,425 @@
+// Package webauthn implements the relying party side of WebAuthn registration and authentication
+// ceremonies (https://www.w3.org/TR/webauthn-2/). Attestation statements are not verified: like
+// relying parties requesting "none" attestation, credentials are trusted on first use.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent       = 0x01
+	flagUserVerified      = 0x04
+	flagAttestedData      = 0x40
+	flagExtensionIncluded = 0x80
+)
+
+// User verification requirements, as sent to the browser
+const (
+	UserVerificationRequired  = "required"
+	UserVerificationPreferred = "preferred"
+)
+
+// challengeLength is the number of random bytes in a ceremony challenge
+const challengeLength = 32
+
+// ErrSignCountRegression is returned when an authenticator reports a signature counter that did not increase,
+// a sign that the credential's private key may have been cloned
+var ErrSignCountRegression = errors.New("webauthn: signature counter did not increase")
+
+// Bytes is binary data encoded as unpadded base64url in JSON, the encoding browsers' WebAuthn JSON helpers use
+type Bytes []byte
+
+// MarshalJSON implements json.Marshaler
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, also accepting padded base64url
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return fmt.Errorf("invalid base64url data: %w", err)
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingParty verifies ceremonies for one relying party
+type RelyingParty struct {
+	ID      string   // Domain credentials are scoped to, such as "example.com"
+	Name    string   // Name shown by authenticators
+	Origins []string // Origins of the web application allowed to run ceremonies, such as "https://app.example.com"
+	Timeout time.Duration
+}
+
+// RelyingPartyEntity identifies the relying party in creation options
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity identifies the user in creation options
+type UserEntity struct {
+	ID          Bytes  `json:"id"` // Opaque user handle, returned by discoverable credentials when signing in
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialParameter is a credential type and algorithm the relying party accepts
+type CredentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int    `json:"alg"`
+}
+
+// CredentialDescriptor identifies an existing credential
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         Bytes    `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection states the requirements on authenticators creating a credential
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are the options for navigator.credentials.create
+type CreationOptions struct {
+	RelyingParty           RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              Bytes                  `json:"challenge"`
+	Parameters             []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"` // Milliseconds
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the options for navigator.credentials.get
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int                    `json:"timeout"` // Milliseconds
+	RelyingPartyID   string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"` // Empty to let the user pick a discoverable credential
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse is the JSON form of the credential returned by navigator.credentials.create
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes    `json:"clientDataJSON"`
+		AttestationObject Bytes    `json:"attestationObject"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of the credential returned by navigator.credentials.get
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AuthenticatorData Bytes `json:"authenticatorData"`
+		Signature         Bytes `json:"signature"`
+		UserHandle        Bytes `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// Credential is a newly registered credential
+type Credential struct {
+	ID           []byte
+	PublicKey    []byte // COSE_Key encoding
+	SignCount    uint32
+	UserVerified bool
+	Transports   []string
+}
+
+// Assertion is the verified result of an authentication ceremony
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// NewChallenge returns a random ceremony challenge
+func NewChallenge() (Bytes, error) {
+	challenge := make([]byte, challengeLength)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// CreationOptions returns the options for registering a credential for the user. Existing credentials
+// of the user are excluded so an authenticator is not registered twice.
+func (rp *RelyingParty) CreationOptions(challenge []byte, user UserEntity, exclude []CredentialDescriptor) CreationOptions {
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+	return CreationOptions{
+		RelyingParty: RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:         user,
+		Challenge:    challenge,
+		Parameters: []CredentialParameter{
+			{Type: "public-key", Algorithm: AlgorithmES256},
+			{Type: "public-key", Algorithm: AlgorithmEdDSA},
+			{Type: "public-key", Algorithm: AlgorithmRS256},
+		},
+		Timeout:            int(rp.timeout().Milliseconds()),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: UserVerificationPreferred,
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns the options for signing in with one of the allowed credentials, or with any
+// discoverable credential if none are given
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow []CredentialDescriptor, userVerification string) RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          int(rp.timeout().Milliseconds()),
+		RelyingPartyID:   rp.ID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+// clientData is the client data collected by the browser for a ceremony
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ClientChallenge returns the challenge a ceremony response was made for, so the relying party can look up
+// the ceremony before verifying the response
+func ClientChallenge(clientDataJSON []byte) ([]byte, error) {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return nil, fmt.Errorf("webauthn: invalid client data: %w", err)
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(data.Challenge, "="))
+	if err != nil || len(challenge) == 0 {
+		return nil, errors.New("webauthn: invalid challenge in client data")
+	}
+	return challenge, nil
+}
+
+// VerifyRegistration verifies the response to a registration ceremony started with the challenge and
+// returns the new credential
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, response AttestationResponse, requireUserVerification bool) (*Credential, error) {
+	if response.Type != "public-key" {
+		return nil, errors.New("webauthn: unsupported credential type")
+	}
+	if err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	item, rest, err := decodeCBOR(response.Response.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, errors.New("webauthn: invalid attestation object")
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("webauthn: invalid attestation object")
+	}
+	rawAuthData, _ := attestation["authData"].([]byte)
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, requireUserVerification); err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedData == 0 {
+		return nil, errors.New("webauthn: no attested credential data")
+	}
+	if len(response.RawID) > 0 && !bytes.Equal(response.RawID, authData.credentialID) {
+		return nil, errors.New("webauthn: credential ID does not match the attested credential")
+	}
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, fmt.Errorf("webauthn: %w", err)
+	}
+
+	return &Credential{
+		ID:           authData.credentialID,
+		PublicKey:    authData.publicKey,
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+		Transports:   response.Response.Transports,
+	}, nil
+}
+
+// VerifyAssertion verifies the response to an authentication ceremony started with the challenge, made with
+// the credential whose COSE public key and last signature counter are given
+func (rp *RelyingParty) VerifyAssertion(challenge, credentialPublicKey []byte, signCount uint32, response AssertionResponse, requireUserVerification bool) (*Assertion, error) {
+	if response.Type != "public-key" {
+		return nil, errors.New("webauthn: unsupported credential type")
+	}
+	if err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := parseAuthenticatorData(response.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, requireUserVerification); err != nil {
+		return nil, err
+	}
+
+	key, err := parsePublicKey(credentialPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: %w", err)
+	}
+	clientDataHash := sha256.Sum256(response.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), response.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, response.Response.Signature) {
+		return nil, errors.New("webauthn: invalid signature")
+	}
+
+	// Authenticators without a counter always report zero
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return nil, ErrSignCountRegression
+	}
+
+	return &Assertion{SignCount: authData.signCount, UserVerified: authData.flags&flagUserVerified != 0}, nil
+}
+
+// verifyClientData checks the ceremony type, challenge and origin the browser reports
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return fmt.Errorf("webauthn: invalid client data: %w", err)
+	}
+	if data.Type != ceremony {
+		return fmt.Errorf("webauthn: unexpected ceremony type %q", data.Type)
+	}
+
+	received, err := ClientChallenge(clientDataJSON)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return errors.New("webauthn: challenge mismatch")
+	}
+
+	allowed := false
+	for _, origin := range rp.Origins {
+		if data.Origin == origin {
+			allowed = true
+		}
+	}
+	if !allowed || data.CrossOrigin {
+		return fmt.Errorf("webauthn: origin %q is not allowed", data.Origin)
+	}
+	return nil
+}
+
+// verifyAuthenticatorData checks the relying party ID hash and the user presence and verification flags
+func (rp *RelyingParty) verifyAuthenticatorData(authData *authenticatorData, requireUserVerification bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return errors.New("webauthn: credential is scoped to another relying party")
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return errors.New("webauthn: user was not present")
+	}
+	if requireUserVerification && authData.flags&flagUserVerified == 0 {
+		return errors.New("webauthn: user was not verified")
+	}
+	return nil
+}
+
+func (rp *RelyingParty) timeout() time.Duration {
+	if rp.Timeout > 0 {
+		return rp.Timeout
+	}
+	return 5 * time.Minute
+}
+
+// authenticatorData is parsed authenticator data (WebAuthn section 6.1)
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte // Set when attested credential data is included
+	publicKey    []byte // COSE_Key of the attested credential
+}
+
+// parseAuthenticatorData parses authenticator data, including attested credential data if present
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	invalid := errors.New("webauthn: invalid authenticator data")
+	if len(data) < 37 {
+		return nil, invalid
+	}
+
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if authData.flags&flagAttestedData != 0 {
+		// AAGUID (16 bytes), credential ID length (2 bytes), credential ID, credential public key
+		if len(rest) < 18 {
+			return nil, invalid
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return nil, invalid
+		}
+		authData.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, afterKey, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, invalid
+		}
+		authData.publicKey = rest[:len(rest)-len(afterKey)]
+		rest = afterKey
+	}
+
+	if authData.flags&flagExtensionIncluded != 0 {
+		_, afterExtensions, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, invalid
+		}
+		rest = afterExtensions
+	}
+
+	if len(rest) != 0 {
+		return nil, invalid
+	}
+	return authData, nil
+}
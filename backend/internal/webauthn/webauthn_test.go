@@ -0,0 +1,151 @@
+package webauthn_test
+
+import (
+	"errors"
+	"testing"
+
+	"tmember/internal/webauthn"
+	"tmember/internal/webauthn/webauthntest"
+)
+
+const testOrigin = "https://app.example.com"
+
+func newTestRelyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{ID: "example.com", Name: "Example", Origins: []string{testOrigin}}
+}
+
+// registerTestCredential registers a credential of the authenticator with the relying party
+func registerTestCredential(t *testing.T, rp *webauthn.RelyingParty, authenticator *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+	challenge, _ := webauthn.NewChallenge()
+	options := rp.CreationOptions(challenge, webauthn.UserEntity{ID: []byte("user-handle"), Name: "jane@example.com", DisplayName: "jane@example.com"}, nil)
+	response, err := authenticator.Register(options)
+	if err != nil {
+		t.Fatalf("Registration failed: %v", err)
+	}
+	credential, err := rp.VerifyRegistration(challenge, response, false)
+	if err != nil {
+		t.Fatalf("Expected registration to verify, got %v", err)
+	}
+	return credential
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	rp := newTestRelyingParty()
+	authenticator := webauthntest.NewAuthenticator(testOrigin)
+	credential := registerTestCredential(t, rp, authenticator)
+	if len(credential.ID) == 0 || len(credential.PublicKey) == 0 || !credential.UserVerified {
+		t.Fatalf("Expected a verified credential with an ID and public key, got %+v", credential)
+	}
+
+	signCount := credential.SignCount
+	for i := 0; i < 2; i++ {
+		challenge, _ := webauthn.NewChallenge()
+		response, err := authenticator.Assert(rp.RequestOptions(challenge, nil, webauthn.UserVerificationRequired))
+		if err != nil {
+			t.Fatalf("Assertion failed: %v", err)
+		}
+		if got, err := webauthn.ClientChallenge(response.Response.ClientDataJSON); err != nil || string(got) != string(challenge) {
+			t.Errorf("Expected the client challenge to be readable before verification, got %v", err)
+		}
+		if string(response.Response.UserHandle) != "user-handle" {
+			t.Errorf("Expected the user handle of the discoverable credential, got %q", response.Response.UserHandle)
+		}
+
+		assertion, err := rp.VerifyAssertion(challenge, credential.PublicKey, signCount, response, true)
+		if err != nil {
+			t.Fatalf("Expected assertion %d to verify, got %v", i, err)
+		}
+		if assertion.SignCount <= signCount || !assertion.UserVerified {
+			t.Errorf("Expected an increasing counter and user verification, got %+v", assertion)
+		}
+		signCount = assertion.SignCount
+	}
+}
+
+func TestAssertionRejections(t *testing.T) {
+	rp := newTestRelyingParty()
+	authenticator := webauthntest.NewAuthenticator(testOrigin)
+	credential := registerTestCredential(t, rp, authenticator)
+	allow := []webauthn.CredentialDescriptor{{Type: "public-key", ID: credential.ID}}
+
+	assert := func(userVerification string) ([]byte, webauthn.AssertionResponse) {
+		challenge, _ := webauthn.NewChallenge()
+		response, err := authenticator.Assert(rp.RequestOptions(challenge, allow, userVerification))
+		if err != nil {
+			t.Fatalf("Assertion failed: %v", err)
+		}
+		return challenge, response
+	}
+
+	challenge, response := assert(webauthn.UserVerificationPreferred)
+	other, _ := webauthn.NewChallenge()
+	if _, err := rp.VerifyAssertion(other, credential.PublicKey, 0, response, false); err == nil {
+		t.Error("Expected a response to another challenge to be rejected")
+	}
+
+	tampered := response
+	tampered.Response.Signature = append([]byte(nil), response.Response.Signature...)
+	tampered.Response.Signature[len(tampered.Response.Signature)-1] ^= 0xff
+	if _, err := rp.VerifyAssertion(challenge, credential.PublicKey, 0, tampered, false); err == nil {
+		t.Error("Expected a tampered signature to be rejected")
+	}
+
+	otherRP := &webauthn.RelyingParty{ID: "evil.example", Origins: []string{testOrigin}}
+	if _, err := otherRP.VerifyAssertion(challenge, credential.PublicKey, 0, response, false); err == nil {
+		t.Error("Expected a credential of another relying party to be rejected")
+	}
+
+	// A phishing site cannot relay ceremonies, since the browser reports its origin
+	authenticator.Origin = "https://app.example.com.evil.example"
+	challenge, phished := assert(webauthn.UserVerificationPreferred)
+	if _, err := rp.VerifyAssertion(challenge, credential.PublicKey, 0, phished, false); err == nil {
+		t.Error("Expected a foreign origin to be rejected")
+	}
+	authenticator.Origin = testOrigin
+
+	challenge, unverified := assert("discouraged")
+	if _, err := rp.VerifyAssertion(challenge, credential.PublicKey, 0, unverified, true); err == nil {
+		t.Error("Expected an assertion without user verification to be rejected when it is required")
+	}
+
+	// A counter that does not increase suggests a cloned authenticator
+	authenticator.SetSignCount(credential.ID, 1)
+	challenge, cloned := assert(webauthn.UserVerificationPreferred)
+	if _, err := rp.VerifyAssertion(challenge, credential.PublicKey, 5, cloned, false); !errors.Is(err, webauthn.ErrSignCountRegression) {
+		t.Errorf("Expected ErrSignCountRegression, got %v", err)
+	}
+}
+
+func TestRegistrationRejections(t *testing.T) {
+	rp := newTestRelyingParty()
+	authenticator := webauthntest.NewAuthenticator(testOrigin)
+
+	challenge, _ := webauthn.NewChallenge()
+	options := rp.CreationOptions(challenge, webauthn.UserEntity{ID: []byte("user-handle"), Name: "jane@example.com"}, nil)
+	response, err := authenticator.Register(options)
+	if err != nil {
+		t.Fatalf("Registration failed: %v", err)
+	}
+
+	other, _ := webauthn.NewChallenge()
+	if _, err := rp.VerifyRegistration(other, response, false); err == nil {
+		t.Error("Expected a response to another challenge to be rejected")
+	}
+
+	truncated := response
+	truncated.Response.AttestationObject = response.Response.AttestationObject[:len(response.Response.AttestationObject)-10]
+	if _, err := rp.VerifyRegistration(challenge, truncated, false); err == nil {
+		t.Error("Expected a truncated attestation object to be rejected")
+	}
+
+	// Authenticators that already hold one of the user's credentials refuse to register another
+	credential, err := rp.VerifyRegistration(challenge, response, false)
+	if err != nil {
+		t.Fatalf("Expected registration to verify, got %v", err)
+	}
+	options.ExcludeCredentials = []webauthn.CredentialDescriptor{{Type: "public-key", ID: credential.ID}}
+	if _, err := authenticator.Register(options); err == nil {
+		t.Error("Expected the authenticator to refuse an excluded credential")
+	}
+}
@@ -0,0 +1,243 @@
+// Package webauthntest provides a software WebAuthn authenticator for tests
+package webauthntest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"tmember/internal/webauthn"
+)
+
+// Authenticator is a software authenticator holding ES256 credentials. Like a platform authenticator, it
+// creates discoverable credentials and verifies the user whenever user verification is not discouraged.
+type Authenticator struct {
+	Origin string // Origin the simulated browser reports in client data
+
+	credentials []*credential
+}
+
+// credential is a credential held by the authenticator
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// NewAuthenticator returns an authenticator used from a web application at the origin
+func NewAuthenticator(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// Register creates a credential as navigator.credentials.create would with the options
+func (a *Authenticator) Register(options webauthn.CreationOptions) (webauthn.AttestationResponse, error) {
+	var response webauthn.AttestationResponse
+
+	supported := false
+	for _, parameter := range options.Parameters {
+		if parameter.Type == "public-key" && parameter.Algorithm == webauthn.AlgorithmES256 {
+			supported = true
+		}
+	}
+	if !supported {
+		return response, errors.New("webauthntest: ES256 is not among the accepted algorithms")
+	}
+	for _, excluded := range options.ExcludeCredentials {
+		if a.find(options.RelyingParty.ID, excluded.ID) != nil {
+			return response, errors.New("webauthntest: authenticator already holds an excluded credential")
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return response, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return response, err
+	}
+	cred := &credential{id: id, rpID: options.RelyingParty.ID, userHandle: options.User.ID, key: key}
+	a.credentials = append(a.credentials, cred)
+
+	// Attested credential data: AAGUID, credential ID length, credential ID and COSE public key
+	attested := make([]byte, 16, 16+2+len(id))
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(id)))
+	attested = append(attested, id...)
+	attested = append(attested, encodeCOSEKey(&key.PublicKey)...)
+
+	flags := byte(0x01 | 0x40)
+	if options.AuthenticatorSelection.UserVerification != "discouraged" {
+		flags |= 0x04
+	}
+	authData := append(authenticatorData(cred, flags), attested...)
+
+	response.ID = base64.RawURLEncoding.EncodeToString(id)
+	response.RawID = id
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = a.clientData("webauthn.create", options.Challenge)
+	response.Response.AttestationObject = encodeCBOR(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	response.Response.Transports = []string{"internal"}
+	return response, nil
+}
+
+// Assert signs in as navigator.credentials.get would with the options, using the first allowed credential
+// or, if none are listed, the first discoverable credential for the relying party
+func (a *Authenticator) Assert(options webauthn.RequestOptions) (webauthn.AssertionResponse, error) {
+	var response webauthn.AssertionResponse
+
+	var cred *credential
+	if len(options.AllowCredentials) == 0 {
+		for _, candidate := range a.credentials {
+			if candidate.rpID == options.RelyingPartyID {
+				cred = candidate
+				break
+			}
+		}
+	}
+	for _, allowed := range options.AllowCredentials {
+		if cred = a.find(options.RelyingPartyID, allowed.ID); cred != nil {
+			break
+		}
+	}
+	if cred == nil {
+		return response, errors.New("webauthntest: no matching credential")
+	}
+
+	cred.signCount++
+	flags := byte(0x01)
+	if options.UserVerification != "discouraged" {
+		flags |= 0x04
+	}
+	authData := authenticatorData(cred, flags)
+	clientDataJSON := a.clientData("webauthn.get", options.Challenge)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return response, err
+	}
+
+	response.ID = base64.RawURLEncoding.EncodeToString(cred.id)
+	response.RawID = cred.id
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = clientDataJSON
+	response.Response.AuthenticatorData = authData
+	response.Response.Signature = signature
+	response.Response.UserHandle = cred.userHandle
+	return response, nil
+}
+
+// SetSignCount sets the signature counter of a credential, to simulate a cloned authenticator
+func (a *Authenticator) SetSignCount(credentialID []byte, count uint32) {
+	for _, cred := range a.credentials {
+		if bytes.Equal(cred.id, credentialID) {
+			cred.signCount = count
+		}
+	}
+}
+
+func (a *Authenticator) find(rpID string, id []byte) *credential {
+	for _, cred := range a.credentials {
+		if cred.rpID == rpID && bytes.Equal(cred.id, id) {
+			return cred
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+// authenticatorData returns the relying party ID hash, flags and signature counter of a credential
+func authenticatorData(cred *credential, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(cred.rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, cred.signCount)
+}
+
+// encodeCOSEKey encodes a P-256 public key as an ES256 COSE_Key
+func encodeCOSEKey(key *ecdsa.PublicKey) []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return encodeCBOR(map[int64]interface{}{1: int64(2), 3: int64(webauthn.AlgorithmES256), -1: int64(1), -2: x, -3: y})
+}
+
+// encodeCBOR encodes the CBOR subset used by WebAuthn: integers, byte and text strings and maps
+func encodeCBOR(value interface{}) []byte {
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return cborHeader(1, uint64(-1-v))
+		}
+		return cborHeader(0, uint64(v))
+	case []byte:
+		return append(cborHeader(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHeader(3, uint64(len(v))), v...)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out := cborHeader(5, uint64(len(v)))
+		for _, key := range keys {
+			out = append(out, encodeCBOR(key)...)
+			out = append(out, encodeCBOR(v[key])...)
+		}
+		return out
+	case map[int64]interface{}:
+		keys := make([]int64, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		out := cborHeader(5, uint64(len(v)))
+		for _, key := range keys {
+			out = append(out, encodeCBOR(key)...)
+			out = append(out, encodeCBOR(v[key])...)
+		}
+		return out
+	default:
+		panic("webauthntest: unsupported CBOR value")
+	}
+}
+
+// cborHeader encodes an item header with the shortest argument encoding
+func cborHeader(major byte, argument uint64) []byte {
+	switch {
+	case argument < 24:
+		return []byte{major<<5 | byte(argument)}
+	case argument <= 0xff:
+		return []byte{major<<5 | 24, byte(argument)}
+	case argument <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(argument))
+	case argument <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(argument))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, argument)
+	}
+}
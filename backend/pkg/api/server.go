@@ -6,7 +6,10 @@ import (
 
 	"tmember/internal/database"
 	"tmember/internal/handlers"
+	"tmember/internal/ldap"
+	"tmember/internal/mailer"
 	"tmember/internal/middleware"
+	"tmember/internal/oidc"
 
 	"gorm.io/gorm"
 )
@@ -24,20 +27,100 @@ func NewServer() *Server {
 
 	// Create auth handlers with database connection
 	authHandlers := handlers.NewAuthHandlers(db)
+	authHandlers.Mailer = mailer.GetMailer()
+	authHandlers.OIDCProviders = oidc.GetProviders()
+	if directory := ldap.GetDirectory(); directory != nil {
+		authHandlers.Authenticator = &handlers.LDAPAuthenticator{DB: db, Directory: directory}
+	}
 	orgHandlers := handlers.NewOrganizationHandlers(db)
+	authMiddleware := middleware.NewAuth(db).AuthMiddleware
 
 	// Register routes
 	mux.HandleFunc("/api/health", handlers.HealthHandler)
+	mux.HandleFunc("/.well-known/jwks.json", handlers.JWKSHandler)
 
 	// Authentication routes
 	mux.HandleFunc("/api/auth/register", authHandlers.RegisterHandler)
 	mux.HandleFunc("/api/auth/login", authHandlers.LoginHandler)
+	mux.HandleFunc("/api/auth/refresh", authHandlers.RefreshHandler)
+	mux.HandleFunc("/api/auth/logout", authHandlers.LogoutHandler)
+	mux.HandleFunc("/api/auth/password/forgot", authHandlers.ForgotPasswordHandler)
+	mux.HandleFunc("/api/auth/password/reset", authHandlers.ResetPasswordHandler)
+	mux.HandleFunc("/api/auth/verify-email", authHandlers.VerifyEmailHandler)
+	mux.HandleFunc("/api/auth/email/revert", authHandlers.RevertEmailChangeHandler)
+	mux.HandleFunc("/api/auth/magic-link", authHandlers.MagicLinkHandler)
+	mux.HandleFunc("/api/auth/magic-link/redeem", authHandlers.RedeemMagicLinkHandler)
+	mux.HandleFunc("/api/auth/mfa/verify", authHandlers.MFAVerifyHandler)
+	mux.HandleFunc("/api/auth/mfa/webauthn/options", authHandlers.WebAuthnMFAOptionsHandler)
+	mux.HandleFunc("/api/auth/webauthn/login/options", authHandlers.WebAuthnLoginOptionsHandler)
+	mux.HandleFunc("/api/auth/webauthn/login", authHandlers.WebAuthnLoginHandler)
+	mux.HandleFunc("/api/auth/oidc/providers", authHandlers.ListOIDCProvidersHandler)
+	mux.HandleFunc("/api/auth/oidc/callback", authHandlers.OIDCCallbackHandler)
+	mux.HandleFunc("/api/auth/oidc/", authHandlers.OIDCAuthorizeHandler)
+	mux.HandleFunc("/api/auth/saml/exchange", authHandlers.SAMLExchangeHandler)
+	mux.Handle("/api/auth/verify-email/resend", authMiddleware(http.HandlerFunc(authHandlers.ResendVerificationHandler)))
+
+	// SAML service provider routes (public, per organization)
+	mux.HandleFunc("/api/saml/", authHandlers.SAMLHandler)
+
+	// Account security routes (require an interactive session, API tokens cannot manage credentials)
+	sessionMiddleware := func(next http.Handler) http.Handler {
+		return authMiddleware(middleware.RequireSession(next))
+	}
 
 	// User routes (protected by auth middleware)
-	mux.Handle("/api/users/me", middleware.AuthMiddleware(http.HandlerFunc(authHandlers.GetCurrentUserHandler)))
+	mux.Handle("/api/users/me", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			// DELETE /api/users/me schedules the account for deletion
+			middleware.RequireSession(http.HandlerFunc(authHandlers.DeleteAccountHandler)).ServeHTTP(w, r)
+		} else {
+			authHandlers.GetCurrentUserHandler(w, r)
+		}
+	})))
+	mux.Handle("/api/users/me/export", sessionMiddleware(http.HandlerFunc(authHandlers.ExportAccountHandler)))
+	mux.Handle("/api/users/me/sessions", sessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			// DELETE /api/users/me/sessions signs out everywhere else
+			authHandlers.RevokeOtherSessionsHandler(w, r)
+		} else {
+			authHandlers.ListSessionsHandler(w, r)
+		}
+	})))
+	mux.Handle("/api/users/me/sessions/", sessionMiddleware(http.HandlerFunc(authHandlers.RevokeSessionHandler)))
+	mux.Handle("/api/users/me/password", sessionMiddleware(http.HandlerFunc(authHandlers.ChangePasswordHandler)))
+	mux.Handle("/api/users/me/email", sessionMiddleware(http.HandlerFunc(authHandlers.ChangeEmailHandler)))
+	mux.Handle("/api/users/me/email/confirm", sessionMiddleware(http.HandlerFunc(authHandlers.ConfirmEmailChangeHandler)))
+	mux.Handle("/api/users/me/mfa/totp/setup", sessionMiddleware(http.HandlerFunc(authHandlers.TOTPSetupHandler)))
+	mux.Handle("/api/users/me/mfa/totp/confirm", sessionMiddleware(http.HandlerFunc(authHandlers.TOTPConfirmHandler)))
+	mux.Handle("/api/users/me/mfa/disable", sessionMiddleware(http.HandlerFunc(authHandlers.DisableMFAHandler)))
+	mux.Handle("/api/users/me/mfa/recovery-codes", sessionMiddleware(http.HandlerFunc(authHandlers.RegenerateRecoveryCodesHandler)))
+	mux.Handle("/api/users/me/webauthn/credentials", sessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			authHandlers.RegisterWebAuthnCredentialHandler(w, r)
+		} else {
+			authHandlers.ListWebAuthnCredentialsHandler(w, r)
+		}
+	})))
+	mux.Handle("/api/users/me/webauthn/credentials/options", sessionMiddleware(http.HandlerFunc(authHandlers.WebAuthnRegistrationOptionsHandler)))
+	mux.Handle("/api/users/me/webauthn/credentials/", sessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			authHandlers.DeleteWebAuthnCredentialHandler(w, r)
+		} else {
+			authHandlers.UpdateWebAuthnCredentialHandler(w, r)
+		}
+	})))
+	mux.Handle("/api/users/me/tokens", sessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			authHandlers.CreatePersonalAccessTokenHandler(w, r)
+		} else {
+			authHandlers.ListPersonalAccessTokensHandler(w, r)
+		}
+	})))
+	mux.Handle("/api/users/me/tokens/", sessionMiddleware(http.HandlerFunc(authHandlers.RevokePersonalAccessTokenHandler)))
+	mux.Handle("/api/users/me/join-requests", authMiddleware(http.HandlerFunc(orgHandlers.ListMyJoinRequestsHandler)))
 
 	// Organization routes (protected by auth middleware)
-	mux.Handle("/api/organizations", middleware.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/api/organizations", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
 			orgHandlers.CreateOrganizationHandler(w, r)
 		} else if r.Method == http.MethodGet {
@@ -48,7 +131,7 @@ func NewServer() *Server {
 	})))
 
 	// Organization switch route (protected by auth middleware)
-	mux.Handle("/api/organizations/", middleware.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/api/organizations/", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasSuffix(r.URL.Path, "/switch") {
 			orgHandlers.SwitchOrganizationHandler(w, r)
 		} else if strings.Contains(r.URL.Path, "/members") {
@@ -67,11 +150,153 @@ func NewServer() *Server {
 					http.Error(w, "Not found", http.StatusNotFound)
 				}
 			})).ServeHTTP(w, r)
+		} else if strings.Contains(r.URL.Path, "/invitations") {
+			// Apply organization access middleware for invitation management endpoints
+			orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/invitations") {
+					if r.Method == http.MethodPost {
+						// POST /api/organizations/{id}/invitations
+						orgHandlers.CreateInvitationHandler(w, r)
+					} else {
+						// GET /api/organizations/{id}/invitations
+						orgHandlers.ListInvitationsHandler(w, r)
+					}
+				} else if strings.Count(r.URL.Path, "/") == 5 {
+					// DELETE /api/organizations/{id}/invitations/{invitation_id}
+					orgHandlers.RevokeInvitationHandler(w, r)
+				} else {
+					http.Error(w, "Not found", http.StatusNotFound)
+				}
+			})).ServeHTTP(w, r)
+		} else if strings.Contains(r.URL.Path, "/security") {
+			// Apply organization access middleware for security policy endpoints
+			orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/security") {
+					if r.Method == http.MethodPut {
+						// PUT /api/organizations/{id}/security
+						orgHandlers.UpdateSecurityPolicyHandler(w, r)
+					} else {
+						// GET /api/organizations/{id}/security
+						orgHandlers.GetSecurityPolicyHandler(w, r)
+					}
+				} else if strings.HasSuffix(r.URL.Path, "/security/mfa-compliance") {
+					// GET /api/organizations/{id}/security/mfa-compliance
+					orgHandlers.MFAComplianceHandler(w, r)
+				} else {
+					http.Error(w, "Not found", http.StatusNotFound)
+				}
+			})).ServeHTTP(w, r)
+		} else if strings.Contains(r.URL.Path, "/domains") {
+			// Apply organization access middleware for domain endpoints
+			orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/domains") {
+					if r.Method == http.MethodPost {
+						// POST /api/organizations/{id}/domains
+						orgHandlers.CreateDomainHandler(w, r)
+					} else {
+						// GET /api/organizations/{id}/domains
+						orgHandlers.ListDomainsHandler(w, r)
+					}
+				} else if strings.HasSuffix(r.URL.Path, "/verify") {
+					// POST /api/organizations/{id}/domains/{domain_id}/verify
+					orgHandlers.VerifyDomainHandler(w, r)
+				} else if strings.Count(r.URL.Path, "/") == 5 {
+					if r.Method == http.MethodPut {
+						// PUT /api/organizations/{id}/domains/{domain_id}
+						orgHandlers.UpdateDomainHandler(w, r)
+					} else {
+						// DELETE /api/organizations/{id}/domains/{domain_id}
+						orgHandlers.DeleteDomainHandler(w, r)
+					}
+				} else {
+					http.Error(w, "Not found", http.StatusNotFound)
+				}
+			})).ServeHTTP(w, r)
+		} else if strings.Contains(r.URL.Path, "/join-requests") {
+			// Apply organization access middleware for join request endpoints
+			orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/join-requests") {
+					// GET /api/organizations/{id}/join-requests
+					orgHandlers.ListJoinRequestsHandler(w, r)
+				} else {
+					// POST /api/organizations/{id}/join-requests/{request_id}/{approve|reject}
+					orgHandlers.DecideJoinRequestHandler(w, r)
+				}
+			})).ServeHTTP(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/saml") {
+			// Apply organization access middleware for SAML configuration endpoints
+			orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					// PUT /api/organizations/{id}/saml
+					orgHandlers.UpdateSAMLConfigHandler(w, r)
+				} else {
+					// GET /api/organizations/{id}/saml
+					orgHandlers.GetSAMLConfigHandler(w, r)
+				}
+			})).ServeHTTP(w, r)
+		} else if strings.Contains(r.URL.Path, "/scim-tokens") {
+			// Apply organization access middleware for SCIM token endpoints
+			orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/scim-tokens") {
+					if r.Method == http.MethodPost {
+						// POST /api/organizations/{id}/scim-tokens
+						orgHandlers.CreateSCIMTokenHandler(w, r)
+					} else {
+						// GET /api/organizations/{id}/scim-tokens
+						orgHandlers.ListSCIMTokensHandler(w, r)
+					}
+				} else if strings.Count(r.URL.Path, "/") == 5 {
+					// DELETE /api/organizations/{id}/scim-tokens/{token_id}
+					orgHandlers.RevokeSCIMTokenHandler(w, r)
+				} else {
+					http.Error(w, "Not found", http.StatusNotFound)
+				}
+			})).ServeHTTP(w, r)
+		} else if strings.Contains(r.URL.Path, "/service-accounts") {
+			// Apply organization access middleware for service account management endpoints
+			orgHandlers.OrganizationAccessMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/service-accounts") {
+					if r.Method == http.MethodPost {
+						// POST /api/organizations/{id}/service-accounts
+						orgHandlers.CreateServiceAccountHandler(w, r)
+					} else {
+						// GET /api/organizations/{id}/service-accounts
+						orgHandlers.ListServiceAccountsHandler(w, r)
+					}
+				} else if strings.HasSuffix(r.URL.Path, "/keys") {
+					if r.Method == http.MethodPost {
+						// POST /api/organizations/{id}/service-accounts/{service_account_id}/keys
+						orgHandlers.CreateServiceAccountKeyHandler(w, r)
+					} else {
+						// GET /api/organizations/{id}/service-accounts/{service_account_id}/keys
+						orgHandlers.ListServiceAccountKeysHandler(w, r)
+					}
+				} else if strings.Count(r.URL.Path, "/") == 7 {
+					// DELETE /api/organizations/{id}/service-accounts/{service_account_id}/keys/{key_id}
+					orgHandlers.RevokeServiceAccountKeyHandler(w, r)
+				} else if strings.Count(r.URL.Path, "/") == 5 {
+					if r.Method == http.MethodPut {
+						// PUT /api/organizations/{id}/service-accounts/{service_account_id}
+						orgHandlers.UpdateServiceAccountHandler(w, r)
+					} else {
+						// DELETE /api/organizations/{id}/service-accounts/{service_account_id}
+						orgHandlers.DeleteServiceAccountHandler(w, r)
+					}
+				} else {
+					http.Error(w, "Not found", http.StatusNotFound)
+				}
+			})).ServeHTTP(w, r)
 		} else {
 			http.Error(w, "Not found", http.StatusNotFound)
 		}
 	})))
 
+	// SCIM provisioning routes (authenticated by organization SCIM tokens)
+	mux.HandleFunc("/scim/v2/", orgHandlers.SCIMHandler)
+
+	// Invitation acceptance route (protected by auth middleware)
+	mux.Handle("/api/invitations/accept", authMiddleware(middleware.RequireSession(http.HandlerFunc(orgHandlers.AcceptInvitationHandler))))
+
 	return &Server{mux: mux, db: db}
 }
 